@@ -17,42 +17,91 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"net/http"
 	"time"
 
 	"github.com/superedge/superedge/pkg/edge-health-admission/admission"
 	"github.com/superedge/superedge/pkg/edge-health-admission/config"
+	"github.com/superedge/superedge/pkg/edge-health-admission/evictor"
+	"github.com/superedge/superedge/pkg/edge-health-admission/signer"
+	siteclientset "github.com/superedge/superedge/pkg/site-manager/generated/clientset/versioned"
+	siteinformers "github.com/superedge/superedge/pkg/site-manager/generated/informers/externalversions"
 	"github.com/superedge/superedge/pkg/version"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog/v2"
 )
 
 var (
 	Certconfig                 config.Config
+	PeerSigner                 config.PeerSigner
 	admissionControlListenAddr string
 )
 
 func init() {
 	flag.StringVar(&admissionControlListenAddr, "adminssion-control-listen-addr", ":8443", "")
 	flag.BoolVar(&config.NodeAlwaysReachable, "always-reachable", false, "set true addmision will forbidden apiserver set Unreachable taint, when node can't access apiserver")
+	flag.DurationVar(&config.CloudPartitionTimeout, "cloud-partition-timeout", 5*time.Minute, "a NodeUnit is partitioned from the cloud while its CloudPartitioned condition is true and refreshed in this time, 0 to trust the condition however old")
+	flag.DurationVar(&config.EvictionPeriod, "unreachable-eviction-period", 10*time.Second, "period of the eviction of the pods whose unreachable policy does not keep them on the unreachable nodes without taint, 0 to disable")
 }
 
 func main() {
 	klog.InitFlags(nil)
 
 	Certconfig.AddFlags()
+	PeerSigner.AddFlags()
 
 	flag.Parse()
 
 	klog.Infof("Versions: %#v\n", version.Get())
 
 	klog.V(4).Infof("master url is %s", Certconfig.MasterUrl)
-	config.Kubeclient = generateClientset(Certconfig.MasterUrl, Certconfig.KubeconfigPath)
+	var siteClient siteclientset.Interface
+	config.Kubeclient, siteClient = generateClientset(Certconfig.MasterUrl, Certconfig.KubeconfigPath)
+	informerFactory := informers.NewSharedInformerFactory(config.Kubeclient, 0)
+	nodeInformer := informerFactory.Core().V1().Nodes()
+	namespaceInformer := informerFactory.Core().V1().Namespaces()
+	serviceInformer := informerFactory.Core().V1().Services()
+	config.NodeLister = nodeInformer.Lister()
+	config.NamespaceLister = namespaceInformer.Lister()
+	config.ServiceLister = serviceInformer.Lister()
+	siteInformerFactory := siteinformers.NewSharedInformerFactory(siteClient, 0)
+	unitInformer := siteInformerFactory.Site().V1alpha2().NodeUnits()
+	config.NodeUnitLister = unitInformer.Lister()
+	cacheSynced := []cache.InformerSynced{nodeInformer.Informer().HasSynced, namespaceInformer.Informer().HasSynced,
+		serviceInformer.Informer().HasSynced, unitInformer.Informer().HasSynced}
+	var podIndexer cache.Indexer
+	if config.EvictionPeriod > 0 {
+		podInformer := informerFactory.Core().V1().Pods().Informer()
+		if err := podInformer.AddIndexers(cache.Indexers{evictor.NodeNameIndex: evictor.NodeNameIndexFunc}); err != nil {
+			klog.Fatalf("Init: add pod indexer err: %v", err)
+		}
+		podIndexer = podInformer.GetIndexer()
+		cacheSynced = append(cacheSynced, podInformer.HasSynced)
+	}
+	informerFactory.Start(wait.NeverStop)
+	siteInformerFactory.Start(wait.NeverStop)
+	if !cache.WaitForCacheSync(wait.NeverStop, cacheSynced...) {
+		klog.Fatal("Init: timed out waiting for the caches to sync")
+	}
+	go admission.RunGraceExpiry(context.Background(), config.Kubeclient)
+	if config.EvictionPeriod > 0 {
+		go evictor.NewEvictor(config.Kubeclient, config.NodeUnitLister, config.NodeLister, config.NamespaceLister,
+			podIndexer, config.CloudPartitionTimeout, config.EvictionPeriod).Run(context.Background())
+	}
+	if PeerSigner.Enable {
+		go signer.NewSigner(config.Kubeclient, PeerSigner.Namespace, PeerSigner.ServiceAccount, PeerSigner.CertDuration).Run(context.Background())
+	}
 
 	http.HandleFunc("/node-taint", admission.NodeTaint)
 	http.HandleFunc("/endpoint", admission.EndPoint)
+	http.HandleFunc("/endpointslice", admission.EndpointSlice)
+	http.HandleFunc("/pod", admission.Pod)
 	server := &http.Server{
 		Addr: admissionControlListenAddr,
 	}
@@ -63,7 +112,7 @@ func main() {
 	}
 }
 
-func generateClientset(masterUrl, kubeconfigPath string) *kubernetes.Clientset {
+func generateClientset(masterUrl, kubeconfigPath string) (*kubernetes.Clientset, *siteclientset.Clientset) {
 	var err error
 	kubeconfig, err := clientcmd.BuildConfigFromFlags(masterUrl, kubeconfigPath)
 	if err != nil {
@@ -73,5 +122,9 @@ func generateClientset(masterUrl, kubeconfigPath string) *kubernetes.Clientset {
 	if err != nil {
 		klog.Fatalf("Init: Error building clientset: %s", err.Error())
 	}
-	return clientset
+	siteClient, err := siteclientset.NewForConfig(kubeconfig)
+	if err != nil {
+		klog.Fatalf("Init: Error building site clientset: %s", err.Error())
+	}
+	return clientset, siteClient
 }
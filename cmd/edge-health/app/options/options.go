@@ -29,12 +29,17 @@ type Options struct {
 }
 
 func NewEdgeHealthOptions() *Options {
-	return &Options{
+	o := &Options{
 		options.NewCheckOptions(),
 		options.NewCommunOptions(),
 		options.NewNodeOptions(),
 		options.NewVoteOptions(),
 	}
+	// the defaults are set before the flags are added, otherwise they overwrite the flags
+	o.CheckOptions.Default()
+	o.CommunOptions.Default()
+	o.VoteOptions.Default()
+	return o
 }
 
 func (s *Options) Complete() error {
@@ -64,9 +69,6 @@ type CompletedOptions struct {
 
 func Complete(o *Options) CompletedOptions {
 	var completeoptions CompletedOptions
-	o.CheckOptions.Default()
-	o.CommunOptions.Default()
-	o.VoteOptions.Default()
 	completeoptions.Options = o
 	return completeoptions
 }
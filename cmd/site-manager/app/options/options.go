@@ -26,6 +26,9 @@ import (
 	utilfeature "k8s.io/apiserver/pkg/util/feature"
 	cliflag "k8s.io/component-base/cli/flag"
 	"k8s.io/component-base/config"
+
+	"github.com/superedge/superedge/pkg/site-manager/controller"
+	"github.com/superedge/superedge/pkg/site-manager/controller/cordon"
 )
 
 const (
@@ -42,6 +45,8 @@ type Options struct {
 	Kubeconfig        string
 	EnsureCrd         bool
 	FeatureGates      map[string]bool
+	Drain             cordon.DrainOptions
+	Partition         controller.PartitionOptions
 	config.LeaderElectionConfiguration
 }
 
@@ -65,6 +70,12 @@ func NewSiteManagerDaemonOptions() *Options {
 			RenewDeadline:     metav1.Duration{Duration: time.Second * time.Duration(10)},
 		},
 		FeatureGates: featureGates,
+		Drain: cordon.DrainOptions{
+			GracePeriodSeconds: -1,
+		},
+		Partition: controller.PartitionOptions{
+			TunnelNamespace: "edge-system",
+		},
 	}
 }
 
@@ -80,6 +91,13 @@ func (o *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.IntVar(&o.SyncPeriod, "sync-period", o.SyncPeriod, "Period for syncing the objects")
 	fs.IntVar(&o.SyncPeriodAsWhole, "sync-period-as-whole", o.SyncPeriodAsWhole, "Period for syncing the dns hosts as whole")
 	fs.IntVar(&o.Worker, "worker", o.Worker, "worker number of controller")
+	fs.BoolVar(&o.Drain.Drain, "unschedulable-drain", o.Drain.Drain, "Drain the nodes of the unschedulable NodeUnits after cordoning them")
+	fs.BoolVar(&o.Drain.DisableEviction, "drain-disable-eviction", o.Drain.DisableEviction, "Delete the pods instead of evicting them "+
+		"when draining the nodes of the unschedulable NodeUnits, this bypasses the PodDisruptionBudgets")
+	fs.IntVar(&o.Drain.GracePeriodSeconds, "drain-grace-period", o.Drain.GracePeriodSeconds, "Termination grace period in seconds "+
+		"of the pods evicted from the nodes of the unschedulable NodeUnits, negative means the grace period of the pods")
+	fs.StringVar(&o.Partition.TunnelNamespace, "tunnel-namespace", o.Partition.TunnelNamespace, "Namespace of tunnel-cloud, "+
+		"a NodeUnit whose nodes are all unreachable is CloudPartitioned when none of them is connected to tunnel-cloud, empty to not check the tunnel")
 
 	fs.BoolVar(&o.LeaderElect, "leader-elect", o.LeaderElect, ""+
 		"Start a leader election client and gain leadership before "+
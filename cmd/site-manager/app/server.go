@@ -43,6 +43,8 @@ import (
 	"github.com/superedge/superedge/pkg/site-manager/config"
 	"github.com/superedge/superedge/pkg/site-manager/constant"
 	"github.com/superedge/superedge/pkg/site-manager/controller"
+	"github.com/superedge/superedge/pkg/site-manager/controller/cordon"
+	"github.com/superedge/superedge/pkg/site-manager/controller/workload"
 	crdclientset "github.com/superedge/superedge/pkg/site-manager/generated/clientset/versioned"
 	"github.com/superedge/superedge/pkg/util"
 	utilkubeclient "github.com/superedge/superedge/pkg/util/kubeclient"
@@ -124,7 +126,7 @@ func NewSiteManagerDaemonCommand() *cobra.Command {
 			}()
 			// not leade elect
 			if !siteOptions.LeaderElect {
-				runController(context.TODO(), kubeClient, crdClient, siteOptions.Worker, siteOptions.SyncPeriod, siteOptions.SyncPeriodAsWhole)
+				runController(context.TODO(), kubeClient, crdClient, siteOptions.Worker, siteOptions.SyncPeriod, siteOptions.SyncPeriodAsWhole, siteOptions.Drain, siteOptions.Partition)
 				panic("Start site-manager failed\n")
 			}
 
@@ -159,7 +161,7 @@ func NewSiteManagerDaemonCommand() *cobra.Command {
 				RetryPeriod:   siteOptions.RetryPeriod.Duration,
 				Callbacks: leaderelection.LeaderCallbacks{
 					OnStartedLeading: func(ctx context.Context) {
-						runController(ctx, kubeClient, crdClient, siteOptions.Worker, siteOptions.SyncPeriod, siteOptions.SyncPeriodAsWhole)
+						runController(ctx, kubeClient, crdClient, siteOptions.Worker, siteOptions.SyncPeriod, siteOptions.SyncPeriodAsWhole, siteOptions.Drain, siteOptions.Partition)
 					},
 					OnStoppedLeading: func() {
 						klog.Fatalf("Leader election lost")
@@ -179,22 +181,35 @@ func NewSiteManagerDaemonCommand() *cobra.Command {
 }
 
 func runController(parent context.Context, kubeClient *clientset.Clientset,
-	crdClient *crdclientset.Clientset, workerNum, syncPeriod, syncPeriodAsWhole int) {
+	crdClient *crdclientset.Clientset, workerNum, syncPeriod, syncPeriodAsWhole int, drainOptions cordon.DrainOptions,
+	partitionOptions controller.PartitionOptions) {
 
 	controllerConfig := config.NewControllerConfig(kubeClient, crdClient, time.Second*time.Duration(syncPeriod))
 	nuc := controller.NewNodeUnitController(
 		controllerConfig.NodeInformer,
 		controllerConfig.DaemonSetInformer,
+		controllerConfig.StatefulSetInformer,
 		controllerConfig.NodeUnitInformer,
 		controllerConfig.NodeGroupInformer,
 		kubeClient,
 		crdClient,
+		drainOptions,
+		partitionOptions,
 	)
 
 	ngc := controller.NewNodeGroupController(
 		controllerConfig.NodeInformer,
 		controllerConfig.NodeUnitInformer,
 		controllerConfig.NodeGroupInformer,
+		&workload.Informers{
+			Deployment:  controllerConfig.DeploymentInformer,
+			DaemonSet:   controllerConfig.DaemonSetInformer,
+			StatefulSet: controllerConfig.StatefulSetInformer,
+			Job:         controllerConfig.JobInformer,
+			CronJob:     controllerConfig.CronJobInformer,
+			Service:     controllerConfig.ServiceInformer,
+			Endpoints:   controllerConfig.EndpointsInformer,
+		},
 		kubeClient,
 		crdClient,
 	)
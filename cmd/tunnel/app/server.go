@@ -17,13 +17,18 @@ limitations under the License.
 package app
 
 import (
+	"time"
+
 	"github.com/spf13/cobra"
 	"github.com/superedge/superedge/cmd/tunnel/app/options"
+	"github.com/superedge/superedge/pkg/tunnel/bandwidth"
 	"github.com/superedge/superedge/pkg/tunnel/conf"
 	"github.com/superedge/superedge/pkg/tunnel/module"
 	"github.com/superedge/superedge/pkg/tunnel/proxy/common/indexers"
 	"github.com/superedge/superedge/pkg/tunnel/proxy/modules/egress"
+	"github.com/superedge/superedge/pkg/tunnel/proxy/modules/gateway"
 	"github.com/superedge/superedge/pkg/tunnel/proxy/modules/http-proxy"
+	"github.com/superedge/superedge/pkg/tunnel/proxy/modules/portmapping"
 	"github.com/superedge/superedge/pkg/tunnel/proxy/modules/ssh"
 	"github.com/superedge/superedge/pkg/tunnel/proxy/modules/stream"
 	"github.com/superedge/superedge/pkg/tunnel/proxy/modules/stream/streammng/connect"
@@ -63,6 +68,13 @@ func NewTunnelCommand() *cobra.Command {
 				}
 				stop := make(chan struct{})
 				indexers.InitCache(clientSet, stop)
+				bandwidth.InitBandwidth(conf.TunnelConf.TunnlMode.Cloud.Bandwidth, func(nodeName string) map[string]string {
+					node, err := indexers.NodeLister.Get(nodeName)
+					if err != nil {
+						return nil
+					}
+					return node.Labels
+				})
 				go connect.SyncPodIP()
 				go connect.SyncEndPoints()
 				go connect.SyncRoute(clientSet)
@@ -70,11 +82,20 @@ func NewTunnelCommand() *cobra.Command {
 					stop <- struct{}{}
 				}()
 			}
+			if *option.TunnelMode == tunnelutil.EDGE {
+				bandwidth.InitBandwidth(conf.TunnelConf.TunnlMode.EDGE.Bandwidth, nil)
+			}
 			egress.InitEgress()
 			ssh.InitSSH()
 			http_proxy.InitHttpProxy()
+			portmapping.InitPortMapping()
+			gateway.InitGateway()
 			module.LoadModules(*option.TunnelMode)
-			module.ShutDown()
+			var drainTimeout time.Duration
+			if *option.TunnelMode == tunnelutil.CLOUD {
+				drainTimeout = connect.DrainTimeout()
+			}
+			module.ShutDown(drainTimeout)
 		},
 	}
 	fs := cmd.Flags()
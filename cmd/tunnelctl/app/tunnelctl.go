@@ -0,0 +1,213 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/superedge/superedge/pkg/tunnel/admin"
+)
+
+type options struct {
+	servers            []string
+	token              string
+	tokenFile          string
+	caFile             string
+	insecureSkipVerify bool
+}
+
+func NewTunnelctlCommand() *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:          "tunnelctl",
+		Short:        "Inspect the nodes and proxied connections of tunnel-cloud",
+		SilenceUsage: true,
+	}
+	cmd.PersistentFlags().StringSliceVar(&o.servers, "server", splitEnv("TUNNELCTL_SERVER"), "Admin API addresses of the tunnel-cloud replicas, e.g. https://10.0.0.1:6000")
+	cmd.PersistentFlags().StringVar(&o.token, "token", os.Getenv("TUNNELCTL_TOKEN"), "Bearer token of the admin API")
+	cmd.PersistentFlags().StringVar(&o.tokenFile, "token-file", "", "File holding the bearer token of the admin API")
+	cmd.PersistentFlags().StringVar(&o.caFile, "ca-file", "", "CA certificate to verify the certificate of tunnel-cloud")
+	cmd.PersistentFlags().BoolVar(&o.insecureSkipVerify, "insecure-skip-tls-verify", false, "Do not verify the certificate of tunnel-cloud")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "nodes",
+		Short: "List the connected edge nodes",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.listNodes()
+		},
+	})
+	var node string
+	connsCmd := &cobra.Command{
+		Use:   "conns",
+		Short: "List the active proxied connections",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.listConns(node)
+		},
+	}
+	connsCmd.Flags().StringVar(&node, "node", "", "Only list the connections of the node")
+	cmd.AddCommand(connsCmd)
+	cmd.AddCommand(&cobra.Command{
+		Use:   "kill TRACE_ID",
+		Short: "Close a proxied connection",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.each(func(c *admin.Client) error {
+				return c.KillConn(args[0])
+			})
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "disconnect NODE",
+		Short: "Close the tunnel of an edge node, tunnel-edge reconnects afterwards",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.each(func(c *admin.Client) error {
+				return c.DisconnectNode(args[0])
+			})
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "drain",
+		Short: "Drain the tunnel-cloud replicas, the edge nodes reconnect to other replicas",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.each(func(c *admin.Client) error {
+				return c.Drain()
+			})
+		},
+	})
+	return cmd
+}
+
+func (o *options) clients() ([]*admin.Client, error) {
+	if len(o.servers) == 0 {
+		return nil, fmt.Errorf("--server is required")
+	}
+	token := o.token
+	if o.tokenFile != "" {
+		tk, err := ioutil.ReadFile(o.tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(tk))
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: o.insecureSkipVerify}
+	if o.caFile != "" {
+		ca, err := ioutil.ReadFile(o.caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate is found in %s", o.caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	httpClient := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+	var clients []*admin.Client
+	for _, server := range o.servers {
+		clients = append(clients, &admin.Client{Server: server, Token: token, HTTPClient: httpClient})
+	}
+	return clients, nil
+}
+
+// each calls f on every replica, it succeeds when one of the replicas succeeds because a node is only
+// connected to one replica
+func (o *options) each(f func(c *admin.Client) error) error {
+	clients, err := o.clients()
+	if err != nil {
+		return err
+	}
+	var errs []string
+	for _, c := range clients {
+		if err := f(c); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", c.Server, err))
+			continue
+		}
+		fmt.Printf("done on %s\n", c.Server)
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(errs, "\n"))
+}
+
+func (o *options) listNodes() error {
+	clients, err := o.clients()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "NODE\tREPLICA\tCONNECTED\tREMOTE ADDRESS\tVERSION\tCONNECTIONS")
+	for _, c := range clients {
+		nodes, err := c.ListNodes()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Server, err)
+			continue
+		}
+		for _, n := range nodes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\n", n.Name, c.Server, n.Connected.Format(time.RFC3339), n.RemoteAddr, n.Version, n.Connections)
+		}
+	}
+	return nil
+}
+
+func (o *options) listConns(node string) error {
+	clients, err := o.clients()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "TRACE ID\tNODE\tCATEGORY\tTARGET\tAGE\tBYTES IN\tBYTES OUT")
+	for _, c := range clients {
+		conns, err := c.ListConns(node)
+		if err != nil {
+			// the node is connected to another replica
+			if node == "" || !strings.Contains(err.Error(), "404") {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", c.Server, err)
+			}
+			continue
+		}
+		for _, conn := range conns {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%d\n", conn.TraceID, conn.Node, conn.Category, conn.Target,
+				time.Since(conn.Created).Round(time.Second), conn.BytesIn, conn.BytesOut)
+		}
+	}
+	return nil
+}
+
+func splitEnv(key string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
@@ -17,24 +17,25 @@ limitations under the License.
 package admission
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"time"
+
 	"github.com/superedge/superedge/pkg/edge-health-admission/config"
 	"github.com/superedge/superedge/pkg/edge-health-admission/util"
 	admissionv1 "k8s.io/api/admission/v1"
-	"k8s.io/api/core/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/klog/v2"
-
-	"net/http"
 )
 
 func EndPoint(w http.ResponseWriter, r *http.Request) {
 	serve(w, r, endPoint)
 }
 
+// endPoint moves the not ready addresses on the unreachable nodes kept by the policy of the service back to the
+// ready addresses, and the ready addresses on the unreachable nodes no longer kept to the not ready addresses
 func endPoint(ar admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
 	var endpointNew corev1.Endpoints
 
@@ -52,57 +53,92 @@ func endPoint(ar admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
 		return reviewResponseEndPoint
 	}
 
+	policy := util.ServicePolicy(config.NamespaceLister, config.ServiceLister, endpointNew.Namespace, endpointNew.Name)
+	now := time.Now()
+	var resync time.Time
 	patches := []*Patch{}
-
-	for i1, EndpointSubset := range endpointNew.Subsets {
-		if len(EndpointSubset.NotReadyAddresses) != 0 {
-			for i2, EndpointAddress := range EndpointSubset.NotReadyAddresses {
-				if node, err := config.Kubeclient.CoreV1().Nodes().Get(context.TODO(), *EndpointAddress.NodeName, metav1.GetOptions{}); err != nil {
-					klog.Errorf("can't get pod's node err: %v", err)
-				} else {
-					_, condition := util.GetNodeCondition(&node.Status, v1.NodeReady)
-					if _, ok := node.Annotations["nodeunhealth"]; !ok && condition.Status == v1.ConditionUnknown {
-
-						patches = append(patches, &Patch{
-							OP:   "remove",
-							Path: fmt.Sprintf("/subsets/%d/notReadyAddresses/%d", i1, i2),
-						})
-
-						TargetRef := map[string]interface{}{}
-						TargetRef["kind"] = EndpointAddress.TargetRef.Kind
-						TargetRef["namespace"] = EndpointAddress.TargetRef.Namespace
-						TargetRef["name"] = EndpointAddress.TargetRef.Name
-						TargetRef["uid"] = EndpointAddress.TargetRef.UID
-						TargetRef["apiVersion"] = EndpointAddress.TargetRef.APIVersion
-						TargetRef["resourceVersion"] = EndpointAddress.TargetRef.ResourceVersion
-						TargetRef["fieldPath"] = EndpointAddress.TargetRef.FieldPath
-
-						patches = append(patches, &Patch{
-							OP:   "add",
-							Path: fmt.Sprintf("/subsets/%d/addresses/%d", i1, i2),
-							Value: map[string]interface{}{
-								"ip":        EndpointAddress.IP,
-								"hostname":  EndpointAddress.Hostname,
-								"nodeName":  EndpointAddress.NodeName,
-								"targetRef": TargetRef,
-							},
-						})
-
-						if len(patches) != 0 {
-							bytes, _ := json.Marshal(patches)
-							reviewResponse.Patch = bytes
-							pt := admissionv1.PatchTypeJSONPatch
-							reviewResponse.PatchType = &pt
-						}
-					}
-				}
+	for i, subset := range endpointNew.Subsets {
+		var addresses, notReadyAddresses []corev1.EndpointAddress
+		moved := 0
+		for _, address := range subset.Addresses {
+			if unreachable, keep, expiry := nodeKeepReachable(address.NodeName, policy, now); unreachable && !keep {
+				notReadyAddresses = append(notReadyAddresses, address)
+				moved++
+			} else {
+				addresses = append(addresses, address)
+				resync = earliest(resync, expiry)
+			}
+		}
+		for _, address := range subset.NotReadyAddresses {
+			if _, keep, expiry := nodeKeepReachable(address.NodeName, policy, now); keep {
+				addresses = append(addresses, address)
+				resync = earliest(resync, expiry)
+				moved++
+			} else {
+				notReadyAddresses = append(notReadyAddresses, address)
 			}
 		}
+		if moved == 0 {
+			continue
+		}
+		klog.V(7).Infof("endpoints %s/%s: %d addresses of subset %d are moved by the unreachable policy", endpointNew.Namespace, endpointNew.Name, moved, i)
+		patches = append(patches, addressesPatch(fmt.Sprintf("/subsets/%d/addresses", i), addresses))
+		patches = append(patches, addressesPatch(fmt.Sprintf("/subsets/%d/notReadyAddresses", i), notReadyAddresses))
+	}
+	if !resync.IsZero() {
+		enqueueGraceExpiry(endpointResource.Resource, endpointNew.Namespace, endpointNew.Name, resync.Sub(now))
 	}
+	setPatches(&reviewResponse, patches)
 	reviewResponse.Allowed = true
 	return &reviewResponse
 }
 
+// addressesPatch replaces the addresses at path, the member is removed when they are empty. The addresses were
+// not empty when they are empty after a move, so the member exists.
+func addressesPatch(path string, addresses []corev1.EndpointAddress) *Patch {
+	if len(addresses) == 0 {
+		return &Patch{OP: "remove", Path: path}
+	}
+	// add replaces the member when it exists
+	return &Patch{OP: "add", Path: path, Value: addresses}
+}
+
+// nodeKeepReachable returns whether the node is unreachable, whether the workloads of policy on it are kept and
+// when its grace period expires. Its Ready condition is Unknown, and unless the policy says otherwise, it is kept
+// when edge-health did not vote it unhealthy or its NodeUnit is partitioned from the cloud.
+func nodeKeepReachable(nodeName *string, policy util.Policy, now time.Time) (bool, bool, time.Time) {
+	if nodeName == nil {
+		return false, false, time.Time{}
+	}
+	node, err := config.NodeLister.Get(*nodeName)
+	if err != nil {
+		klog.Errorf("can't get pod's node err: %v", err)
+		return false, false, time.Time{}
+	}
+	if _, ok := util.NodeUnreachableSince(node); !ok {
+		return false, false, time.Time{}
+	}
+	keep, expiry := policy.KeepReachable(config.NodeUnitLister, node, now, config.CloudPartitionTimeout)
+	return true, keep, expiry
+}
+
+func earliest(t1, t2 time.Time) time.Time {
+	if t1.IsZero() || (!t2.IsZero() && t2.Before(t1)) {
+		return t2
+	}
+	return t1
+}
+
+func setPatches(reviewResponse *admissionv1.AdmissionResponse, patches []*Patch) {
+	if len(patches) == 0 {
+		return
+	}
+	bytes, _ := json.Marshal(patches)
+	reviewResponse.Patch = bytes
+	pt := admissionv1.PatchTypeJSONPatch
+	reviewResponse.PatchType = &pt
+}
+
 func decodeRawEndPoint(ar admissionv1.AdmissionReview, version string) (*admissionv1.AdmissionResponse, corev1.Endpoints, error) {
 	var raw []byte
 	if version == "new" {
@@ -0,0 +1,255 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/superedge/superedge/pkg/edge-health-admission/config"
+	"github.com/superedge/superedge/pkg/edge-health-admission/util"
+	"github.com/superedge/superedge/pkg/edge-health/common"
+	sitev1alpha2 "github.com/superedge/superedge/pkg/site-manager/apis/site.superedge.io/v1alpha2"
+	siteconst "github.com/superedge/superedge/pkg/site-manager/constant"
+	crdv1listers "github.com/superedge/superedge/pkg/site-manager/generated/listers/site.superedge.io/v1alpha2"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newNode(name string, ready corev1.ConditionStatus, edgeHealthy *corev1.ConditionStatus, labels map[string]string) *corev1.Node {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	node.Status.Conditions = append(node.Status.Conditions, corev1.NodeCondition{Type: corev1.NodeReady, Status: ready})
+	if edgeHealthy != nil {
+		node.Status.Conditions = append(node.Status.Conditions, corev1.NodeCondition{Type: common.EdgeHealthyCondition, Status: *edgeHealthy})
+	}
+	return node
+}
+
+// setupNodes serves the nodes from a lister: node-ready is ready, node-cloud is only unreachable from the cloud,
+// node-down is voted unhealthy and node-unit is voted unhealthy in a NodeUnit partitioned from the cloud
+func setupNodes(t *testing.T) {
+	unhealthy := corev1.ConditionFalse
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, node := range []*corev1.Node{
+		newNode("node-ready", corev1.ConditionTrue, nil, nil),
+		newNode("node-cloud", corev1.ConditionUnknown, nil, nil),
+		newNode("node-down", corev1.ConditionUnknown, &unhealthy, nil),
+		newNode("node-unit", corev1.ConditionUnknown, &unhealthy, map[string]string{"unit1": siteconst.NodeUnitSuperedge}),
+	} {
+		if err := indexer.Add(node); err != nil {
+			t.Fatal(err)
+		}
+	}
+	unit := &sitev1alpha2.NodeUnit{ObjectMeta: metav1.ObjectMeta{Name: "unit1"}}
+	unit.Status.Conditions = []sitev1alpha2.ClusterCondition{{
+		Type:          sitev1alpha2.NodeUnitCloudPartitioned,
+		Status:        sitev1alpha2.ConditionTrue,
+		LastProbeTime: metav1.Now(),
+	}}
+
+	unitIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := unitIndexer.Add(unit); err != nil {
+		t.Fatal(err)
+	}
+
+	nodeLister, unitLister := config.NodeLister, config.NodeUnitLister
+	config.NodeLister = corelisters.NewNodeLister(indexer)
+	config.NodeUnitLister = crdv1listers.NewNodeUnitLister(unitIndexer)
+	t.Cleanup(func() {
+		config.NodeLister, config.NodeUnitLister = nodeLister, unitLister
+	})
+}
+
+// review runs the admission of obj and returns obj patched by the response
+func review(t *testing.T, admit admitFunc, resource metav1.GroupVersionResource, obj runtime.Object) []byte {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := admit(admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{
+			Resource:  resource,
+			Operation: admissionv1.Update,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	})
+	if !resp.Allowed {
+		t.Fatalf("request is not allowed: %v", resp.Result)
+	}
+	if resp.Patch == nil {
+		return raw
+	}
+	if *resp.PatchType != admissionv1.PatchTypeJSONPatch {
+		t.Fatalf("unexpected patch type %s", *resp.PatchType)
+	}
+	patch, err := jsonpatch.DecodePatch(resp.Patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patched, err := patch.Apply(raw)
+	if err != nil {
+		t.Fatalf("apply patch %s error: %v", resp.Patch, err)
+	}
+	return patched
+}
+
+func address(ip, nodeName string) corev1.EndpointAddress {
+	return corev1.EndpointAddress{IP: ip, NodeName: &nodeName}
+}
+
+func TestEndPoint(t *testing.T) {
+	setupNodes(t)
+	endpoints := &corev1.Endpoints{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Endpoints"},
+		ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "default"},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{address("10.0.0.1", "node-ready")},
+				NotReadyAddresses: []corev1.EndpointAddress{
+					address("10.0.0.2", "node-cloud"),
+					address("10.0.0.3", "node-down"),
+					address("10.0.0.4", "node-unit"),
+				},
+			},
+			{
+				NotReadyAddresses: []corev1.EndpointAddress{address("10.0.0.5", "node-cloud"), address("10.0.0.6", "node-cloud")},
+			},
+			{
+				NotReadyAddresses: []corev1.EndpointAddress{address("10.0.0.7", "node-down")},
+			},
+		},
+	}
+
+	var patched corev1.Endpoints
+	raw := review(t, endPoint, metav1.GroupVersionResource{Version: "v1", Resource: "endpoints"}, endpoints)
+	if err := json.Unmarshal(raw, &patched); err != nil {
+		t.Fatal(err)
+	}
+	ips := func(addresses []corev1.EndpointAddress) []string {
+		var ips []string
+		for _, address := range addresses {
+			ips = append(ips, address.IP)
+		}
+		return ips
+	}
+	for i, expected := range []struct {
+		addresses, notReadyAddresses []string
+	}{
+		{addresses: []string{"10.0.0.1", "10.0.0.2", "10.0.0.4"}, notReadyAddresses: []string{"10.0.0.3"}},
+		{addresses: []string{"10.0.0.5", "10.0.0.6"}},
+		{notReadyAddresses: []string{"10.0.0.7"}},
+	} {
+		subset := patched.Subsets[i]
+		if !reflect.DeepEqual(ips(subset.Addresses), expected.addresses) || !reflect.DeepEqual(ips(subset.NotReadyAddresses), expected.notReadyAddresses) {
+			t.Errorf("subset %d: expected %v and not ready %v, got %v and not ready %v", i,
+				expected.addresses, expected.notReadyAddresses, ips(subset.Addresses), ips(subset.NotReadyAddresses))
+		}
+	}
+	if *patched.Subsets[0].Addresses[1].NodeName != "node-cloud" {
+		t.Errorf("the address moved must keep its node, got %+v", patched.Subsets[0].Addresses[1])
+	}
+}
+
+func TestEndpointSlice(t *testing.T) {
+	setupNodes(t)
+	ready, notReady := true, false
+	endpoint := func(ip, nodeName string, ready, terminating bool) discoveryv1.Endpoint {
+		return discoveryv1.Endpoint{
+			Addresses:  []string{ip},
+			NodeName:   &nodeName,
+			Conditions: discoveryv1.EndpointConditions{Ready: &ready, Serving: &ready, Terminating: &terminating},
+		}
+	}
+	slice := &discoveryv1.EndpointSlice{
+		TypeMeta:    metav1.TypeMeta{APIVersion: "discovery.k8s.io/v1", Kind: "EndpointSlice"},
+		ObjectMeta:  metav1.ObjectMeta{Name: "svc-abcde", Namespace: "default"},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints: []discoveryv1.Endpoint{
+			endpoint("10.0.0.1", "node-ready", true, false),
+			endpoint("10.0.0.2", "node-cloud", false, false),
+			endpoint("10.0.0.3", "node-down", false, false),
+			endpoint("10.0.0.4", "node-unit", false, false),
+			endpoint("10.0.0.5", "node-cloud", false, true),
+		},
+	}
+
+	var patched discoveryv1.EndpointSlice
+	raw := review(t, endpointSlice, metav1.GroupVersionResource{Group: "discovery.k8s.io", Version: "v1", Resource: "endpointslices"}, slice)
+	if err := json.Unmarshal(raw, &patched); err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []bool{ready, ready, notReady, ready, notReady} {
+		conditions := patched.Endpoints[i].Conditions
+		if *conditions.Ready != expected || *conditions.Serving != expected {
+			t.Errorf("endpoint %s: expected ready %t, got %+v", patched.Endpoints[i].Addresses[0], expected, conditions)
+		}
+	}
+	if !*patched.Endpoints[4].Conditions.Terminating {
+		t.Errorf("the terminating condition must be kept")
+	}
+
+	// other resources are allowed untouched
+	resp := endpointSlice(admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{
+		Resource: metav1.GroupVersionResource{Group: "discovery.k8s.io", Version: "v1beta1", Resource: "endpointslices"},
+	}})
+	if !resp.Allowed || resp.Patch != nil {
+		t.Errorf("unexpected response %+v", resp)
+	}
+}
+
+func TestStaleCloudPartition(t *testing.T) {
+	setupNodes(t)
+	timeout := config.CloudPartitionTimeout
+	config.CloudPartitionTimeout = 5 * time.Minute
+	t.Cleanup(func() {
+		config.CloudPartitionTimeout = timeout
+	})
+	review := func(probed time.Time) bool {
+		unit := &sitev1alpha2.NodeUnit{ObjectMeta: metav1.ObjectMeta{Name: "unit1"}}
+		unit.Status.Conditions = []sitev1alpha2.ClusterCondition{{
+			Type:          sitev1alpha2.NodeUnitCloudPartitioned,
+			Status:        sitev1alpha2.ConditionTrue,
+			LastProbeTime: metav1.NewTime(probed),
+		}}
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		if err := indexer.Add(unit); err != nil {
+			t.Fatal(err)
+		}
+		config.NodeUnitLister = crdv1listers.NewNodeUnitLister(indexer)
+		nodeName := "node-unit"
+		unreachable, keep, _ := nodeKeepReachable(&nodeName, util.Policy{}, time.Now())
+		if !unreachable {
+			t.Fatalf("expected %s unreachable", nodeName)
+		}
+		return keep
+	}
+	if !review(time.Now().Add(-time.Minute)) {
+		t.Error("the nodes of a NodeUnit freshly partitioned must be kept")
+	}
+	// edge-health stopped refreshing the condition, the NodeUnit may be down as a whole
+	if review(time.Now().Add(-10 * time.Minute)) {
+		t.Error("a stale CloudPartitioned condition must not keep the nodes")
+	}
+}
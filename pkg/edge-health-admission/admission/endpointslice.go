@@ -0,0 +1,104 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/superedge/superedge/pkg/edge-health-admission/config"
+	"github.com/superedge/superedge/pkg/edge-health-admission/util"
+	admissionv1 "k8s.io/api/admission/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+func EndpointSlice(w http.ResponseWriter, r *http.Request) {
+	serve(w, r, endpointSlice)
+}
+
+// endpointSlice marks the endpoints on the unreachable nodes kept by the policy of the service ready again, and the
+// ones no longer kept not ready, like endPoint does for the Endpoints. The terminating endpoints are left untouched.
+func endpointSlice(ar admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
+	klog.V(7).Info("admitting endpointslices")
+	endpointSliceResource := metav1.GroupVersionResource{Group: "discovery.k8s.io", Version: "v1", Resource: "endpointslices"}
+	reviewResponse := admissionv1.AdmissionResponse{}
+	if ar.Request.Resource != endpointSliceResource {
+		reviewResponse = admissionv1.AdmissionResponse{Allowed: true}
+		return &reviewResponse
+	}
+
+	reviewResponseEndpointSlice, slice, err := decodeRawEndpointSlice(ar, "new")
+	if err != nil {
+		return reviewResponseEndpointSlice
+	}
+
+	policy := util.ServicePolicy(config.NamespaceLister, config.ServiceLister, slice.Namespace, slice.Labels[discoveryv1.LabelServiceName])
+	now := time.Now()
+	var resync time.Time
+	patches := []*Patch{}
+	for i, endpoint := range slice.Endpoints {
+		conditions := endpoint.Conditions
+		if conditions.Terminating != nil && *conditions.Terminating {
+			continue
+		}
+		unreachable, keep, expiry := nodeKeepReachable(endpoint.NodeName, policy, now)
+		if !unreachable {
+			continue
+		}
+		if keep {
+			resync = earliest(resync, expiry)
+		}
+		// a nil ready condition is interpreted as ready
+		if ready := conditions.Ready == nil || *conditions.Ready; ready == keep {
+			continue
+		}
+		conditions.Ready = &keep
+		conditions.Serving = &keep
+		patches = append(patches, &Patch{
+			OP:    "add",
+			Path:  fmt.Sprintf("/endpoints/%d/conditions", i),
+			Value: conditions,
+		})
+		klog.V(7).Infof("endpointslice %s/%s: endpoint %v on node %s is set ready %t", slice.Namespace, slice.Name, endpoint.Addresses, *endpoint.NodeName, keep)
+	}
+	if !resync.IsZero() {
+		enqueueGraceExpiry(endpointSliceResource.Resource, slice.Namespace, slice.Name, resync.Sub(now))
+	}
+	setPatches(&reviewResponse, patches)
+	reviewResponse.Allowed = true
+	return &reviewResponse
+}
+
+func decodeRawEndpointSlice(ar admissionv1.AdmissionReview, version string) (*admissionv1.AdmissionResponse, discoveryv1.EndpointSlice, error) {
+	var raw []byte
+	if version == "new" {
+		raw = ar.Request.Object.Raw
+	} else if version == "old" {
+		raw = ar.Request.OldObject.Raw
+	}
+
+	slice := discoveryv1.EndpointSlice{}
+	deserializer := Codecs.UniversalDeserializer()
+	if _, _, err := deserializer.Decode(raw, nil, &slice); err != nil {
+		klog.Error(err)
+		return toAdmissionResponse(err), slice, err
+	}
+	return nil, slice, nil
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// GraceExpiredAnnotation is set on the Endpoints and EndpointSlices whose grace period expired, the update lets
+// the webhooks admit them again since nothing else updates them while the node is unreachable
+const GraceExpiredAnnotation = "superedge.io/unreachable-grace-expired"
+
+type graceKey struct {
+	resource, namespace, name string
+}
+
+// graceQueue holds the Endpoints and EndpointSlices kept ready until a grace period expires
+var graceQueue = workqueue.NewNamedDelayingQueue("edge-health-admission-grace")
+
+func enqueueGraceExpiry(resource, namespace, name string, after time.Duration) {
+	// the webhook must see the grace period expired
+	graceQueue.AddAfter(graceKey{resource: resource, namespace: namespace, name: name}, after+time.Second)
+}
+
+// RunGraceExpiry updates the Endpoints and EndpointSlices when their grace period expires
+func RunGraceExpiry(ctx context.Context, client kubernetes.Interface) {
+	defer utilruntime.HandleCrash()
+	go func() {
+		<-ctx.Done()
+		graceQueue.ShutDown()
+	}()
+
+	for {
+		item, shutdown := graceQueue.Get()
+		if shutdown {
+			return
+		}
+		key := item.(graceKey)
+		if err := touchGraceExpired(ctx, client, key); err != nil {
+			klog.Errorf("update %s %s/%s after its grace period err: %v", key.resource, key.namespace, key.name, err)
+		}
+		graceQueue.Done(item)
+	}
+}
+
+func touchGraceExpired(ctx context.Context, client kubernetes.Interface, key graceKey) error {
+	patch := []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, GraceExpiredAnnotation, time.Now().Format(time.RFC3339)))
+	var err error
+	switch key.resource {
+	case "endpoints":
+		_, err = client.CoreV1().Endpoints(key.namespace).Patch(ctx, key.name, types.MergePatchType, patch, metav1.PatchOptions{})
+	case "endpointslices":
+		_, err = client.DiscoveryV1().EndpointSlices(key.namespace).Patch(ctx, key.name, types.MergePatchType, patch, metav1.PatchOptions{})
+	}
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -78,7 +78,8 @@ func nodeTaint(ar admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
 	_, condition := util.GetNodeCondition(&nodeNew.Status, corev1.NodeReady)
 	patches := []*Patch{}
 	if condition.Status == corev1.ConditionUnknown {
-		if _, ok := nodeNew.Annotations["nodeunhealth"]; !ok || config.NodeAlwaysReachable {
+		if !util.NodeEdgeUnhealthy(&nodeNew) || config.NodeAlwaysReachable ||
+			util.NodeCloudPartitioned(config.NodeUnitLister, &nodeNew, config.CloudPartitionTimeout) {
 			taintsToAdd, _ := util.TaintSetDiff(nodeNew.Spec.Taints, nodeOld.Spec.Taints)
 			if _, flag := util.TaintExistsPosition(taintsToAdd, UnreachNoExecuteTaint); flag {
 				index, _ := util.TaintExistsPosition(nodeNew.Spec.Taints, UnreachNoExecuteTaint)
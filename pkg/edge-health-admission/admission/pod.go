@@ -0,0 +1,93 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"net/http"
+
+	"github.com/superedge/superedge/pkg/edge-health-admission/config"
+	"github.com/superedge/superedge/pkg/edge-health-admission/util"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+func Pod(w http.ResponseWriter, r *http.Request) {
+	serve(w, r, pod)
+}
+
+// pod sets the toleration of the unreachable taint of the pods from their policy, the taint is kept on the nodes
+// voted unhealthy. The pods with an invalid policy are denied.
+func pod(ar admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
+	klog.V(7).Info("admitting pods")
+	podResource := metav1.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"}
+	reviewResponse := admissionv1.AdmissionResponse{}
+	if ar.Request.Resource != podResource || ar.Request.SubResource != "" {
+		reviewResponse = admissionv1.AdmissionResponse{Allowed: true}
+		return &reviewResponse
+	}
+
+	podNew := corev1.Pod{}
+	if _, _, err := Codecs.UniversalDeserializer().Decode(ar.Request.Object.Raw, nil, &podNew); err != nil {
+		klog.Error(err)
+		return toAdmissionResponse(err)
+	}
+	// the namespace of the pod is not set yet when it is created
+	policy, err := util.PodPolicy(config.NamespaceLister, ar.Request.Namespace, &podNew)
+	if err != nil {
+		return toAdmissionResponse(err)
+	}
+
+	if toleration, ok := unreachableToleration(policy); ok {
+		tolerations := []corev1.Toleration{toleration}
+		for _, t := range podNew.Spec.Tolerations {
+			if t.Key == corev1.TaintNodeUnreachable && (t.Effect == "" || t.Effect == corev1.TaintEffectNoExecute) {
+				continue
+			}
+			tolerations = append(tolerations, t)
+		}
+		setPatches(&reviewResponse, []*Patch{{
+			OP:    "add",
+			Path:  "/spec/tolerations",
+			Value: tolerations,
+		}})
+		klog.V(7).Infof("pod %s/%s: toleration of the unreachable taint set by the policy %+v", ar.Request.Namespace, podNew.Name, policy)
+	}
+	reviewResponse.Allowed = true
+	return &reviewResponse
+}
+
+// unreachableToleration returns the toleration of the unreachable taint for policy: the retained pods tolerate it
+// forever, and the others for their grace period. A failover pod without grace period is evicted at once instead of
+// after the default 300s.
+func unreachableToleration(policy util.Policy) (corev1.Toleration, bool) {
+	toleration := corev1.Toleration{
+		Key:      corev1.TaintNodeUnreachable,
+		Operator: corev1.TolerationOpExists,
+		Effect:   corev1.TaintEffectNoExecute,
+	}
+	if !policy.Explicit() {
+		return toleration, false
+	}
+	if policy.Unreachable == util.UnreachableRetain && policy.GracePeriod == 0 {
+		return toleration, true
+	}
+	seconds := int64(policy.GracePeriod.Seconds())
+	toleration.TolerationSeconds = &seconds
+	return toleration, true
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/superedge/superedge/pkg/edge-health-admission/config"
+	"github.com/superedge/superedge/pkg/edge-health-admission/util"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// setupPolicies serves the namespaces and the services from listers
+func setupPolicies(t *testing.T, objs ...runtime.Object) {
+	nsIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	svcIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, obj := range objs {
+		indexer := svcIndexer
+		if _, ok := obj.(*corev1.Namespace); ok {
+			indexer = nsIndexer
+		}
+		if err := indexer.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	nsLister, svcLister := config.NamespaceLister, config.ServiceLister
+	config.NamespaceLister = corelisters.NewNamespaceLister(nsIndexer)
+	config.ServiceLister = corelisters.NewServiceLister(svcIndexer)
+	t.Cleanup(func() {
+		config.NamespaceLister, config.ServiceLister = nsLister, svcLister
+	})
+}
+
+func TestEndPointPolicy(t *testing.T) {
+	setupNodes(t)
+	setupPolicies(t,
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "retain", Annotations: map[string]string{
+			util.UnreachablePolicyAnnotation: string(util.UnreachableRetain),
+		}}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "failover", Namespace: "retain", Annotations: map[string]string{
+			util.UnreachablePolicyAnnotation: string(util.UnreachableFailover),
+		}}},
+		// the nodes of the tests became unreachable long ago
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "grace", Namespace: "default", Annotations: map[string]string{
+			util.UnreachableGracePeriodAnnotation: "10m",
+		}}},
+	)
+
+	ips := func(addresses []corev1.EndpointAddress) []string {
+		var ips []string
+		for _, address := range addresses {
+			ips = append(ips, address.IP)
+		}
+		return ips
+	}
+	for _, tc := range []struct {
+		namespace, name              string
+		addresses, notReadyAddresses []string
+	}{
+		{namespace: "retain", name: "svc", addresses: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"}},
+		{namespace: "retain", name: "failover", addresses: []string{"10.0.0.1"}, notReadyAddresses: []string{"10.0.0.2", "10.0.0.3", "10.0.0.4"}},
+		{namespace: "default", name: "grace", addresses: []string{"10.0.0.1"}, notReadyAddresses: []string{"10.0.0.2", "10.0.0.3", "10.0.0.4"}},
+	} {
+		endpoints := &corev1.Endpoints{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Endpoints"},
+			ObjectMeta: metav1.ObjectMeta{Name: tc.name, Namespace: tc.namespace},
+			Subsets: []corev1.EndpointSubset{{
+				Addresses:         []corev1.EndpointAddress{address("10.0.0.1", "node-ready"), address("10.0.0.2", "node-cloud")},
+				NotReadyAddresses: []corev1.EndpointAddress{address("10.0.0.3", "node-down"), address("10.0.0.4", "node-unit")},
+			}},
+		}
+		var patched corev1.Endpoints
+		raw := review(t, endPoint, metav1.GroupVersionResource{Version: "v1", Resource: "endpoints"}, endpoints)
+		if err := json.Unmarshal(raw, &patched); err != nil {
+			t.Fatal(err)
+		}
+		subset := patched.Subsets[0]
+		if !reflect.DeepEqual(ips(subset.Addresses), tc.addresses) || !reflect.DeepEqual(ips(subset.NotReadyAddresses), tc.notReadyAddresses) {
+			t.Errorf("%s/%s: expected %v and not ready %v, got %v and not ready %v", tc.namespace, tc.name,
+				tc.addresses, tc.notReadyAddresses, ips(subset.Addresses), ips(subset.NotReadyAddresses))
+		}
+	}
+}
+
+func TestPod(t *testing.T) {
+	setupPolicies(t, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "retain", Annotations: map[string]string{
+		util.UnreachablePolicyAnnotation: string(util.UnreachableRetain),
+	}}})
+	defaultSeconds, graceSeconds, zero := int64(300), int64(60), int64(0)
+	defaultToleration := corev1.Toleration{
+		Key:               corev1.TaintNodeUnreachable,
+		Operator:          corev1.TolerationOpExists,
+		Effect:            corev1.TaintEffectNoExecute,
+		TolerationSeconds: &defaultSeconds,
+	}
+	otherToleration := corev1.Toleration{Key: "other", Operator: corev1.TolerationOpExists}
+	withSeconds := func(seconds *int64) corev1.Toleration {
+		toleration := defaultToleration
+		toleration.TolerationSeconds = seconds
+		return toleration
+	}
+
+	for _, tc := range []struct {
+		namespace   string
+		annotations map[string]string
+		denied      bool
+		tolerations []corev1.Toleration
+	}{
+		{namespace: "default", tolerations: []corev1.Toleration{otherToleration, defaultToleration}},
+		{namespace: "retain", tolerations: []corev1.Toleration{withSeconds(nil), otherToleration}},
+		{namespace: "retain", annotations: map[string]string{util.UnreachableGracePeriodAnnotation: "1m"},
+			tolerations: []corev1.Toleration{withSeconds(&graceSeconds), otherToleration}},
+		{namespace: "default", annotations: map[string]string{util.UnreachablePolicyAnnotation: string(util.UnreachableFailover)},
+			tolerations: []corev1.Toleration{withSeconds(&zero), otherToleration}},
+		{namespace: "default", annotations: map[string]string{util.UnreachablePolicyAnnotation: "never"}, denied: true},
+	} {
+		p := &corev1.Pod{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+			ObjectMeta: metav1.ObjectMeta{Name: "pod", Annotations: tc.annotations},
+			Spec:       corev1.PodSpec{Tolerations: []corev1.Toleration{otherToleration, defaultToleration}},
+		}
+		raw, err := json.Marshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ar := admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{
+			Resource:  metav1.GroupVersionResource{Version: "v1", Resource: "pods"},
+			Namespace: tc.namespace,
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		}}
+		if resp := pod(ar); resp.Allowed == tc.denied {
+			t.Errorf("%s %v: expected denied %t, got %+v", tc.namespace, tc.annotations, tc.denied, resp)
+			continue
+		}
+		if tc.denied {
+			continue
+		}
+		var patched corev1.Pod
+		if err := json.Unmarshal(review(t, func(admissionv1.AdmissionReview) *admissionv1.AdmissionResponse { return pod(ar) },
+			ar.Request.Resource, p), &patched); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(patched.Spec.Tolerations, tc.tolerations) {
+			t.Errorf("%s %v: expected tolerations %+v, got %+v", tc.namespace, tc.annotations, tc.tolerations, patched.Spec.Tolerations)
+		}
+	}
+}
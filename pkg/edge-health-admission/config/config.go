@@ -19,8 +19,11 @@ package config
 import (
 	"crypto/tls"
 	"flag"
+	"time"
 
+	crdv1listers "github.com/superedge/superedge/pkg/site-manager/generated/listers/site.superedge.io/v1alpha2"
 	clientset "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/klog/v2"
 )
 
@@ -33,8 +36,40 @@ type Config struct {
 }
 
 var Kubeclient clientset.Interface
+
+// NodeLister reads the nodes from the shared informer, the endpoints admission reads a node for every not
+// ready address
+var NodeLister corelisters.NodeLister
+
+// NamespaceLister and ServiceLister read the annotations holding the unreachable policy of the workloads
+var NamespaceLister corelisters.NamespaceLister
+var ServiceLister corelisters.ServiceLister
 var NodeAlwaysReachable bool
 
+// NodeUnitLister reads the CloudPartitioned condition of the NodeUnits of the unreachable nodes
+var NodeUnitLister crdv1listers.NodeUnitLister
+
+// a NodeUnit whose CloudPartitioned condition is not refreshed in CloudPartitionTimeout is not trusted to be partitioned
+var CloudPartitionTimeout time.Duration
+
+// the pods whose policy does not keep them on an unreachable node without taint are evicted every EvictionPeriod
+var EvictionPeriod time.Duration
+
+// PeerSigner signs the certificates edge-health peers authenticate each other with
+type PeerSigner struct {
+	Enable         bool
+	Namespace      string
+	ServiceAccount string
+	CertDuration   time.Duration
+}
+
+func (s *PeerSigner) AddFlags() {
+	flag.BoolVar(&s.Enable, "edge-health-peer-signer", true, "approve and sign the CertificateSigningRequests of edge-health peers")
+	flag.StringVar(&s.Namespace, "edge-health-namespace", "edge-system", "namespace of edge-health, the CA of the peers is stored in it")
+	flag.StringVar(&s.ServiceAccount, "edge-health-service-account", "edge-health", "service account of edge-health")
+	flag.DurationVar(&s.CertDuration, "edge-health-cert-duration", 7*24*time.Hour, "validity of the certificates of edge-health peers, they are rotated before expiration")
+}
+
 func (c *Config) AddFlags() {
 	flag.StringVar(&c.CertFile, "admission-control-server-cert", c.CertFile, ""+
 		"File containing the default x509 Certificate for HTTPS. (CA cert, if any, concatenated "+
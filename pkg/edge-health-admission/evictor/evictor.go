@@ -0,0 +1,152 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package evictor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/superedge/superedge/pkg/edge-health-admission/util"
+	crdv1listers "github.com/superedge/superedge/pkg/site-manager/generated/listers/site.superedge.io/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// NodeNameIndex indexes the pods of the shared informer by their node
+const NodeNameIndex = "spec.nodeName"
+
+// NodeNameIndexFunc returns the node of the pod
+func NodeNameIndexFunc(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object %T", obj)
+	}
+	if pod.Spec.NodeName == "" {
+		return nil, nil
+	}
+	return []string{pod.Spec.NodeName}, nil
+}
+
+// Evictor evicts the pods whose policy does not keep them on an unreachable node, when the unreachable taint was
+// removed from the node by the admission. The taint manager of kube-controller-manager evicts them otherwise.
+// The policy of the namespace is read at every check, so it applies to the pods created before it was set.
+type Evictor struct {
+	client           kubernetes.Interface
+	unitLister       crdv1listers.NodeUnitLister
+	nodeLister       corelisters.NodeLister
+	nsLister         corelisters.NamespaceLister
+	podIndexer       cache.Indexer
+	partitionTimeout time.Duration
+	period           time.Duration
+}
+
+// NewEvictor checks the pods on the unreachable nodes every period, podIndexer indexes them by NodeNameIndex
+func NewEvictor(client kubernetes.Interface, unitLister crdv1listers.NodeUnitLister, nodeLister corelisters.NodeLister,
+	nsLister corelisters.NamespaceLister, podIndexer cache.Indexer, partitionTimeout, period time.Duration) *Evictor {
+	return &Evictor{
+		client:           client,
+		unitLister:       unitLister,
+		nodeLister:       nodeLister,
+		nsLister:         nsLister,
+		podIndexer:       podIndexer,
+		partitionTimeout: partitionTimeout,
+		period:           period,
+	}
+}
+
+func (e *Evictor) Run(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+	wait.UntilWithContext(ctx, e.evict, e.period)
+}
+
+func (e *Evictor) evict(ctx context.Context) {
+	nodes, err := e.nodeLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("list nodes err: %v", err)
+		return
+	}
+	unreachTaint := &corev1.Taint{Key: corev1.TaintNodeUnreachable, Effect: corev1.TaintEffectNoExecute}
+	for _, node := range nodes {
+		if _, ok := util.NodeUnreachableSince(node); !ok || util.TaintExists(node.Spec.Taints, unreachTaint) {
+			continue
+		}
+		objs, err := e.podIndexer.ByIndex(NodeNameIndex, node.Name)
+		if err != nil {
+			klog.Errorf("list pods of node %s err: %v", node.Name, err)
+			continue
+		}
+		if len(objs) == 0 {
+			continue
+		}
+		// the verdict of edge-health is the same for all the pods of the node
+		kept := util.NodeKeptReachable(e.unitLister, node, e.partitionTimeout)
+		now := time.Now()
+		for _, obj := range objs {
+			pod := obj.(*corev1.Pod)
+			if !e.evictable(pod, node, kept, now) {
+				continue
+			}
+			klog.Infof("evict pod %s/%s from the unreachable node %s by its unreachable policy", pod.Namespace, pod.Name, node.Name)
+			// the eviction honors the PodDisruptionBudgets, the pods refused are evicted at a later period
+			err := e.client.CoreV1().Pods(pod.Namespace).EvictV1(ctx, &policyv1.Eviction{
+				ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+			})
+			switch {
+			case err == nil, errors.IsNotFound(err):
+			case errors.IsTooManyRequests(err):
+				klog.V(2).Infof("eviction of pod %s/%s is refused by its disruption budget: %v", pod.Namespace, pod.Name, err)
+			default:
+				klog.Errorf("evict pod %s/%s err: %v", pod.Namespace, pod.Name, err)
+			}
+		}
+	}
+}
+
+// evictable returns whether the policy of the pod asks for its eviction from the unreachable node, kept is the
+// verdict for the pods without policy. The pods without policy are kept like the admission keeps the node, and
+// the DaemonSet and static pods would come back on it.
+func (e *Evictor) evictable(pod *corev1.Pod, node *corev1.Node, kept bool, now time.Time) bool {
+	if pod.DeletionTimestamp != nil {
+		return false
+	}
+	if owner := metav1.GetControllerOf(pod); owner != nil && owner.Kind == "DaemonSet" {
+		return false
+	}
+	if _, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]; ok {
+		return false
+	}
+	policy, err := util.PodPolicy(e.nsLister, pod.Namespace, pod)
+	if err != nil {
+		klog.Errorf("pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		return false
+	}
+	if !policy.Explicit() {
+		return false
+	}
+	keep, _ := policy.KeepReachableVerdict(node, now, kept)
+	return !keep
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package evictor
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/superedge/superedge/pkg/edge-health-admission/util"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestEvict(t *testing.T) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-cloud"}}
+	node.Status.Conditions = []corev1.NodeCondition{{
+		Type:               corev1.NodeReady,
+		Status:             corev1.ConditionUnknown,
+		LastTransitionTime: metav1.NewTime(time.Now().Add(-5 * time.Minute)),
+	}}
+	nodeIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := nodeIndexer.Add(node); err != nil {
+		t.Fatal(err)
+	}
+	failover := func(name string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: map[string]string{
+			util.UnreachablePolicyAnnotation: string(util.UnreachableFailover),
+		}}}
+	}
+	nsIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := nsIndexer.Add(failover("failover")); err != nil {
+		t.Fatal(err)
+	}
+
+	newPod := func(namespace, name string, annotations map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Annotations: annotations},
+			Spec:       corev1.PodSpec{NodeName: node.Name},
+		}
+	}
+	daemon := newPod("failover", "daemon", nil)
+	controller := true
+	daemon.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "DaemonSet", Name: "ds", Controller: &controller}}
+	podIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{NodeNameIndex: NodeNameIndexFunc})
+	for _, pod := range []*corev1.Pod{
+		newPod("default", "default", nil),
+		newPod("default", "grace-expired", map[string]string{util.UnreachableGracePeriodAnnotation: "1m"}),
+		newPod("default", "grace", map[string]string{util.UnreachableGracePeriodAnnotation: "10m"}),
+		newPod("failover", "failover", nil),
+		newPod("failover", "budget", nil),
+		newPod("failover", "retain", map[string]string{util.UnreachablePolicyAnnotation: string(util.UnreachableRetain)}),
+		newPod("later", "later", nil),
+		daemon,
+	} {
+		if err := podIndexer.Add(pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the evicted pods leave the informer, the disruption budget refuses the eviction of budget
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		eviction := action.(k8stesting.CreateAction).GetObject().(*policyv1.Eviction)
+		if eviction.Name == "budget" {
+			return true, nil, errors.NewTooManyRequests("disruption budget", 10)
+		}
+		obj, exists, err := podIndexer.GetByKey(eviction.Namespace + "/" + eviction.Name)
+		if err != nil || !exists {
+			return true, nil, errors.NewNotFound(corev1.Resource("pods"), eviction.Name)
+		}
+		return true, nil, podIndexer.Delete(obj)
+	})
+	left := func() []string {
+		names := podIndexer.ListKeys()
+		sort.Strings(names)
+		return names
+	}
+
+	e := NewEvictor(client, nil, corelisters.NewNodeLister(nodeIndexer), corelisters.NewNamespaceLister(nsIndexer),
+		podIndexer, 0, time.Second)
+	e.evict(context.TODO())
+	expected := []string{"default/default", "default/grace", "failover/budget", "failover/daemon", "failover/retain", "later/later"}
+	if names := left(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected pods %v left, got %v", expected, names)
+	}
+
+	// the policy set on the namespace applies to its running pods
+	if err := nsIndexer.Add(failover("later")); err != nil {
+		t.Fatal(err)
+	}
+	e.evict(context.TODO())
+	expected = []string{"default/default", "default/grace", "failover/budget", "failover/daemon", "failover/retain"}
+	if names := left(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected pods %v left, got %v", expected, names)
+	}
+
+	// the taint manager evicts the pods of the tainted nodes
+	node = node.DeepCopy()
+	node.Spec.Taints = []corev1.Taint{{Key: corev1.TaintNodeUnreachable, Effect: corev1.TaintEffectNoExecute}}
+	if err := nodeIndexer.Update(node); err != nil {
+		t.Fatal(err)
+	}
+	if err := podIndexer.Add(newPod("failover", "tainted", nil)); err != nil {
+		t.Fatal(err)
+	}
+	e.evict(context.TODO())
+	if _, exists, _ := podIndexer.GetByKey("failover/tainted"); !exists {
+		t.Error("the pod of a tainted node must be left to the taint manager")
+	}
+}
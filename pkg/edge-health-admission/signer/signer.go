@@ -0,0 +1,394 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/superedge/superedge/pkg/edge-health/common"
+	"github.com/superedge/superedge/pkg/util"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	certlisters "k8s.io/client-go/listers/certificates/v1"
+	"k8s.io/client-go/tools/cache"
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/client-go/util/keyutil"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// podNameExtraKey is added to the user info of the service account tokens bound to a pod
+	podNameExtraKey = "authentication.kubernetes.io/pod-name"
+	// minDuration bounds the expirationSeconds requested by a CertificateSigningRequest
+	minDuration = 10 * time.Minute
+
+	// caSecretName holds the CA certificate and key of the edge-health peers
+	caSecretName = "edge-health-ca"
+
+	reasonApproved = "EdgeHealthPeerApproved"
+	reasonDenied   = "EdgeHealthPeerDenied"
+)
+
+// Signer approves and signs the CertificateSigningRequests of the edge-health peers. A certificate names the
+// ip of the node the requesting edge-health pod runs on, so that a node can not speak for another one.
+type Signer struct {
+	client         kubernetes.Interface
+	namespace      string
+	serviceAccount string
+	duration       time.Duration
+
+	caCert *x509.Certificate
+	caKey  *rsa.PrivateKey
+
+	csrInformer cache.SharedIndexInformer
+	csrLister   certlisters.CertificateSigningRequestLister
+	csrSynced   cache.InformerSynced
+	queue       workqueue.RateLimitingInterface
+}
+
+// NewSigner signs the certificates for edge-health running with serviceAccount in namespace, they are valid for duration
+func NewSigner(client kubernetes.Interface, namespace, serviceAccount string, duration time.Duration) *Signer {
+	csrInformer := informers.NewSharedInformerFactory(client, 10*time.Minute).Certificates().V1().CertificateSigningRequests()
+	s := &Signer{
+		client:         client,
+		namespace:      namespace,
+		serviceAccount: serviceAccount,
+		duration:       duration,
+		csrInformer:    csrInformer.Informer(),
+		csrLister:      csrInformer.Lister(),
+		queue:          workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "edge-health-peer-signer"),
+	}
+	s.csrInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    s.enqueue,
+		UpdateFunc: func(old, cur interface{}) { s.enqueue(cur) },
+	})
+	s.csrSynced = s.csrInformer.HasSynced
+	return s
+}
+
+func (s *Signer) enqueue(obj interface{}) {
+	csr, ok := obj.(*certificatesv1.CertificateSigningRequest)
+	if !ok || csr.Spec.SignerName != common.PeerCertSignerName {
+		return
+	}
+	s.queue.Add(csr.Name)
+}
+
+func (s *Signer) Run(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+	defer s.queue.ShutDown()
+
+	if err := wait.PollImmediateUntil(10*time.Second, func() (bool, error) {
+		if err := s.ensureCA(ctx); err != nil {
+			klog.Errorf("ensure CA of edge-health peers err: %v", err)
+			return false, nil
+		}
+		return true, nil
+	}, ctx.Done()); err != nil {
+		return
+	}
+
+	go s.csrInformer.Run(ctx.Done())
+	if ok := cache.WaitForCacheSync(ctx.Done(), s.csrSynced); !ok {
+		klog.Error("failed to wait for CertificateSigningRequest caches to sync")
+		return
+	}
+	go wait.Until(s.worker, time.Second, ctx.Done())
+	<-ctx.Done()
+}
+
+func (s *Signer) worker() {
+	for s.processNextItem() {
+	}
+}
+
+func (s *Signer) processNextItem() bool {
+	key, quit := s.queue.Get()
+	if quit {
+		return false
+	}
+	defer s.queue.Done(key)
+
+	if err := s.sync(context.TODO(), key.(string)); err != nil {
+		klog.Errorf("sync CertificateSigningRequest %s err: %v", key, err)
+		s.queue.AddRateLimited(key)
+		return true
+	}
+	s.queue.Forget(key)
+	return true
+}
+
+// ensureCA loads the CA from the Secret of the edge-health namespace, the first signer generates it. The CA
+// certificate is published in a ConfigMap read by edge-health.
+func (s *Signer) ensureCA(ctx context.Context) error {
+	secret, err := s.client.CoreV1().Secrets(s.namespace).Get(ctx, caSecretName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		secret, err = s.createCA(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	certs, err := util.ParseCertsPEM(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		return err
+	}
+	key, err := util.ParsePrivateKeyPEMRSA(secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return err
+	}
+	s.caCert, s.caKey = certs[0], key
+	return s.publishCA(ctx, string(secret.Data[corev1.TLSCertKey]))
+}
+
+func (s *Signer) createCA(ctx context.Context) (*corev1.Secret, error) {
+	_, caCert, caKey, err := util.GenerateCA("superedge")
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := keyutil.MarshalPrivateKeyToPEM(caKey)
+	if err != nil {
+		return nil, err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      caSecretName,
+			Namespace: s.namespace,
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       util.EncodeCertPEM(caCert),
+			corev1.TLSPrivateKeyKey: keyPEM,
+		},
+	}
+	created, err := s.client.CoreV1().Secrets(s.namespace).Create(ctx, secret, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		// another replica created the CA first
+		return s.client.CoreV1().Secrets(s.namespace).Get(ctx, caSecretName, metav1.GetOptions{})
+	}
+	if err == nil {
+		klog.Infof("generate CA of edge-health peers in Secret %s/%s", s.namespace, caSecretName)
+	}
+	return created, err
+}
+
+func (s *Signer) publishCA(ctx context.Context, caPEM string) error {
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, common.PeerCAConfigMap, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      common.PeerCAConfigMap,
+				Namespace: s.namespace,
+				// edge-health only watches the ConfigMaps with its label
+				Labels: map[string]string{"name": "edge-health"},
+			},
+			Data: map[string]string{common.PeerCAKey: caPEM},
+		}
+		_, err = s.client.CoreV1().ConfigMaps(s.namespace).Create(ctx, cm, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if cm.Data[common.PeerCAKey] == caPEM && cm.Labels["name"] == "edge-health" {
+		return nil
+	}
+	cm = cm.DeepCopy()
+	if cm.Labels == nil {
+		cm.Labels = map[string]string{}
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Labels["name"] = "edge-health"
+	cm.Data[common.PeerCAKey] = caPEM
+	_, err = s.client.CoreV1().ConfigMaps(s.namespace).Update(ctx, cm, metav1.UpdateOptions{})
+	return err
+}
+
+func (s *Signer) sync(ctx context.Context, name string) error {
+	csr, err := s.csrLister.Get(name)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if csr.Spec.SignerName != common.PeerCertSignerName || len(csr.Status.Certificate) != 0 ||
+		hasCondition(csr, certificatesv1.CertificateDenied) || hasCondition(csr, certificatesv1.CertificateFailed) {
+		return nil
+	}
+
+	req, validateErr, err := s.validate(ctx, csr)
+	if err != nil {
+		// the pod or the node could not be read, the request is validated again later
+		return err
+	}
+	if !hasCondition(csr, certificatesv1.CertificateApproved) {
+		csr = csr.DeepCopy()
+		if validateErr != nil {
+			klog.Warningf("deny CertificateSigningRequest %s of %s: %v", csr.Name, csr.Spec.Username, validateErr)
+			csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+				Type:    certificatesv1.CertificateDenied,
+				Status:  corev1.ConditionTrue,
+				Reason:  reasonDenied,
+				Message: validateErr.Error(),
+			})
+			_, err := s.client.CertificatesV1().CertificateSigningRequests().UpdateApproval(ctx, csr.Name, csr, metav1.UpdateOptions{})
+			return err
+		}
+		csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+			Type:    certificatesv1.CertificateApproved,
+			Status:  corev1.ConditionTrue,
+			Reason:  reasonApproved,
+			Message: "the certificate names the node of the requesting edge-health pod",
+		})
+		if csr, err = s.client.CertificatesV1().CertificateSigningRequests().UpdateApproval(ctx, csr.Name, csr, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	} else if validateErr != nil {
+		// approved by someone else, the signer still only signs valid requests
+		klog.Warningf("CertificateSigningRequest %s is approved but not signed: %v", csr.Name, validateErr)
+		return nil
+	}
+
+	duration := s.duration
+	if csr.Spec.ExpirationSeconds != nil {
+		if requested := time.Duration(*csr.Spec.ExpirationSeconds) * time.Second; requested < duration {
+			duration = requested
+		}
+		if duration < minDuration {
+			duration = minDuration
+		}
+	}
+	cert, err := util.NewSignedCertWithDuration(&certutil.Config{
+		CommonName:   req.Subject.CommonName,
+		Organization: req.Subject.Organization,
+		AltNames:     certutil.AltNames{IPs: req.IPAddresses},
+		Usages:       []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}, req.PublicKey, s.caCert, s.caKey, duration)
+	if err != nil {
+		return err
+	}
+	csr = csr.DeepCopy()
+	csr.Status.Certificate = util.EncodeCertPEM(cert)
+	if _, err := s.client.CertificatesV1().CertificateSigningRequests().UpdateStatus(ctx, csr, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+	klog.V(2).Infof("sign certificate of edge-health on %s for %v, it expires at %v", req.Subject.CommonName, req.IPAddresses, cert.NotAfter)
+	return nil
+}
+
+// validate checks that the request comes from an edge-health pod and only names the node the pod runs on. It returns
+// why the request is denied, and an error when the pod or the node can not be read.
+func (s *Signer) validate(ctx context.Context, csr *certificatesv1.CertificateSigningRequest) (*x509.CertificateRequest, error, error) {
+	req, denyErr := s.validateRequest(csr)
+	if denyErr != nil {
+		return nil, denyErr, nil
+	}
+	podNames := csr.Spec.Extra[podNameExtraKey]
+	if len(podNames) != 1 {
+		return nil, fmt.Errorf("requester is not bound to a pod"), nil
+	}
+	pod, err := s.client.CoreV1().Pods(s.namespace).Get(ctx, podNames[0], metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, fmt.Errorf("pod %s of the requester is not found", podNames[0]), nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	nodeName := req.Subject.CommonName
+	if pod.Spec.NodeName != nodeName {
+		return nil, fmt.Errorf("pod %s runs on %s, not on %s", pod.Name, pod.Spec.NodeName, nodeName), nil
+	}
+	node, err := s.client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, fmt.Errorf("node %s is not found", nodeName), nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !nodeHasInternalIP(node, req.IPAddresses[0]) {
+		return nil, fmt.Errorf("%s is not an internal ip of node %s", req.IPAddresses[0], nodeName), nil
+	}
+	return req, nil, nil
+}
+
+// validateRequest checks the requester, the usages and the content of the request
+func (s *Signer) validateRequest(csr *certificatesv1.CertificateSigningRequest) (*x509.CertificateRequest, error) {
+	username := "system:serviceaccount:" + s.namespace + ":" + s.serviceAccount
+	if csr.Spec.Username != username {
+		return nil, fmt.Errorf("requester %s is not %s", csr.Spec.Username, username)
+	}
+	for _, usage := range csr.Spec.Usages {
+		switch usage {
+		case certificatesv1.UsageDigitalSignature, certificatesv1.UsageKeyEncipherment,
+			certificatesv1.UsageServerAuth, certificatesv1.UsageClientAuth:
+		default:
+			return nil, fmt.Errorf("usage %s is not allowed", usage)
+		}
+	}
+
+	block, _ := pem.Decode(csr.Spec.Request)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, fmt.Errorf("request is not a PEM encoded certificate request")
+	}
+	req, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.CheckSignature(); err != nil {
+		return nil, err
+	}
+	if len(req.Subject.Organization) != 1 || req.Subject.Organization[0] != common.PeerCertOrganization {
+		return nil, fmt.Errorf("organization must be %s", common.PeerCertOrganization)
+	}
+	if len(req.DNSNames) != 0 || len(req.EmailAddresses) != 0 || len(req.URIs) != 0 || len(req.IPAddresses) != 1 {
+		return nil, fmt.Errorf("the request must only name the ip of the node")
+	}
+	return req, nil
+}
+
+func nodeHasInternalIP(node *corev1.Node, ip net.IP) bool {
+	for _, address := range node.Status.Addresses {
+		if address.Type == corev1.NodeInternalIP && ip.Equal(net.ParseIP(address.Address)) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasCondition(csr *certificatesv1.CertificateSigningRequest, conditionType certificatesv1.RequestConditionType) bool {
+	for _, c := range csr.Status.Conditions {
+		if c.Type == conditionType {
+			return true
+		}
+	}
+	return false
+}
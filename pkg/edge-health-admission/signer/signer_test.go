@@ -0,0 +1,191 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/superedge/superedge/pkg/edge-health/common"
+	"github.com/superedge/superedge/pkg/util"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	certutil "k8s.io/client-go/util/cert"
+)
+
+func newPeerCSR(t *testing.T, name, nodeName, ip, podName string) *certificatesv1.CertificateSigningRequest {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err := certutil.MakeCSR(key, &pkix.Name{CommonName: nodeName, Organization: []string{common.PeerCertOrganization}}, nil, []net.IP{net.ParseIP(ip)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &certificatesv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: certificatesv1.CertificateSigningRequestSpec{
+			Request:    request,
+			SignerName: common.PeerCertSignerName,
+			Usages:     []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageServerAuth, certificatesv1.UsageClientAuth},
+			Username:   "system:serviceaccount:edge-system:edge-health",
+			Extra:      map[string]certificatesv1.ExtraValue{podNameExtraKey: {podName}},
+		},
+	}
+}
+
+func TestSigner(t *testing.T) {
+	ctx := context.TODO()
+	client := fake.NewSimpleClientset(
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+			Status:     corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}}},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "edge-health-abcde", Namespace: "edge-system"},
+			Spec:       corev1.PodSpec{NodeName: "node1"},
+		},
+	)
+	s := NewSigner(client, "edge-system", "edge-health", time.Hour)
+	if err := s.ensureCA(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cm, err := client.CoreV1().ConfigMaps("edge-system").Get(ctx, common.PeerCAConfigMap, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCerts, err := util.ParseCertsPEM([]byte(cm.Data[common.PeerCAKey]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(caCerts[0])
+
+	// the CA is loaded again after a restart
+	caCert := s.caCert
+	if err := s.ensureCA(ctx); err != nil || !s.caCert.Equal(caCert) {
+		t.Fatalf("CA changed after a restart, err: %v", err)
+	}
+
+	unbound := newPeerCSR(t, "unbound", "node1", "10.0.0.1", "")
+	unbound.Spec.Extra = nil
+	otherUser := newPeerCSR(t, "other-user", "node1", "10.0.0.1", "edge-health-abcde")
+	otherUser.Spec.Username = "system:serviceaccount:default:default"
+
+	testcases := []struct {
+		name   string
+		csr    *certificatesv1.CertificateSigningRequest
+		signed bool
+	}{
+		{"valid", newPeerCSR(t, "valid", "node1", "10.0.0.1", "edge-health-abcde"), true},
+		{"other node ip", newPeerCSR(t, "other-ip", "node1", "10.0.0.2", "edge-health-abcde"), false},
+		{"pod on another node", newPeerCSR(t, "other-node", "node2", "10.0.0.1", "edge-health-abcde"), false},
+		{"unbound token", unbound, false},
+		{"other service account", otherUser, false},
+	}
+
+	for _, tc := range testcases {
+		if _, err := client.CertificatesV1().CertificateSigningRequests().Create(ctx, tc.csr, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.csrInformer.GetIndexer().Add(tc.csr); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.sync(ctx, tc.csr.Name); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		csr, err := client.CertificatesV1().CertificateSigningRequests().Get(ctx, tc.csr.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tc.signed {
+			if len(csr.Status.Certificate) != 0 || !hasCondition(csr, certificatesv1.CertificateDenied) {
+				t.Errorf("%s: expected a denied request", tc.name)
+			}
+			continue
+		}
+		if !hasCondition(csr, certificatesv1.CertificateApproved) {
+			t.Fatalf("%s: expected an approved request", tc.name)
+		}
+		// the signer is called again with the approved request
+		if err := s.csrInformer.GetIndexer().Update(csr); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.sync(ctx, tc.csr.Name); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		csr, _ = client.CertificatesV1().CertificateSigningRequests().Get(ctx, tc.csr.Name, metav1.GetOptions{})
+		certs, err := util.ParseCertsPEM(csr.Status.Certificate)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if _, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:     roots,
+			DNSName:   "10.0.0.1",
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if certs[0].NotAfter.After(time.Now().Add(time.Hour)) {
+			t.Errorf("%s: certificate expires at %v, after the duration", tc.name, certs[0].NotAfter)
+		}
+	}
+}
+
+func TestSignerRetriesTransientErrors(t *testing.T) {
+	ctx := context.TODO()
+	client := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "edge-health-abcde", Namespace: "edge-system"},
+		Spec:       corev1.PodSpec{NodeName: "node1"},
+	})
+	client.PrependReactor("get", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("connection refused")
+	})
+	s := NewSigner(client, "edge-system", "edge-health", time.Hour)
+	if err := s.ensureCA(ctx); err != nil {
+		t.Fatal(err)
+	}
+	csr := newPeerCSR(t, "valid", "node1", "10.0.0.1", "edge-health-abcde")
+	if _, err := client.CertificatesV1().CertificateSigningRequests().Create(ctx, csr, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.csrInformer.GetIndexer().Add(csr); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.sync(ctx, csr.Name); err == nil {
+		t.Fatal("expected the request to be retried")
+	}
+	csr, err := client.CertificatesV1().CertificateSigningRequests().Get(ctx, csr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(csr.Status.Conditions) != 0 {
+		t.Errorf("the request must not be approved or denied, got %+v", csr.Status.Conditions)
+	}
+}
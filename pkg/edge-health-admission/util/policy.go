@@ -0,0 +1,174 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"time"
+
+	crdv1listers "github.com/superedge/superedge/pkg/site-manager/generated/listers/site.superedge.io/v1alpha2"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// The unreachable policy of a workload is read from the annotations of its Namespace, overridden by the ones of
+// its Service for the endpoints and of its Pod for the eviction
+const (
+	UnreachablePolicyAnnotation      = "superedge.io/unreachable-policy"
+	UnreachableGracePeriodAnnotation = "superedge.io/unreachable-grace-period"
+)
+
+type UnreachablePolicy string
+
+const (
+	// UnreachableDefault keeps the workloads on the nodes only unreachable from the cloud
+	UnreachableDefault UnreachablePolicy = ""
+	// UnreachableRetain keeps the workloads on the unreachable nodes, even when edge-health voted them unhealthy
+	UnreachableRetain UnreachablePolicy = "retain"
+	// UnreachableFailover removes the endpoints and evicts the pods of the unreachable nodes like Kubernetes does
+	UnreachableFailover UnreachablePolicy = "failover"
+)
+
+// Policy tells how the endpoints and the pods on an unreachable node are handled
+type Policy struct {
+	Unreachable UnreachablePolicy
+	// GracePeriod bounds the time the workloads are kept once the node is unreachable, whatever the verdict
+	// of edge-health. 0 keeps them as long as Unreachable says.
+	GracePeriod time.Duration
+}
+
+// ParsePolicy returns base overridden by the policy annotations
+func ParsePolicy(annotations map[string]string, base Policy) (Policy, error) {
+	policy := base
+	if v, ok := annotations[UnreachablePolicyAnnotation]; ok {
+		switch p := UnreachablePolicy(v); p {
+		case UnreachableDefault, UnreachableRetain, UnreachableFailover:
+			policy.Unreachable = p
+		default:
+			return base, fmt.Errorf("invalid %s %q", UnreachablePolicyAnnotation, v)
+		}
+	}
+	if v, ok := annotations[UnreachableGracePeriodAnnotation]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return base, fmt.Errorf("invalid %s %q", UnreachableGracePeriodAnnotation, v)
+		}
+		policy.GracePeriod = d
+	}
+	return policy, nil
+}
+
+// Explicit returns whether the policy changes the default behavior
+func (p Policy) Explicit() bool {
+	return p.Unreachable != UnreachableDefault || p.GracePeriod > 0
+}
+
+// NodeUnreachableSince returns when the Ready condition of the node became Unknown
+func NodeUnreachableSince(node *v1.Node) (time.Time, bool) {
+	_, condition := GetNodeCondition(&node.Status, v1.NodeReady)
+	if condition == nil || condition.Status != v1.ConditionUnknown {
+		return time.Time{}, false
+	}
+	return condition.LastTransitionTime.Time, true
+}
+
+// KeepReachable returns whether the workloads on the unreachable node are kept at now, and when the grace
+// period of the policy expires if it has not yet
+func (p Policy) KeepReachable(unitLister crdv1listers.NodeUnitLister, node *v1.Node, now time.Time, partitionTimeout time.Duration) (bool, time.Time) {
+	return p.keepReachable(node, now, func() bool {
+		return NodeKeptReachable(unitLister, node, partitionTimeout)
+	})
+}
+
+// KeepReachableVerdict is KeepReachable with the verdict of NodeKeptReachable, computed once for all the
+// workloads of the node
+func (p Policy) KeepReachableVerdict(node *v1.Node, now time.Time, kept bool) (bool, time.Time) {
+	return p.keepReachable(node, now, func() bool {
+		return kept
+	})
+}
+
+func (p Policy) keepReachable(node *v1.Node, now time.Time, kept func() bool) (bool, time.Time) {
+	since, ok := NodeUnreachableSince(node)
+	if !ok || p.Unreachable == UnreachableFailover {
+		return false, time.Time{}
+	}
+	var expiry time.Time
+	if p.GracePeriod > 0 {
+		expiry = since.Add(p.GracePeriod)
+		if !now.Before(expiry) {
+			return false, time.Time{}
+		}
+	}
+	if p.Unreachable == UnreachableRetain || kept() {
+		return true, expiry
+	}
+	return false, time.Time{}
+}
+
+// NodeKeptReachable returns whether the workloads without policy are kept on the unreachable node: edge-health
+// did not vote it unhealthy, or its NodeUnit is partitioned from the cloud
+func NodeKeptReachable(unitLister crdv1listers.NodeUnitLister, node *v1.Node, partitionTimeout time.Duration) bool {
+	return !NodeEdgeUnhealthy(node) || NodeCloudPartitioned(unitLister, node, partitionTimeout)
+}
+
+// NamespacePolicy returns the policy of the namespace, the invalid annotations are ignored
+func NamespacePolicy(nsLister corelisters.NamespaceLister, namespace string) Policy {
+	if nsLister == nil {
+		return Policy{}
+	}
+	ns, err := nsLister.Get(namespace)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			klog.Errorf("get namespace %s err: %v", namespace, err)
+		}
+		return Policy{}
+	}
+	policy, err := ParsePolicy(ns.Annotations, Policy{})
+	if err != nil {
+		klog.Errorf("namespace %s: %v", namespace, err)
+	}
+	return policy
+}
+
+// ServicePolicy returns the policy of the endpoints of the service, the invalid annotations are ignored
+func ServicePolicy(nsLister corelisters.NamespaceLister, svcLister corelisters.ServiceLister, namespace, name string) Policy {
+	policy := NamespacePolicy(nsLister, namespace)
+	if svcLister == nil || name == "" {
+		return policy
+	}
+	svc, err := svcLister.Services(namespace).Get(name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			klog.Errorf("get service %s/%s err: %v", namespace, name, err)
+		}
+		return policy
+	}
+	if p, err := ParsePolicy(svc.Annotations, policy); err != nil {
+		klog.Errorf("service %s/%s: %v", namespace, name, err)
+	} else {
+		policy = p
+	}
+	return policy
+}
+
+// PodPolicy returns the eviction policy of the pod in namespace
+func PodPolicy(nsLister corelisters.NamespaceLister, namespace string, pod *v1.Pod) (Policy, error) {
+	return ParsePolicy(pod.Annotations, NamespacePolicy(nsLister, namespace))
+}
@@ -18,7 +18,14 @@ package util
 
 import (
 	"io/ioutil"
+	"time"
+
+	"github.com/superedge/superedge/pkg/edge-health/common"
+	sitev1alpha2 "github.com/superedge/superedge/pkg/site-manager/apis/site.superedge.io/v1alpha2"
+	siteconst "github.com/superedge/superedge/pkg/site-manager/constant"
+	crdv1listers "github.com/superedge/superedge/pkg/site-manager/generated/listers/site.superedge.io/v1alpha2"
 	"k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
 )
 
 func GetCABundle(certFile string) ([]byte, error) {
@@ -66,6 +73,56 @@ func TaintExistsPosition(taints []v1.Taint, taintToFind *v1.Taint) (int, bool) {
 	return -1, false
 }
 
+// NodeEdgeUnhealthy returns whether edge-health voted the node unhealthy. The EdgeHealthy condition is
+// preferred, the nodeunhealth annotation is read for the nodes checked by old edge-health.
+func NodeEdgeUnhealthy(node *v1.Node) bool {
+	if _, condition := GetNodeCondition(&node.Status, common.EdgeHealthyCondition); condition != nil {
+		return condition.Status == v1.ConditionFalse
+	}
+	_, ok := node.Annotations[common.NodeUnhealthAnnotation]
+	return ok
+}
+
+// NodeCloudPartitioned returns whether a NodeUnit of the node is partitioned from the cloud, evicting its pods
+// is futile then. The NodeUnits are read from the shared informer, the admission and the evictor ask for every
+// address and pod of the unreachable nodes.
+func NodeCloudPartitioned(unitLister crdv1listers.NodeUnitLister, node *v1.Node, timeout time.Duration) bool {
+	if unitLister == nil {
+		return false
+	}
+	for unit, v := range node.Labels {
+		if v != siteconst.NodeUnitSuperedge {
+			continue
+		}
+		nu, err := unitLister.Get(unit)
+		if err != nil {
+			klog.Errorf("get NodeUnit %s of node %s err: %v", unit, node.Name, err)
+			continue
+		}
+		if UnitCloudPartitioned(&nu.Status, time.Now(), timeout) {
+			klog.V(4).Infof("node %s is in NodeUnit %s partitioned from the cloud", node.Name, unit)
+			return true
+		}
+	}
+	return false
+}
+
+// UnitCloudPartitioned returns whether the CloudPartitioned condition is true and refreshed in timeout. A NodeUnit cut
+// from the cloud as a whole keeps it refreshed by site-manager. A stale condition is not trusted: edge-health or
+// site-manager may be gone, and the workloads of the NodeUnit are failed over.
+func UnitCloudPartitioned(status *sitev1alpha2.NodeUnitStatus, now time.Time, timeout time.Duration) bool {
+	for _, condition := range status.Conditions {
+		if condition.Type != sitev1alpha2.NodeUnitCloudPartitioned {
+			continue
+		}
+		if condition.Status != sitev1alpha2.ConditionTrue {
+			return false
+		}
+		return timeout <= 0 || now.Sub(condition.LastProbeTime.Time) <= timeout
+	}
+	return false
+}
+
 // GetNodeCondition extracts the provided condition from the given status and returns that.
 // Returns nil and -1 if the condition is not present, and the index of the located condition.
 func GetNodeCondition(status *v1.NodeStatus, conditionType v1.NodeConditionType) (int, *v1.NodeCondition) {
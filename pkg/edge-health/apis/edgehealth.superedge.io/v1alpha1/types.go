@@ -0,0 +1,127 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HealthCheckPolicyResource is the resource name of HealthCheckPolicy
+const HealthCheckPolicyResource = "healthcheckpolicies"
+
+type CheckType string
+
+const (
+	// CheckTypeKubelet sends HEAD /healthz to the kubelet read-only port
+	CheckTypeKubelet CheckType = "Kubelet"
+	// CheckTypeKubeletAuth sends GET /healthz to the kubelet secure port with the service account token
+	CheckTypeKubeletAuth CheckType = "KubeletAuth"
+	// CheckTypePing dials the port, it is kept for the compatibility with the pingplugin flag
+	CheckTypePing CheckType = "Ping"
+	// CheckTypeTCP dials the port
+	CheckTypeTCP CheckType = "TCP"
+	// CheckTypeHTTPGet sends GET to the port and compares the status code
+	CheckTypeHTTPGet CheckType = "HTTPGet"
+	// CheckTypeContainerRuntime asks edge-health on the checked node to connect to the container runtime socket
+	CheckTypeContainerRuntime CheckType = "ContainerRuntime"
+	// CheckTypeDiskPressure asks edge-health on the checked node for the usage of a filesystem
+	CheckTypeDiskPressure CheckType = "DiskPressure"
+)
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// HealthCheckPolicy declares the checks edge-health runs on the nodes of the selected NodeUnits, it
+// replaces the check plugins given by the command-line flags
+type HealthCheckPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec HealthCheckPolicySpec `json:"spec,omitempty"`
+}
+
+type HealthCheckPolicySpec struct {
+	// NodeUnits are the names of the NodeUnits whose nodes use the policy, the policy applies to the
+	// nodes not selected by other policies when it is empty
+	NodeUnits []string `json:"nodeUnits,omitempty"`
+	// ScoreLine is the score a node needs to be normal, defaults to 100
+	ScoreLine *float64 `json:"scoreLine,omitempty"`
+	Checks    []Check  `json:"checks"`
+	// Vote overrides the vote flags of the nodes using the policy
+	Vote *VotePolicy `json:"vote,omitempty"`
+}
+
+// VotePolicy decides when the verdict of a node changes. A verdict is reached when more than the threshold of
+// the checking nodes agree, and the state of the node changes after the same verdict in consecutive rounds.
+type VotePolicy struct {
+	// UnhealthyThreshold is the fraction of the checking nodes in [0, 1) to exceed for an unhealthy verdict
+	UnhealthyThreshold *float64 `json:"unhealthyThreshold,omitempty"`
+	// HealthyThreshold is the fraction of the checking nodes in [0, 1) to exceed for a healthy verdict
+	HealthyThreshold *float64 `json:"healthyThreshold,omitempty"`
+	// UnhealthyRounds is the number of consecutive unhealthy verdicts marking a node unhealthy
+	UnhealthyRounds int `json:"unhealthyRounds,omitempty"`
+	// HealthyRounds is the number of consecutive healthy verdicts marking a node recovered
+	HealthyRounds int `json:"healthyRounds,omitempty"`
+}
+
+type Check struct {
+	// Name is unique in the policy, the scores of a check are stored under its name
+	Name string    `json:"name"`
+	Type CheckType `json:"type"`
+	// Weight multiplies the score of the check, which is 100 when the check succeeds
+	Weight float64 `json:"weight"`
+	// TimeoutSeconds defaults to 5
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+	// RetryTime defaults to 3
+	RetryTime int `json:"retryTime,omitempty"`
+	// Port is required by TCP, Ping and HTTPGet checks, Kubelet and KubeletAuth checks default to 10255 and 10250
+	Port int `json:"port,omitempty"`
+
+	HTTPGet          *HTTPGetCheck          `json:"httpGet,omitempty"`
+	ContainerRuntime *ContainerRuntimeCheck `json:"containerRuntime,omitempty"`
+	DiskPressure     *DiskPressureCheck     `json:"diskPressure,omitempty"`
+}
+
+type HTTPGetCheck struct {
+	// Scheme is HTTP or HTTPS, defaults to HTTP. The certificate of HTTPS is not verified
+	Scheme string `json:"scheme,omitempty"`
+	// Path defaults to /
+	Path string `json:"path,omitempty"`
+	// ExpectedStatus defaults to 200
+	ExpectedStatus int `json:"expectedStatus,omitempty"`
+}
+
+type ContainerRuntimeCheck struct {
+	// Socket is the path of the container runtime socket in edge-health, defaults to /run/containerd/containerd.sock
+	Socket string `json:"socket,omitempty"`
+}
+
+type DiskPressureCheck struct {
+	// Path is a path on the filesystem in edge-health, defaults to /
+	Path string `json:"path,omitempty"`
+	// ThresholdPercent is the usage at which the check fails, defaults to 90
+	ThresholdPercent int `json:"thresholdPercent,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type HealthCheckPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []HealthCheckPolicy `json:"items"`
+}
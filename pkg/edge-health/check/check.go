@@ -17,12 +17,17 @@ limitations under the License.
 package check
 
 import (
+	"fmt"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/superedge/superedge/pkg/edge-health/checkplugin"
 	"github.com/superedge/superedge/pkg/edge-health/common"
 	"github.com/superedge/superedge/pkg/edge-health/data"
+	"github.com/superedge/superedge/pkg/edge-health/metrics"
+	"github.com/superedge/superedge/pkg/edge-health/timeline"
 	siteconst "github.com/superedge/superedge/pkg/site-manager/constant"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -37,6 +42,7 @@ type Check interface {
 	GetNodeList()
 	Check()
 	AddCheckPlugin(plugins []checkplugin.CheckPlugin)
+	SetCheckPlugins(plugins []checkplugin.CheckPlugin, healthCheckScoreLine float64)
 	CheckPluginsLen() int
 	GetHealthCheckPeriod() int
 }
@@ -45,6 +51,10 @@ type CheckEdge struct {
 	HealthCheckPeriod    int
 	CheckPlugins         map[string]checkplugin.CheckPlugin
 	HealthCheckScoreLine float64
+	// the plugins and the score line are replaced when a HealthCheckPolicy changes
+	lock sync.RWMutex
+	// the last result of the checks of this node on each peer, a change is recorded in the timeline
+	normals map[string]bool
 }
 
 func NewCheckEdge(checkplugins []checkplugin.CheckPlugin, healthcheckperiod int, healthCheckScoreLine float64) Check {
@@ -52,7 +62,7 @@ func NewCheckEdge(checkplugins []checkplugin.CheckPlugin, healthcheckperiod int,
 	for _, v := range checkplugins {
 		m[v.Name()] = v
 	}
-	return CheckEdge{
+	return &CheckEdge{
 		HealthCheckPeriod:    healthcheckperiod,
 		HealthCheckScoreLine: healthCheckScoreLine,
 		CheckPlugins:         m,
@@ -60,7 +70,7 @@ func NewCheckEdge(checkplugins []checkplugin.CheckPlugin, healthcheckperiod int,
 
 }
 
-func (c CheckEdge) GetNodeList() {
+func (c *CheckEdge) GetNodeList() {
 	var host *metav1.PartialObjectMetadata
 
 	masterSelector := labels.NewSelector()
@@ -164,48 +174,109 @@ func (c CheckEdge) GetNodeList() {
 		}
 	}
 
+	for k := range data.Uplink.CopyUplinkAll() {
+		if _, ok := iplist[k]; !ok && k != common.NodeIP {
+			data.Uplink.DeleteUplink(k)
+		}
+	}
+
 	klog.V(4).Infof("GetNodeList: checkinfo is %v", data.CheckInfoResult)
 }
 
-func (c CheckEdge) CheckPluginsLen() int {
+func (c *CheckEdge) CheckPluginsLen() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
 	return len(c.CheckPlugins)
 }
 
-func (c CheckEdge) GetHealthCheckPeriod() int {
+func (c *CheckEdge) GetHealthCheckPeriod() int {
 	return c.HealthCheckPeriod
 }
 
-func (c CheckEdge) Check() {
+func (c *CheckEdge) Check() {
+	c.lock.RLock()
+	checkPlugins, scoreLine := c.GetCheckPlugins(), c.HealthCheckScoreLine
+	c.lock.RUnlock()
+
 	wg := sync.WaitGroup{}
-	wg.Add(c.CheckPluginsLen())
-	for _, plugin := range c.GetCheckPlugins() {
-		go plugin.CheckExecute(&wg)
+	wg.Add(len(checkPlugins))
+	for _, plugin := range checkPlugins {
+		go func(plugin checkplugin.CheckPlugin) {
+			start := time.Now()
+			pluginwg := sync.WaitGroup{}
+			pluginwg.Add(1)
+			plugin.CheckExecute(&pluginwg)
+			metrics.CheckDuration.WithLabelValues(plugin.Name()).Observe(time.Since(start).Seconds())
+			wg.Done()
+		}(plugin)
 	}
 	wg.Wait()
 	klog.V(4).Info("check finished")
 	klog.V(4).Infof("healthcheck: after health check, checkinfo is %v", data.CheckInfoResult.CheckInfo)
 
 	calculatetemp := data.CheckInfoResult.CopyCheckInfo()
+	normals := make(map[string]bool, len(calculatetemp))
 	for desip, plugins := range calculatetemp {
 		totalscore := 0.0
-		for _, score := range plugins {
-			totalscore += score
+		var failed []string
+		for name, score := range plugins {
+			// the scores of the plugins removed by a policy change are left in checkinfo
+			if _, ok := checkPlugins[name]; ok {
+				totalscore += score
+				if score == 0 {
+					failed = append(failed, name)
+					metrics.CheckFailures.WithLabelValues(name).Inc()
+				}
+			}
 		}
-		if totalscore >= c.HealthCheckScoreLine {
-			data.Result.SetResultFromCheckInfo(common.NodeIP, desip, data.ResultDetail{Normal: true})
-		} else {
-			data.Result.SetResultFromCheckInfo(common.NodeIP, desip, data.ResultDetail{Normal: false})
+		normal := totalscore >= scoreLine
+		data.Result.SetResultFromCheckInfo(common.NodeIP, desip, data.ResultDetail{Normal: normal})
+		metrics.CheckScore.WithLabelValues(desip).Set(totalscore)
+		metrics.VotesCast.WithLabelValues(metrics.Vote(normal)).Inc()
+
+		normals[desip] = normal
+		if last, ok := c.normals[desip]; !ok || last != normal {
+			sort.Strings(failed)
+			timeline.Default.Record(desip, timeline.EventCheck, normal,
+				fmt.Sprintf("checked by %s, score %v of score line %v, failed checks: %v", common.NodeIP, totalscore, scoreLine, failed))
 		}
 	}
+	for desip := range c.normals {
+		if _, ok := normals[desip]; !ok {
+			metrics.CheckScore.DeleteLabelValues(desip)
+		}
+	}
+	c.normals = normals
 	klog.V(6).Infof("healthcheck: after health check, result is %v", data.Result.GetResultDataAll())
 }
 
-func (c CheckEdge) AddCheckPlugin(plugins []checkplugin.CheckPlugin) {
+func (c *CheckEdge) AddCheckPlugin(plugins []checkplugin.CheckPlugin) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	m := c.GetCheckPlugins()
 	for _, p := range plugins {
-		c.CheckPlugins[p.Name()] = p
+		m[p.Name()] = p
 	}
+	c.CheckPlugins = m
 }
 
-func (c CheckEdge) GetCheckPlugins() map[string]checkplugin.CheckPlugin {
-	return c.CheckPlugins
+// SetCheckPlugins replaces the plugins and the score line, the checks running keep the old ones
+func (c *CheckEdge) SetCheckPlugins(plugins []checkplugin.CheckPlugin, healthCheckScoreLine float64) {
+	m := make(map[string]checkplugin.CheckPlugin, len(plugins))
+	for _, p := range plugins {
+		m[p.Name()] = p
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.CheckPlugins = m
+	c.HealthCheckScoreLine = healthCheckScoreLine
+}
+
+// GetCheckPlugins returns a copy of the plugins, the caller holds the lock
+func (c *CheckEdge) GetCheckPlugins() map[string]checkplugin.CheckPlugin {
+	m := make(map[string]checkplugin.CheckPlugin, len(c.CheckPlugins))
+	for name, p := range c.CheckPlugins {
+		m[name] = p
+	}
+	return m
 }
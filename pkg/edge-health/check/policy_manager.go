@@ -0,0 +1,259 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package check
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/superedge/superedge/pkg/edge-health/apis/edgehealth.superedge.io/v1alpha1"
+	"github.com/superedge/superedge/pkg/edge-health/checkplugin"
+	"github.com/superedge/superedge/pkg/edge-health/common"
+	siteconst "github.com/superedge/superedge/pkg/site-manager/constant"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	runtimeutil "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+var PolicyManager *PolicyController
+
+// PolicyController applies the HealthCheckPolicy selecting this node to the check, the plugins given by the
+// flags are used when no policy selects the node
+type PolicyController struct {
+	PolicyInformer cache.SharedIndexInformer
+	PolicyLister   cache.GenericLister
+	PolicySynced   cache.InformerSynced
+
+	check            Check
+	defaultPlugins   []checkplugin.CheckPlugin
+	defaultScoreLine float64
+
+	lock sync.Mutex
+	// name and resourceVersion of the policy applied, empty when the defaults are applied
+	applied    string
+	votePolicy *v1alpha1.VotePolicy
+}
+
+func NewPolicyController(dynamicClient dynamic.Interface, check Check, defaultPlugins []checkplugin.CheckPlugin, defaultScoreLine float64) *PolicyController {
+	genericInformer := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 10*time.Minute).
+		ForResource(v1alpha1.SchemeGroupVersion.WithResource(v1alpha1.HealthCheckPolicyResource))
+
+	p := &PolicyController{
+		PolicyInformer:   genericInformer.Informer(),
+		PolicyLister:     genericInformer.Lister(),
+		check:            check,
+		defaultPlugins:   defaultPlugins,
+		defaultScoreLine: defaultScoreLine,
+	}
+	p.PolicyInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { p.Sync() },
+		UpdateFunc: func(old, cur interface{}) { p.Sync() },
+		DeleteFunc: func(obj interface{}) { p.Sync() },
+	})
+	p.PolicySynced = p.PolicyInformer.HasSynced
+	PolicyManager = p
+	return p
+}
+
+// Sync applies the policy selecting this node if it changed, the node may move to another NodeUnit too
+func (p *PolicyController) Sync() {
+	if !p.PolicySynced() {
+		return
+	}
+	nodeUnits, err := p.nodeUnits()
+	if err != nil {
+		klog.Errorf("get NodeUnits of node %s err: %v", common.NodeName, err)
+		return
+	}
+	objs, err := p.PolicyLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("list HealthCheckPolicy err: %v", err)
+		return
+	}
+	var policies []*v1alpha1.HealthCheckPolicy
+	for _, obj := range objs {
+		policy, err := toHealthCheckPolicy(obj)
+		if err != nil {
+			klog.ErrorS(err, "failed to convert HealthCheckPolicy")
+			continue
+		}
+		policies = append(policies, policy)
+	}
+	policy := SelectPolicy(policies, nodeUnits)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	applied := ""
+	if policy != nil {
+		applied = policy.Name + "/" + policy.ResourceVersion
+	}
+	if applied == p.applied {
+		return
+	}
+	// an invalid policy is not retried until it changes, the plugins applied before are kept
+	p.applied = applied
+
+	if policy == nil {
+		p.check.SetCheckPlugins(p.defaultPlugins, p.defaultScoreLine)
+		checkplugin.SetLocalChecks(nil)
+		p.votePolicy = nil
+		klog.V(2).Infof("no HealthCheckPolicy selects node %s, use the plugins of the flags", common.NodeName)
+		return
+	}
+	plugins, err := checkplugin.NewPlugins(policy.Spec.Checks)
+	if err == nil {
+		err = validateVotePolicy(policy.Spec.Vote)
+	}
+	if err != nil {
+		klog.Errorf("HealthCheckPolicy %s is invalid, keep the current plugins: %v", policy.Name, err)
+		return
+	}
+	scoreLine := p.defaultScoreLine
+	if policy.Spec.ScoreLine != nil {
+		scoreLine = *policy.Spec.ScoreLine
+	}
+	p.check.SetCheckPlugins(plugins, scoreLine)
+	checkplugin.SetLocalChecks(plugins)
+	p.votePolicy = policy.Spec.Vote.DeepCopy()
+	klog.V(2).Infof("apply HealthCheckPolicy %s with %d checks, score line %v", applied, len(plugins), scoreLine)
+}
+
+// VotePolicy returns the vote overrides of the policy applied, nil when there are none
+func (p *PolicyController) VotePolicy() *v1alpha1.VotePolicy {
+	if p == nil {
+		return nil
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.votePolicy.DeepCopy()
+}
+
+func validateVotePolicy(vote *v1alpha1.VotePolicy) error {
+	if vote == nil {
+		return nil
+	}
+	for _, threshold := range []*float64{vote.UnhealthyThreshold, vote.HealthyThreshold} {
+		if threshold != nil && (*threshold < 0 || *threshold >= 1) {
+			return fmt.Errorf("vote threshold %v is not in [0, 1)", *threshold)
+		}
+	}
+	if vote.UnhealthyRounds < 0 || vote.HealthyRounds < 0 {
+		return fmt.Errorf("vote rounds must not be negative")
+	}
+	return nil
+}
+
+func (p *PolicyController) nodeUnits() (map[string]bool, error) {
+	return NodeUnits(common.NodeName)
+}
+
+// NodeUnits returns the NodeUnits of the node, they label the node with their name
+func NodeUnits(nodeName string) (map[string]bool, error) {
+	if NodeMetaManager == nil {
+		return nil, fmt.Errorf("node meta manager is not initialized")
+	}
+	obj, err := NodeMetaManager.NodeMetaILister.Get(nodeName)
+	if err != nil {
+		return nil, err
+	}
+	units := make(map[string]bool)
+	for k, v := range obj.(*metav1.PartialObjectMetadata).Labels {
+		if v == siteconst.NodeUnitSuperedge {
+			units[k] = true
+		}
+	}
+	return units, nil
+}
+
+// NodeUnitMembers returns the names of the nodes of the NodeUnit
+func NodeUnitMembers(unit string) ([]string, error) {
+	if NodeMetaManager == nil {
+		return nil, fmt.Errorf("node meta manager is not initialized")
+	}
+	selector := labels.SelectorFromSet(labels.Set{unit: siteconst.NodeUnitSuperedge})
+	objs, err := NodeMetaManager.NodeMetaILister.List(selector)
+	if err != nil {
+		return nil, err
+	}
+	var members []string
+	for _, obj := range objs {
+		members = append(members, obj.(*metav1.PartialObjectMetadata).Name)
+	}
+	return members, nil
+}
+
+// SelectPolicy returns the policy of a node in nodeUnits. The policies naming one of the NodeUnits win over
+// the policies without NodeUnits, the first by name wins among them.
+func SelectPolicy(policies []*v1alpha1.HealthCheckPolicy, nodeUnits map[string]bool) *v1alpha1.HealthCheckPolicy {
+	sorted := make([]*v1alpha1.HealthCheckPolicy, len(policies))
+	copy(sorted, policies)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	var fallback *v1alpha1.HealthCheckPolicy
+	for _, policy := range sorted {
+		if len(policy.Spec.NodeUnits) == 0 {
+			if fallback == nil {
+				fallback = policy
+			}
+			continue
+		}
+		for _, unit := range policy.Spec.NodeUnits {
+			if nodeUnits[unit] {
+				return policy
+			}
+		}
+	}
+	return fallback
+}
+
+func (p *PolicyController) Run(ctx context.Context) {
+	defer runtimeutil.HandleCrash()
+
+	go p.PolicyInformer.Run(ctx.Done())
+
+	if ok := cache.WaitForCacheSync(
+		ctx.Done(),
+		p.PolicySynced,
+	); !ok {
+		klog.Error("failed to wait for HealthCheckPolicy caches to sync")
+		return
+	}
+
+	// the labels of the node are not watched, the NodeUnits of the node are checked periodically
+	wait.Until(p.Sync, common.ReListTime, ctx.Done())
+}
+
+func toHealthCheckPolicy(obj runtime.Object) (*v1alpha1.HealthCheckPolicy, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object type %T", obj)
+	}
+	policy := &v1alpha1.HealthCheckPolicy{}
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), policy)
+	return policy, err
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package check
+
+import (
+	"testing"
+
+	"github.com/superedge/superedge/pkg/edge-health/apis/edgehealth.superedge.io/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newPolicy(name string, units ...string) *v1alpha1.HealthCheckPolicy {
+	return &v1alpha1.HealthCheckPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       v1alpha1.HealthCheckPolicySpec{NodeUnits: units},
+	}
+}
+
+func TestSelectPolicy(t *testing.T) {
+	policies := []*v1alpha1.HealthCheckPolicy{
+		newPolicy("z-default"),
+		newPolicy("b-default"),
+		newPolicy("unit-b", "unit2", "unit3"),
+		newPolicy("unit-a", "unit1"),
+		newPolicy("unit-c", "unit3"),
+	}
+	testcases := []struct {
+		description string
+		nodeUnits   map[string]bool
+		expected    string
+	}{
+		{"node without NodeUnits uses the first policy without NodeUnits", nil, "b-default"},
+		{"node in an unselected NodeUnit", map[string]bool{"unit4": true}, "b-default"},
+		{"node in a selected NodeUnit", map[string]bool{"unit1": true}, "unit-a"},
+		{"node in NodeUnits of several policies uses the first by name", map[string]bool{"unit3": true}, "unit-b"},
+	}
+	for _, tc := range testcases {
+		policy := SelectPolicy(policies, tc.nodeUnits)
+		if policy == nil || policy.Name != tc.expected {
+			t.Errorf("%s: expected %s, got %v", tc.description, tc.expected, policy)
+		}
+	}
+	if policy := SelectPolicy(policies[2:], nil); policy != nil {
+		t.Errorf("expected no policy, got %s", policy.Name)
+	}
+}
@@ -93,11 +93,17 @@ func NewPluginInfo() Plugin {
 	return PluginInfo
 }
 
+// AddPlugin adds the plugin, a plugin with the same name is replaced so merging a registry again does not add it twice
 func (p *Plugin) AddPlugin(plugin CheckPlugin) {
 	PluginMu.Lock()
 	defer PluginMu.Unlock()
-	// TODO: should check plugin is it exist or not, now have a logic bug
-	// plugins can be add many times since it is only a slice, you could check on the ut TestMerge
+	for i, existing := range p.Plugins {
+		if existing.Name() == plugin.Name() {
+			p.Plugins[i] = plugin
+			klog.V(4).Infof("replace plugin %s", plugin.Name())
+			return
+		}
+	}
 	p.Plugins = append(p.Plugins, plugin)
 	klog.V(4).Info("add ok")
 }
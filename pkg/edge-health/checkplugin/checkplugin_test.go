@@ -123,9 +123,14 @@ func TestMerge(t *testing.T) {
 			expected:        1,
 		},
 		{
-			description:     "two mock registry",
+			description:     "merge the first registry again with another one",
 			registryToMerge: []Registry{m1, m2},
-			expected:        3,
+			expected:        2,
+		},
+		{
+			description:     "merge both registries twice",
+			registryToMerge: []Registry{m1, m2, m1, m2},
+			expected:        2,
 		},
 	}
 
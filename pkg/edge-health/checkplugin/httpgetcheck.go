@@ -0,0 +1,74 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checkplugin
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// HTTPGetCheckPlugin sends GET to a port of the checked node and expects the status code
+type HTTPGetCheckPlugin struct {
+	BasePlugin
+	Scheme         string
+	Path           string
+	ExpectedStatus int
+}
+
+func (p HTTPGetCheckPlugin) Name() string {
+	return p.PluginName
+}
+
+func (plugin HTTPGetCheckPlugin) CheckExecute(wg *sync.WaitGroup) {
+	defer wg.Done()
+	client := plugin.client()
+	checkNodes(plugin, plugin.HealthCheckRetryTime, func(checkedIp string) error {
+		return plugin.get(client, checkedIp)
+	})
+}
+
+func (plugin HTTPGetCheckPlugin) client() http.Client {
+	return http.Client{
+		Timeout: time.Duration(plugin.HealthCheckoutTimeOut) * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		},
+	}
+}
+
+func (plugin HTTPGetCheckPlugin) get(client http.Client, checkedIp string) error {
+	url := plugin.Scheme + "://" + net.JoinHostPort(checkedIp, strconv.Itoa(plugin.Port)) + plugin.Path
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode != plugin.ExpectedStatus {
+		return fmt.Errorf("get %s failed, StatusCode is %d, expected %d", url, resp.StatusCode, plugin.ExpectedStatus)
+	}
+	return nil
+}
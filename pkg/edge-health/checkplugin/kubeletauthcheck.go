@@ -36,6 +36,9 @@ type KubeletAuthCheckPlugin struct {
 }
 
 func (p KubeletAuthCheckPlugin) Name() string {
+	if p.PluginName != "" {
+		return p.PluginName
+	}
 	return "KubeletAuthCheck"
 }
 
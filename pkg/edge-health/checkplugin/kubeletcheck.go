@@ -34,6 +34,9 @@ type KubeletCheckPlugin struct {
 }
 
 func (p KubeletCheckPlugin) Name() string {
+	if p.PluginName != "" {
+		return p.PluginName
+	}
 	return "KubeletCheck"
 }
 
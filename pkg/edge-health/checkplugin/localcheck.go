@@ -0,0 +1,210 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checkplugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/superedge/superedge/pkg/edge-health/apis/edgehealth.superedge.io/v1alpha1"
+	"k8s.io/klog/v2"
+)
+
+// The container runtime socket and the disk of a node can only be checked on the node itself, so the
+// ContainerRuntime and DiskPressure checks ask edge-health on the checked node through /localcheck
+
+const localDialTimeout = 2 * time.Second
+
+// LocalCheckClient returns the client and the url of /localcheck of edge-health running on the node, it is set by the daemon
+var LocalCheckClient func(nodeIP string, timeout time.Duration) (*http.Client, string, error)
+
+type LocalCheckResult struct {
+	Normal  bool   `json:"normal"`
+	Message string `json:"message,omitempty"`
+}
+
+var (
+	localCheckMu sync.RWMutex
+	// the sockets and paths declared by the current checks, /localcheck does not touch anything else
+	localSockets = map[string]bool{}
+	localPaths   = map[string]bool{}
+)
+
+// SetLocalChecks allows /localcheck to answer the ContainerRuntime and DiskPressure checks in plugins
+func SetLocalChecks(plugins []CheckPlugin) {
+	sockets, paths := map[string]bool{}, map[string]bool{}
+	for _, p := range plugins {
+		switch plugin := p.(type) {
+		case *ContainerRuntimeCheckPlugin:
+			sockets[plugin.Socket] = true
+		case *DiskPressureCheckPlugin:
+			paths[plugin.Path] = true
+		}
+	}
+	localCheckMu.Lock()
+	defer localCheckMu.Unlock()
+	localSockets, localPaths = sockets, paths
+}
+
+// HandleLocalCheck checks the container runtime socket or the disk usage of this node
+func HandleLocalCheck(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var result LocalCheckResult
+	switch v1alpha1.CheckType(q.Get("type")) {
+	case v1alpha1.CheckTypeContainerRuntime:
+		socket := q.Get("socket")
+		if !localCheckAllowed(localSockets, socket) {
+			http.Error(w, "socket "+socket+" is not declared by a check", http.StatusForbidden)
+			return
+		}
+		if err := dialSocket(socket); err != nil {
+			result.Message = err.Error()
+		} else {
+			result.Normal = true
+		}
+	case v1alpha1.CheckTypeDiskPressure:
+		path := q.Get("path")
+		if !localCheckAllowed(localPaths, path) {
+			http.Error(w, "path "+path+" is not declared by a check", http.StatusForbidden)
+			return
+		}
+		threshold, err := strconv.Atoi(q.Get("threshold"))
+		if err != nil {
+			http.Error(w, "Invalid threshold", http.StatusBadRequest)
+			return
+		}
+		usage, err := diskUsage(path)
+		if err != nil {
+			result.Message = err.Error()
+		} else if usage >= threshold {
+			result.Message = fmt.Sprintf("usage of %s is %d%%, threshold is %d%%", path, usage, threshold)
+		} else {
+			result.Normal = true
+		}
+	default:
+		http.Error(w, "Invalid Type", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		klog.Errorf("write local check response err: %v", err)
+	}
+}
+
+func localCheckAllowed(allowed map[string]bool, key string) bool {
+	localCheckMu.RLock()
+	defer localCheckMu.RUnlock()
+	return allowed[key]
+}
+
+func dialSocket(socket string) error {
+	conn, err := net.DialTimeout("unix", socket, localDialTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// diskUsage returns the used percent of the filesystem like df, the blocks reserved for root are not available
+func diskUsage(path string) (int, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	used := st.Blocks - st.Bfree
+	if used+st.Bavail == 0 {
+		return 0, fmt.Errorf("filesystem of %s has no blocks", path)
+	}
+	return int((used*100 + used + st.Bavail - 1) / (used + st.Bavail)), nil
+}
+
+// localCheck asks edge-health on the checked node to run a check
+func localCheck(timeout time.Duration, checkedIp string, query url.Values) error {
+	if LocalCheckClient == nil {
+		return fmt.Errorf("address of edge-health on %s is unknown", checkedIp)
+	}
+	client, localCheckURL, err := LocalCheckClient(checkedIp, timeout)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Get(localCheckURL + "?" + query.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("local check on %s failed, StatusCode is %d", checkedIp, resp.StatusCode)
+	}
+	var result LocalCheckResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if !result.Normal {
+		return fmt.Errorf("local check on %s failed: %s", checkedIp, result.Message)
+	}
+	return nil
+}
+
+// ContainerRuntimeCheckPlugin checks that the container runtime socket of the checked node accepts connections
+type ContainerRuntimeCheckPlugin struct {
+	BasePlugin
+	Socket string
+}
+
+func (p ContainerRuntimeCheckPlugin) Name() string {
+	return p.PluginName
+}
+
+func (plugin ContainerRuntimeCheckPlugin) CheckExecute(wg *sync.WaitGroup) {
+	defer wg.Done()
+	timeout := time.Duration(plugin.HealthCheckoutTimeOut) * time.Second
+	query := url.Values{"type": {string(v1alpha1.CheckTypeContainerRuntime)}, "socket": {plugin.Socket}}
+	checkNodes(plugin, plugin.HealthCheckRetryTime, func(checkedIp string) error {
+		return localCheck(timeout, checkedIp, query)
+	})
+}
+
+// DiskPressureCheckPlugin checks that the usage of a filesystem of the checked node is below the threshold
+type DiskPressureCheckPlugin struct {
+	BasePlugin
+	Path             string
+	ThresholdPercent int
+}
+
+func (p DiskPressureCheckPlugin) Name() string {
+	return p.PluginName
+}
+
+func (plugin DiskPressureCheckPlugin) CheckExecute(wg *sync.WaitGroup) {
+	defer wg.Done()
+	timeout := time.Duration(plugin.HealthCheckoutTimeOut) * time.Second
+	query := url.Values{
+		"type":      {string(v1alpha1.CheckTypeDiskPressure)},
+		"path":      {plugin.Path},
+		"threshold": {strconv.Itoa(plugin.ThresholdPercent)},
+	}
+	checkNodes(plugin, plugin.HealthCheckRetryTime, func(checkedIp string) error {
+		return localCheck(timeout, checkedIp, query)
+	})
+}
@@ -34,6 +34,9 @@ type PingCheckPlugin struct {
 }
 
 func (p PingCheckPlugin) Name() string {
+	if p.PluginName != "" {
+		return p.PluginName
+	}
 	return "PingCheck"
 }
 
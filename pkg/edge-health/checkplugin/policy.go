@@ -0,0 +1,166 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checkplugin
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/superedge/superedge/pkg/edge-health/apis/edgehealth.superedge.io/v1alpha1"
+	"github.com/superedge/superedge/pkg/edge-health/common"
+	"github.com/superedge/superedge/pkg/edge-health/data"
+	"k8s.io/klog/v2"
+)
+
+const (
+	DefaultCheckTimeout          = 5
+	DefaultCheckRetryTime        = 3
+	DefaultKubeletPort           = 10255
+	DefaultKubeletAuthPort       = 10250
+	DefaultContainerRuntimeSock  = "/run/containerd/containerd.sock"
+	DefaultDiskPressurePath      = "/"
+	DefaultDiskPressureThreshold = 90
+)
+
+// NewPlugins builds the plugins of the checks declared by a HealthCheckPolicy
+func NewPlugins(checks []v1alpha1.Check) ([]CheckPlugin, error) {
+	var plugins []CheckPlugin
+	names := make(map[string]bool, len(checks))
+	for _, c := range checks {
+		if c.Name == "" {
+			return nil, fmt.Errorf("check of type %s has no name", c.Type)
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("check name %s is duplicated", c.Name)
+		}
+		names[c.Name] = true
+		if c.Weight <= 0 {
+			return nil, fmt.Errorf("weight of check %s must be positive", c.Name)
+		}
+		timeout, retryTime := c.TimeoutSeconds, c.RetryTime
+		if timeout <= 0 {
+			timeout = DefaultCheckTimeout
+		}
+		if retryTime <= 0 {
+			retryTime = DefaultCheckRetryTime
+		}
+		base := NewBasePlugin(timeout, retryTime, c.Port, c.Weight, c.Name)
+
+		switch c.Type {
+		case v1alpha1.CheckTypeKubelet:
+			if base.Port == 0 {
+				base.Port = DefaultKubeletPort
+			}
+			plugins = append(plugins, &KubeletCheckPlugin{BasePlugin: base})
+		case v1alpha1.CheckTypeKubeletAuth:
+			if base.Port == 0 {
+				base.Port = DefaultKubeletAuthPort
+			}
+			plugins = append(plugins, &KubeletAuthCheckPlugin{BasePlugin: base})
+		case v1alpha1.CheckTypePing, v1alpha1.CheckTypeTCP, v1alpha1.CheckTypeHTTPGet:
+			if base.Port <= 0 || base.Port > 65535 {
+				return nil, fmt.Errorf("check %s of type %s needs a valid port", c.Name, c.Type)
+			}
+			switch c.Type {
+			case v1alpha1.CheckTypePing:
+				plugins = append(plugins, &PingCheckPlugin{BasePlugin: base})
+			case v1alpha1.CheckTypeTCP:
+				plugins = append(plugins, &TCPCheckPlugin{BasePlugin: base})
+			default:
+				plugin, err := newHTTPGetCheckPlugin(base, c.HTTPGet)
+				if err != nil {
+					return nil, err
+				}
+				plugins = append(plugins, plugin)
+			}
+		case v1alpha1.CheckTypeContainerRuntime:
+			socket := DefaultContainerRuntimeSock
+			if c.ContainerRuntime != nil && c.ContainerRuntime.Socket != "" {
+				socket = c.ContainerRuntime.Socket
+			}
+			plugins = append(plugins, &ContainerRuntimeCheckPlugin{BasePlugin: base, Socket: socket})
+		case v1alpha1.CheckTypeDiskPressure:
+			path, threshold := DefaultDiskPressurePath, DefaultDiskPressureThreshold
+			if c.DiskPressure != nil {
+				if c.DiskPressure.Path != "" {
+					path = c.DiskPressure.Path
+				}
+				if c.DiskPressure.ThresholdPercent != 0 {
+					threshold = c.DiskPressure.ThresholdPercent
+				}
+			}
+			if threshold <= 0 || threshold > 100 {
+				return nil, fmt.Errorf("thresholdPercent of check %s must be in (0, 100]", c.Name)
+			}
+			plugins = append(plugins, &DiskPressureCheckPlugin{BasePlugin: base, Path: path, ThresholdPercent: threshold})
+		default:
+			return nil, fmt.Errorf("check %s has unknown type %s", c.Name, c.Type)
+		}
+	}
+	return plugins, nil
+}
+
+func newHTTPGetCheckPlugin(base BasePlugin, spec *v1alpha1.HTTPGetCheck) (*HTTPGetCheckPlugin, error) {
+	plugin := &HTTPGetCheckPlugin{BasePlugin: base, Scheme: "http", Path: "/", ExpectedStatus: http.StatusOK}
+	if spec == nil {
+		return plugin, nil
+	}
+	if spec.Scheme != "" {
+		plugin.Scheme = strings.ToLower(spec.Scheme)
+		if plugin.Scheme != "http" && plugin.Scheme != "https" {
+			return nil, fmt.Errorf("check %s has unknown scheme %s", base.PluginName, spec.Scheme)
+		}
+	}
+	if spec.Path != "" {
+		plugin.Path = spec.Path
+		if !strings.HasPrefix(plugin.Path, "/") {
+			plugin.Path = "/" + plugin.Path
+		}
+	}
+	if spec.ExpectedStatus != 0 {
+		plugin.ExpectedStatus = spec.ExpectedStatus
+	}
+	return plugin, nil
+}
+
+// checkNodes runs probe on every checked node and records the scores of the plugin
+func checkNodes(plugin CheckPlugin, retryTime int, probe func(checkedIp string) error) {
+	execwg := sync.WaitGroup{}
+	checkInfo := data.CheckInfoResult.CopyCheckInfo()
+	execwg.Add(len(checkInfo))
+	for k := range checkInfo {
+		go func(checkedIp string) {
+			defer execwg.Done()
+			var err error
+			for i := 0; i < retryTime; i++ {
+				if err = probe(checkedIp); err == nil {
+					break
+				}
+			}
+			if err == nil {
+				klog.V(4).Infof("%s use %s plugin check %s successd", common.NodeIP, plugin.Name(), checkedIp)
+				data.CheckInfoResult.SetCheckInfo(checkedIp, plugin.Name(), plugin.GetWeight(), 100)
+			} else {
+				klog.V(2).Infof("%s use %s plugin check %s failed, reason: %s", common.NodeIP, plugin.Name(), checkedIp, err.Error())
+				data.CheckInfoResult.SetCheckInfo(checkedIp, plugin.Name(), plugin.GetWeight(), 0)
+			}
+		}(k)
+	}
+	execwg.Wait()
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checkplugin
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/superedge/superedge/pkg/edge-health/apis/edgehealth.superedge.io/v1alpha1"
+)
+
+func TestNewPlugins(t *testing.T) {
+	plugins, err := NewPlugins([]v1alpha1.Check{
+		{Name: "kubelet", Type: v1alpha1.CheckTypeKubeletAuth, Weight: 0.5},
+		{Name: "ssh", Type: v1alpha1.CheckTypeTCP, Weight: 0.2, Port: 22, TimeoutSeconds: 1},
+		{Name: "app", Type: v1alpha1.CheckTypeHTTPGet, Weight: 0.1, Port: 8080, HTTPGet: &v1alpha1.HTTPGetCheck{Path: "ready", ExpectedStatus: 204}},
+		{Name: "runtime", Type: v1alpha1.CheckTypeContainerRuntime, Weight: 0.1},
+		{Name: "disk", Type: v1alpha1.CheckTypeDiskPressure, Weight: 0.1, DiskPressure: &v1alpha1.DiskPressureCheck{ThresholdPercent: 80}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(plugins) != 5 {
+		t.Fatalf("expected 5 plugins, got %d", len(plugins))
+	}
+	kubelet := plugins[0].(*KubeletAuthCheckPlugin)
+	if kubelet.Name() != "kubelet" || kubelet.Port != DefaultKubeletAuthPort || kubelet.HealthCheckoutTimeOut != DefaultCheckTimeout || kubelet.HealthCheckRetryTime != DefaultCheckRetryTime {
+		t.Errorf("unexpected defaults of kubelet check %+v", kubelet)
+	}
+	if tcp := plugins[1].(*TCPCheckPlugin); tcp.HealthCheckoutTimeOut != 1 || tcp.GetWeight() != 0.2 {
+		t.Errorf("unexpected tcp check %+v", tcp)
+	}
+	if get := plugins[2].(*HTTPGetCheckPlugin); get.Scheme != "http" || get.Path != "/ready" || get.ExpectedStatus != 204 {
+		t.Errorf("unexpected http check %+v", get)
+	}
+	if runtime := plugins[3].(*ContainerRuntimeCheckPlugin); runtime.Socket != DefaultContainerRuntimeSock {
+		t.Errorf("unexpected container runtime check %+v", runtime)
+	}
+	if disk := plugins[4].(*DiskPressureCheckPlugin); disk.Path != DefaultDiskPressurePath || disk.ThresholdPercent != 80 {
+		t.Errorf("unexpected disk pressure check %+v", disk)
+	}
+
+	invalid := map[string][]v1alpha1.Check{
+		"no name":           {{Type: v1alpha1.CheckTypeTCP, Weight: 1, Port: 22}},
+		"duplicated name":   {{Name: "a", Type: v1alpha1.CheckTypeKubelet, Weight: 1}, {Name: "a", Type: v1alpha1.CheckTypeKubelet, Weight: 1}},
+		"no weight":         {{Name: "a", Type: v1alpha1.CheckTypeKubelet}},
+		"no port":           {{Name: "a", Type: v1alpha1.CheckTypeTCP, Weight: 1}},
+		"unknown type":      {{Name: "a", Type: "Exec", Weight: 1}},
+		"unknown scheme":    {{Name: "a", Type: v1alpha1.CheckTypeHTTPGet, Weight: 1, Port: 80, HTTPGet: &v1alpha1.HTTPGetCheck{Scheme: "ftp"}}},
+		"invalid threshold": {{Name: "a", Type: v1alpha1.CheckTypeDiskPressure, Weight: 1, DiskPressure: &v1alpha1.DiskPressureCheck{ThresholdPercent: 120}}},
+	}
+	for description, checks := range invalid {
+		if _, err := NewPlugins(checks); err == nil {
+			t.Errorf("%s: expected an error", description)
+		}
+	}
+}
+
+func TestHTTPGetCheck(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ready" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+
+	plugin, _ := newHTTPGetCheckPlugin(NewBasePlugin(1, 1, portNum, 1, "app"), &v1alpha1.HTTPGetCheck{Path: "/ready", ExpectedStatus: 204})
+	if err := plugin.get(plugin.client(), host); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	plugin.Path = "/"
+	if err := plugin.get(plugin.client(), host); err == nil {
+		t.Error("expected an error for an unexpected status")
+	}
+}
+
+func TestHandleLocalCheck(t *testing.T) {
+	dir := t.TempDir()
+	SetLocalChecks([]CheckPlugin{&DiskPressureCheckPlugin{Path: dir, ThresholdPercent: 100}})
+	defer SetLocalChecks(nil)
+	srv := httptest.NewServer(http.HandlerFunc(HandleLocalCheck))
+	defer srv.Close()
+	LocalCheckClient = func(string, time.Duration) (*http.Client, string, error) {
+		return srv.Client(), srv.URL + "/localcheck", nil
+	}
+	defer func() { LocalCheckClient = nil }()
+	timeout := time.Second
+
+	disk := url.Values{"type": {string(v1alpha1.CheckTypeDiskPressure)}, "path": {dir}, "threshold": {"100"}}
+	if err := localCheck(timeout, "127.0.0.1", disk); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	disk.Set("threshold", "0")
+	if err := localCheck(timeout, "127.0.0.1", disk); err == nil {
+		t.Error("expected an error when the usage reaches the threshold")
+	}
+	disk.Set("path", "/etc")
+	if err := localCheck(timeout, "127.0.0.1", disk); err == nil {
+		t.Error("a path not declared by a check must be rejected")
+	}
+	runtime := url.Values{"type": {string(v1alpha1.CheckTypeContainerRuntime)}, "socket": {dir + "/runtime.sock"}}
+	if err := localCheck(timeout, "127.0.0.1", runtime); err == nil {
+		t.Error("a socket not declared by a check must be rejected")
+	}
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checkplugin
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TCPCheckPlugin dials a port of the checked node
+type TCPCheckPlugin struct {
+	BasePlugin
+}
+
+func (p TCPCheckPlugin) Name() string {
+	return p.PluginName
+}
+
+func (plugin TCPCheckPlugin) CheckExecute(wg *sync.WaitGroup) {
+	defer wg.Done()
+	checkNodes(plugin, plugin.HealthCheckRetryTime, func(checkedIp string) error {
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(checkedIp, strconv.Itoa(plugin.Port)), time.Duration(plugin.HealthCheckoutTimeOut)*time.Second)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+}
@@ -19,6 +19,8 @@ package common
 import (
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/metadata"
 )
@@ -37,6 +39,25 @@ const (
 	TokenFile        = "/var/run/secrets/kubernetes.io/serviceaccount/token"
 	ReListTime       = 2 * time.Minute
 	DefaultNamespace = "kube-system"
+	// NodeUnhealthAnnotation is added to the nodes voted unhealthy when the compatibility flag is on
+	NodeUnhealthAnnotation = "nodeunhealth"
+)
+
+// The peers of edge-health authenticate each other with the certificates signed by PeerCertSignerName, the signer
+// publishes its CA certificate in the PeerCAConfigMap ConfigMap of the edge-health namespace
+const (
+	PeerCertSignerName   = "superedge.io/edge-health-peer"
+	PeerCertOrganization = "superedge:edge-health"
+	PeerCAConfigMap      = "edge-health-ca"
+	PeerCAKey            = "ca.crt"
+)
+
+// EdgeHealthyCondition is the NodeCondition holding the verdict of the distributed health check
+const (
+	EdgeHealthyCondition corev1.NodeConditionType = "EdgeHealthy"
+
+	EdgeHealthyReasonVotedHealthy   = "VotedHealthy"
+	EdgeHealthyReasonVotedUnhealthy = "VotedUnhealthy"
 )
 
 var (
@@ -49,4 +70,6 @@ var (
 	ClientSet *kubernetes.Clientset
 	// watch node only use metadata client, it will reduce a lot of apiserver bandwidth
 	MetadataClientSet metadata.Interface
+	// watch HealthCheckPolicy
+	DynamicClientSet dynamic.Interface
 )
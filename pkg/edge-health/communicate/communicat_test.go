@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
@@ -128,3 +129,36 @@ func TestHandleProbe(t *testing.T) {
 		}
 	}
 }
+
+func TestHandleProbeLatency(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+	addr := target.Listener.Addr().(*net.TCPAddr)
+
+	ce := &CommunicateEdge{Prober: NewProberManager(2), SourceInfo: &SourceInfo{}}
+	s := httptest.NewServer(http.HandlerFunc(ce.HandleProbe))
+	defer s.Close()
+
+	requestByte, _ := json.Marshal(&Probe{Targets: []*Target{
+		{IP: addr.IP.String(), Port: int32(addr.Port), Protocol: ProtoHTTP},
+		{IP: addr.IP.String(), Port: int32(addr.Port), Protocol: ProtoHTTP, HTTP: &HTTPProbe{ExpectedStatus: http.StatusNoContent}},
+	}})
+	resp, err := http.Post(s.URL, "application/json", bytes.NewReader(requestByte))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var probeResp ProbeResp
+	if err := json.NewDecoder(resp.Body).Decode(&probeResp); err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []bool{true, false} {
+		got := probeResp.Targets[i]
+		if got.Normal == nil || *got.Normal != expected || got.LatencyMs == nil {
+			t.Fatalf("target %d: unexpected result %+v", i, got)
+		}
+		if !expected && got.Error == "" {
+			t.Errorf("target %d: expected the reason of the failure", i)
+		}
+	}
+}
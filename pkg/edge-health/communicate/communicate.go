@@ -22,14 +22,21 @@ import (
 	"encoding/json"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"strconv"
 	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/superedge/superedge/pkg/edge-health/check"
+	"github.com/superedge/superedge/pkg/edge-health/checkplugin"
 	"github.com/superedge/superedge/pkg/edge-health/common"
 	"github.com/superedge/superedge/pkg/edge-health/data"
+	"github.com/superedge/superedge/pkg/edge-health/metrics"
+	"github.com/superedge/superedge/pkg/edge-health/peertls"
+	"github.com/superedge/superedge/pkg/edge-health/timeline"
 	"github.com/superedge/superedge/pkg/edge-health/util"
 	pkgutil "github.com/superedge/superedge/pkg/util"
 	"k8s.io/klog/v2"
@@ -88,12 +95,10 @@ func (c *CommunicateEdge) HandleProbe(w http.ResponseWriter, r *http.Request) {
 	klog.V(6).InfoS("probe request info", "req", string(body))
 	// validate target
 	for _, t := range probe.Targets {
-		if t.Protocol != "" {
-			if _, ok := ProtoSet[t.Protocol]; !ok {
-				klog.ErrorS(err, "Invalid Protocol", "target ip", t.IP, "target port", t.Port, "target protocol", t.Protocol)
-				http.Error(w, "Invalid Protocol "+t.Protocol, http.StatusBadRequest)
-				return
-			}
+		if err := ValidateTarget(t); err != nil {
+			klog.ErrorS(err, "Invalid Target", "target ip", t.IP, "target port", t.Port, "target protocol", t.Protocol)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 		if len(t.Name) > MaxTargetName {
 			klog.ErrorS(err, "Invalid Target Name", "target name", t.Name)
@@ -115,11 +120,16 @@ func (c *CommunicateEdge) HandleProbe(w http.ResponseWriter, r *http.Request) {
 		klog.V(6).InfoS("get piece index", "index", i)
 		t := probe.Targets[i]
 		t.Normal = new(bool)
-		switch t.Protocol {
-		case ProtoTCP:
-			*(t.Normal) = c.Prober.TCPProbe(t.IP, t.Port, c.Prober.ProbeTimeout)
-		case ProtoICMP:
-			*(t.Normal) = c.Prober.ICMPProbe(t.IP, c.Prober.ProbeTimeout)
+		if t.Protocol == "" {
+			return
+		}
+		start := time.Now()
+		err := c.Prober.Probe(t)
+		latency := float64(time.Since(start).Microseconds()) / 1000
+		t.LatencyMs = &latency
+		*(t.Normal) = err == nil
+		if err != nil {
+			t.Error = err.Error()
 		}
 	})
 	probeResp := &ProbeResp{
@@ -147,6 +157,38 @@ func buildSourceInfo() *SourceInfo {
 
 //TODO: 监听端口可变
 func (c *CommunicateEdge) Server(ctx context.Context, wg *sync.WaitGroup) {
+	c.serve(ctx, wg, c.newPeerServeMux())
+}
+
+// newServeMux returns the handlers of the local API, which is always served over HTTP
+func (c *CommunicateEdge) newServeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/flags/v", pkgutil.UpdateLogLevel)
+	mux.HandleFunc("/probe", c.HandleProbe)
+	mux.HandleFunc("/timeline", HandleTimeline)
+	reg := prometheus.NewRegistry()
+	metrics.RegisterMetrics(reg)
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/localinfo", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("fullmesh") != "" {
+			localInfoData := data.Result.GetResultDataAll()
+			if err := json.NewEncoder(w).Encode(localInfoData); err != nil {
+				klog.Errorf("Get local info all:  err: %v", err)
+				return
+			}
+		}
+		localInfoData := data.Result.CopyLocalResultData(common.NodeIP)
+		if err := json.NewEncoder(w).Encode(localInfoData); err != nil {
+			klog.Errorf("Get Local Info: NodeInfo err: %v", err)
+			return
+		}
+	})
+	return mux
+}
+
+// newPeerServeMux returns the handlers called by the peers, they are served over mTLS unless it is disabled
+func (c *CommunicateEdge) newPeerServeMux() *http.ServeMux {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/result", func(w http.ResponseWriter, r *http.Request) {
 		var communicatedata data.CommunicateData
@@ -158,51 +200,118 @@ func (c *CommunicateEdge) Server(ctx context.Context, wg *sync.WaitGroup) {
 		err := json.NewDecoder(r.Body).Decode(&communicatedata)
 		if err != nil {
 			klog.ErrorS(err, "Decode request body error", "request url", r.URL.String())
+			metrics.CommunicationErrors.WithLabelValues(metrics.ReasonDecode).Inc()
 			http.Error(w, "Invalid Body", http.StatusPaymentRequired)
 			return
 		}
 
 		klog.V(4).Infof("Communicate Server: received data from %v : %v", communicatedata.SourceIP, communicatedata.ResultDetail)
-		if hmac, err := util.GenerateHmac(communicatedata); err != nil {
+		if peertls.Manager != nil {
+			if err := peertls.VerifyPeer(r, communicatedata.SourceIP); err != nil {
+				klog.Errorf("Communicate Server: %v", err)
+				metrics.CommunicationErrors.WithLabelValues(metrics.ReasonCertificateMismatch).Inc()
+				http.Error(w, "Certificate not match", http.StatusForbidden)
+				return
+			}
+		} else if hmac, err := util.GenerateHmac(communicatedata); err != nil {
 			klog.Errorf("Communicate Server: server GenerateHmac err: %v", err)
 			http.Error(w, "Hmac not match", http.StatusInternalServerError)
 			return
 		} else {
 			if hmac != communicatedata.Hmac {
 				klog.Errorf("Communicate Server: Hmac not equal, hmac is %s, communicatedata.Hmac is %s", hmac, communicatedata.Hmac)
+				metrics.CommunicationErrors.WithLabelValues(metrics.ReasonHmacMismatch).Inc()
 				http.Error(w, "Hmac not match", http.StatusForbidden)
 				return
 			}
 		}
-		klog.V(4).Infof("Communicate Server: Hmac match")
+		klog.V(4).Infof("Communicate Server: peer authenticated")
 
 		data.Result.SetResult(&communicatedata)
+		countReceivedVotes(communicatedata.ResultDetail)
+		if communicatedata.Uplink != nil {
+			// the uplink is signed apart from the results, a forged uplink is dropped alone
+			if peertls.Manager == nil && !verifyUplinkHmac(communicatedata) {
+				metrics.CommunicationErrors.WithLabelValues(metrics.ReasonHmacMismatch).Inc()
+			} else {
+				data.Uplink.SetUplink(communicatedata.SourceIP, *communicatedata.Uplink)
+			}
+		}
 		klog.V(6).Infof("After communicate, result is %v", data.Result.GetResultDataAll())
 		w.WriteHeader(http.StatusOK)
 	})
+	mux.HandleFunc("/localcheck", checkplugin.HandleLocalCheck)
+	return mux
+}
 
-	mux.HandleFunc("/debug/flags/v", pkgutil.UpdateLogLevel)
-	mux.HandleFunc("/probe", c.HandleProbe)
-	mux.HandleFunc("/localinfo", func(w http.ResponseWriter, r *http.Request) {
-		q := r.URL.Query()
-		if q.Get("fullmesh") != "" {
-			localInfoData := data.Result.GetResultDataAll()
-			if err := json.NewEncoder(w).Encode(localInfoData); err != nil {
-				klog.Errorf("Get local info all:  err: %v", err)
-				return
-			}
-		}
-		localInfoData := data.Result.CopyLocalResultData(common.NodeIP)
-		if err := json.NewEncoder(w).Encode(localInfoData); err != nil {
-			klog.Errorf("Get Local Info: NodeInfo err: %v", err)
+// localUplink returns the uplink of this node sent with the results, it is nil until the uplink is probed
+func localUplink() *data.UplinkStatus {
+	status, ok := data.Uplink.GetUplink(common.NodeIP)
+	if !ok {
+		return nil
+	}
+	// the receivers set the time
+	status.Time = 0
+	return &status
+}
+
+func verifyUplinkHmac(communicatedata data.CommunicateData) bool {
+	hmac, err := util.GenerateUplinkHmac(communicatedata)
+	if err != nil || hmac != communicatedata.UplinkHmac {
+		klog.Errorf("Communicate Server: uplink hmac of %s not match, err: %v", communicatedata.SourceIP, err)
+		return false
+	}
+	return true
+}
+
+func countReceivedVotes(detail map[string]data.ResultDetail) {
+	for _, d := range detail {
+		metrics.VotesReceived.WithLabelValues(metrics.Vote(d.Normal)).Inc()
+	}
+}
+
+// HandleTimeline returns the events of the node in the query, which is a node ip or name, or of all the nodes
+func HandleTimeline(w http.ResponseWriter, r *http.Request) {
+	node := r.URL.Query().Get("node")
+	if node != "" && net.ParseIP(node) == nil {
+		nodeIP, err := check.PodManager.GetNodeIPByNodeName(node)
+		if err != nil {
+			http.Error(w, "Invalid Node "+node, http.StatusNotFound)
 			return
 		}
-	})
+		node = nodeIP
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(timeline.Default.Events(node)); err != nil {
+		klog.Errorf("Timeline: write response err: %v", err)
+	}
+}
 
+// serve serves the local API on the communicate server port, the peer handlers are served on the port of
+// peertls.Manager over mTLS, or on the communicate server port too when mTLS is disabled
+func (c *CommunicateEdge) serve(ctx context.Context, wg *sync.WaitGroup, peerMux *http.ServeMux) {
+	mux := c.newServeMux()
 	srv := &http.Server{
 		Addr:    ":" + strconv.Itoa(c.CommunicateServerPort),
 		Handler: http.Handler(mux),
 	}
+	servers := []*http.Server{srv}
+
+	if peertls.Manager == nil {
+		mux.Handle("/", peerMux)
+	} else {
+		peerSrv := &http.Server{
+			Addr:      ":" + strconv.Itoa(peertls.Manager.Port),
+			Handler:   http.Handler(peerMux),
+			TLSConfig: peertls.Manager.ServerTLSConfig(),
+		}
+		servers = append(servers, peerSrv)
+		go func() {
+			if err := peerSrv.ListenAndServeTLS("", ""); err != http.ErrServerClosed {
+				klog.Fatalf("Server: exit with error: %v", err)
+			}
+		}()
+	}
 
 	go func() {
 		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
@@ -213,8 +322,10 @@ func (c *CommunicateEdge) Server(ctx context.Context, wg *sync.WaitGroup) {
 	for range ctx.Done() {
 		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 		cancel()
-		if err := srv.Shutdown(ctx); err != nil {
-			klog.Errorf("Server: program exit, server exit")
+		for _, s := range servers {
+			if err := s.Shutdown(ctx); err != nil {
+				klog.Errorf("Server: program exit, server exit")
+			}
 		}
 		wg.Done()
 	}
@@ -232,24 +343,38 @@ func (c *CommunicateEdge) Client() {
 			go func(wg *sync.WaitGroup) {
 				if desNodeIP != common.NodeIP {
 					for i := 0; i < c.CommunicateRetryTime; i++ {
-						u := data.CommunicateData{SourceIP: common.NodeIP, ResultDetail: tempCommunicateData}
-						if hmac, err := util.GenerateHmac(u); err != nil {
-							klog.Errorf("Communicate Client: generateHmac err: %v", err)
-						} else {
-							u.Hmac = hmac
+						u := data.CommunicateData{SourceIP: common.NodeIP, ResultDetail: tempCommunicateData, Uplink: localUplink()}
+						// the certificate authenticates the data over mTLS
+						if peertls.Manager == nil {
+							if hmac, err := util.GenerateHmac(u); err != nil {
+								klog.Errorf("Communicate Client: generateHmac err: %v", err)
+							} else {
+								u.Hmac = hmac
+							}
+							if u.Uplink != nil {
+								if hmac, err := util.GenerateUplinkHmac(u); err != nil {
+									klog.Errorf("Communicate Client: generateUplinkHmac err: %v", err)
+								} else {
+									u.UplinkHmac = hmac
+								}
+							}
 						}
 						klog.V(4).Infof("Communicate Client: ready to put data: %v to %s", u, desNodeIP)
 						requestByte, _ := json.Marshal(u)
 						requestReader := bytes.NewReader(requestByte)
 						ok := func() bool {
-							client := http.Client{Timeout: 5 * time.Second}
 							// cause peer edge-health no longer use host network, we need get peer pod ip for communication
 							desPodIP, err := check.PodManager.GetPodIPByNodeIP(desNodeIP)
 							if err != nil {
 								klog.ErrorS(err, "get Peer Pod IP failed")
 								return false
 							}
-							req, err := http.NewRequest("PUT", "http://"+desPodIP+":"+strconv.Itoa(c.CommunicateServerPort)+"/result", requestReader)
+							client, url, err := peertls.NewPeerClient(desNodeIP, desPodIP, c.CommunicateServerPort, "/result", 5*time.Second)
+							if err != nil {
+								klog.Errorf("Communicate Client: desPodIP %s, new client err: %v", desPodIP, err)
+								return false
+							}
+							req, err := http.NewRequest("PUT", url, requestReader)
 							if err != nil {
 								klog.Errorf("Communicate Client: desPodIP %s, NewRequest err: %s", desPodIP, err.Error())
 								return false
@@ -258,6 +383,7 @@ func (c *CommunicateEdge) Client() {
 							res, err := client.Do(req)
 							if err != nil {
 								klog.Errorf("Communicate Client: communicate to desPodIP %s failed %v", desPodIP, err)
+								metrics.CommunicationErrors.WithLabelValues(metrics.ReasonRequest).Inc()
 								return false
 							}
 							defer func() {
@@ -270,6 +396,7 @@ func (c *CommunicateEdge) Client() {
 							}
 							if res.StatusCode != http.StatusOK {
 								klog.Errorf("Communicate Client: httpResponse.StatusCode!=200, is %d", res.StatusCode)
+								metrics.CommunicationErrors.WithLabelValues(metrics.ReasonStatus).Inc()
 								return false
 							}
 
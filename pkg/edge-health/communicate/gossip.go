@@ -0,0 +1,574 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package communicate
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/superedge/superedge/pkg/edge-health/data"
+	"github.com/superedge/superedge/pkg/edge-health/metrics"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// a suspected node is declared dead when it does not refute the suspicion within the rounds
+	DefaultSuspicionRounds = 3
+	// result details carried by a message at most
+	DefaultMaxDetails = 4096
+	// an unchanged result is published again after the rounds
+	DefaultRefreshRounds = 10
+)
+
+type GossipTransport interface {
+	// Send delivers the message to the node and returns its answer
+	Send(nodeIP string, msg *GossipMessage) (*GossipMessage, error)
+}
+
+type (
+	// SignFunc signs the entry published by this node
+	SignFunc func(entry *ResultEntry) error
+	// VerifyFunc checks that the entry is signed by its checker
+	VerifyFunc func(entry *ResultEntry) error
+	// ApplyFunc stores a result received from gossip
+	ApplyFunc func(entry *ResultEntry)
+)
+
+type GossipConfig struct {
+	// nodes gossiped with in each round
+	Fanout int
+	// nodes asked to probe a node which does not answer
+	IndirectProbes int
+	// a membership update is gossiped RetransmitMult*log2(nodes) times by each node
+	RetransmitMult  int
+	SuspicionRounds int
+	// result details carried by a message at most, the others are sent in the next rounds. A result counts
+	// the nodes it holds, or the nodes changed since the version held by the receiver when it is sent as a delta.
+	MaxDetails int
+	// an unchanged result is published again after RefreshRounds rounds, the results of a checker not
+	// published again within twice the rounds are no longer kept fresh
+	RefreshRounds int
+}
+
+type member struct {
+	MemberUpdate
+	// round in which the member was suspected
+	suspected int
+	transmits int
+}
+
+type result struct {
+	entry *ResultEntry
+	// the version replaced by entry, the receivers holding it are sent the changes only
+	prev *ResultEntry
+	// round in which the entry was published or received
+	round int
+}
+
+// Gossip disseminates the check results SWIM-style: each round a few random nodes are pinged, the nodes not
+// answering are probed indirectly through other nodes and suspected when those fail too. The pings and their
+// acks piggyback the membership updates and the versions of the results known by their sender, the acks carry up to
+// MaxDetails details of the results missed by the node pinged, as deltas when it holds the previous version. A result
+// is only published again when it changes or after RefreshRounds, so each change is sent about once to each node and
+// the rounds without changes only carry the versions, while the full mesh mode sends all the results to all the nodes
+// in each period.
+type Gossip struct {
+	self      string
+	config    GossipConfig
+	transport GossipTransport
+	sign      SignFunc
+	verify    VerifyFunc
+	apply     ApplyFunc
+
+	lock        sync.Mutex
+	round       int
+	incarnation uint64
+	// transmits of the alive update refuting a suspicion of this node
+	selfTransmits int
+	members       map[string]*member
+	results       map[string]*result
+	// versions of the results held by each member, from its last message and the results sent to it since
+	versions map[string]map[string]int64
+	rand     *rand.Rand
+}
+
+func NewGossip(self string, config GossipConfig, transport GossipTransport, sign SignFunc, verify VerifyFunc, apply ApplyFunc) *Gossip {
+	if config.SuspicionRounds <= 0 {
+		config.SuspicionRounds = DefaultSuspicionRounds
+	}
+	if config.MaxDetails <= 0 {
+		config.MaxDetails = DefaultMaxDetails
+	}
+	if config.RefreshRounds <= 0 {
+		config.RefreshRounds = DefaultRefreshRounds
+	}
+	return &Gossip{
+		self:          self,
+		config:        config,
+		transport:     transport,
+		sign:          sign,
+		verify:        verify,
+		apply:         apply,
+		selfTransmits: math.MaxInt32,
+		members:       make(map[string]*member),
+		results:       make(map[string]*result),
+		versions:      make(map[string]map[string]int64),
+		rand:          rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// SetMembers replaces the nodes gossiped with, the new nodes are assumed alive
+func (g *Gossip) SetMembers(nodeIPs []string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	ips := make(map[string]bool, len(nodeIPs))
+	for _, ip := range nodeIPs {
+		if ip == g.self {
+			continue
+		}
+		ips[ip] = true
+		if _, ok := g.members[ip]; !ok {
+			g.members[ip] = &member{MemberUpdate: MemberUpdate{IP: ip, State: MemberAlive}, transmits: math.MaxInt32}
+		}
+	}
+	for ip := range g.members {
+		if !ips[ip] {
+			delete(g.members, ip)
+			delete(g.versions, ip)
+		}
+	}
+	for ip := range g.results {
+		if !ips[ip] && ip != g.self {
+			delete(g.results, ip)
+		}
+	}
+}
+
+// Members returns the membership seen by this node
+func (g *Gossip) Members() []MemberUpdate {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	members := make([]MemberUpdate, 0, len(g.members))
+	for _, m := range g.members {
+		members = append(members, m.MemberUpdate)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].IP < members[j].IP
+	})
+	return members
+}
+
+func previous(r *result) *ResultEntry {
+	if r == nil {
+		return nil
+	}
+	return r.entry
+}
+
+// Current returns the results of the other checkers which are not dead and published them within twice
+// RefreshRounds, they are kept fresh without being sent again
+func (g *Gossip) Current() []*ResultEntry {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	var entries []*ResultEntry
+	for ip, r := range g.results {
+		m, ok := g.members[ip]
+		if !ok || m.State == MemberDead || g.round-r.round > 2*g.config.RefreshRounds {
+			continue
+		}
+		entry := *r.entry
+		entry.ResultDetail = copyDetail(r.entry.ResultDetail)
+		entries = append(entries, &entry)
+	}
+	return entries
+}
+
+// Publish starts gossiping the results and the uplink of this node, they replace the ones published before.
+// The receivers set the time of the results, so the results only get a new version when they change or
+// after RefreshRounds.
+func (g *Gossip) Publish(detail map[string]data.ResultDetail, uplink *data.UplinkStatus) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	published := make(map[string]data.ResultDetail, len(detail))
+	for ip, d := range detail {
+		published[ip] = data.ResultDetail{Normal: d.Normal}
+	}
+	r, ok := g.results[g.self]
+	if ok && g.round-r.round < g.config.RefreshRounds && reflect.DeepEqual(r.entry.ResultDetail, published) &&
+		reflect.DeepEqual(r.entry.Uplink, uplink) {
+		return
+	}
+	version := time.Now().UnixNano()
+	if ok && version <= r.entry.Version {
+		version = r.entry.Version + 1
+	}
+	entry := &ResultEntry{
+		CommunicateData: data.CommunicateData{SourceIP: g.self, ResultDetail: published, Uplink: uplink},
+		Version:         version,
+	}
+	if err := g.sign(entry); err != nil {
+		klog.Errorf("Gossip: sign result err: %v", err)
+		return
+	}
+	g.results[g.self] = &result{entry: entry, prev: previous(r), round: g.round}
+}
+
+// Round pings Fanout nodes, the nodes believed dead are only pinged when there are not enough other nodes,
+// which lets partitioned nodes find each other again
+func (g *Gossip) Round() {
+	g.lock.Lock()
+	g.round++
+	for _, m := range g.members {
+		if m.State == MemberSuspect && g.round-m.suspected >= g.config.SuspicionRounds {
+			klog.V(2).Infof("Gossip: %s is not refuting the suspicion, declare it dead", m.IP)
+			m.State = MemberDead
+			m.transmits = 0
+		}
+	}
+	targets := g.pickMembers(g.config.Fanout, "", true)
+	g.lock.Unlock()
+
+	wg := sync.WaitGroup{}
+	wg.Add(len(targets))
+	for _, target := range targets {
+		go func(target string) {
+			defer wg.Done()
+			g.probe(target)
+		}(target)
+	}
+	wg.Wait()
+}
+
+// Handle answers a message received from another node
+func (g *Gossip) Handle(msg *GossipMessage) *GossipMessage {
+	g.merge(msg)
+	ack := false
+	switch msg.Type {
+	case GossipPing:
+		ack = true
+	case GossipPingReq:
+		ack = g.ping(msg.Target)
+	}
+	resp := g.message(msg.Type, msg.Target, msg.From, true)
+	resp.Ack = ack
+	return resp
+}
+
+func (g *Gossip) probe(target string) {
+	if g.ping(target) {
+		return
+	}
+	g.lock.Lock()
+	relays := g.pickMembers(g.config.IndirectProbes, target, false)
+	g.lock.Unlock()
+
+	acks := make(chan bool, len(relays))
+	for _, relay := range relays {
+		go func(relay string) {
+			resp, err := g.transport.Send(relay, g.message(GossipPingReq, target, relay, false))
+			if err != nil {
+				klog.V(4).Infof("Gossip: ping-req %s through %s err: %v", target, relay, err)
+				acks <- false
+				return
+			}
+			g.merge(resp)
+			acks <- resp.Ack
+		}(relay)
+	}
+	for range relays {
+		if <-acks {
+			return
+		}
+	}
+	g.suspect(target)
+}
+
+func (g *Gossip) ping(target string) bool {
+	resp, err := g.transport.Send(target, g.message(GossipPing, "", target, false))
+	if err != nil {
+		klog.V(4).Infof("Gossip: ping %s err: %v", target, err)
+		return false
+	}
+	g.merge(resp)
+	return resp.Ack
+}
+
+func (g *Gossip) suspect(ip string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if m, ok := g.members[ip]; ok && m.State == MemberAlive {
+		klog.V(2).Infof("Gossip: %s does not answer direct and indirect probes, suspect it", ip)
+		m.State = MemberSuspect
+		m.suspected = g.round
+		m.transmits = 0
+	}
+}
+
+// message builds a message to the node to, piggybacking the membership updates which have not been gossiped enough
+// times and the versions of the results. The answers carry the results missed by the sender of the message answered,
+// whose versions were just received. The other messages only push the result of this node in the round following
+// its change, the versions known of the node pinged could be outdated.
+func (g *Gossip) message(typ, target, to string, answer bool) *GossipMessage {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	msg := &GossipMessage{
+		Type:        typ,
+		From:        g.self,
+		Incarnation: g.incarnation,
+		Target:      target,
+		Versions:    make(map[string]int64, len(g.results)),
+	}
+	limit := g.retransmitLimit()
+	if g.selfTransmits < limit {
+		msg.Members = append(msg.Members, &MemberUpdate{IP: g.self, State: MemberAlive, Incarnation: g.incarnation})
+		g.selfTransmits++
+	}
+	for _, m := range g.members {
+		if m.transmits < limit {
+			update := m.MemberUpdate
+			msg.Members = append(msg.Members, &update)
+			m.transmits++
+		}
+	}
+	for ip, r := range g.results {
+		msg.Versions[ip] = r.entry.Version
+	}
+	msg.Results = g.missing(to, answer)
+	return msg
+}
+
+// missing returns the results which the node has not received, in random order up to MaxDetails details. The
+// results are sent as deltas when the node holds their previous version. They are assumed received, the next
+// message of the node corrects it.
+func (g *Gossip) missing(to string, all bool) []*ResultEntry {
+	versions, ok := g.versions[to]
+	if !ok {
+		versions = make(map[string]int64)
+		g.versions[to] = versions
+	}
+	var missing []*result
+	for ip, r := range g.results {
+		if ip == to || versions[ip] >= r.entry.Version {
+			continue
+		}
+		// the result of this node is pushed in the round following its change only
+		if all || (ip == g.self && g.round-r.round <= 1) {
+			missing = append(missing, r)
+		}
+	}
+	g.rand.Shuffle(len(missing), func(i, j int) { missing[i], missing[j] = missing[j], missing[i] })
+	var entries []*ResultEntry
+	budget := g.config.MaxDetails
+	for _, r := range missing {
+		var entry *ResultEntry
+		if r.prev != nil && versions[r.entry.SourceIP] == r.prev.Version {
+			entry = resultDelta(r.prev, r.entry)
+		} else {
+			entry = &ResultEntry{}
+			*entry = *r.entry
+			entry.ResultDetail = copyDetail(r.entry.ResultDetail)
+		}
+		// a result larger than the budget is still sent alone
+		size := len(entry.ResultDetail) + len(entry.Removed) + 1
+		if size > budget && len(entries) != 0 {
+			continue
+		}
+		budget -= size
+		entries = append(entries, entry)
+		versions[entry.SourceIP] = entry.Version
+		if budget <= 0 {
+			break
+		}
+	}
+	return entries
+}
+
+// resultDelta returns the changes from prev to cur, the certificate is left out when it is unchanged
+func resultDelta(prev, cur *ResultEntry) *ResultEntry {
+	delta := &ResultEntry{
+		CommunicateData: data.CommunicateData{
+			SourceIP:     cur.SourceIP,
+			ResultDetail: make(map[string]data.ResultDetail),
+			Hmac:         cur.Hmac,
+			Uplink:       cur.Uplink,
+		},
+		Version:   cur.Version,
+		Base:      prev.Version,
+		Signature: cur.Signature,
+	}
+	if !bytes.Equal(prev.Cert, cur.Cert) {
+		delta.Cert = cur.Cert
+	}
+	for ip, d := range cur.ResultDetail {
+		if p, ok := prev.ResultDetail[ip]; !ok || p != d {
+			delta.ResultDetail[ip] = d
+		}
+	}
+	for ip := range prev.ResultDetail {
+		if _, ok := cur.ResultDetail[ip]; !ok {
+			delta.Removed = append(delta.Removed, ip)
+		}
+	}
+	sort.Strings(delta.Removed)
+	return delta
+}
+
+// applyDelta returns the result built from the delta and the version it is based on
+func applyDelta(base, delta *ResultEntry) *ResultEntry {
+	entry := *delta
+	entry.Base, entry.Removed = 0, nil
+	entry.ResultDetail = copyDetail(base.ResultDetail)
+	for ip, d := range delta.ResultDetail {
+		entry.ResultDetail[ip] = d
+	}
+	for _, ip := range delta.Removed {
+		delete(entry.ResultDetail, ip)
+	}
+	if len(entry.Cert) == 0 {
+		entry.Cert = base.Cert
+	}
+	return &entry
+}
+
+func (g *Gossip) merge(msg *GossipMessage) {
+	var applies []*ResultEntry
+	g.lock.Lock()
+	// the sender is alive, the direct contact overrides the rumors of the same incarnation
+	if m, ok := g.members[msg.From]; ok && m.State != MemberAlive && msg.Incarnation >= m.Incarnation {
+		m.State = MemberAlive
+		m.Incarnation = msg.Incarnation
+		m.transmits = 0
+	}
+	for _, u := range msg.Members {
+		g.update(u)
+	}
+	if _, ok := g.members[msg.From]; ok && msg.Versions != nil {
+		g.versions[msg.From] = msg.Versions
+	}
+	for _, entry := range msg.Results {
+		if merged := g.mergeResult(entry); merged != nil {
+			applies = append(applies, merged)
+		}
+	}
+	g.lock.Unlock()
+
+	for _, entry := range applies {
+		g.apply(entry)
+	}
+}
+
+// update applies the SWIM override rules, the updates of unknown nodes are ignored
+func (g *Gossip) update(u *MemberUpdate) {
+	if u.IP == g.self {
+		if u.State != MemberAlive && u.Incarnation >= g.incarnation {
+			g.incarnation = u.Incarnation + 1
+			g.selfTransmits = 0
+			klog.V(2).Infof("Gossip: refute %s of this node with incarnation %d", u.State, g.incarnation)
+		}
+		return
+	}
+	m, ok := g.members[u.IP]
+	if !ok {
+		return
+	}
+	var override bool
+	switch u.State {
+	case MemberAlive:
+		override = u.Incarnation > m.Incarnation
+	case MemberSuspect:
+		override = (m.State == MemberAlive && u.Incarnation >= m.Incarnation) || (m.State == MemberSuspect && u.Incarnation > m.Incarnation)
+	case MemberDead:
+		override = m.State != MemberDead && u.Incarnation >= m.Incarnation
+	}
+	if !override {
+		return
+	}
+	if u.State == MemberSuspect && m.State != MemberSuspect {
+		m.suspected = g.round
+	}
+	m.MemberUpdate = *u
+	m.transmits = 0
+}
+
+// mergeResult keeps the newest result of each checker, it returns the result when it is new
+func (g *Gossip) mergeResult(entry *ResultEntry) *ResultEntry {
+	if entry.SourceIP == g.self {
+		return nil
+	}
+	r, ok := g.results[entry.SourceIP]
+	if ok && r.entry.Version >= entry.Version {
+		return nil
+	}
+	if entry.Base != 0 {
+		// the delta is dropped when the base is not held, the sender sees the version held in the next message
+		if !ok || r.entry.Version != entry.Base {
+			klog.V(4).Infof("Gossip: the base %d of the result of %s is not held", entry.Base, entry.SourceIP)
+			return nil
+		}
+		entry = applyDelta(r.entry, entry)
+	}
+	if err := g.verify(entry); err != nil {
+		klog.Errorf("Gossip: the result of %s is not signed by it, err: %v", entry.SourceIP, err)
+		metrics.CommunicationErrors.WithLabelValues(mismatchReason()).Inc()
+		return nil
+	}
+	stored := *entry
+	stored.ResultDetail = copyDetail(entry.ResultDetail)
+	g.results[entry.SourceIP] = &result{entry: &stored, prev: previous(r), round: g.round}
+	return entry
+}
+
+// pickMembers returns up to n random members other than exclude
+func (g *Gossip) pickMembers(n int, exclude string, fillWithDead bool) []string {
+	var live, dead []string
+	for ip, m := range g.members {
+		if ip == exclude {
+			continue
+		}
+		if m.State == MemberDead {
+			dead = append(dead, ip)
+		} else {
+			live = append(live, ip)
+		}
+	}
+	g.rand.Shuffle(len(live), func(i, j int) { live[i], live[j] = live[j], live[i] })
+	g.rand.Shuffle(len(dead), func(i, j int) { dead[i], dead[j] = dead[j], dead[i] })
+	if fillWithDead {
+		live = append(live, dead...)
+	}
+	if len(live) > n {
+		live = live[:n]
+	}
+	return live
+}
+
+func (g *Gossip) retransmitLimit() int {
+	return g.config.RetransmitMult * int(math.Ceil(math.Log2(float64(len(g.members)+2))))
+}
+
+func copyDetail(detail map[string]data.ResultDetail) map[string]data.ResultDetail {
+	temp := make(map[string]data.ResultDetail, len(detail))
+	for ip, d := range detail {
+		temp[ip] = d
+	}
+	return temp
+}
@@ -0,0 +1,363 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package communicate
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/superedge/superedge/pkg/edge-health/data"
+	"github.com/superedge/superedge/pkg/edge-health/metrics"
+)
+
+// memNetwork delivers the messages in memory, the messages are encoded like on the wire
+type memNetwork struct {
+	lock     sync.Mutex
+	nodes    map[string]*Gossip
+	down     map[string]bool
+	cut      map[[2]string]bool
+	received map[string]map[string]int64
+	messages int64
+	bytes    int64
+	results  int64
+}
+
+func newMemNetwork() *memNetwork {
+	return &memNetwork{
+		nodes:    make(map[string]*Gossip),
+		down:     make(map[string]bool),
+		cut:      make(map[[2]string]bool),
+		received: make(map[string]map[string]int64),
+	}
+}
+
+type memTransport struct {
+	network *memNetwork
+	from    string
+}
+
+func (t *memTransport) Send(nodeIP string, msg *GossipMessage) (*GossipMessage, error) {
+	n := t.network
+	body, _ := json.Marshal(msg)
+	atomic.AddInt64(&n.messages, 1)
+	atomic.AddInt64(&n.bytes, int64(len(body)))
+	atomic.AddInt64(&n.results, int64(len(msg.Results)))
+	n.lock.Lock()
+	node, unreachable := n.nodes[nodeIP], n.down[nodeIP] || n.down[t.from] || n.cut[[2]string{t.from, nodeIP}]
+	n.lock.Unlock()
+	if node == nil || unreachable {
+		return nil, fmt.Errorf("%s is unreachable from %s", nodeIP, t.from)
+	}
+	var decoded GossipMessage
+	json.Unmarshal(body, &decoded)
+	handled := node.Handle(&decoded)
+	resp, _ := json.Marshal(handled)
+	atomic.AddInt64(&n.bytes, int64(len(resp)))
+	atomic.AddInt64(&n.results, int64(len(handled.Results)))
+	var decodedResp GossipMessage
+	json.Unmarshal(resp, &decodedResp)
+	return &decodedResp, nil
+}
+
+func fakeSign(entry *ResultEntry) error {
+	entry.Hmac = fmt.Sprintf("%s/%d/%d", entry.SourceIP, entry.Version, len(entry.ResultDetail))
+	return nil
+}
+
+func fakeVerify(entry *ResultEntry) error {
+	signed := *entry
+	fakeSign(&signed)
+	if signed.Hmac != entry.Hmac {
+		return fmt.Errorf("hmac not match")
+	}
+	return nil
+}
+
+func (n *memNetwork) addNodes(count int, config GossipConfig) []string {
+	var ips []string
+	for i := 0; i < count; i++ {
+		ips = append(ips, fmt.Sprintf("10.0.%d.%d", i/250, i%250+1))
+	}
+	for _, ip := range ips {
+		self := ip
+		n.received[self] = make(map[string]int64)
+		n.nodes[self] = NewGossip(self, config, &memTransport{network: n, from: self}, fakeSign, fakeVerify, func(entry *ResultEntry) {
+			n.lock.Lock()
+			n.received[self][entry.SourceIP] = entry.Version
+			n.lock.Unlock()
+		})
+		n.nodes[self].SetMembers(ips)
+	}
+	return ips
+}
+
+func (n *memNetwork) publish(ips []string) {
+	for _, ip := range ips {
+		detail := make(map[string]data.ResultDetail, len(ips))
+		for _, checked := range ips {
+			detail[checked] = data.ResultDetail{Normal: !n.down[checked]}
+		}
+		n.nodes[ip].Publish(detail, nil)
+	}
+}
+
+func (n *memNetwork) round() {
+	wg := sync.WaitGroup{}
+	for ip, node := range n.nodes {
+		if n.down[ip] {
+			continue
+		}
+		wg.Add(1)
+		go func(node *Gossip) {
+			defer wg.Done()
+			node.Round()
+		}(node)
+	}
+	wg.Wait()
+}
+
+// converged returns whether every node received the current results of all other nodes
+func (n *memNetwork) converged() bool {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	for ip := range n.nodes {
+		if n.down[ip] {
+			continue
+		}
+		for source, other := range n.nodes {
+			if source == ip || n.down[source] {
+				continue
+			}
+			if n.received[ip][source] != other.results[source].entry.Version {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (n *memNetwork) state(observer, ip string) string {
+	for _, m := range n.nodes[observer].Members() {
+		if m.IP == ip {
+			return m.State
+		}
+	}
+	return ""
+}
+
+var testConfig = GossipConfig{Fanout: 3, IndirectProbes: 3, RetransmitMult: 4}
+
+func TestGossipDissemination(t *testing.T) {
+	n := newMemNetwork()
+	ips := n.addNodes(50, testConfig)
+	n.publish(ips)
+	rounds := 0
+	for !n.converged() {
+		if rounds == 15 {
+			t.Fatalf("results are not disseminated to all nodes after %d rounds", rounds)
+		}
+		n.round()
+		rounds++
+	}
+	t.Logf("converged after %d rounds, %d messages", rounds, n.messages)
+
+	// the unchanged results are not sent again once the versions of the peers are known, the messages only carry
+	// the versions
+	n.publish(ips)
+	n.round()
+	results := n.results
+	n.publish(ips)
+	n.round()
+	if n.results != results {
+		t.Errorf("expected no result to be sent without changes, %d were sent", n.results-results)
+	}
+	if entries := n.nodes[ips[0]].Current(); len(entries) != len(ips)-1 {
+		t.Errorf("expected the results of the %d other nodes to be kept fresh, got %d", len(ips)-1, len(entries))
+	}
+
+	// tampered results are dropped
+	forged := &ResultEntry{CommunicateData: data.CommunicateData{SourceIP: ips[1], Hmac: "forged"}, Version: 1 << 62}
+	mismatches := testutil.ToFloat64(metrics.CommunicationErrors.WithLabelValues(metrics.ReasonHmacMismatch))
+	n.nodes[ips[0]].Handle(&GossipMessage{Type: GossipPing, From: ips[1], Results: []*ResultEntry{forged}})
+	if n.received[ips[0]][ips[1]] == forged.Version {
+		t.Fatal("a result with a wrong hmac must not be applied")
+	}
+	if v := testutil.ToFloat64(metrics.CommunicationErrors.WithLabelValues(metrics.ReasonHmacMismatch)); v != mismatches+1 {
+		t.Errorf("expected %v hmac mismatches, got %v", mismatches+1, v)
+	}
+}
+
+func TestGossipDelta(t *testing.T) {
+	n := newMemNetwork()
+	ips := n.addNodes(3, testConfig)
+	a, b := n.nodes[ips[0]], n.nodes[ips[1]]
+	detail := map[string]data.ResultDetail{ips[1]: {Normal: true}, ips[2]: {Normal: true}}
+	a.Publish(detail, nil)
+	b.merge(a.Handle(b.message(GossipPing, "", ips[0], false)))
+
+	// the node holding the previous version receives the changed node only
+	detail[ips[2]] = data.ResultDetail{Normal: false}
+	a.Publish(detail, nil)
+	resp := a.Handle(b.message(GossipPing, "", ips[0], false))
+	if len(resp.Results) != 1 || resp.Results[0].Base == 0 || len(resp.Results[0].ResultDetail) != 1 {
+		t.Fatalf("expected a delta of one node, got %+v", resp.Results)
+	}
+	b.merge(resp)
+	version := a.results[ips[0]].entry.Version
+	if n.received[ips[1]][ips[0]] != version || b.results[ips[0]].entry.ResultDetail[ips[2]].Normal {
+		t.Fatalf("the delta is not applied, got %+v", b.results[ips[0]].entry)
+	}
+
+	// a delta whose base is not held is dropped
+	delete(detail, ips[2])
+	a.Publish(detail, nil)
+	resp = a.Handle(b.message(GossipPing, "", ips[0], false))
+	resp.Results[0].Base--
+	b.merge(resp)
+	if n.received[ips[1]][ips[0]] != version {
+		t.Fatal("a delta of another base must not be applied")
+	}
+}
+
+func TestGossipFailureDetection(t *testing.T) {
+	n := newMemNetwork()
+	ips := n.addNodes(4, GossipConfig{Fanout: 3, IndirectProbes: 2, RetransmitMult: 4, SuspicionRounds: 2})
+	a, b := ips[0], ips[1]
+	n.publish(ips)
+
+	// the direct link is broken, the indirect probes reach the node
+	n.cut[[2]string{a, b}] = true
+	n.nodes[a].Round()
+	if state := n.state(a, b); state != MemberAlive {
+		t.Fatalf("a node reachable by indirect probes must stay alive, got %s", state)
+	}
+
+	n.down[b] = true
+	n.nodes[a].Round()
+	if state := n.state(a, b); state != MemberSuspect {
+		t.Fatalf("expected suspect, got %s", state)
+	}
+	for i := 0; i < 3; i++ {
+		n.round()
+	}
+	for _, observer := range ips[2:] {
+		if state := n.state(observer, b); state != MemberDead {
+			t.Fatalf("the death of the node must be gossiped, %s sees %s", observer, state)
+		}
+		for _, entry := range n.nodes[observer].Current() {
+			if entry.SourceIP == b {
+				t.Fatalf("the result of the dead node must not be kept fresh by %s", observer)
+			}
+		}
+	}
+
+	// the node comes back and refutes its death with a higher incarnation
+	n.down[b] = false
+	delete(n.cut, [2]string{a, b})
+	for i := 0; i < 5; i++ {
+		n.round()
+	}
+	for _, observer := range []string{a, ips[2], ips[3]} {
+		if state := n.state(observer, b); state != MemberAlive {
+			t.Fatalf("the node must be alive again, %s sees %s", observer, state)
+		}
+	}
+}
+
+// benchPeriods is the number of communicate periods of the benchmark after the first dissemination, a node
+// goes down in the middle of them
+const benchPeriods = 10
+
+// fullMeshBytesPerPeriod is the bytes sent in a communicate period of the full mesh mode, every node sends its
+// results to every other node
+func fullMeshBytesPerPeriod(ips []string) int64 {
+	var bytes int64
+	detail := make(map[string]data.ResultDetail, len(ips))
+	for _, ip := range ips {
+		detail[ip] = data.ResultDetail{Normal: true, Time: time.Now().Unix()}
+	}
+	for _, ip := range ips {
+		body, _ := json.Marshal(data.CommunicateData{SourceIP: ip, ResultDetail: detail, Hmac: strings.Repeat("0", 64)})
+		bytes += int64(len(ips)-1) * int64(len(body))
+	}
+	return bytes
+}
+
+// BenchmarkCommunicate compares the messages and the bytes per communicate period of the full mesh and the gossip
+// mode, the gossip mode fails when it sends as many bytes as the full mesh mode
+func BenchmarkCommunicate(b *testing.B) {
+	for _, nodes := range []int{50, 200} {
+		var ips []string
+		for j := 0; j < nodes; j++ {
+			ips = append(ips, fmt.Sprintf("10.0.%d.%d", j/250, j%250+1))
+		}
+		fullMeshBytes := fullMeshBytesPerPeriod(ips)
+		b.Run(fmt.Sprintf("fullmesh-%d", nodes), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				fullMeshBytesPerPeriod(ips)
+			}
+			b.ReportMetric(float64(nodes*(nodes-1)), "msgs/period")
+			b.ReportMetric(float64(fullMeshBytes), "bytes/period")
+			b.ReportMetric(1, "periods/convergence")
+		})
+		b.Run(fmt.Sprintf("gossip-%d", nodes), func(b *testing.B) {
+			var messages, bytes, convergence int64
+			for i := 0; i < b.N; i++ {
+				n := newMemNetwork()
+				ips := n.addNodes(nodes, testConfig)
+				for rounds := 1; ; rounds++ {
+					n.publish(ips)
+					n.round()
+					convergence++
+					if n.converged() {
+						break
+					}
+					if rounds == benchPeriods {
+						b.Fatalf("the results are not disseminated to all nodes after %d periods", benchPeriods)
+					}
+				}
+				for period := 0; period < benchPeriods; period++ {
+					// every result changes when a node goes down
+					if period == benchPeriods/2 {
+						n.down[ips[0]] = true
+					}
+					n.publish(ips)
+					n.round()
+				}
+				if !n.converged() {
+					b.Fatalf("the results are not disseminated to all nodes %d periods after a node went down", benchPeriods/2)
+				}
+				messages += n.messages
+				bytes += n.bytes
+			}
+			// the periods of the first dissemination are counted too
+			periods := convergence + int64(b.N*benchPeriods)
+			b.ReportMetric(float64(messages)/float64(periods), "msgs/period")
+			b.ReportMetric(float64(bytes)/float64(periods), "bytes/period")
+			b.ReportMetric(float64(convergence)/float64(b.N), "periods/convergence")
+			if bytes/periods >= fullMeshBytes {
+				b.Fatalf("gossip sends %d bytes per period, not less than the %d bytes of full mesh", bytes/periods, fullMeshBytes)
+			}
+		})
+	}
+}
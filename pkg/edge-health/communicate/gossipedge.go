@@ -0,0 +1,211 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package communicate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/superedge/superedge/pkg/edge-health/check"
+	"github.com/superedge/superedge/pkg/edge-health/common"
+	"github.com/superedge/superedge/pkg/edge-health/data"
+	"github.com/superedge/superedge/pkg/edge-health/metrics"
+	"github.com/superedge/superedge/pkg/edge-health/peertls"
+	"github.com/superedge/superedge/pkg/edge-health/util"
+	"k8s.io/klog/v2"
+)
+
+// GossipEdge exchanges the results by gossip, the received results are stored in data.Result like
+// the results received in full mesh mode, so the vote is the same in both modes
+type GossipEdge struct {
+	*CommunicateEdge
+	Gossip *Gossip
+}
+
+func NewGossipEdge(communicatePeriod, communicateTimetout, communicateRetryTime, communicateServerPort int, config GossipConfig) Communicate {
+	c := NewCommunicateEdge(communicatePeriod, communicateTimetout, communicateRetryTime, communicateServerPort).(*CommunicateEdge)
+	transport := &httpGossipTransport{
+		port:    communicateServerPort,
+		timeout: time.Duration(communicateTimetout) * time.Second,
+	}
+	return &GossipEdge{
+		CommunicateEdge: c,
+		Gossip:          NewGossip(common.NodeIP, config, transport, signResultEntry, verifyResultEntry, applyResultEntry),
+	}
+}
+
+func (g *GossipEdge) Server(ctx context.Context, wg *sync.WaitGroup) {
+	mux := g.newPeerServeMux()
+	mux.HandleFunc("/gossip", g.HandleGossip)
+	g.serve(ctx, wg, mux)
+}
+
+// Client runs a gossip round with the nodes checked by this node. The results are not sent again while they do
+// not change, the results of the checkers which are alive are kept fresh here instead.
+func (g *GossipEdge) Client() {
+	g.Gossip.SetMembers(data.CheckInfoResult.TraverseCheckedIpCheckInfo())
+	if local := data.Result.CopyLocalResultData(common.NodeIP); len(local) != 0 {
+		g.Gossip.Publish(local, localUplink())
+	}
+	g.Gossip.Round()
+	for _, entry := range g.Gossip.Current() {
+		data.Result.SetResult(&data.CommunicateData{SourceIP: entry.SourceIP, ResultDetail: entry.ResultDetail})
+		if entry.Uplink != nil {
+			data.Uplink.SetUplink(entry.SourceIP, *entry.Uplink)
+		}
+	}
+}
+
+// HandleGossip answers the gossip messages, GET returns the membership seen by this node
+func (g *GossipEdge) HandleGossip(w http.ResponseWriter, r *http.Request) {
+	var resp interface{}
+	switch r.Method {
+	case http.MethodGet:
+		resp = g.Gossip.Members()
+	case http.MethodPost:
+		var msg GossipMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			klog.ErrorS(err, "Decode gossip message error", "remoteAddr", r.RemoteAddr)
+			metrics.CommunicationErrors.WithLabelValues(metrics.ReasonDecode).Inc()
+			http.Error(w, "Invalid Body", http.StatusBadRequest)
+			return
+		}
+		// the results relayed for other nodes are signed by their sources, the sender only speaks for itself
+		if peertls.Manager != nil {
+			if err := peertls.VerifyPeer(r, msg.From); err != nil {
+				klog.Errorf("Gossip: %v", err)
+				metrics.CommunicationErrors.WithLabelValues(metrics.ReasonCertificateMismatch).Inc()
+				http.Error(w, "Certificate not match", http.StatusForbidden)
+				return
+			}
+		}
+		klog.V(6).Infof("Gossip: received %s from %s", msg.Type, msg.From)
+		resp = g.Gossip.Handle(&msg)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		klog.Errorf("Gossip: write response err: %v", err)
+	}
+}
+
+// signResultEntry signs the entry with the key of the certificate of this node over mTLS, the shared hmac key is
+// only used without it
+func signResultEntry(entry *ResultEntry) error {
+	if peertls.Manager != nil {
+		payload := util.VersionedPayload(entry.CommunicateData, entry.Version)
+		cert, signature, err := peertls.Manager.Sign([]byte(payload))
+		if err != nil {
+			return err
+		}
+		entry.Cert, entry.Signature = cert, signature
+		return nil
+	}
+	hmac, err := util.GenerateVersionedHmac(entry.CommunicateData, entry.Version)
+	if err != nil {
+		return err
+	}
+	entry.Hmac = hmac
+	return nil
+}
+
+// verifyResultEntry checks the entry is signed by the certificate of its checker over mTLS, whichever node
+// relayed it, and checks the hmac without mTLS
+func verifyResultEntry(entry *ResultEntry) error {
+	if peertls.Manager != nil {
+		payload := util.VersionedPayload(entry.CommunicateData, entry.Version)
+		return peertls.Manager.VerifySignature(entry.SourceIP, []byte(payload), entry.Cert, entry.Signature)
+	}
+	hmac, err := util.GenerateVersionedHmac(entry.CommunicateData, entry.Version)
+	if err != nil {
+		return err
+	}
+	if hmac != entry.Hmac {
+		return fmt.Errorf("hmac not match")
+	}
+	return nil
+}
+
+// mismatchReason is the reason counted when a result is not signed by its checker
+func mismatchReason() string {
+	if peertls.Manager != nil {
+		return metrics.ReasonCertificateMismatch
+	}
+	return metrics.ReasonHmacMismatch
+}
+
+func applyResultEntry(entry *ResultEntry) {
+	communicatedata := data.CommunicateData{
+		SourceIP:     entry.SourceIP,
+		ResultDetail: copyDetail(entry.ResultDetail),
+	}
+	data.Result.SetResult(&communicatedata)
+	countReceivedVotes(communicatedata.ResultDetail)
+	// the uplink is signed with the result
+	if entry.Uplink != nil {
+		data.Uplink.SetUplink(entry.SourceIP, *entry.Uplink)
+	}
+	klog.V(4).Infof("Gossip: received result of %s, version %d", entry.SourceIP, entry.Version)
+}
+
+type httpGossipTransport struct {
+	port    int
+	timeout time.Duration
+}
+
+func (t *httpGossipTransport) Send(nodeIP string, msg *GossipMessage) (*GossipMessage, error) {
+	// cause peer edge-health no longer use host network, we need get peer pod ip for communication
+	podIP, err := check.PodManager.GetPodIPByNodeIP(nodeIP)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	timeout := t.timeout
+	// the relay of a ping-req waits for the ping of the target
+	if msg.Type == GossipPingReq {
+		timeout *= 2
+	}
+	client, url, err := peertls.NewPeerClient(nodeIP, podIP, t.port, "/gossip", timeout)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		metrics.CommunicationErrors.WithLabelValues(metrics.ReasonRequest).Inc()
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		metrics.CommunicationErrors.WithLabelValues(metrics.ReasonStatus).Inc()
+		return nil, fmt.Errorf("gossip to %s failed, StatusCode is %d", podIP, res.StatusCode)
+	}
+	var resp GossipMessage
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -1,8 +1,16 @@
 package communicate
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
+	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,10 +20,16 @@ import (
 
 type TCPProbeFunc func(ip string, port int32, timeout int32) bool
 type ICMPProbeFunc func(ip string, timeout int32) bool
+type HTTPProbeFunc func(scheme, ip string, port int32, probe *HTTPProbe, timeout int32) error
+type UDPProbeFunc func(ip string, port int32, probe *UDPProbe, timeout int32) error
+type DNSProbeFunc func(ip string, port int32, probe *DNSProbe, timeout int32) error
 
 type ProberManager struct {
 	TCPProbe     TCPProbeFunc
 	ICMPProbe    ICMPProbeFunc
+	HTTPProbe    HTTPProbeFunc
+	UDPProbe     UDPProbeFunc
+	DNSProbe     DNSProbeFunc
 	ProbeTimeout int32
 }
 
@@ -23,10 +37,90 @@ func NewProberManager(timeout int32) *ProberManager {
 	return &ProberManager{
 		TCPProbe:     tcpProbe,
 		ICMPProbe:    icmpProbe,
+		HTTPProbe:    httpProbe,
+		UDPProbe:     udpProbe,
+		DNSProbe:     dnsProbe,
 		ProbeTimeout: timeout,
 	}
 }
 
+var errProbeFailed = errors.New("probe failed")
+
+// Probe probes the target with its protocol, the target must be validated by ValidateTarget
+func (pm *ProberManager) Probe(t *Target) error {
+	switch t.Protocol {
+	case ProtoTCP:
+		if !pm.TCPProbe(t.IP, t.Port, pm.ProbeTimeout) {
+			return errProbeFailed
+		}
+	case ProtoICMP:
+		if !pm.ICMPProbe(t.IP, pm.ProbeTimeout) {
+			return errProbeFailed
+		}
+	case ProtoHTTP, ProtoHTTPS:
+		return pm.HTTPProbe(t.Protocol, t.IP, t.Port, t.HTTP, pm.ProbeTimeout)
+	case ProtoUDP:
+		return pm.UDPProbe(t.IP, t.Port, t.UDP, pm.ProbeTimeout)
+	case ProtoDNS:
+		return pm.DNSProbe(t.IP, t.Port, t.DNS, pm.ProbeTimeout)
+	default:
+		return fmt.Errorf("protocol %q is not supported", t.Protocol)
+	}
+	return nil
+}
+
+// ValidateTarget checks the protocol of the target and fills the defaults of its probe
+func ValidateTarget(t *Target) error {
+	if t.Protocol == "" {
+		return nil
+	}
+	if _, ok := ProtoSet[t.Protocol]; !ok {
+		return fmt.Errorf("Invalid Protocol %s", t.Protocol)
+	}
+	if t.Port < 0 || t.Port > 65535 {
+		return fmt.Errorf("Invalid Port %d", t.Port)
+	}
+	switch t.Protocol {
+	case ProtoHTTP, ProtoHTTPS:
+		if t.HTTP == nil {
+			t.HTTP = &HTTPProbe{}
+		}
+		if t.Port == 0 {
+			t.Port = 80
+			if t.Protocol == ProtoHTTPS {
+				t.Port = 443
+			}
+		}
+		switch t.HTTP.Method {
+		case "":
+			t.HTTP.Method = http.MethodGet
+		case http.MethodGet, http.MethodHead:
+		default:
+			return fmt.Errorf("Invalid Method %s, must be GET or HEAD", t.HTTP.Method)
+		}
+		if t.HTTP.Path == "" {
+			t.HTTP.Path = "/"
+		} else if !strings.HasPrefix(t.HTTP.Path, "/") {
+			return fmt.Errorf("Invalid Path %s", t.HTTP.Path)
+		}
+		if t.HTTP.ExpectedStatus == 0 {
+			t.HTTP.ExpectedStatus = http.StatusOK
+		}
+	case ProtoUDP:
+		if t.Port == 0 || t.UDP == nil || t.UDP.Send == "" || len(t.UDP.Send) > MaxUDPPayload {
+			return fmt.Errorf("udp probe needs a port and a payload of at most %d bytes", MaxUDPPayload)
+		}
+	case ProtoDNS:
+		if t.DNS == nil || t.DNS.Domain == "" {
+			return fmt.Errorf("dns probe needs a domain")
+		}
+		if t.Port == 0 {
+			t.Port = 53
+		}
+	}
+	return nil
+}
+
 func tcpProbe(ip string, port int32, timeout int32) bool {
 	conn, err := net.DialTimeout(ProtoTCP, fmt.Sprintf("%s:%d", ip, port), time.Duration(timeout)*time.Second)
 	defer func() {
@@ -74,6 +168,90 @@ func icmpProbe(ip string, timeout int32) bool {
 	}
 }
 
+func httpProbe(scheme, ip string, port int32, probe *HTTPProbe, timeout int32) error {
+	transport := &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: probe.InsecureSkipVerify, ServerName: probe.Host},
+		DisableKeepAlives: true,
+	}
+	client := http.Client{
+		Timeout:   time.Duration(timeout) * time.Second,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	req, err := http.NewRequest(probe.Method, scheme+"://"+net.JoinHostPort(ip, strconv.Itoa(int(port)))+probe.Path, nil)
+	if err != nil {
+		return err
+	}
+	if probe.Host != "" {
+		req.Host = probe.Host
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096)); err != nil {
+		klog.V(4).InfoS("read http probe response error", "err", err)
+	}
+	if resp.StatusCode != probe.ExpectedStatus {
+		return fmt.Errorf("status code is %d, expected %d", resp.StatusCode, probe.ExpectedStatus)
+	}
+	return nil
+}
+
+func udpProbe(ip string, port int32, probe *UDPProbe, timeout int32) error {
+	conn, err := net.DialTimeout(ProtoUDP, net.JoinHostPort(ip, strconv.Itoa(int(port))), time.Duration(timeout)*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(time.Duration(timeout) * time.Second)); err != nil {
+		return err
+	}
+	if _, err := conn.Write([]byte(probe.Send)); err != nil {
+		return err
+	}
+	reply := make([]byte, MaxUDPPayload)
+	n, err := conn.Read(reply)
+	if err != nil {
+		return err
+	}
+	if probe.Expect != "" && !strings.Contains(string(reply[:n]), probe.Expect) {
+		return fmt.Errorf("reply does not contain %q", probe.Expect)
+	}
+	return nil
+}
+
+func dnsProbe(ip string, port int32, probe *DNSProbe, timeout int32) error {
+	server := net.JoinHostPort(ip, strconv.Itoa(int(port)))
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{}
+			return d.DialContext(ctx, network, server)
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+	addrs, err := resolver.LookupHost(ctx, probe.Domain)
+	if err != nil {
+		return err
+	}
+	if len(probe.Expected) == 0 {
+		return nil
+	}
+	for _, addr := range addrs {
+		for _, expected := range probe.Expected {
+			if addr == expected {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%s is resolved to %v, expected one of %v", probe.Domain, addrs, probe.Expected)
+}
+
 func (pm *ProberManager) Parallelize(workers, pieces int, doWorkPiece func(piece int)) {
 	toProcess := make(chan int, pieces)
 	for i := 0; i < pieces; i++ {
@@ -1,7 +1,14 @@
 package communicate
 
 import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
 	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
 )
 
 func TestTcpProbe(t *testing.T) {
@@ -79,3 +86,189 @@ func TestIcmpProbe(t *testing.T) {
 		}
 	}
 }
+
+func splitHostPort(t *testing.T, addr string) (string, int32) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := strconv.Atoi(port)
+	return host, int32(p)
+}
+
+func TestHttpProbe(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			if r.Host != "svc.example.com" {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case "/moved":
+			http.Redirect(w, r, "/healthz", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	tlsSrv := httptest.NewTLSServer(handler)
+	defer tlsSrv.Close()
+	u, _ := url.Parse(srv.URL)
+	ip, port := splitHostPort(t, u.Host)
+	tu, _ := url.Parse(tlsSrv.URL)
+	tlsIP, tlsPort := splitHostPort(t, tu.Host)
+
+	testcases := []struct {
+		name     string
+		target   *Target
+		expected bool
+	}{
+		{"expected status", &Target{IP: ip, Port: port, Protocol: ProtoHTTP, HTTP: &HTTPProbe{Path: "/healthz", Host: "svc.example.com"}}, true},
+		{"wrong host", &Target{IP: ip, Port: port, Protocol: ProtoHTTP, HTTP: &HTTPProbe{Path: "/healthz"}}, false},
+		{"unexpected status", &Target{IP: ip, Port: port, Protocol: ProtoHTTP}, false},
+		{"redirect is not followed", &Target{IP: ip, Port: port, Protocol: ProtoHTTP, HTTP: &HTTPProbe{Method: http.MethodHead, Path: "/moved", ExpectedStatus: http.StatusFound}}, true},
+		{"https skip verify", &Target{IP: tlsIP, Port: tlsPort, Protocol: ProtoHTTPS, HTTP: &HTTPProbe{Path: "/", ExpectedStatus: http.StatusServiceUnavailable, InsecureSkipVerify: true}}, true},
+		{"https unknown certificate", &Target{IP: tlsIP, Port: tlsPort, Protocol: ProtoHTTPS, HTTP: &HTTPProbe{ExpectedStatus: http.StatusServiceUnavailable}}, false},
+	}
+	pm := NewProberManager(2)
+	for _, tc := range testcases {
+		if err := ValidateTarget(tc.target); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if err := pm.Probe(tc.target); (err == nil) != tc.expected {
+			t.Errorf("test case %s failed, expect %v, err %v", tc.name, tc.expected, err)
+		}
+	}
+}
+
+func TestUdpProbe(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, MaxUDPPayload)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(append([]byte("echo "), buf[:n]...), addr)
+		}
+	}()
+	ip, port := splitHostPort(t, conn.LocalAddr().String())
+
+	pm := NewProberManager(1)
+	if err := pm.Probe(&Target{IP: ip, Port: port, Protocol: ProtoUDP, UDP: &UDPProbe{Send: "ping", Expect: "echo ping"}}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := pm.Probe(&Target{IP: ip, Port: port, Protocol: ProtoUDP, UDP: &UDPProbe{Send: "ping", Expect: "pong"}}); err == nil {
+		t.Error("expected an error for an unexpected reply")
+	}
+	closed, _ := net.ListenPacket("udp", "127.0.0.1:0")
+	closedIP, closedPort := splitHostPort(t, closed.LocalAddr().String())
+	closed.Close()
+	if err := pm.Probe(&Target{IP: closedIP, Port: closedPort, Protocol: ProtoUDP, UDP: &UDPProbe{Send: "ping"}}); err == nil {
+		t.Error("expected an error without a reply")
+	}
+}
+
+// serveDNS answers the A questions of example.test with 10.1.2.3
+func serveDNS(conn net.PacketConn) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var p dnsmessage.Parser
+		header, err := p.Start(buf[:n])
+		if err != nil {
+			continue
+		}
+		question, err := p.Question()
+		if err != nil {
+			continue
+		}
+		header.Response = true
+		header.Authoritative = true
+		if question.Name.String() != "example.test." {
+			header.RCode = dnsmessage.RCodeNameError
+		}
+		b := dnsmessage.NewBuilder(nil, header)
+		b.EnableCompression()
+		b.StartQuestions()
+		b.Question(question)
+		b.StartAnswers()
+		if header.RCode == dnsmessage.RCodeSuccess && question.Type == dnsmessage.TypeA {
+			b.AResource(dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: 60},
+				dnsmessage.AResource{A: [4]byte{10, 1, 2, 3}})
+		}
+		msg, err := b.Finish()
+		if err != nil {
+			continue
+		}
+		conn.WriteTo(msg, addr)
+	}
+}
+
+func TestDnsProbe(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go serveDNS(conn)
+	ip, port := splitHostPort(t, conn.LocalAddr().String())
+
+	testcases := []struct {
+		name     string
+		probe    *DNSProbe
+		expected bool
+	}{
+		{"resolved", &DNSProbe{Domain: "example.test"}, true},
+		{"expected address", &DNSProbe{Domain: "example.test", Expected: []string{"10.1.2.4", "10.1.2.3"}}, true},
+		{"unexpected address", &DNSProbe{Domain: "example.test", Expected: []string{"10.1.2.4"}}, false},
+		{"unknown domain", &DNSProbe{Domain: "unknown.test"}, false},
+	}
+	pm := NewProberManager(2)
+	for _, tc := range testcases {
+		if err := pm.Probe(&Target{IP: ip, Port: port, Protocol: ProtoDNS, DNS: tc.probe}); (err == nil) != tc.expected {
+			t.Errorf("test case %s failed, expect %v, err %v", tc.name, tc.expected, err)
+		}
+	}
+}
+
+func TestValidateTarget(t *testing.T) {
+	testcases := []struct {
+		name   string
+		target *Target
+		valid  bool
+	}{
+		{"no protocol", &Target{IP: "127.0.0.1"}, true},
+		{"unknown protocol", &Target{IP: "127.0.0.1", Protocol: "sctp"}, false},
+		{"http defaults", &Target{IP: "127.0.0.1", Protocol: ProtoHTTPS}, true},
+		{"http method", &Target{IP: "127.0.0.1", Protocol: ProtoHTTP, HTTP: &HTTPProbe{Method: http.MethodPost}}, false},
+		{"http path", &Target{IP: "127.0.0.1", Protocol: ProtoHTTP, HTTP: &HTTPProbe{Path: "healthz"}}, false},
+		{"udp without payload", &Target{IP: "127.0.0.1", Port: 53, Protocol: ProtoUDP, UDP: &UDPProbe{}}, false},
+		{"udp without port", &Target{IP: "127.0.0.1", Protocol: ProtoUDP, UDP: &UDPProbe{Send: "ping"}}, false},
+		{"dns without domain", &Target{IP: "127.0.0.1", Protocol: ProtoDNS}, false},
+		{"dns", &Target{IP: "127.0.0.1", Protocol: ProtoDNS, DNS: &DNSProbe{Domain: "example.test"}}, true},
+	}
+	for _, tc := range testcases {
+		if err := ValidateTarget(tc.target); (err == nil) != tc.valid {
+			t.Errorf("test case %s failed, expect valid %v, err %v", tc.name, tc.valid, err)
+		}
+	}
+	https := &Target{IP: "127.0.0.1", Protocol: ProtoHTTPS}
+	ValidateTarget(https)
+	if https.Port != 443 || https.HTTP.Method != http.MethodGet || https.HTTP.Path != "/" || https.HTTP.ExpectedStatus != http.StatusOK {
+		t.Errorf("unexpected defaults %+v %+v", https, https.HTTP)
+	}
+	dns := &Target{IP: "127.0.0.1", Protocol: ProtoDNS, DNS: &DNSProbe{Domain: "example.test"}}
+	ValidateTarget(dns)
+	if dns.Port != 53 {
+		t.Errorf("unexpected dns port %d", dns.Port)
+	}
+}
@@ -5,18 +5,68 @@ import "github.com/superedge/superedge/pkg/edge-health/data"
 const (
 	ProtoTCP      = "tcp"
 	ProtoICMP     = "icmp"
+	ProtoHTTP     = "http"
+	ProtoHTTPS    = "https"
+	ProtoUDP      = "udp"
+	ProtoDNS      = "dns"
 	MaxProbeIPs   = 100
 	MaxTargetName = 128
+	// MaxUDPPayload bounds the payload sent and the reply read by udp probes
+	MaxUDPPayload = 1024
 )
 
-var ProtoSet = map[string]struct{}{ProtoTCP: {}, ProtoICMP: {}}
+var ProtoSet = map[string]struct{}{
+	ProtoTCP:   {},
+	ProtoICMP:  {},
+	ProtoHTTP:  {},
+	ProtoHTTPS: {},
+	ProtoUDP:   {},
+	ProtoDNS:   {},
+}
 
 type Target struct {
 	Name     string `json:"name,omitempty"`
 	IP       string `json:"ip"`
 	Port     int32  `json:"port,omitempty"`
 	Protocol string `json:"protocol,omitempty"`
-	Normal   *bool  `json:"normal,omitempty"`
+	// HTTP configures the http and https probes, UDP and DNS the udp and dns probes
+	HTTP *HTTPProbe `json:"http,omitempty"`
+	UDP  *UDPProbe  `json:"udp,omitempty"`
+	DNS  *DNSProbe  `json:"dns,omitempty"`
+
+	Normal *bool `json:"normal,omitempty"`
+	// LatencyMs is the time the probe took in milliseconds
+	LatencyMs *float64 `json:"latencyMs,omitempty"`
+	// Error is the reason of the failure of the probe
+	Error string `json:"error,omitempty"`
+}
+
+// HTTPProbe sends a request to ip and port, which default to 80 for http and 443 for https
+type HTTPProbe struct {
+	// Method is GET or HEAD, defaults to GET
+	Method string `json:"method,omitempty"`
+	// Path defaults to /
+	Path string `json:"path,omitempty"`
+	// Host is the Host header and the TLS server name, defaults to ip
+	Host string `json:"host,omitempty"`
+	// ExpectedStatus defaults to 200, redirects are not followed
+	ExpectedStatus int `json:"expectedStatus,omitempty"`
+	// InsecureSkipVerify does not verify the certificate of https targets
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// UDPProbe sends a datagram to ip and port and waits for the reply
+type UDPProbe struct {
+	Send string `json:"send"`
+	// Expect must be contained in the reply, any reply is accepted when it is empty
+	Expect string `json:"expect,omitempty"`
+}
+
+// DNSProbe resolves a domain with the DNS server at ip and port, port defaults to 53
+type DNSProbe struct {
+	Domain string `json:"domain"`
+	// Expected are the addresses of which one must be resolved, any address is accepted when it is empty
+	Expected []string `json:"expected,omitempty"`
 }
 
 type SourceInfo struct {
@@ -39,3 +89,48 @@ type LocalInfoResp struct {
 	LocalInfo map[string]map[string]data.ResultDetail `json:"localInfo,omitempty"`
 	*SourceInfo
 }
+
+const (
+	GossipPing    = "ping"
+	GossipPingReq = "ping-req"
+
+	MemberAlive   = "alive"
+	MemberSuspect = "suspect"
+	MemberDead    = "dead"
+)
+
+// GossipMessage is sent to a node in gossip mode, the answer carries Ack. Both piggyback the
+// membership updates which have not been gossiped enough times, the versions of the results known by
+// the sender and some of the results the receiver misses.
+type GossipMessage struct {
+	Type string `json:"type"`
+	// node ip of the sender
+	From        string `json:"from"`
+	Incarnation uint64 `json:"incarnation"`
+	// the node probed on behalf of the sender of a ping-req
+	Target  string          `json:"target,omitempty"`
+	Ack     bool            `json:"ack,omitempty"`
+	Members []*MemberUpdate `json:"members,omitempty"`
+	// versions of the results known by the sender by checker ip
+	Versions map[string]int64 `json:"versions,omitempty"`
+	Results  []*ResultEntry   `json:"results,omitempty"`
+}
+
+type MemberUpdate struct {
+	IP          string `json:"ip"`
+	State       string `json:"state"`
+	Incarnation uint64 `json:"incarnation"`
+}
+
+// ResultEntry is the result of a checker. It is signed with its version by Hmac, or by Signature with the key of
+// Cert, the certificate of the checker, when the peers communicate over mTLS. When Base is set the entry is a delta,
+// ResultDetail only holds the nodes changed since the version Base and Removed the nodes no longer checked, the
+// certificate of Base is used when Cert is empty.
+type ResultEntry struct {
+	data.CommunicateData
+	Version   int64    `json:"version"`
+	Base      int64    `json:"base,omitempty"`
+	Removed   []string `json:"removed,omitempty"`
+	Cert      []byte   `json:"cert,omitempty"`
+	Signature []byte   `json:"signature,omitempty"`
+}
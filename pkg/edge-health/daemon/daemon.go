@@ -18,6 +18,8 @@ package daemon
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"sync"
 	"time"
 
@@ -26,9 +28,13 @@ import (
 	"github.com/superedge/superedge/pkg/edge-health/checkplugin"
 	"github.com/superedge/superedge/pkg/edge-health/common"
 	"github.com/superedge/superedge/pkg/edge-health/communicate"
+	edgeoptions "github.com/superedge/superedge/pkg/edge-health/options"
+	"github.com/superedge/superedge/pkg/edge-health/peertls"
 	"github.com/superedge/superedge/pkg/edge-health/registry"
+	"github.com/superedge/superedge/pkg/edge-health/uplink"
 	"github.com/superedge/superedge/pkg/edge-health/vote"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
 )
 
 type Daemon interface {
@@ -36,34 +42,63 @@ type Daemon interface {
 }
 
 type EdgeDaemon struct {
-	HealthCheckPeriod     int
-	HealthCheckScoreLine  float64
-	CommunicatePeriod     int
-	CommunicateTimeout    int
-	CommunicateRetryTime  int
-	CommunicateServerPort int
-	VotePeriod            int
-	VoteTimeOut           int
-	MasterUrl             string
-	KubeconfigPath        string
-	HostName              string
-	ExtendOptions         []registry.ExtendOptions
+	HealthCheckPeriod       int
+	HealthCheckScoreLine    float64
+	UplinkTunnelUrl         string
+	UplinkLiteAPIServerUrl  string
+	CommunicatePeriod       int
+	CommunicateTimeout      int
+	CommunicateRetryTime    int
+	CommunicateServerPort   int
+	CommunicateTLS          bool
+	CommunicateTLSPort      int
+	CommunicateMode         string
+	GossipConfig            communicate.GossipConfig
+	VotePeriod              int
+	VoteTimeOut             int
+	NodeUnhealthAnnotation  bool
+	CloudPartitionCondition bool
+	VoteConfig              vote.VoteConfig
+	MasterUrl               string
+	KubeconfigPath          string
+	HostName                string
+	ExtendOptions           []registry.ExtendOptions
 }
 
 func NewEdgeHealthDaemon(o options.CompletedOptions, registryOptions ...registry.ExtendOptions) Daemon {
 	return EdgeDaemon{
-		HealthCheckPeriod:     o.CheckOptions.HealthCheckPeriod,
-		HealthCheckScoreLine:  o.CheckOptions.HealthCheckScoreLine,
-		CommunicatePeriod:     o.CommunOptions.CommunicatePeriod,
-		CommunicateTimeout:    o.CommunOptions.CommunicateTimeout,
-		CommunicateRetryTime:  o.CommunOptions.CommunicateRetryTime,
-		CommunicateServerPort: o.CommunOptions.CommunicateServerPort,
-		VotePeriod:            o.VoteOptions.VotePeriod,
-		VoteTimeOut:           o.VoteOptions.VoteTimeOut,
-		MasterUrl:             o.NodeOptions.MasterUrl,
-		KubeconfigPath:        o.NodeOptions.KubeconfigPath,
-		HostName:              o.NodeOptions.HostName,
-		ExtendOptions:         registryOptions,
+		HealthCheckPeriod:      o.CheckOptions.HealthCheckPeriod,
+		HealthCheckScoreLine:   o.CheckOptions.HealthCheckScoreLine,
+		UplinkTunnelUrl:        o.CheckOptions.UplinkTunnelUrl,
+		UplinkLiteAPIServerUrl: o.CheckOptions.UplinkLiteAPIServerUrl,
+		CommunicatePeriod:      o.CommunOptions.CommunicatePeriod,
+		CommunicateTimeout:     o.CommunOptions.CommunicateTimeout,
+		CommunicateRetryTime:   o.CommunOptions.CommunicateRetryTime,
+		CommunicateServerPort:  o.CommunOptions.CommunicateServerPort,
+		CommunicateTLS:         o.CommunOptions.CommunicateTLS,
+		CommunicateTLSPort:     o.CommunOptions.CommunicateTLSPort,
+		CommunicateMode:        o.CommunOptions.CommunicateMode,
+		GossipConfig: communicate.GossipConfig{
+			Fanout:         o.CommunOptions.GossipFanout,
+			IndirectProbes: o.CommunOptions.GossipIndirectProbes,
+			RetransmitMult: o.CommunOptions.GossipRetransmitMult,
+			MaxDetails:     o.CommunOptions.GossipMaxDetails,
+			RefreshRounds:  o.CommunOptions.GossipRefreshRounds,
+		},
+		VotePeriod:              o.VoteOptions.VotePeriod,
+		VoteTimeOut:             o.VoteOptions.VoteTimeOut,
+		NodeUnhealthAnnotation:  o.VoteOptions.NodeUnhealthAnnotation,
+		CloudPartitionCondition: o.VoteOptions.CloudPartitionCondition,
+		VoteConfig: vote.VoteConfig{
+			UnhealthyThreshold: o.VoteOptions.VoteUnhealthyThreshold,
+			HealthyThreshold:   o.VoteOptions.VoteHealthyThreshold,
+			UnhealthyRounds:    o.VoteOptions.VoteUnhealthyRounds,
+			HealthyRounds:      o.VoteOptions.VoteHealthyRounds,
+		},
+		MasterUrl:      o.NodeOptions.MasterUrl,
+		KubeconfigPath: o.NodeOptions.KubeconfigPath,
+		HostName:       o.NodeOptions.HostName,
+		ExtendOptions:  registryOptions,
 	}
 }
 
@@ -78,21 +113,43 @@ func (d EdgeDaemon) Run(ctx context.Context) {
 	}
 
 	check := checkpkg.NewCheckEdge(checkplugin.PluginInfo.Plugins, d.HealthCheckPeriod, d.HealthCheckScoreLine)
+	checkplugin.LocalCheckClient = func(nodeIP string, timeout time.Duration) (*http.Client, string, error) {
+		podIP, err := checkpkg.PodManager.GetPodIPByNodeIP(nodeIP)
+		if err != nil {
+			return nil, "", err
+		}
+		return peertls.NewPeerClient(nodeIP, podIP, d.CommunicateServerPort, "/localcheck", timeout)
+	}
+	if d.CommunicateTLS {
+		certManager, err := peertls.NewCertManager(common.ClientSet, common.NodeName, common.NodeIP, d.CommunicateTLSPort, peerCABundle)
+		if err != nil {
+			klog.Fatalf("init certificate manager of edge-health peer err: %v", err)
+		}
+		go certManager.Run(ctx)
+	}
 
 	//TODO: Template pattern
 	go checkpkg.NewNodeMetaController(common.MetadataClientSet).Run(ctx)
 	go checkpkg.NewPodController(common.ClientSet).Run(ctx)
 	go checkpkg.NewConfigMapController(common.ClientSet).Run(ctx)
+	go checkpkg.NewPolicyController(common.DynamicClientSet, check, checkplugin.PluginInfo.Plugins, d.HealthCheckScoreLine).Run(ctx)
 	go wait.Until(check.GetNodeList, time.Duration(check.GetHealthCheckPeriod())*time.Second, ctx.Done())
 	go wait.Until(check.Check, time.Duration(check.GetHealthCheckPeriod())*time.Second, ctx.Done())
-
-	commun := communicate.NewCommunicateEdge(d.CommunicatePeriod, d.CommunicateTimeout, d.CommunicateRetryTime, d.CommunicateServerPort)
+	prober := uplink.NewProber(d.UplinkTunnelUrl, d.UplinkLiteAPIServerUrl, time.Duration(d.CommunicateTimeout)*time.Second)
+	go wait.Until(prober.Probe, time.Duration(check.GetHealthCheckPeriod())*time.Second, ctx.Done())
+
+	var commun communicate.Communicate
+	if d.CommunicateMode == edgeoptions.CommunicateModeGossip {
+		commun = communicate.NewGossipEdge(d.CommunicatePeriod, d.CommunicateTimeout, d.CommunicateRetryTime, d.CommunicateServerPort, d.GossipConfig)
+	} else {
+		commun = communicate.NewCommunicateEdge(d.CommunicatePeriod, d.CommunicateTimeout, d.CommunicateRetryTime, d.CommunicateServerPort)
+	}
 	//TODO: Template pattern
 	wg.Add(1)
 	go commun.Server(ctx, &wg)
 	go wait.Until(commun.Client, time.Duration(commun.GetPeriod())*time.Second, ctx.Done())
 
-	vote := vote.NewVoteEdge(d.VoteTimeOut, d.VotePeriod)
+	vote := vote.NewVoteEdge(d.VoteTimeOut, d.VotePeriod, d.NodeUnhealthAnnotation, d.CloudPartitionCondition, d.VoteConfig)
 	go wait.Until(vote.Vote, time.Duration(vote.GetVotePeriod())*time.Second, ctx.Done())
 
 	for range ctx.Done() {
@@ -100,3 +157,15 @@ func (d EdgeDaemon) Run(ctx context.Context) {
 		return
 	}
 }
+
+// peerCABundle returns the CA certificates published by the signer of the peer certificates
+func peerCABundle() ([]byte, error) {
+	cm, err := checkpkg.ConfigMapManager.ConfigMapLister.ConfigMaps(common.Namespace).Get(common.PeerCAConfigMap)
+	if err != nil {
+		return nil, err
+	}
+	if cm.Data[common.PeerCAKey] == "" {
+		return nil, fmt.Errorf("ConfigMap %s has no %s", common.PeerCAConfigMap, common.PeerCAKey)
+	}
+	return []byte(cm.Data[common.PeerCAKey]), nil
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/superedge/superedge/pkg/edge-health/common"
 	"github.com/superedge/superedge/pkg/edge-health/data"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/tools/clientcmd"
@@ -51,6 +52,7 @@ func initClientSet(masterUrl, kubeconfigPath string) {
 	}
 	common.MetadataClientSet = metadata.NewForConfigOrDie(kubeconfig)
 	common.ClientSet = kubernetes.NewForConfigOrDie(kubeconfig)
+	common.DynamicClientSet = dynamic.NewForConfigOrDie(kubeconfig)
 }
 
 func initHostName(hostName string) {
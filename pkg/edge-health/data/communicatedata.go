@@ -20,4 +20,8 @@ type CommunicateData struct {
 	SourceIP     string                  `json:"sourceIP,omitempty"`     //clientIP，checker ip
 	ResultDetail map[string]ResultDetail `json:"resultDetail,omitempty"` //checdedip checkdetail
 	Hmac         string                  `json:"hmac,omitempty"`
+	// Uplink is the uplink of the checker. It is signed apart by UplinkHmac so that old peers still verify Hmac,
+	// gossip signs it with the result.
+	Uplink     *UplinkStatus `json:"uplink,omitempty"`
+	UplinkHmac string        `json:"uplinkHmac,omitempty"`
 }
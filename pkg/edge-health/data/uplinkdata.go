@@ -0,0 +1,79 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package data
+
+import (
+	"sync"
+	"time"
+)
+
+// Uplink keeps the uplink reported by each node, by node ip
+var Uplink = NewUplinkData()
+
+// UplinkStatus is the reachability of the cloud from a node, a probe is nil when it is disabled on the node
+type UplinkStatus struct {
+	// Tunnel is whether tunnel-edge is connected to tunnel-cloud
+	Tunnel *bool `json:"tunnel,omitempty"`
+	// LiteAPIServer is whether lite-apiserver reaches kube-apiserver
+	LiteAPIServer *bool `json:"liteAPIServer,omitempty"`
+	// Time is set to the local time when the status is received
+	Time int64 `json:"time,omitempty"`
+}
+
+// Connected returns whether none of the probes of the node failed
+func (s UplinkStatus) Connected() bool {
+	return (s.Tunnel == nil || *s.Tunnel) && (s.LiteAPIServer == nil || *s.LiteAPIServer)
+}
+
+type UplinkData struct {
+	lock   sync.Mutex
+	uplink map[string]UplinkStatus
+}
+
+func NewUplinkData() *UplinkData {
+	return &UplinkData{uplink: make(map[string]UplinkStatus)}
+}
+
+func (u *UplinkData) SetUplink(ip string, status UplinkStatus) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	status.Time = time.Now().UTC().Unix()
+	u.uplink[ip] = status
+}
+
+func (u *UplinkData) GetUplink(ip string) (UplinkStatus, bool) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	status, ok := u.uplink[ip]
+	return status, ok
+}
+
+func (u *UplinkData) CopyUplinkAll() map[string]UplinkStatus {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	temp := make(map[string]UplinkStatus, len(u.uplink))
+	for ip, status := range u.uplink {
+		temp[ip] = status
+	}
+	return temp
+}
+
+func (u *UplinkData) DeleteUplink(ip string) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	delete(u.uplink, ip)
+}
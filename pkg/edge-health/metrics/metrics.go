@@ -0,0 +1,127 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	VoteYes = "yes"
+	VoteNo  = "no"
+
+	StateHealthy   = "healthy"
+	StateUnhealthy = "unhealthy"
+
+	// the reasons of the communication errors
+	ReasonHmacMismatch        = "hmac_mismatch"
+	ReasonCertificateMismatch = "certificate_mismatch"
+	ReasonDecode              = "decode"
+	ReasonRequest             = "request"
+	ReasonStatus              = "status"
+
+	UplinkTunnel        = "tunnel"
+	UplinkLiteAPIServer = "lite_apiserver"
+)
+
+var (
+	CheckScore = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "edge_health_check_score",
+			Help: "Total score of the checks of the peer in the last round, the peer is voted healthy by this node when it reaches the score line.",
+		},
+		[]string{"peer"},
+	)
+
+	CheckDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "edge_health_check_duration_seconds",
+			Help:    "Time taken by the check plugin to check all the peers in a round.",
+			Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+		},
+		[]string{"plugin"},
+	)
+
+	CheckFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "edge_health_check_failures_total",
+			Help: "Number of the checks of a peer failed by the check plugin.",
+		},
+		[]string{"plugin"},
+	)
+
+	VotesCast = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "edge_health_votes_cast_total",
+			Help: "Number of the votes of this node on the peers.",
+		},
+		[]string{"vote"},
+	)
+
+	VotesReceived = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "edge_health_votes_received_total",
+			Help: "Number of the votes of the peers received by this node, directly or through gossip.",
+		},
+		[]string{"vote"},
+	)
+
+	VoteTransitions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "edge_health_vote_transitions_total",
+			Help: "Number of the state changes of the nodes decided by the vote of this node.",
+		},
+		[]string{"node", "state"},
+	)
+
+	UplinkConnected = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "edge_health_uplink_connected",
+			Help: "Reachability of the cloud from this node, 1 for connected and 0 for disconnected.",
+		},
+		[]string{"uplink"},
+	)
+
+	CloudPartitioned = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "edge_health_cloud_partitioned",
+			Help: "Verdict of this node on the NodeUnit, 1 when no node of the NodeUnit reaches the cloud.",
+		},
+		[]string{"nodeunit"},
+	)
+
+	CommunicationErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "edge_health_communication_errors_total",
+			Help: "Number of the failed exchanges of the results with the peers.",
+		},
+		[]string{"reason"},
+	)
+)
+
+func RegisterMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(CheckScore, CheckDuration, CheckFailures, VotesCast, VotesReceived, VoteTransitions,
+		UplinkConnected, CloudPartitioned, CommunicationErrors)
+}
+
+// Vote returns the label of the vote
+func Vote(normal bool) string {
+	if normal {
+		return VoteYes
+	}
+	return VoteNo
+}
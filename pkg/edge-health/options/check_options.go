@@ -19,12 +19,16 @@ package options
 import (
 	"github.com/spf13/pflag"
 	"github.com/superedge/superedge/pkg/edge-health/checkplugin"
+	"github.com/superedge/superedge/pkg/edge-health/uplink"
 )
 
 type CheckOptions struct {
 	Checks               []string //check method
 	HealthCheckPeriod    int
 	HealthCheckScoreLine float64
+	// the health endpoints probed for the uplink of this node to the cloud, empty to skip
+	UplinkTunnelUrl        string
+	UplinkLiteAPIServerUrl string
 }
 
 func NewCheckOptions() *CheckOptions {
@@ -34,6 +38,8 @@ func NewCheckOptions() *CheckOptions {
 func (o *CheckOptions) Default() {
 	o.HealthCheckScoreLine = 100.0
 	o.HealthCheckPeriod = 10
+	o.UplinkTunnelUrl = uplink.DefaultTunnelURL
+	o.UplinkLiteAPIServerUrl = uplink.DefaultLiteAPIServerURL
 }
 
 func (o *CheckOptions) Validate() []error {
@@ -55,4 +61,6 @@ func (o *CheckOptions) AddFlags(fs *pflag.FlagSet) {
 
 	fs.IntVar(&o.HealthCheckPeriod, "healthcheckperiod", o.HealthCheckPeriod, "health check period")
 	fs.Float64Var(&o.HealthCheckScoreLine, "healthcheckscoreline", o.HealthCheckScoreLine, "health check score line")
+	fs.StringVar(&o.UplinkTunnelUrl, "uplinktunnelurl", o.UplinkTunnelUrl, "health endpoint of tunnel-edge probed for the uplink to the cloud, empty to skip")
+	fs.StringVar(&o.UplinkLiteAPIServerUrl, "uplinkliteapiserverurl", o.UplinkLiteAPIServerUrl, "upstream health endpoint of lite-apiserver probed for the uplink to the cloud, empty to skip")
 }
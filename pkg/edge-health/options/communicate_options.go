@@ -16,13 +16,32 @@ limitations under the License.
 
 package options
 
-import "github.com/spf13/pflag"
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	// CommunicateModeFullMesh sends the results to every checked node
+	CommunicateModeFullMesh = "fullmesh"
+	// CommunicateModeGossip disseminates the results with SWIM-style gossip
+	CommunicateModeGossip = "gossip"
+)
 
 type CommunOptions struct {
 	CommunicatePeriod     int
 	CommunicateTimeout    int
 	CommunicateRetryTime  int
 	CommunicateServerPort int
+	CommunicateTLS        bool
+	CommunicateTLSPort    int
+	CommunicateMode       string
+	GossipFanout          int
+	GossipIndirectProbes  int
+	GossipRetransmitMult  int
+	GossipMaxDetails      int
+	GossipRefreshRounds   int
 }
 
 func NewCommunOptions() *CommunOptions {
@@ -34,10 +53,29 @@ func (o *CommunOptions) Default() {
 	o.CommunicateRetryTime = 1
 	o.CommunicateTimeout = 2
 	o.CommunicateServerPort = 51005
+	o.CommunicateTLS = true
+	o.CommunicateTLSPort = 51006
+	o.CommunicateMode = CommunicateModeFullMesh
+	o.GossipFanout = 3
+	o.GossipIndirectProbes = 3
+	o.GossipRetransmitMult = 4
+	o.GossipMaxDetails = 4096
+	o.GossipRefreshRounds = 10
 }
 
 func (o *CommunOptions) Validate() []error {
-	return nil
+	var errs []error
+	if o.CommunicateMode != CommunicateModeFullMesh && o.CommunicateMode != CommunicateModeGossip {
+		errs = append(errs, fmt.Errorf("invalid communicatemode %s, must be %s or %s", o.CommunicateMode, CommunicateModeFullMesh, CommunicateModeGossip))
+	}
+	if o.CommunicateTLS && (o.CommunicateTLSPort <= 0 || o.CommunicateTLSPort > 65535 || o.CommunicateTLSPort == o.CommunicateServerPort) {
+		errs = append(errs, fmt.Errorf("invalid communicatetlsport %d, it must be a port other than communicateserverport", o.CommunicateTLSPort))
+	}
+	if o.CommunicateMode == CommunicateModeGossip && (o.GossipFanout <= 0 || o.GossipIndirectProbes < 0 || o.GossipRetransmitMult <= 0 ||
+		o.GossipMaxDetails <= 0 || o.GossipRefreshRounds <= 0) {
+		errs = append(errs, fmt.Errorf("gossipfanout, gossipretransmitmult, gossipmaxdetails and gossiprefreshrounds must be positive, gossipindirectprobes must not be negative"))
+	}
+	return errs
 }
 
 func (o *CommunOptions) AddFlags(fs *pflag.FlagSet) {
@@ -48,4 +86,12 @@ func (o *CommunOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.IntVar(&o.CommunicateTimeout, "communicatetimetout", o.CommunicateTimeout, "communicate timetout")
 	fs.IntVar(&o.CommunicateRetryTime, "communicateretrytime", o.CommunicateRetryTime, "communicate retry time")
 	fs.IntVar(&o.CommunicateServerPort, "communicateserverport", o.CommunicateServerPort, "communicate server port")
+	fs.BoolVar(&o.CommunicateTLS, "communicatetls", o.CommunicateTLS, "authenticate the peers with mTLS, the certificates are signed by edge-health-admission. Set false to keep the HMAC of hmac-config")
+	fs.IntVar(&o.CommunicateTLSPort, "communicatetlsport", o.CommunicateTLSPort, "port serving the peers over mTLS")
+	fs.StringVar(&o.CommunicateMode, "communicatemode", o.CommunicateMode, "how the results are exchanged, fullmesh or gossip")
+	fs.IntVar(&o.GossipFanout, "gossipfanout", o.GossipFanout, "number of nodes gossiped with in each communicate period")
+	fs.IntVar(&o.GossipIndirectProbes, "gossipindirectprobes", o.GossipIndirectProbes, "number of nodes asked to probe a node which does not answer")
+	fs.IntVar(&o.GossipRetransmitMult, "gossipretransmitmult", o.GossipRetransmitMult, "a membership update is gossiped gossipretransmitmult*log2(nodes) times")
+	fs.IntVar(&o.GossipMaxDetails, "gossipmaxdetails", o.GossipMaxDetails, "result details carried by a gossip message at most, a result counts the nodes it holds or the nodes changed when it is sent as a delta")
+	fs.IntVar(&o.GossipRefreshRounds, "gossiprefreshrounds", o.GossipRefreshRounds, "communicate periods after which an unchanged result is gossiped again")
 }
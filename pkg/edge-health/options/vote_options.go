@@ -16,11 +16,25 @@ limitations under the License.
 
 package options
 
-import "github.com/spf13/pflag"
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
 
 type VoteOptions struct {
 	VotePeriod  int
 	VoteTimeOut int // vote will be timeout after VoteTimeOut
+	// also publish the verdicts as the nodeunhealth annotation read by old edge-health-admission
+	NodeUnhealthAnnotation bool
+	// a node is voted unhealthy or healthy by more than the threshold of the checking nodes
+	VoteUnhealthyThreshold float64
+	VoteHealthyThreshold   float64
+	// the state of a node changes after the same verdict in the consecutive rounds
+	VoteUnhealthyRounds int
+	VoteHealthyRounds   int
+	// publish the CloudPartitioned condition of the NodeUnits from the uplinks of their nodes
+	CloudPartitionCondition bool
 }
 
 func NewVoteOptions() *VoteOptions {
@@ -30,10 +44,22 @@ func NewVoteOptions() *VoteOptions {
 func (o *VoteOptions) Default() {
 	o.VotePeriod = 10
 	o.VoteTimeOut = 60
+	o.VoteUnhealthyThreshold = 0.5
+	o.VoteHealthyThreshold = 0.5
+	o.VoteUnhealthyRounds = 1
+	o.VoteHealthyRounds = 1
+	o.CloudPartitionCondition = true
 }
 
 func (o *VoteOptions) Validate() []error {
-	return nil
+	var errs []error
+	if o.VoteUnhealthyThreshold < 0 || o.VoteUnhealthyThreshold >= 1 || o.VoteHealthyThreshold < 0 || o.VoteHealthyThreshold >= 1 {
+		errs = append(errs, fmt.Errorf("voteunhealthythreshold and votehealthythreshold must be in [0, 1)"))
+	}
+	if o.VoteUnhealthyRounds < 1 || o.VoteHealthyRounds < 1 {
+		errs = append(errs, fmt.Errorf("voteunhealthyrounds and votehealthyrounds must be at least 1"))
+	}
+	return errs
 }
 
 func (o *VoteOptions) AddFlags(fs *pflag.FlagSet) {
@@ -42,4 +68,10 @@ func (o *VoteOptions) AddFlags(fs *pflag.FlagSet) {
 	}
 	fs.IntVar(&o.VotePeriod, "voteperiod", o.VotePeriod, "vote period")
 	fs.IntVar(&o.VoteTimeOut, "votetimeout", o.VoteTimeOut, "vote timeout")
+	fs.Float64Var(&o.VoteUnhealthyThreshold, "voteunhealthythreshold", o.VoteUnhealthyThreshold, "a node is voted unhealthy by more than this fraction of the checking nodes")
+	fs.Float64Var(&o.VoteHealthyThreshold, "votehealthythreshold", o.VoteHealthyThreshold, "a node is voted healthy by more than this fraction of the checking nodes")
+	fs.IntVar(&o.VoteUnhealthyRounds, "voteunhealthyrounds", o.VoteUnhealthyRounds, "consecutive unhealthy verdicts needed to mark a node unhealthy")
+	fs.IntVar(&o.VoteHealthyRounds, "votehealthyrounds", o.VoteHealthyRounds, "consecutive healthy verdicts needed to mark a node recovered")
+	fs.BoolVar(&o.NodeUnhealthAnnotation, "nodeunhealthannotation", o.NodeUnhealthAnnotation, "also add the nodeunhealth annotation to the nodes voted unhealthy, for the compatibility with old edge-health-admission")
+	fs.BoolVar(&o.CloudPartitionCondition, "cloudpartitioncondition", o.CloudPartitionCondition, "publish the CloudPartitioned condition of the NodeUnits of this node, true when none of their nodes reaches the cloud")
 }
@@ -0,0 +1,295 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peertls
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/superedge/superedge/pkg/edge-health/common"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/certificate"
+	"k8s.io/klog/v2"
+)
+
+// Manager is nil when the peers communicate over HTTP with HMAC
+var Manager *CertManager
+
+// CertManager holds the certificate of this node, which is requested with a CertificateSigningRequest and rotated
+// before it expires. The certificate names the node IP, so the peers know which node sent a request.
+type CertManager struct {
+	// Port serves the peers over mTLS
+	Port        int
+	certManager certificate.Manager
+	// caBundle returns the PEM of the CA certificates trusted for the peers
+	caBundle func() ([]byte, error)
+
+	lock   sync.Mutex
+	caPEM  string
+	caPool *x509.CertPool
+}
+
+func NewCertManager(client kubernetes.Interface, nodeName, nodeIP string, port int, caBundle func() ([]byte, error)) (*CertManager, error) {
+	ip := net.ParseIP(nodeIP)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid node ip %s", nodeIP)
+	}
+	certManager, err := certificate.NewManager(&certificate.Config{
+		ClientsetFn: func(current *tls.Certificate) (kubernetes.Interface, error) {
+			return client, nil
+		},
+		Template: &x509.CertificateRequest{
+			Subject: pkix.Name{
+				CommonName:   nodeName,
+				Organization: []string{common.PeerCertOrganization},
+			},
+			IPAddresses: []net.IP{ip},
+		},
+		SignerName: common.PeerCertSignerName,
+		Usages: []certificatesv1.KeyUsage{
+			certificatesv1.UsageDigitalSignature,
+			certificatesv1.UsageKeyEncipherment,
+			certificatesv1.UsageServerAuth,
+			certificatesv1.UsageClientAuth,
+		},
+		CertificateStore: &memoryStore{},
+		Name:             "edge-health-peer",
+	})
+	if err != nil {
+		return nil, err
+	}
+	m := &CertManager{
+		Port:        port,
+		certManager: certManager,
+		caBundle:    caBundle,
+	}
+	Manager = m
+	return m, nil
+}
+
+func (m *CertManager) Run(ctx context.Context) {
+	m.certManager.Start()
+	<-ctx.Done()
+	m.certManager.Stop()
+}
+
+// ServerTLSConfig requires the clients to present a certificate signed by the CA, the certificate and the CA
+// are read on every handshake so that they are rotated without restarting the server
+func (m *CertManager) ServerTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		// http.Server needs a certificate in the config, GetConfigForClient replaces it in every handshake
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, _, err := m.current()
+			return cert, err
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool, err := m.current()
+			if err != nil {
+				return nil, err
+			}
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+				ClientCAs:    pool,
+				Certificates: []tls.Certificate{*cert},
+			}, nil
+		},
+	}
+}
+
+// Client returns a client presenting the certificate of this node, it only trusts the server when its
+// certificate names nodeIP, whichever pod ip it dials
+func (m *CertManager) Client(nodeIP string, timeout time.Duration) (*http.Client, error) {
+	cert, pool, err := m.current()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				RootCAs:      pool,
+				ServerName:   nodeIP,
+				Certificates: []tls.Certificate{*cert},
+			},
+			// the client is built for every request
+			DisableKeepAlives: true,
+		},
+	}, nil
+}
+
+// NewPeerClient returns the client and the url of path to reach edge-health on nodeIP through its pod ip,
+// port is used when the peers communicate over HTTP
+func NewPeerClient(nodeIP, podIP string, port int, path string, timeout time.Duration) (*http.Client, string, error) {
+	if Manager == nil {
+		return &http.Client{Timeout: timeout}, "http://" + net.JoinHostPort(podIP, strconv.Itoa(port)) + path, nil
+	}
+	client, err := Manager.Client(nodeIP, timeout)
+	if err != nil {
+		return nil, "", err
+	}
+	return client, "https://" + net.JoinHostPort(podIP, strconv.Itoa(Manager.Port)) + path, nil
+}
+
+func (m *CertManager) current() (*tls.Certificate, *x509.CertPool, error) {
+	cert := m.certManager.Current()
+	if cert == nil {
+		return nil, nil, fmt.Errorf("the certificate of %s is not issued yet", common.NodeName)
+	}
+	pool, err := m.pool()
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, pool, nil
+}
+
+func (m *CertManager) pool() (*x509.CertPool, error) {
+	caPEM, err := m.caBundle()
+	if err != nil {
+		return nil, err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.caPool != nil && string(caPEM) == m.caPEM {
+		return m.caPool, nil
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no CA certificate found in %s", common.PeerCAConfigMap)
+	}
+	m.caPEM, m.caPool = string(caPEM), pool
+	return pool, nil
+}
+
+// VerifyPeer checks that the client certificate of the request names nodeIP, requests whose certificate
+// identity does not match the node they speak for are rejected
+func VerifyPeer(r *http.Request, nodeIP string) error {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return fmt.Errorf("request from %s has no verified client certificate", r.RemoteAddr)
+	}
+	return namesNode(r.TLS.VerifiedChains[0][0], nodeIP)
+}
+
+// Sign signs payload with the key of the certificate of this node and returns the certificate with the
+// signature. The data relayed by other nodes carries both, so the relays can not forge it.
+func (m *CertManager) Sign(payload []byte) ([]byte, []byte, error) {
+	cert, _, err := m.current()
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, ok := cert.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("the key of the certificate of %s can not sign", common.NodeName)
+	}
+	digest := sha256.Sum256(payload)
+	signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert.Certificate[0], signature, nil
+}
+
+// VerifySignature checks that certDER is signed by the CA and names nodeIP, and that signature is the signature
+// of payload by the key of certDER
+func (m *CertManager) VerifySignature(nodeIP string, payload, certDER, signature []byte) error {
+	pool, err := m.pool()
+	if err != nil {
+		return err
+	}
+	leaf, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return fmt.Errorf("invalid certificate of %s: %v", nodeIP, err)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		return fmt.Errorf("certificate of %s is not trusted: %v", leaf.Subject.CommonName, err)
+	}
+	if err := namesNode(leaf, nodeIP); err != nil {
+		return err
+	}
+	digest := sha256.Sum256(payload)
+	switch key := leaf.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest[:], signature) {
+			return fmt.Errorf("signature of %s does not match", nodeIP)
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return fmt.Errorf("signature of %s does not match: %v", nodeIP, err)
+		}
+	default:
+		return fmt.Errorf("unsupported key %T of the certificate of %s", leaf.PublicKey, nodeIP)
+	}
+	return nil
+}
+
+func namesNode(leaf *x509.Certificate, nodeIP string) error {
+	ip := net.ParseIP(nodeIP)
+	for _, certIP := range leaf.IPAddresses {
+		if ip != nil && certIP.Equal(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("certificate of %s does not match %s, it names %v", leaf.Subject.CommonName, nodeIP, leaf.IPAddresses)
+}
+
+// memoryStore keeps the certificate in memory, a new one is requested after edge-health restarts
+type memoryStore struct {
+	lock sync.Mutex
+	cert *tls.Certificate
+}
+
+func (s *memoryStore) Current() (*tls.Certificate, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.cert == nil {
+		noCertKeyErr := certificate.NoCertKeyError("no certificate of edge-health peer in memory")
+		return nil, &noCertKeyErr
+	}
+	return s.cert, nil
+}
+
+func (s *memoryStore) Update(certData, keyData []byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(certData, keyData)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.cert = &cert
+	klog.V(2).Infof("certificate of edge-health peer is updated, it expires at %v", cert.Leaf.NotAfter)
+	return &cert, nil
+}
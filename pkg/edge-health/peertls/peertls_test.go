@@ -0,0 +1,178 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peertls
+
+import (
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/superedge/superedge/pkg/edge-health/common"
+	"github.com/superedge/superedge/pkg/util"
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/client-go/util/keyutil"
+)
+
+// staticManager serves a fixed certificate instead of requesting one
+type staticManager struct {
+	cert *tls.Certificate
+}
+
+func (m *staticManager) Current() *tls.Certificate { return m.cert }
+func (m *staticManager) Start()                    {}
+func (m *staticManager) Stop()                     {}
+func (m *staticManager) ServerHealthy() bool       { return true }
+
+func newCertManager(t *testing.T, caCert *x509.Certificate, caKey *rsa.PrivateKey, nodeIP string) *CertManager {
+	key, err := util.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := util.NewSignedCertWithDuration(&certutil.Config{
+		CommonName:   "node-" + nodeIP,
+		Organization: []string{common.PeerCertOrganization},
+		AltNames:     certutil.AltNames{IPs: []net.IP{net.ParseIP(nodeIP)}},
+		Usages:       []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}, key.Public(), caCert, caKey, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM, err := keyutil.MarshalPrivateKeyToPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tls.X509KeyPair(util.EncodeCertPEM(cert), keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &CertManager{
+		certManager: &staticManager{cert: &pair},
+		caBundle:    func() ([]byte, error) { return util.EncodeCertPEM(caCert), nil },
+	}
+}
+
+func TestPeerTLS(t *testing.T) {
+	_, caCert, caKey, err := util.GenerateCA("superedge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newCertManager(t, caCert, caKey, "127.0.0.1")
+	client := newCertManager(t, caCert, caKey, "10.0.0.2")
+	// the certificate of another cluster is not trusted
+	_, otherCACert, otherCAKey, err := util.GenerateCA("superedge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stranger := newCertManager(t, otherCACert, otherCAKey, "10.0.0.2")
+	stranger.caBundle = server.caBundle
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := VerifyPeer(r, r.URL.Query().Get("source")); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+		}
+	}))
+	srv.TLS = server.ServerTLSConfig()
+	srv.StartTLS()
+	defer srv.Close()
+
+	testcases := []struct {
+		name    string
+		manager *CertManager
+		nodeIP  string
+		source  string
+		status  int
+	}{
+		{"peer speaks for itself", client, "127.0.0.1", "10.0.0.2", http.StatusOK},
+		{"peer speaks for another node", client, "127.0.0.1", "10.0.0.3", http.StatusForbidden},
+		{"server is not the node dialed", client, "10.0.0.9", "10.0.0.2", 0},
+		{"certificate of another CA", stranger, "127.0.0.1", "10.0.0.2", 0},
+	}
+	for _, tc := range testcases {
+		c, err := tc.manager.Client(tc.nodeIP, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := c.Get(srv.URL + "/?source=" + tc.source)
+		if tc.status == 0 {
+			if err == nil {
+				resp.Body.Close()
+				t.Errorf("%s: expected a handshake error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestSignature(t *testing.T) {
+	_, caCert, caKey, err := util.GenerateCA("superedge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver := newCertManager(t, caCert, caKey, "10.0.0.1")
+	checker := newCertManager(t, caCert, caKey, "10.0.0.2")
+	_, otherCACert, otherCAKey, err := util.GenerateCA("superedge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stranger := newCertManager(t, otherCACert, otherCAKey, "10.0.0.2")
+
+	payload := []byte("result of 10.0.0.2")
+	cert, signature, err := checker.Sign(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strangerCert, strangerSignature, err := stranger.Sign(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testcases := []struct {
+		name      string
+		nodeIP    string
+		payload   []byte
+		cert      []byte
+		signature []byte
+		valid     bool
+	}{
+		{"signed by the checker", "10.0.0.2", payload, cert, signature, true},
+		{"relayed for another node", "10.0.0.3", payload, cert, signature, false},
+		{"tampered payload", "10.0.0.2", []byte("result of 10.0.0.3"), cert, signature, false},
+		{"certificate of another CA", "10.0.0.2", payload, strangerCert, strangerSignature, false},
+		{"no signature", "10.0.0.2", payload, nil, nil, false},
+	}
+	for _, tc := range testcases {
+		err := receiver.VerifySignature(tc.nodeIP, tc.payload, tc.cert, tc.signature)
+		if tc.valid && err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+}
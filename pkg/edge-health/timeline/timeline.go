@@ -0,0 +1,90 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timeline
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	DefaultCapacity = 1024
+
+	// EventCheck is recorded when the checks of this node on a peer change their result
+	EventCheck = "Check"
+	// EventVote is recorded when the vote changes the state of a node
+	EventVote = "Vote"
+)
+
+// Default keeps the latest events of edge-health, it is served at /timeline
+var Default = New(DefaultCapacity)
+
+type Event struct {
+	Time time.Time `json:"time"`
+	// Node is the ip of the node the event is about
+	Node    string `json:"node"`
+	Type    string `json:"type"`
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message"`
+}
+
+// Timeline is a ring buffer of events, the oldest events are overwritten when it is full
+type Timeline struct {
+	lock   sync.RWMutex
+	events []Event
+	// next is the index of the next event, the buffer is full once it wraps
+	next int
+	full bool
+}
+
+func New(capacity int) *Timeline {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &Timeline{events: make([]Event, capacity)}
+}
+
+func (t *Timeline) Record(node, eventType string, healthy bool, message string) {
+	t.Add(Event{Time: time.Now(), Node: node, Type: eventType, Healthy: healthy, Message: message})
+}
+
+func (t *Timeline) Add(e Event) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.events[t.next] = e
+	t.next++
+	if t.next == len(t.events) {
+		t.next, t.full = 0, true
+	}
+}
+
+// Events returns the events of node from the oldest, or the events of all the nodes when node is empty
+func (t *Timeline) Events(node string) []Event {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	ordered := t.events[:t.next]
+	if t.full {
+		ordered = append(append([]Event{}, t.events[t.next:]...), t.events[:t.next]...)
+	}
+	events := []Event{}
+	for _, e := range ordered {
+		if node == "" || e.Node == node {
+			events = append(events, e)
+		}
+	}
+	return events
+}
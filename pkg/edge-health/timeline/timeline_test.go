@@ -0,0 +1,59 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timeline
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestTimeline(t *testing.T) {
+	tl := New(3)
+	if events := tl.Events(""); len(events) != 0 {
+		t.Fatalf("expected no events, got %v", events)
+	}
+	for i := 0; i < 5; i++ {
+		node := "10.0.0.1"
+		if i%2 == 1 {
+			node = "10.0.0.2"
+		}
+		tl.Record(node, EventCheck, false, strconv.Itoa(i))
+	}
+
+	testcases := []struct {
+		node     string
+		messages []string
+	}{
+		{"", []string{"2", "3", "4"}},
+		{"10.0.0.1", []string{"2", "4"}},
+		{"10.0.0.2", []string{"3"}},
+		{"10.0.0.3", nil},
+	}
+	for _, tc := range testcases {
+		events := tl.Events(tc.node)
+		if len(events) != len(tc.messages) {
+			t.Errorf("node %q: expected %v, got %v", tc.node, tc.messages, events)
+			continue
+		}
+		for i, e := range events {
+			if e.Message != tc.messages[i] {
+				t.Errorf("node %q: expected %v, got %v", tc.node, tc.messages, events)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uplink
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/superedge/superedge/pkg/edge-health/common"
+	"github.com/superedge/superedge/pkg/edge-health/data"
+	"github.com/superedge/superedge/pkg/edge-health/metrics"
+	"k8s.io/klog/v2"
+)
+
+const (
+	DefaultTunnelURL        = "http://127.0.0.1:51010/edge/healthz"
+	DefaultLiteAPIServerURL = "https://127.0.0.1:51003/upstream/healthz"
+)
+
+// Prober probes the uplink of this node: the healthz of tunnel-edge, which fails when it is not connected to
+// tunnel-cloud, and the healthz of kube-apiserver through lite-apiserver. An empty url disables the probe.
+type Prober struct {
+	TunnelURL        string
+	LiteAPIServerURL string
+	client           *http.Client
+}
+
+func NewProber(tunnelURL, liteAPIServerURL string, timeout time.Duration) *Prober {
+	return &Prober{
+		TunnelURL:        tunnelURL,
+		LiteAPIServerURL: liteAPIServerURL,
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				// lite-apiserver serves a certificate for the kubelet, only the status code of the local healthz is read
+				TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+				DisableKeepAlives: true,
+			},
+		},
+	}
+}
+
+// Probe records the uplink of this node, it is sent to the peers with the check results
+func (p *Prober) Probe() {
+	status := data.UplinkStatus{
+		Tunnel:        p.probe(metrics.UplinkTunnel, p.TunnelURL),
+		LiteAPIServer: p.probe(metrics.UplinkLiteAPIServer, p.LiteAPIServerURL),
+	}
+	if status.Tunnel == nil && status.LiteAPIServer == nil {
+		return
+	}
+	data.Uplink.SetUplink(common.NodeIP, status)
+}
+
+func (p *Prober) probe(uplink, url string) *bool {
+	if url == "" {
+		return nil
+	}
+	connected := true
+	if err := p.get(url); err != nil {
+		klog.V(2).Infof("uplink: %s is disconnected: %v", uplink, err)
+		connected = false
+	}
+	if connected {
+		metrics.UplinkConnected.WithLabelValues(uplink).Set(1)
+	} else {
+		metrics.UplinkConnected.WithLabelValues(uplink).Set(0)
+	}
+	return &connected
+}
+
+func (p *Prober) get(url string) error {
+	res, err := p.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("status code is %d: %s", res.StatusCode, body)
+	}
+	return nil
+}
@@ -25,6 +25,7 @@ import (
 	"io"
 	"os"
 	"os/signal"
+	"strconv"
 
 	"github.com/superedge/superedge/pkg/edge-health/check"
 	"github.com/superedge/superedge/pkg/edge-health/common"
@@ -38,14 +39,41 @@ func GenerateHmac(communicatedata data.CommunicateData) (string, error) {
 	part1byte, _ := json.Marshal(communicatedata.SourceIP)
 	part2byte, _ := json.Marshal(communicatedata.ResultDetail)
 	hmacBefore := string(part1byte) + string(part2byte)
-	var hmacKey string
+	return GetHmacCode(hmacBefore, getHmacKey())
+}
+
+// GenerateVersionedHmac also signs the version of the data, so that old results relayed by gossip can not replace new ones
+func GenerateVersionedHmac(communicatedata data.CommunicateData, version int64) (string, error) {
+	return GetHmacCode(VersionedPayload(communicatedata, version), getHmacKey())
+}
+
+// VersionedPayload is the content of the data and its version signed for gossip
+func VersionedPayload(communicatedata data.CommunicateData, version int64) string {
+	part1byte, _ := json.Marshal(communicatedata.SourceIP)
+	part2byte, _ := json.Marshal(communicatedata.ResultDetail)
+	payload := string(part1byte) + string(part2byte) + strconv.FormatInt(version, 10)
+	if communicatedata.Uplink != nil {
+		part3byte, _ := json.Marshal(communicatedata.Uplink)
+		payload += string(part3byte)
+	}
+	return payload
+}
+
+// GenerateUplinkHmac signs the uplink of the data, which is not covered by GenerateHmac
+func GenerateUplinkHmac(communicatedata data.CommunicateData) (string, error) {
+	part1byte, _ := json.Marshal(communicatedata.SourceIP)
+	part2byte, _ := json.Marshal(communicatedata.Uplink)
+	hmacBefore := string(part1byte) + string(part2byte)
+	return GetHmacCode(hmacBefore, getHmacKey())
+}
+
+func getHmacKey() string {
 	if hmacconf, err := check.ConfigMapManager.ConfigMapLister.ConfigMaps(common.Namespace).Get(common.HmacConfig); err != nil || hmacconf.Data[common.HmacKey] == "" {
 		klog.V(6).InfoS("could not find hmac-config configmap, will use default hmac key")
-		hmacKey = common.DefaultHmacKey
+		return common.DefaultHmacKey
 	} else {
-		hmacKey = hmacconf.Data[common.HmacKey]
+		return hmacconf.Data[common.HmacKey]
 	}
-	return GetHmacCode(hmacBefore, hmacKey)
 }
 
 func GetHmacCode(s, key string) (string, error) {
@@ -0,0 +1,143 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/superedge/superedge/pkg/edge-health/common"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	log "k8s.io/klog/v2"
+)
+
+const (
+	EventReasonEdgeHealthy   = "EdgeHealthy"
+	EventReasonEdgeUnhealthy = "EdgeUnhealthy"
+)
+
+// ConditionPublisher keeps the EdgeHealthy condition of the nodes in line with the votes of this node. Every
+// edge-health votes, so the condition is only patched when it differs from the verdict, and an Event is
+// emitted by the node which patched the transition.
+type ConditionPublisher struct {
+	client   kubernetes.Interface
+	recorder record.EventRecorder
+
+	lock sync.Mutex
+	// the status of the condition seen on each node, it is read again from the apiserver after ReListTime
+	known map[string]knownStatus
+}
+
+type knownStatus struct {
+	status corev1.ConditionStatus
+	seen   time.Time
+}
+
+func NewConditionPublisher(client kubernetes.Interface, recorder record.EventRecorder) *ConditionPublisher {
+	return &ConditionPublisher{
+		client:   client,
+		recorder: recorder,
+		known:    make(map[string]knownStatus),
+	}
+}
+
+// Publish sets the EdgeHealthy condition of the node to the verdict, yes and no are the votes of the checkers
+func (p *ConditionPublisher) Publish(nodeName string, healthy bool, yes, no, checkers int) {
+	status := corev1.ConditionFalse
+	if healthy {
+		status = corev1.ConditionTrue
+	}
+	p.lock.Lock()
+	known, ok := p.known[nodeName]
+	p.lock.Unlock()
+	if ok && known.status == status && time.Since(known.seen) < common.ReListTime {
+		return
+	}
+
+	node, err := p.client.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+	if err != nil {
+		log.Errorf("get node %s to update %s condition error: %v", nodeName, common.EdgeHealthyCondition, err)
+		return
+	}
+	if current := getNodeCondition(node, common.EdgeHealthyCondition); current != nil && current.Status == status {
+		p.remember(nodeName, status)
+		return
+	}
+
+	condition := NewEdgeHealthyCondition(healthy, yes, no, checkers)
+	patchBytes, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []corev1.NodeCondition{condition},
+		},
+	})
+	if err != nil {
+		log.Errorf("marshal %s condition error: %v", common.EdgeHealthyCondition, err)
+		return
+	}
+	if _, err := p.client.CoreV1().Nodes().PatchStatus(context.TODO(), nodeName, patchBytes); err != nil {
+		log.Errorf("patch %s condition of %s error: %v", common.EdgeHealthyCondition, nodeName, err)
+		return
+	}
+	p.remember(nodeName, status)
+	log.V(2).Infof("patch %s condition of %s to %s: %s", common.EdgeHealthyCondition, nodeName, status, condition.Message)
+
+	if healthy {
+		p.recorder.Event(node, corev1.EventTypeNormal, EventReasonEdgeHealthy, condition.Message)
+	} else {
+		p.recorder.Event(node, corev1.EventTypeWarning, EventReasonEdgeUnhealthy, condition.Message)
+	}
+}
+
+func (p *ConditionPublisher) remember(nodeName string, status corev1.ConditionStatus) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.known[nodeName] = knownStatus{status: status, seen: time.Now()}
+}
+
+// NewEdgeHealthyCondition returns the condition of a verdict, the message carries the vote tally
+func NewEdgeHealthyCondition(healthy bool, yes, no, checkers int) corev1.NodeCondition {
+	now := metav1.Now()
+	condition := corev1.NodeCondition{
+		Type:               common.EdgeHealthyCondition,
+		LastHeartbeatTime:  now,
+		LastTransitionTime: now,
+	}
+	if healthy {
+		condition.Status = corev1.ConditionTrue
+		condition.Reason = common.EdgeHealthyReasonVotedHealthy
+	} else {
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = common.EdgeHealthyReasonVotedUnhealthy
+	}
+	condition.Message = fmt.Sprintf("%d yes and %d no votes of %d checking nodes, counted by %s", yes, no, checkers, common.NodeName)
+	return condition
+}
+
+func getNodeCondition(node *corev1.Node, conditionType corev1.NodeConditionType) *corev1.NodeCondition {
+	for i := range node.Status.Conditions {
+		if node.Status.Conditions[i].Type == conditionType {
+			return &node.Status.Conditions[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vote
+
+import (
+	"context"
+	"testing"
+
+	"github.com/superedge/superedge/pkg/edge-health/common"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestConditionPublisher(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	recorder := record.NewFakeRecorder(10)
+	p := NewConditionPublisher(client, recorder)
+
+	patches := func() int {
+		count := 0
+		for _, action := range client.Actions() {
+			if action.GetVerb() == "patch" && action.(k8stesting.PatchAction).GetSubresource() == "status" {
+				count++
+			}
+		}
+		return count
+	}
+	condition := func() *corev1.NodeCondition {
+		node, err := client.CoreV1().Nodes().Get(context.TODO(), "node1", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return getNodeCondition(node, common.EdgeHealthyCondition)
+	}
+
+	p.Publish("node1", false, 1, 2, 3)
+	if c := condition(); c == nil || c.Status != corev1.ConditionFalse || c.Reason != common.EdgeHealthyReasonVotedUnhealthy {
+		t.Fatalf("unexpected condition %+v", c)
+	}
+	if event := <-recorder.Events; event != "Warning EdgeUnhealthy "+condition().Message {
+		t.Errorf("unexpected event %q", event)
+	}
+
+	// the same verdict is not patched again
+	p.Publish("node1", false, 0, 3, 3)
+	if patches() != 1 {
+		t.Errorf("expected 1 patch, got %d", patches())
+	}
+
+	p.Publish("node1", true, 3, 0, 3)
+	if c := condition(); c == nil || c.Status != corev1.ConditionTrue || c.Reason != common.EdgeHealthyReasonVotedHealthy {
+		t.Fatalf("unexpected condition %+v", c)
+	}
+	if event := <-recorder.Events; event != "Normal EdgeHealthy "+condition().Message {
+		t.Errorf("unexpected event %q", event)
+	}
+
+	// the verdict already published by another node is only remembered
+	p.known = map[string]knownStatus{}
+	p.Publish("node1", true, 3, 0, 3)
+	if patches() != 2 || len(recorder.Events) != 0 {
+		t.Errorf("expected 2 patches and no event, got %d patches and %d events", patches(), len(recorder.Events))
+	}
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vote
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/superedge/superedge/pkg/edge-health/check"
+	"github.com/superedge/superedge/pkg/edge-health/common"
+	"github.com/superedge/superedge/pkg/edge-health/data"
+	"github.com/superedge/superedge/pkg/edge-health/metrics"
+	sitev1alpha2 "github.com/superedge/superedge/pkg/site-manager/apis/site.superedge.io/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	log "k8s.io/klog/v2"
+)
+
+const (
+	CloudPartitionedReasonUplinkLost      = "UplinkLost"
+	CloudPartitionedReasonUplinkConnected = "UplinkConnected"
+)
+
+var nodeUnitResource = sitev1alpha2.SchemeGroupVersion.WithResource("nodeunits")
+
+// PartitionPublisher keeps the CloudPartitioned condition of the NodeUnits of this node. A NodeUnit is
+// partitioned when none of its nodes reporting their uplink in the vote timeout reaches the cloud. The node
+// with the lowest ip among the nodes still reaching kube-apiserver publishes it, and refreshes its
+// LastProbeTime every ReListTime. It can only publish a partial partition, like the tunnel lost while
+// lite-apiserver still reaches kube-apiserver: a NodeUnit cut from the cloud as a whole has no node left to
+// write the condition, site-manager derives that one cloud side from the unreachable nodes of the NodeUnit.
+type PartitionPublisher struct {
+	client dynamic.Interface
+	// the status of the condition published for each NodeUnit
+	known map[string]knownPartition
+}
+
+type knownPartition struct {
+	status sitev1alpha2.ConditionStatus
+	seen   time.Time
+}
+
+func NewPartitionPublisher(client dynamic.Interface) *PartitionPublisher {
+	return &PartitionPublisher{
+		client: client,
+		known:  make(map[string]knownPartition),
+	}
+}
+
+// Publish decides the CloudPartitioned condition of the NodeUnits of this node from the uplinks reported in timeout
+func (p *PartitionPublisher) Publish(timeout time.Duration) {
+	units, err := check.NodeUnits(common.NodeName)
+	if err != nil {
+		log.Errorf("get NodeUnits of node %s err: %v", common.NodeName, err)
+		return
+	}
+	uplinks := data.Uplink.CopyUplinkAll()
+	now := time.Now()
+	for unit := range units {
+		names, err := check.NodeUnitMembers(unit)
+		if err != nil {
+			log.Errorf("get nodes of NodeUnit %s err: %v", unit, err)
+			continue
+		}
+		members := make(map[string]string, len(names))
+		for _, name := range names {
+			if ip, err := check.PodManager.GetNodeIPByNodeName(name); err == nil {
+				members[ip] = name
+			}
+		}
+		reported, disconnected := uplinkVerdict(members, uplinks, now, timeout)
+		if len(reported) == 0 {
+			continue
+		}
+		partitioned := len(disconnected) == len(reported)
+		if partitioned {
+			metrics.CloudPartitioned.WithLabelValues(unit).Set(1)
+		} else {
+			metrics.CloudPartitioned.WithLabelValues(unit).Set(0)
+		}
+		publisher := uplinkPublisher(reported, uplinks)
+		if publisher == "" {
+			log.V(4).Infof("vote: no node of NodeUnit %s reaches kube-apiserver to publish CloudPartitioned", unit)
+			continue
+		}
+		if publisher != common.NodeIP {
+			log.V(4).Infof("vote: CloudPartitioned of NodeUnit %s is published by %s", unit, publisher)
+			continue
+		}
+		p.patch(unit, NewCloudPartitionedCondition(partitioned, members, reported, disconnected, uplinks))
+	}
+}
+
+func (p *PartitionPublisher) patch(unit string, condition sitev1alpha2.ClusterCondition) {
+	if known, ok := p.known[unit]; ok && known.status == condition.Status && time.Since(known.seen) < common.ReListTime {
+		return
+	}
+	obj, err := p.client.Resource(nodeUnitResource).Get(context.TODO(), unit, metav1.GetOptions{})
+	if err != nil {
+		log.Errorf("get NodeUnit %s to update %s condition error: %v", unit, sitev1alpha2.NodeUnitCloudPartitioned, err)
+		return
+	}
+	nu := &sitev1alpha2.NodeUnit{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), nu); err != nil {
+		log.Errorf("convert NodeUnit %s error: %v", unit, err)
+		return
+	}
+	nu.Status.Conditions = setUnitCondition(nu.Status.Conditions, condition)
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(nu)
+	if err != nil {
+		log.Errorf("convert NodeUnit %s error: %v", unit, err)
+		return
+	}
+	if _, err := p.client.Resource(nodeUnitResource).UpdateStatus(context.TODO(), &unstructured.Unstructured{Object: content}, metav1.UpdateOptions{}); err != nil {
+		log.Errorf("update %s condition of NodeUnit %s error: %v", sitev1alpha2.NodeUnitCloudPartitioned, unit, err)
+		return
+	}
+	if known, ok := p.known[unit]; !ok || known.status != condition.Status {
+		log.V(2).Infof("vote: %s of NodeUnit %s is %s: %s", sitev1alpha2.NodeUnitCloudPartitioned, unit, condition.Status, condition.Message)
+	}
+	p.known[unit] = knownPartition{status: condition.Status, seen: time.Now()}
+}
+
+// uplinkVerdict returns the members whose uplink is reported in timeout, and the ones among them which do not
+// reach the cloud, sorted by ip. members maps the ip of the nodes to their name.
+func uplinkVerdict(members map[string]string, uplinks map[string]data.UplinkStatus, now time.Time, timeout time.Duration) (reported, disconnected []string) {
+	for ip := range members {
+		status, ok := uplinks[ip]
+		if !ok || now.After(time.Unix(status.Time, 0).Add(timeout)) {
+			continue
+		}
+		reported = append(reported, ip)
+		if !status.Connected() {
+			disconnected = append(disconnected, ip)
+		}
+	}
+	sort.Strings(reported)
+	sort.Strings(disconnected)
+	return reported, disconnected
+}
+
+// uplinkPublisher returns the node publishing the condition, the first node still reaching kube-apiserver, or an
+// empty string when none does
+func uplinkPublisher(reported []string, uplinks map[string]data.UplinkStatus) string {
+	for _, ip := range reported {
+		if status := uplinks[ip]; status.LiteAPIServer == nil || *status.LiteAPIServer {
+			return ip
+		}
+	}
+	return ""
+}
+
+// NewCloudPartitionedCondition returns the condition of a verdict, the message names the nodes which lost the uplink
+func NewCloudPartitionedCondition(partitioned bool, members map[string]string, reported, disconnected []string, uplinks map[string]data.UplinkStatus) sitev1alpha2.ClusterCondition {
+	now := metav1.Now()
+	condition := sitev1alpha2.ClusterCondition{
+		Type:               sitev1alpha2.NodeUnitCloudPartitioned,
+		LastProbeTime:      now,
+		LastTransitionTime: now,
+	}
+	if partitioned {
+		condition.Status = sitev1alpha2.ConditionTrue
+		condition.Reason = CloudPartitionedReasonUplinkLost
+	} else {
+		condition.Status = sitev1alpha2.ConditionFalse
+		condition.Reason = CloudPartitionedReasonUplinkConnected
+	}
+	var lost []string
+	for _, ip := range disconnected {
+		lost = append(lost, fmt.Sprintf("%s (%s)", members[ip], strings.Join(lostUplinks(uplinks[ip]), ", ")))
+	}
+	condition.Message = fmt.Sprintf("%d of %d nodes lost the uplink, reported to %s", len(disconnected), len(reported), common.NodeName)
+	if len(lost) != 0 {
+		condition.Message += ": " + strings.Join(lost, ", ")
+	}
+	return condition
+}
+
+func lostUplinks(status data.UplinkStatus) []string {
+	var lost []string
+	if status.Tunnel != nil && !*status.Tunnel {
+		lost = append(lost, "tunnel")
+	}
+	if status.LiteAPIServer != nil && !*status.LiteAPIServer {
+		lost = append(lost, "lite-apiserver")
+	}
+	return lost
+}
+
+// setUnitCondition replaces the condition of the same type, the transition time is kept when the status is the same
+func setUnitCondition(conditions []sitev1alpha2.ClusterCondition, condition sitev1alpha2.ClusterCondition) []sitev1alpha2.ClusterCondition {
+	for i := range conditions {
+		if conditions[i].Type != condition.Type {
+			continue
+		}
+		if conditions[i].Status == condition.Status {
+			condition.LastTransitionTime = conditions[i].LastTransitionTime
+		}
+		conditions[i] = condition
+		return conditions
+	}
+	return append(conditions, condition)
+}
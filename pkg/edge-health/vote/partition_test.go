@@ -0,0 +1,92 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vote
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/superedge/superedge/pkg/edge-health/data"
+	sitev1alpha2 "github.com/superedge/superedge/pkg/site-manager/apis/site.superedge.io/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestUplinkVerdict(t *testing.T) {
+	yes, no := true, false
+	now := time.Now()
+	members := map[string]string{"10.0.0.1": "node1", "10.0.0.2": "node2", "10.0.0.3": "node3", "10.0.0.4": "node4"}
+	uplinks := map[string]data.UplinkStatus{
+		"10.0.0.1": {Tunnel: &no, LiteAPIServer: &no, Time: now.Unix()},
+		"10.0.0.2": {Tunnel: &no, LiteAPIServer: &yes, Time: now.Unix()},
+		// reported before the timeout, it is not counted
+		"10.0.0.3": {Tunnel: &yes, LiteAPIServer: &yes, Time: now.Add(-2 * time.Minute).Unix()},
+		// not a member
+		"10.0.0.9": {Tunnel: &yes, Time: now.Unix()},
+	}
+
+	reported, disconnected := uplinkVerdict(members, uplinks, now, time.Minute)
+	if !reflect.DeepEqual(reported, []string{"10.0.0.1", "10.0.0.2"}) || !reflect.DeepEqual(disconnected, reported) {
+		t.Errorf("unexpected verdict, reported %v, disconnected %v", reported, disconnected)
+	}
+	// node2 still reaches kube-apiserver by lite-apiserver, it publishes the condition
+	if publisher := uplinkPublisher(reported, uplinks); publisher != "10.0.0.2" {
+		t.Errorf("expected publisher 10.0.0.2, got %s", publisher)
+	}
+
+	uplinks["10.0.0.3"] = data.UplinkStatus{Tunnel: &yes, LiteAPIServer: &yes, Time: now.Unix()}
+	reported, disconnected = uplinkVerdict(members, uplinks, now, time.Minute)
+	if len(reported) != 3 || len(disconnected) != 2 {
+		t.Errorf("unexpected verdict, reported %v, disconnected %v", reported, disconnected)
+	}
+	condition := NewCloudPartitionedCondition(len(disconnected) == len(reported), members, reported, disconnected, uplinks)
+	if condition.Status != sitev1alpha2.ConditionFalse || condition.Reason != CloudPartitionedReasonUplinkConnected {
+		t.Errorf("unexpected condition %+v", condition)
+	}
+
+	// no node reaches kube-apiserver, nobody publishes and site-manager derives the condition
+	uplinks["10.0.0.2"] = data.UplinkStatus{Tunnel: &no, LiteAPIServer: &no, Time: now.Unix()}
+	if publisher := uplinkPublisher([]string{"10.0.0.1", "10.0.0.2"}, uplinks); publisher != "" {
+		t.Errorf("expected no publisher, got %s", publisher)
+	}
+}
+
+func TestSetUnitCondition(t *testing.T) {
+	before := metav1.NewTime(time.Now().Add(-time.Hour))
+	conditions := []sitev1alpha2.ClusterCondition{
+		{Type: "Other", Status: sitev1alpha2.ConditionTrue},
+		{Type: sitev1alpha2.NodeUnitCloudPartitioned, Status: sitev1alpha2.ConditionFalse, LastTransitionTime: before},
+	}
+
+	conditions = setUnitCondition(conditions, sitev1alpha2.ClusterCondition{
+		Type: sitev1alpha2.NodeUnitCloudPartitioned, Status: sitev1alpha2.ConditionFalse, LastTransitionTime: metav1.Now(),
+	})
+	if len(conditions) != 2 || !conditions[1].LastTransitionTime.Equal(&before) {
+		t.Errorf("the transition time of the same status must be kept, got %+v", conditions)
+	}
+
+	conditions = setUnitCondition(conditions, sitev1alpha2.ClusterCondition{
+		Type: sitev1alpha2.NodeUnitCloudPartitioned, Status: sitev1alpha2.ConditionTrue, LastTransitionTime: metav1.Now(),
+	})
+	if len(conditions) != 2 || conditions[1].Status != sitev1alpha2.ConditionTrue || conditions[1].LastTransitionTime.Equal(&before) {
+		t.Errorf("unexpected conditions %+v", conditions)
+	}
+
+	if conditions := setUnitCondition(nil, conditions[1]); len(conditions) != 1 {
+		t.Errorf("expected the condition added, got %+v", conditions)
+	}
+}
@@ -21,12 +21,18 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/superedge/superedge/pkg/edge-health/apis/edgehealth.superedge.io/v1alpha1"
 	"github.com/superedge/superedge/pkg/edge-health/check"
 	"github.com/superedge/superedge/pkg/edge-health/common"
 	"github.com/superedge/superedge/pkg/edge-health/data"
+	"github.com/superedge/superedge/pkg/edge-health/metrics"
+	"github.com/superedge/superedge/pkg/edge-health/timeline"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 	log "k8s.io/klog/v2"
 )
 
@@ -46,27 +52,72 @@ type Vote interface {
 	GetVoteTimeout() int
 }
 
+// VoteConfig decides when the state of a node changes, a HealthCheckPolicy can override it for its NodeUnits
+type VoteConfig struct {
+	// a node is voted unhealthy or healthy by more than the threshold of the checking nodes
+	UnhealthyThreshold float64
+	HealthyThreshold   float64
+	// the state of a node changes after the same verdict in the consecutive rounds
+	UnhealthyRounds int
+	HealthyRounds   int
+}
+
+// VoteEdge publishes the verdicts as the EdgeHealthy NodeCondition, and as the nodeunhealth annotation
+// when NodeUnhealthAnnotation is on for the compatibility with old edge-health-admission
 type VoteEdge struct {
-	VoteTimeOut int
-	VotePeriod  int
+	VoteTimeOut            int
+	VotePeriod             int
+	NodeUnhealthAnnotation bool
+	Config                 VoteConfig
+	Conditions             *ConditionPublisher
+	// nil when the CloudPartitioned condition of the NodeUnits is off
+	Partitions *PartitionPublisher
+
+	// the state of the checked nodes, by node ip
+	states  map[string]*nodeState
+	publish func(ip string, healthy bool, yes, no, checkers int)
 }
 
-func NewVoteEdge(voteTimeOut, votePeriod int) Vote {
-	return VoteEdge{
-		VoteTimeOut: voteTimeOut,
-		VotePeriod:  votePeriod,
+type nodeState struct {
+	// healthy is nil until the first transition
+	healthy *bool
+	// the verdict of the consecutive rounds and their count
+	verdict bool
+	streak  int
+}
+
+func NewVoteEdge(voteTimeOut, votePeriod int, nodeUnhealthAnnotation, cloudPartitionCondition bool, config VoteConfig) Vote {
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartLogging(log.Infof)
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{
+		Interface: common.ClientSet.CoreV1().Events(""),
+	})
+	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: common.CmdName, Host: common.NodeName})
+
+	vote := &VoteEdge{
+		VoteTimeOut:            voteTimeOut,
+		VotePeriod:             votePeriod,
+		NodeUnhealthAnnotation: nodeUnhealthAnnotation,
+		Config:                 config,
+		Conditions:             NewConditionPublisher(common.ClientSet, recorder),
+		states:                 make(map[string]*nodeState),
+	}
+	if cloudPartitionCondition {
+		vote.Partitions = NewPartitionPublisher(common.DynamicClientSet)
 	}
+	vote.publish = vote.publishVerdict
+	return vote
 }
 
-func (vote VoteEdge) GetVoteTimeout() int {
+func (vote *VoteEdge) GetVoteTimeout() int {
 	return vote.VoteTimeOut
 }
 
-func (vote VoteEdge) GetVotePeriod() int {
+func (vote *VoteEdge) GetVotePeriod() int {
 	return vote.VotePeriod
 }
 
-func (vote VoteEdge) Vote() {
+func (vote *VoteEdge) Vote() {
 	voteCountMap := make(map[string]map[string]int) // {"a":{"yes":1,"no":2}}
 	healthNodeMap := make(map[string]string)
 
@@ -96,56 +147,136 @@ func (vote VoteEdge) Vote() {
 	}
 	log.V(4).Infof("Vote: healthNodeMap is %v , voteCountMap is %v", healthNodeMap, voteCountMap)
 
-	//num := (float64(len(healthNodeMap)) + 1) / 2
-	num := (float64(data.CheckInfoResult.GetLenCheckInfo()) + 1) / 2
+	// a node cut from the cloud with its whole NodeUnit still decides the CloudPartitioned condition
+	if vote.Partitions != nil {
+		vote.Partitions.Publish(time.Duration(vote.GetVoteTimeout()) * time.Second)
+	}
 
 	if len(healthNodeMap) == 1 {
 		return
 	}
+	config := MergeVotePolicy(vote.Config, check.PolicyManager.VotePolicy())
+	checkers := data.CheckInfoResult.GetLenCheckInfo()
+	if vote.states == nil {
+		vote.states = make(map[string]*nodeState)
+	}
 	for ip, v := range voteCountMap {
-		if _, ok := v["yes"]; ok {
-			if float64(v["yes"]) >= num {
-				log.V(4).Infof("vote: vote yes to master begin")
-				name, err := check.PodManager.GetNodeNameByNodeIP(ip)
-				if err != nil {
-					log.ErrorS(err, "GetNodeNameByNodeIP error")
-					continue
-				}
-				if nodeObject, err := check.NodeMetaManager.NodeMetaILister.Get(name); err == nil && name != "" {
-					node := nodeObject.(*metav1.PartialObjectMetadata)
-					if _, ok := node.Annotations["nodeunhealth"]; ok {
-						// delete nodeunhealth annotation
-						patchBytes := []byte(fmt.Sprintf(NodeAnnotationPatchDeleteTemplate, "nodeunhealth"))
-						if _, err := common.ClientSet.CoreV1().Nodes().Patch(context.TODO(), node.Name, types.StrategicMergePatchType, patchBytes, metav1.PatchOptions{}); err != nil {
-							log.Errorf("patch yes vote to master error: %v ", err)
-						} else {
-							log.V(2).Infof("patch yes vote of %s to master", node.Name)
-						}
-					}
-				}
-			}
+		vote.decide(ip, v["yes"], v["no"], checkers, config)
+	}
+	// the nodes without votes in this round start over
+	for ip := range vote.states {
+		if _, ok := voteCountMap[ip]; !ok {
+			delete(vote.states, ip)
 		}
-		if _, ok := v["no"]; ok {
-			if float64(v["no"]) >= num {
-				log.V(4).Infof("vote: vote no to master begin")
-				name, err := check.PodManager.GetNodeNameByNodeIP(ip)
-				if err != nil {
-					log.ErrorS(err, "GetNodeNameByNodeIP error")
-					continue
-				}
-				if nodeObject, err := check.NodeMetaManager.NodeMetaILister.Get(name); err == nil && name != "" {
-					node := nodeObject.(*metav1.PartialObjectMetadata)
-					if _, ok := node.Annotations["nodeunhealth"]; !ok {
-
-						patchBytes := []byte(fmt.Sprintf(NodeAnnotationPatchAddUpdateTemplate, "nodeunhealth", "yes"))
-						if _, err := common.ClientSet.CoreV1().Nodes().Patch(context.TODO(), node.Name, types.StrategicMergePatchType, patchBytes, metav1.PatchOptions{}); err != nil {
-							log.Errorf("patch no vote to master error: %v ", err)
-						} else {
-							log.V(2).Infof("patch no vote of %s to master", node.Name)
-						}
-					}
-				}
-			}
+	}
+}
+
+// decide publishes the state of the node, which changes after the same verdict in the consecutive rounds
+func (vote *VoteEdge) decide(ip string, yes, no, checkers int, config VoteConfig) {
+	state, ok := vote.states[ip]
+	if !ok {
+		state = &nodeState{}
+		vote.states[ip] = state
+	}
+	healthy := float64(yes) > config.HealthyThreshold*float64(checkers)
+	unhealthy := float64(no) > config.UnhealthyThreshold*float64(checkers)
+	if healthy == unhealthy {
+		// no verdict, or both with low thresholds
+		state.streak = 0
+		return
+	}
+	if state.streak > 0 && state.verdict == healthy {
+		state.streak++
+	} else {
+		state.verdict, state.streak = healthy, 1
+	}
+
+	if state.healthy == nil || *state.healthy != healthy {
+		rounds := config.UnhealthyRounds
+		if healthy {
+			rounds = config.HealthyRounds
 		}
+		if state.streak < rounds {
+			log.V(4).Infof("vote: %s voted healthy %v in %d of %d rounds", ip, healthy, state.streak, rounds)
+			return
+		}
+		state.healthy = &healthy
+		log.V(2).Infof("vote: %s is healthy %v after %d rounds, %d yes and %d no votes", ip, healthy, state.streak, yes, no)
+		metrics.VoteTransitions.WithLabelValues(ip, transitionState(healthy)).Inc()
+		timeline.Default.Record(ip, timeline.EventVote, healthy,
+			fmt.Sprintf("voted %s by %s after %d rounds, %d yes and %d no votes of %d checkers", transitionState(healthy), common.NodeIP, state.streak, yes, no, checkers))
+	}
+	if healthy {
+		log.V(4).Infof("vote: vote yes to master begin")
+	} else {
+		log.V(4).Infof("vote: vote no to master begin")
+	}
+	vote.publish(ip, healthy, yes, no, checkers)
+}
+
+// MergeVotePolicy returns the config overridden by the policy
+func MergeVotePolicy(config VoteConfig, policy *v1alpha1.VotePolicy) VoteConfig {
+	if policy == nil {
+		return config
+	}
+	if policy.UnhealthyThreshold != nil {
+		config.UnhealthyThreshold = *policy.UnhealthyThreshold
+	}
+	if policy.HealthyThreshold != nil {
+		config.HealthyThreshold = *policy.HealthyThreshold
+	}
+	if policy.UnhealthyRounds > 0 {
+		config.UnhealthyRounds = policy.UnhealthyRounds
+	}
+	if policy.HealthyRounds > 0 {
+		config.HealthyRounds = policy.HealthyRounds
+	}
+	return config
+}
+
+func (vote *VoteEdge) publishVerdict(ip string, healthy bool, yes, no, checkers int) {
+	name, err := check.PodManager.GetNodeNameByNodeIP(ip)
+	if err != nil {
+		log.ErrorS(err, "GetNodeNameByNodeIP error")
+		return
+	}
+	if name == "" {
+		return
+	}
+	if vote.NodeUnhealthAnnotation {
+		patchAnnotation(name, healthy)
+	}
+	vote.Conditions.Publish(name, healthy, yes, no, checkers)
+}
+
+func patchAnnotation(name string, healthy bool) {
+	nodeObject, err := check.NodeMetaManager.NodeMetaILister.Get(name)
+	if err != nil {
+		return
+	}
+	node := nodeObject.(*metav1.PartialObjectMetadata)
+	_, annotated := node.Annotations[common.NodeUnhealthAnnotation]
+	if healthy && annotated {
+		// delete nodeunhealth annotation
+		patchBytes := []byte(fmt.Sprintf(NodeAnnotationPatchDeleteTemplate, common.NodeUnhealthAnnotation))
+		if _, err := common.ClientSet.CoreV1().Nodes().Patch(context.TODO(), node.Name, types.StrategicMergePatchType, patchBytes, metav1.PatchOptions{}); err != nil {
+			log.Errorf("patch yes vote to master error: %v ", err)
+		} else {
+			log.V(2).Infof("patch yes vote of %s to master", node.Name)
+		}
+	} else if !healthy && !annotated {
+		patchBytes := []byte(fmt.Sprintf(NodeAnnotationPatchAddUpdateTemplate, common.NodeUnhealthAnnotation, "yes"))
+		if _, err := common.ClientSet.CoreV1().Nodes().Patch(context.TODO(), node.Name, types.StrategicMergePatchType, patchBytes, metav1.PatchOptions{}); err != nil {
+			log.Errorf("patch no vote to master error: %v ", err)
+		} else {
+			log.V(2).Infof("patch no vote of %s to master", node.Name)
+		}
+	}
+}
+
+func transitionState(healthy bool) string {
+	if healthy {
+		return metrics.StateHealthy
 	}
+	return metrics.StateUnhealthy
 }
@@ -0,0 +1,174 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vote
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/superedge/superedge/pkg/edge-health/apis/edgehealth.superedge.io/v1alpha1"
+	"github.com/superedge/superedge/pkg/edge-health/common"
+	"github.com/superedge/superedge/pkg/edge-health/data"
+)
+
+const (
+	simNodes = 5
+	target   = "10.0.0.5"
+)
+
+// simulation drives data.Result round by round and records the states published for the target
+type simulation struct {
+	vote      *VoteEdge
+	checkers  []string
+	published []bool
+}
+
+func newSimulation(config VoteConfig) *simulation {
+	common.NodeIP = "10.0.0.1"
+	data.CheckInfoResult = data.NewCheckInfoData()
+	data.Result = data.NewResultData()
+	sim := &simulation{}
+	for i := 1; i <= simNodes; i++ {
+		ip := fmt.Sprintf("10.0.0.%d", i)
+		data.CheckInfoResult.SetCheckedIpCheckInfo(ip)
+		if ip != target {
+			sim.checkers = append(sim.checkers, ip)
+		}
+	}
+	sim.vote = &VoteEdge{VoteTimeOut: 60, Config: config}
+	sim.vote.publish = func(ip string, healthy bool, yes, no, checkers int) {
+		if ip == target {
+			sim.published = append(sim.published, healthy)
+		}
+	}
+	return sim
+}
+
+// round lets the first noVotes checkers vote the target unhealthy and the others healthy
+func (sim *simulation) round(noVotes int) {
+	for i, checker := range sim.checkers {
+		data.Result.SetResult(&data.CommunicateData{
+			SourceIP:     checker,
+			ResultDetail: map[string]data.ResultDetail{target: {Normal: i >= noVotes}},
+		})
+	}
+	sim.vote.Vote()
+}
+
+// transitions returns the states published when they changed
+func (sim *simulation) transitions() []bool {
+	var states []bool
+	for i, healthy := range sim.published {
+		if i == 0 || sim.published[i-1] != healthy {
+			states = append(states, healthy)
+		}
+	}
+	return states
+}
+
+var defaultConfig = VoteConfig{UnhealthyThreshold: 0.5, HealthyThreshold: 0.5, UnhealthyRounds: 1, HealthyRounds: 1}
+
+func TestVoteFlapping(t *testing.T) {
+	// on a lossy link the majority flips every round
+	flapping := []int{4, 0, 4, 0, 4, 0, 4, 0}
+
+	sim := newSimulation(defaultConfig)
+	for _, no := range flapping {
+		sim.round(no)
+	}
+	if n := len(sim.transitions()); n != len(flapping) {
+		t.Errorf("without hysteresis the state follows every round, got %d transitions", n)
+	}
+
+	sim = newSimulation(VoteConfig{UnhealthyThreshold: 0.5, HealthyThreshold: 0.5, UnhealthyRounds: 3, HealthyRounds: 2})
+	for _, no := range flapping {
+		sim.round(no)
+	}
+	if len(sim.published) != 0 {
+		t.Errorf("a flapping node must not be published, got %v", sim.published)
+	}
+	// a sustained failure marks the node unhealthy after UnhealthyRounds
+	for i := 0; i < 3; i++ {
+		sim.round(4)
+	}
+	// a single good round does not recover it, two do
+	sim.round(0)
+	sim.round(4)
+	sim.round(0)
+	sim.round(0)
+	if got := sim.transitions(); fmt.Sprint(got) != "[false true]" {
+		t.Errorf("expected unhealthy then recovered, got %v", got)
+	}
+	if len(sim.published) != 3 || sim.published[0] {
+		t.Errorf("expected the state published in the rounds it held, got %v", sim.published)
+	}
+}
+
+func TestVoteThresholds(t *testing.T) {
+	// 5 nodes are checking, 3 no votes are a majority but not more than 0.7 of them
+	sim := newSimulation(VoteConfig{UnhealthyThreshold: 0.7, HealthyThreshold: 0.3, UnhealthyRounds: 1, HealthyRounds: 1})
+	sim.round(0)
+	sim.round(3)
+	if got := sim.transitions(); fmt.Sprint(got) != "[true]" {
+		t.Errorf("the unhealthy threshold is not exceeded, got %v", got)
+	}
+	sim.round(4)
+	// 1 yes vote is not more than 0.3 of the checking nodes, 2 are
+	sim.round(3)
+	sim.round(2)
+	if got := sim.transitions(); fmt.Sprint(got) != "[true false true]" {
+		t.Errorf("expected healthy, unhealthy and recovered, got %v", got)
+	}
+}
+
+func TestVoteRandomLoss(t *testing.T) {
+	// every checker loses the target with a probability of 40%, the seed keeps the rounds deterministic
+	r := rand.New(rand.NewSource(1))
+	rounds := make([]int, 200)
+	for i := range rounds {
+		for j := 0; j < simNodes-1; j++ {
+			if r.Float64() < 0.4 {
+				rounds[i]++
+			}
+		}
+	}
+	count := func(config VoteConfig) int {
+		sim := newSimulation(config)
+		for _, no := range rounds {
+			sim.round(no)
+		}
+		return len(sim.transitions())
+	}
+	flaps := count(defaultConfig)
+	damped := count(VoteConfig{UnhealthyThreshold: 0.5, HealthyThreshold: 0.5, UnhealthyRounds: 3, HealthyRounds: 3})
+	if damped*4 > flaps {
+		t.Errorf("hysteresis must damp the transitions, got %d without and %d with it", flaps, damped)
+	}
+}
+
+func TestMergeVotePolicy(t *testing.T) {
+	threshold := 0.6
+	config := MergeVotePolicy(defaultConfig, &v1alpha1.VotePolicy{UnhealthyThreshold: &threshold, HealthyRounds: 4})
+	expected := VoteConfig{UnhealthyThreshold: 0.6, HealthyThreshold: 0.5, UnhealthyRounds: 1, HealthyRounds: 4}
+	if config != expected {
+		t.Errorf("expected %+v, got %+v", expected, config)
+	}
+	if MergeVotePolicy(defaultConfig, nil) != defaultConfig {
+		t.Error("config without policy must not change")
+	}
+}
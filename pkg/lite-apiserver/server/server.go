@@ -168,6 +168,15 @@ func (s *LiteServer) Run() error {
 	mux := http.NewServeMux()
 	mux.Handle("/", edgeServerHandler)
 	mux.HandleFunc("/debug/flags/v", util.UpdateLogLevel)
+	// edge-health reads the reachability of kube-apiserver from the node
+	mux.HandleFunc("/upstream/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if err := transportManager.CheckUpstreamHealth(); err != nil {
+			klog.V(2).Infof("kube-apiserver is unreachable: %v", err)
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
 	// register for pprof
 	if s.ServerConfig.Profiling {
 		mux.HandleFunc("/debug/pprof/", pprof.Index)
@@ -300,12 +300,34 @@ func (tm *TransportManager) getTransport(commonName string) (*EdgeTransport, err
 	return defaultTransport, nil
 }
 
+// CheckUpstreamHealth checks the healthz of kube-apiserver with the transports of the certs and the default
+// transport, kube-apiserver is reachable when one of them gets ok
+func (tm *TransportManager) CheckUpstreamHealth() error {
+	tm.transportMapLock.RLock()
+	transports := make([]*EdgeTransport, 0, len(tm.transportMap)+1)
+	for _, t := range tm.transportMap {
+		transports = append(transports, t)
+	}
+	tm.transportMapLock.RUnlock()
+	transports = append(transports, tm.defaultTransport)
+
+	var lastErr error
+	for _, t := range transports {
+		isHealthy, err := tm.checkApiserverHealth(t.Transport, tm.config.KubeApiserverUrl, tm.config.KubeApiserverPort)
+		if isHealthy {
+			return nil
+		}
+		lastErr = err
+	}
+	return lastErr
+}
+
 func (tm *TransportManager) checkApiserverHealth(transport *http.Transport, url string, port int) (bool, error) {
 	if transport == nil {
 		return false, fmt.Errorf("http client is invalid")
 	}
 
-	client := &http.Client{Transport: transport}
+	client := &http.Client{Transport: transport, Timeout: time.Duration(tm.timeout) * time.Second}
 	resp, err := client.Get(fmt.Sprintf("https://%s:%d/healthz", url, port))
 	if err != nil {
 		return false, err
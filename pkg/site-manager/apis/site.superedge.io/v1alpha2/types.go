@@ -26,21 +26,23 @@ import (
 type WorkloadType string
 
 const (
-	WorkloadPod          WorkloadType = "Pod"
-	WorkloadJob          WorkloadType = "Job"
-	WorkloadCronjob      WorkloadType = "CronJob"
-	WorkloadDeploy       WorkloadType = "Deployment"
-	WorkloadService      WorkloadType = "Service"
-	WorkloadReplicaSet   WorkloadType = "ReplicaSet"
-	WorkloadDaemonset    WorkloadType = "DaemonSet"
+	WorkloadPod         WorkloadType = "Pod"
+	WorkloadJob         WorkloadType = "Job"
+	WorkloadCronjob     WorkloadType = "CronJob"
+	WorkloadDeploy      WorkloadType = "Deployment"
+	WorkloadService     WorkloadType = "Service"
+	WorkloadReplicaSet  WorkloadType = "ReplicaSet"
+	WorkloadDaemonset   WorkloadType = "DaemonSet"
+	WorkloadStatefulset WorkloadType = "StatefulSet"
+	// WorkloadStatuefulset is kept for the NodeGroups written with it
 	WorkloadStatuefulset WorkloadType = "StatuefulSet"
 )
 
 type Workload struct {
-	// workload name
+	// workload name, namespace/name or name in the default namespace
 	// +optional
 	Name string `json:"name,omitempty"`
-	// workload type, Value can be pod, deploy, ds, service, job, st
+	// workload type, Value can be Deployment, DaemonSet, StatefulSet, Job, CronJob, Service
 	// +optional
 	Type WorkloadType `json:"type,omitempty"`
 	// If specified, Label selector for workload.
@@ -69,7 +71,7 @@ type NodeGroupSpec struct {
 
 // NodeGroupStatus defines the observed state of NodeGroup
 type WorkloadStatus struct {
-	// workload Name
+	// workload Name, type/namespace/name
 	// +optional
 	WorkloadName string `json:"workloadName,omitempty"`
 	// workload Ready Units
@@ -141,6 +143,13 @@ const (
 
 	UnitClusterStorageTypeSqlite = "sqlite"
 	UnitClusterStorageTypeETCD   = "etcd"
+
+	// NodeUnitCloudPartitioned is True when no node of the nodeunit reaches the cloud, it is published by edge-health
+	// while a node still reaches kube-apiserver, and by site-manager when no node of the nodeunit is reachable
+	NodeUnitCloudPartitioned = "CloudPartitioned"
+	// NodeUnitUnschedulable is True when all the nodes of the unschedulable nodeunit are cordoned, and drained when
+	// the drain is on, it is published by site-manager
+	NodeUnitUnschedulable = "Unschedulable"
 )
 
 // ConditionStatus defines the status of Condition.
@@ -339,6 +348,51 @@ type UnitClusterStatus struct {
 	ClusterResource ClusterResource `json:"resource,omitempty"`
 	// +optional
 	ServiceCIDR string `json:"serviceCIDR,omitempty"`
+	// Upgrade is the progress of the upgrade of the unit cluster to the k3s image of the node unit
+	// +optional
+	Upgrade *UnitClusterUpgrade `json:"upgrade,omitempty"`
+}
+
+// UnitClusterUpgradePhase is the phase of the upgrade of a unit cluster.
+type UnitClusterUpgradePhase string
+
+const (
+	// UpgradePreflight checks the unit cluster is healthy and can be upgraded to the target image.
+	UpgradePreflight UnitClusterUpgradePhase = "Preflight"
+	// UpgradeServers replaces the kins servers one by one.
+	UpgradeServers UnitClusterUpgradePhase = "UpgradingServers"
+	// UpgradeAgents replaces the kins agents one by one.
+	UpgradeAgents UnitClusterUpgradePhase = "UpgradingAgents"
+	// UpgradeSucceeded means the unit cluster runs the target image.
+	UpgradeSucceeded UnitClusterUpgradePhase = "Succeeded"
+	// UpgradeRollingBack replaces the upgraded kins agents and servers with the previous image.
+	UpgradeRollingBack UnitClusterUpgradePhase = "RollingBack"
+	// UpgradeRolledBack means the upgrade failed and the unit cluster runs the previous image again.
+	UpgradeRolledBack UnitClusterUpgradePhase = "RolledBack"
+	// UpgradeFailed means the rollback failed too.
+	UpgradeFailed UnitClusterUpgradePhase = "Failed"
+)
+
+// UnitClusterUpgrade is the progress of the upgrade of the k3s image of a unit cluster.
+type UnitClusterUpgrade struct {
+	// Image is the k3s image the unit cluster runs, the target image once upgraded
+	Image string `json:"image"`
+	// TargetImage is the k3s image being upgraded to
+	// +optional
+	TargetImage string `json:"targetImage,omitempty"`
+	// +optional
+	Phase UnitClusterUpgradePhase `json:"phase,omitempty"`
+	// UpgradedPods are the kins pods of the current phase replaced already
+	// +optional
+	UpgradedPods []string `json:"upgradedPods,omitempty"`
+	// +optional
+	Message string `json:"message,omitempty"`
+	// FailureReason tells why the upgrade to the target image is rolled back
+	// +optional
+	FailureReason string `json:"failureReason,omitempty"`
+	// LastTransitionTime is the last time a phase started or a pod was replaced
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
 }
 
 // NodeUnitStatus defines the observed state of NodeUnit
@@ -358,6 +412,13 @@ type NodeUnitStatus struct {
 	// +optional
 	//+k8s:conversion-gen=false
 	UnitCluster UnitClusterStatus `json:"unitClusterStatus,omitempty"`
+
+	// Conditions of the nodeunit published by the components in the nodeunit, like CloudPartitioned by edge-health
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	//+k8s:conversion-gen=false
+	Conditions []ClusterCondition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 }
 
 // +genclient
@@ -369,6 +430,7 @@ type NodeUnitStatus struct {
 // +kubebuilder:storageversion
 // +kubebuilder:printcolumn:name="TYPE",type="string",JSONPath=`.spec.type`
 // +kubebuilder:printcolumn:name="READY",type="string",JSONPath=`.status.readyRate`
+// +kubebuilder:printcolumn:name="PARTITIONED",type="string",JSONPath=`.status.conditions[?(@.type=="CloudPartitioned")].status`
 // +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
 // +kubebuilder:printcolumn:name="DELETING",type="date",JSONPath=".metadata.deletionTimestamp"
 
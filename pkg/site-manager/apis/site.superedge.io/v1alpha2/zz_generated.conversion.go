@@ -379,6 +379,7 @@ func autoConvert_v1alpha2_NodeUnitStatus_To_sitesuperedgeio_NodeUnitStatus(in *N
 	out.ReadyNodes = *(*[]string)(unsafe.Pointer(&in.ReadyNodes))
 	out.NotReadyNodes = *(*[]string)(unsafe.Pointer(&in.NotReadyNodes))
 	// INFO: in.UnitCluster opted out of conversion generation
+	// INFO: in.Conditions opted out of conversion generation
 	return nil
 }
 
@@ -337,6 +337,13 @@ func (in *NodeUnitStatus) DeepCopyInto(out *NodeUnitStatus) {
 		copy(*out, *in)
 	}
 	in.UnitCluster.DeepCopyInto(&out.UnitCluster)
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]ClusterCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -485,6 +492,11 @@ func (in *UnitClusterStatus) DeepCopyInto(out *UnitClusterStatus) {
 		copy(*out, *in)
 	}
 	in.ClusterResource.DeepCopyInto(&out.ClusterResource)
+	if in.Upgrade != nil {
+		in, out := &in.Upgrade, &out.Upgrade
+		*out = new(UnitClusterUpgrade)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -498,6 +510,28 @@ func (in *UnitClusterStatus) DeepCopy() *UnitClusterStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UnitClusterUpgrade) DeepCopyInto(out *UnitClusterUpgrade) {
+	*out = *in
+	if in.UpgradedPods != nil {
+		in, out := &in.UpgradedPods, &out.UpgradedPods
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UnitClusterUpgrade.
+func (in *UnitClusterUpgrade) DeepCopy() *UnitClusterUpgrade {
+	if in == nil {
+		return nil
+	}
+	out := new(UnitClusterUpgrade)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Workload) DeepCopyInto(out *Workload) {
 	*out = *in
@@ -21,6 +21,7 @@ import (
 
 	"k8s.io/client-go/informers"
 	appv1 "k8s.io/client-go/informers/apps/v1"
+	batchv1 "k8s.io/client-go/informers/batch/v1"
 	corev1 "k8s.io/client-go/informers/core/v1"
 
 	"k8s.io/client-go/kubernetes"
@@ -32,10 +33,16 @@ import (
 )
 
 type ControllerConfig struct {
-	NodeInformer      corev1.NodeInformer
-	DaemonSetInformer appv1.DaemonSetInformer
-	NodeUnitInformer  crdv1.NodeUnitInformer
-	NodeGroupInformer crdv1.NodeGroupInformer
+	NodeInformer        corev1.NodeInformer
+	DaemonSetInformer   appv1.DaemonSetInformer
+	DeploymentInformer  appv1.DeploymentInformer
+	StatefulSetInformer appv1.StatefulSetInformer
+	JobInformer         batchv1.JobInformer
+	CronJobInformer     batchv1.CronJobInformer
+	ServiceInformer     corev1.ServiceInformer
+	EndpointsInformer   corev1.EndpointsInformer
+	NodeUnitInformer    crdv1.NodeUnitInformer
+	NodeGroupInformer   crdv1.NodeGroupInformer
 }
 
 func NewControllerConfig(k8sClient *kubernetes.Clientset, crdClient *crdClientset.Clientset, resyncTime time.Duration) *ControllerConfig {
@@ -43,10 +50,16 @@ func NewControllerConfig(k8sClient *kubernetes.Clientset, crdClient *crdClientse
 	k8sFactory := informers.NewSharedInformerFactory(k8sClient, resyncTime)
 
 	return &ControllerConfig{
-		NodeInformer:      k8sFactory.Core().V1().Nodes(),
-		DaemonSetInformer: k8sFactory.Apps().V1().DaemonSets(),
-		NodeUnitInformer:  crdFactory.Site().V1alpha2().NodeUnits(),
-		NodeGroupInformer: crdFactory.Site().V1alpha2().NodeGroups(),
+		NodeInformer:        k8sFactory.Core().V1().Nodes(),
+		DaemonSetInformer:   k8sFactory.Apps().V1().DaemonSets(),
+		DeploymentInformer:  k8sFactory.Apps().V1().Deployments(),
+		StatefulSetInformer: k8sFactory.Apps().V1().StatefulSets(),
+		JobInformer:         k8sFactory.Batch().V1().Jobs(),
+		CronJobInformer:     k8sFactory.Batch().V1().CronJobs(),
+		ServiceInformer:     k8sFactory.Core().V1().Services(),
+		EndpointsInformer:   k8sFactory.Core().V1().Endpoints(),
+		NodeUnitInformer:    crdFactory.Site().V1alpha2().NodeUnits(),
+		NodeGroupInformer:   crdFactory.Site().V1alpha2().NodeGroups(),
 	}
 }
 
@@ -54,6 +67,12 @@ func (c *ControllerConfig) Run(stop <-chan struct{}) {
 	// TODO need run factory and wait cache sync in site controller run not here
 	go c.NodeInformer.Informer().Run(stop)
 	go c.DaemonSetInformer.Informer().Run(stop)
+	go c.DeploymentInformer.Informer().Run(stop)
+	go c.StatefulSetInformer.Informer().Run(stop)
+	go c.JobInformer.Informer().Run(stop)
+	go c.CronJobInformer.Informer().Run(stop)
+	go c.ServiceInformer.Informer().Run(stop)
+	go c.EndpointsInformer.Informer().Run(stop)
 	go c.NodeUnitInformer.Informer().Run(stop)
 	go c.NodeGroupInformer.Informer().Run(stop)
 
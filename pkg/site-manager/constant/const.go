@@ -21,6 +21,17 @@ const (
 	NodeUnitSuperedge     = "nodeunits.superedge.io"
 	NodeGroupSuperedge    = "nodegroups.superedge.io"
 	NodeUnitAutoFindLabel = "site.superedge.io/node-group-auto-keys-hash"
+	// NodeUnschedulableUnitsAnnotation lists the unschedulable NodeUnits which cordoned the node
+	NodeUnschedulableUnitsAnnotation = "site.superedge.io/unschedulable-units"
+)
+
+// The copies of the workloads bound to a NodeGroup are labeled with the NodeGroup and the NodeUnit they run in,
+// their templates with the NodeGroup which keeps their pods from running
+const (
+	NodeGroupWorkloadLabel = "site.superedge.io/nodegroup"
+	NodeUnitWorkloadLabel  = "site.superedge.io/nodeunit"
+	WorkloadHashAnnotation = "site.superedge.io/workload-hash"
+	WorkloadTemplateLabel  = "site.superedge.io/workload-template"
 )
 
 const (
@@ -317,7 +317,8 @@ spec:
                 items:
                   properties:
                     name:
-                      description: workload name
+                      description: workload name, namespace/name or name in the
+                        default namespace
                       type: string
                     selector:
                       description: If specified, Label selector for workload.
@@ -366,8 +367,8 @@ spec:
                           type: object
                       type: object
                     type:
-                      description: workload type, Value can be pod, deploy, ds, service,
-                        job, st
+                      description: workload type, Value can be Deployment, DaemonSet,
+                        StatefulSet, Job, CronJob, Service
                       type: string
                   type: object
                 type: array
@@ -400,7 +401,7 @@ spec:
                         type: string
                       type: array
                     workloadName:
-                      description: workload Name
+                      description: workload Name, type/namespace/name
                       type: string
                   type: object
                 type: array
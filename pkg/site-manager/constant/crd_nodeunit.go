@@ -242,6 +242,9 @@ spec:
     - jsonPath: .status.readyRate
       name: READY
       type: string
+    - jsonPath: .status.conditions[?(@.type=="CloudPartitioned")].status
+      name: PARTITIONED
+      type: string
     - jsonPath: .metadata.creationTimestamp
       name: AGE
       type: date
@@ -436,6 +439,39 @@ spec:
           status:
             description: NodeUnitStatus defines the observed state of NodeUnit
             properties:
+              conditions:
+                description: Conditions of the nodeunit published by the components
+                  in the nodeunit, like CloudPartitioned by edge-health
+                items:
+                  description: ClusterCondition contains details for the current
+                    condition of this cluster.
+                  properties:
+                    lastProbeTime:
+                      description: Last time we probed the condition.
+                      format: date-time
+                      type: string
+                    lastTransitionTime:
+                      description: Last time the condition transitioned from one
+                        status to another.
+                      format: date-time
+                      type: string
+                    message:
+                      description: Human-readable message indicating details about
+                        last transition.
+                      type: string
+                    reason:
+                      description: Unique, one-word, CamelCase reason for the condition's
+                        last transition.
+                      type: string
+                    status:
+                      description: Status is the status of the condition. Can be
+                        True, False, Unknown.
+                      type: string
+                    type:
+                      description: Type is the type of the condition.
+                      type: string
+                  type: object
+                type: array
               notReadyNodes:
                 description: Node that is not ready in nodeunit
                 items:
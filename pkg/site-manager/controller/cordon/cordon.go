@@ -0,0 +1,268 @@
+/*
+Copyright 2021 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cordon
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+
+	sitev1alpha2 "github.com/superedge/superedge/pkg/site-manager/apis/site.superedge.io/v1alpha2"
+	"github.com/superedge/superedge/pkg/site-manager/constant"
+)
+
+// DrainOptions controls the drain of the nodes of the unschedulable NodeUnits
+type DrainOptions struct {
+	// Drain evicts the pods of the nodes of the unschedulable NodeUnits
+	Drain bool
+	// DisableEviction deletes the pods instead of evicting them, the PodDisruptionBudgets are bypassed
+	DisableEviction bool
+	// GracePeriodSeconds overrides the termination grace period of the pods when not negative
+	GracePeriodSeconds int
+}
+
+// Progress is the progress of the cordon of the nodes of a NodeUnit
+type Progress struct {
+	Nodes    int
+	Cordoned int
+	// Pods left on the cordoned nodes, counted only when draining
+	Pods []string
+	// Pods whose eviction is refused by a PodDisruptionBudget
+	Blocked []string
+}
+
+func (p Progress) Done() bool {
+	return p.Cordoned == p.Nodes && len(p.Pods) == 0
+}
+
+// Cordoner cordons the nodes of the unschedulable NodeUnits, the NodeUnits cordoning a node are recorded in the
+// annotation constant.NodeUnschedulableUnitsAnnotation of the node, so the cordons set by other actors are kept
+type Cordoner struct {
+	kubeClient clientset.Interface
+	options    DrainOptions
+}
+
+func NewCordoner(kubeClient clientset.Interface, options DrainOptions) *Cordoner {
+	return &Cordoner{kubeClient: kubeClient, options: options}
+}
+
+// Cordon cordons the nodes of nu, drains them when the drain is on, and returns the progress
+func (c *Cordoner) Cordon(ctx context.Context, nu *sitev1alpha2.NodeUnit, nodes map[string]*corev1.Node) (Progress, error) {
+	progress := Progress{Nodes: len(nodes)}
+	var errs []error
+	for _, node := range nodes {
+		err := c.updateNode(ctx, node, func(n *corev1.Node) bool {
+			units := unschedulableUnits(n)
+			if n.Spec.Unschedulable && (units.Has(nu.Name) || units.Len() == 0) {
+				// cordoned by this NodeUnit, or by another actor and left to it
+				return false
+			}
+			units.Insert(nu.Name)
+			setUnschedulableUnits(n, units)
+			n.Spec.Unschedulable = true
+			return true
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cordon node %s: %v", node.Name, err))
+			continue
+		}
+		progress.Cordoned++
+		if !c.options.Drain {
+			continue
+		}
+		pods, blocked, err := c.drain(ctx, node.Name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("drain node %s: %v", node.Name, err))
+		}
+		progress.Pods = append(progress.Pods, pods...)
+		progress.Blocked = append(progress.Blocked, blocked...)
+	}
+	sort.Strings(progress.Pods)
+	sort.Strings(progress.Blocked)
+	return progress, utilerrors.NewAggregate(errs)
+}
+
+// Uncordon releases the cordons of unit on nodes, the nodes are uncordoned when no other NodeUnit cordons them
+func (c *Cordoner) Uncordon(ctx context.Context, unit string, nodes map[string]*corev1.Node) error {
+	var errs []error
+	for _, node := range nodes {
+		err := c.updateNode(ctx, node, func(n *corev1.Node) bool {
+			units := unschedulableUnits(n)
+			if !units.Has(unit) {
+				return false
+			}
+			units.Delete(unit)
+			setUnschedulableUnits(n, units)
+			if units.Len() == 0 {
+				n.Spec.Unschedulable = false
+			}
+			return true
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("uncordon node %s: %v", node.Name, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// updateNode updates the node when mutate changes it, the node is got again on conflicts
+func (c *Cordoner) updateNode(ctx context.Context, node *corev1.Node, mutate func(*corev1.Node) bool) error {
+	first := true
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if !first {
+			latest, err := c.kubeClient.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			node = latest
+		}
+		first = false
+		newNode := node.DeepCopy()
+		if !mutate(newNode) {
+			return nil
+		}
+		klog.V(4).InfoS("Update node schedulability", "node", newNode.Name, "unschedulable", newNode.Spec.Unschedulable,
+			"unschedulable units", newNode.Annotations[constant.NodeUnschedulableUnitsAnnotation])
+		_, err := c.kubeClient.CoreV1().Nodes().Update(ctx, newNode, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// drain evicts the pods of the node, it returns the pods left and the ones whose eviction is refused by a
+// PodDisruptionBudget
+func (c *Cordoner) drain(ctx context.Context, nodeName string) (pods, blocked []string, err error) {
+	podList, err := c.kubeClient.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	var gracePeriodSeconds *int64
+	if c.options.GracePeriodSeconds >= 0 {
+		seconds := int64(c.options.GracePeriodSeconds)
+		gracePeriodSeconds = &seconds
+	}
+	var errs []error
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if !drainable(pod) {
+			continue
+		}
+		key := pod.Namespace + "/" + pod.Name
+		pods = append(pods, key)
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		if c.options.DisableEviction {
+			err = c.kubeClient.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{GracePeriodSeconds: gracePeriodSeconds})
+		} else {
+			err = c.kubeClient.CoreV1().Pods(pod.Namespace).Evict(ctx, &policyv1beta1.Eviction{
+				ObjectMeta:    metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+				DeleteOptions: &metav1.DeleteOptions{GracePeriodSeconds: gracePeriodSeconds},
+			})
+		}
+		switch {
+		case err == nil:
+			klog.V(4).InfoS("Evict pod of unschedulable NodeUnit", "pod", klog.KObj(pod), "node", nodeName)
+		case errors.IsNotFound(err):
+		case errors.IsTooManyRequests(err):
+			blocked = append(blocked, key)
+		default:
+			errs = append(errs, fmt.Errorf("evict pod %s: %v", key, err))
+		}
+	}
+	return pods, blocked, utilerrors.NewAggregate(errs)
+}
+
+// drainable excludes the terminated pods, the mirror pods and the pods of the DaemonSets, which ignore the cordon
+func drainable(pod *corev1.Pod) bool {
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return false
+	}
+	if _, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]; ok {
+		return false
+	}
+	if owner := metav1.GetControllerOf(pod); owner != nil && owner.Kind == "DaemonSet" {
+		return false
+	}
+	return true
+}
+
+func unschedulableUnits(node *corev1.Node) sets.String {
+	units := sets.NewString()
+	for _, unit := range strings.Split(node.Annotations[constant.NodeUnschedulableUnitsAnnotation], ",") {
+		if unit != "" {
+			units.Insert(unit)
+		}
+	}
+	return units
+}
+
+func setUnschedulableUnits(node *corev1.Node, units sets.String) {
+	if units.Len() == 0 {
+		delete(node.Annotations, constant.NodeUnschedulableUnitsAnnotation)
+		return
+	}
+	if node.Annotations == nil {
+		node.Annotations = make(map[string]string)
+	}
+	node.Annotations[constant.NodeUnschedulableUnitsAnnotation] = strings.Join(units.List(), ",")
+}
+
+// Condition returns the NodeUnitUnschedulable condition of the progress
+func Condition(progress Progress, drain bool) sitev1alpha2.ClusterCondition {
+	now := metav1.Now()
+	condition := sitev1alpha2.ClusterCondition{
+		Type:               sitev1alpha2.NodeUnitUnschedulable,
+		Status:             sitev1alpha2.ConditionFalse,
+		LastProbeTime:      now,
+		LastTransitionTime: now,
+	}
+	switch {
+	case progress.Cordoned < progress.Nodes:
+		condition.Reason = "Cordoning"
+		condition.Message = fmt.Sprintf("%d/%d nodes cordoned", progress.Cordoned, progress.Nodes)
+	case len(progress.Blocked) > 0:
+		condition.Reason = "DrainBlocked"
+		condition.Message = fmt.Sprintf("%d pods left, the eviction of %s is refused by PodDisruptionBudget",
+			len(progress.Pods), strings.Join(progress.Blocked, ", "))
+	case len(progress.Pods) > 0:
+		condition.Reason = "Draining"
+		condition.Message = fmt.Sprintf("%d pods left: %s", len(progress.Pods), strings.Join(progress.Pods, ", "))
+	case drain:
+		condition.Status = sitev1alpha2.ConditionTrue
+		condition.Reason = "Drained"
+		condition.Message = fmt.Sprintf("%d nodes cordoned and drained", progress.Nodes)
+	default:
+		condition.Status = sitev1alpha2.ConditionTrue
+		condition.Reason = "Cordoned"
+		condition.Message = fmt.Sprintf("%d nodes cordoned", progress.Nodes)
+	}
+	return condition
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2021 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cordon
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	sitev1alpha2 "github.com/superedge/superedge/pkg/site-manager/apis/site.superedge.io/v1alpha2"
+	"github.com/superedge/superedge/pkg/site-manager/constant"
+	"github.com/superedge/superedge/pkg/site-manager/utils"
+)
+
+func newNode(name string, unschedulable bool, units string) *corev1.Node {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: corev1.NodeSpec{Unschedulable: unschedulable}}
+	if units != "" {
+		node.Annotations = map[string]string{constant.NodeUnschedulableUnitsAnnotation: units}
+	}
+	return node
+}
+
+func TestCordon(t *testing.T) {
+	ctx := context.TODO()
+	nodes := map[string]*corev1.Node{
+		"schedulable": newNode("schedulable", false, ""),
+		"manual":      newNode("manual", true, ""),
+		"other":       newNode("other", true, "other"),
+	}
+	client := fake.NewSimpleClientset(nodes["schedulable"], nodes["manual"], nodes["other"])
+	c := NewCordoner(client, DrainOptions{GracePeriodSeconds: -1})
+	nu := &sitev1alpha2.NodeUnit{ObjectMeta: metav1.ObjectMeta{Name: "unit"}}
+
+	check := func(name string, unschedulable bool, units string) {
+		node, err := client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if node.Spec.Unschedulable != unschedulable || node.Annotations[constant.NodeUnschedulableUnitsAnnotation] != units {
+			t.Errorf("node %s: expected unschedulable %t by %q, got %t by %q", name, unschedulable, units,
+				node.Spec.Unschedulable, node.Annotations[constant.NodeUnschedulableUnitsAnnotation])
+		}
+	}
+
+	progress, err := c.Cordon(ctx, nu, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !progress.Done() || progress.Cordoned != 3 {
+		t.Errorf("unexpected progress %+v", progress)
+	}
+	check("schedulable", true, "unit")
+	// the cordon of another actor is left to it
+	check("manual", true, "")
+	check("other", true, "other,unit")
+
+	for name := range nodes {
+		if nodes[name], err = client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Uncordon(ctx, nu.Name, nodes); err != nil {
+		t.Fatal(err)
+	}
+	check("schedulable", false, "")
+	check("manual", true, "")
+	check("other", true, "other")
+}
+
+func TestDrain(t *testing.T) {
+	ctx := context.TODO()
+	node := newNode("node", false, "")
+	newPod := func(name string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceDefault},
+			Spec:       corev1.PodSpec{NodeName: node.Name},
+		}
+	}
+	daemon, mirror, completed := newPod("daemon"), newPod("mirror"), newPod("completed")
+	controller := true
+	daemon.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "DaemonSet", Name: "ds", Controller: &controller}}
+	mirror.Annotations = map[string]string{corev1.MirrorPodAnnotationKey: "hash"}
+	completed.Status.Phase = corev1.PodSucceeded
+	client := fake.NewSimpleClientset(node, newPod("app"), newPod("budget"), daemon, mirror, completed)
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		eviction := action.(k8stesting.CreateAction).GetObject().(*policyv1beta1.Eviction)
+		if eviction.Name == "budget" {
+			return true, nil, errors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 0)
+		}
+		return true, nil, client.Tracker().Delete(schema.GroupVersionResource{Version: "v1", Resource: "pods"}, eviction.Namespace, eviction.Name)
+	})
+
+	c := NewCordoner(client, DrainOptions{Drain: true, GracePeriodSeconds: -1})
+	nu := &sitev1alpha2.NodeUnit{ObjectMeta: metav1.ObjectMeta{Name: "unit"}, Spec: sitev1alpha2.NodeUnitSpec{Unschedulable: true}}
+	nodes := map[string]*corev1.Node{node.Name: node}
+	progress, err := c.Cordon(ctx, nu, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Progress{Nodes: 1, Cordoned: 1, Pods: []string{"default/app", "default/budget"}, Blocked: []string{"default/budget"}}
+	if !reflect.DeepEqual(progress, expected) {
+		t.Errorf("expected progress %+v, got %+v", expected, progress)
+	}
+	if condition := Condition(progress, true); condition.Status != sitev1alpha2.ConditionFalse || condition.Reason != "DrainBlocked" {
+		t.Errorf("unexpected condition %+v", condition)
+	}
+
+	if progress, err = c.Cordon(ctx, nu, nodes); err != nil {
+		t.Fatal(err)
+	}
+	expected = Progress{Nodes: 1, Cordoned: 1, Pods: []string{"default/budget"}, Blocked: []string{"default/budget"}}
+	if !reflect.DeepEqual(progress, expected) {
+		t.Errorf("expected progress %+v, got %+v", expected, progress)
+	}
+	if err := client.CoreV1().Pods(metav1.NamespaceDefault).Delete(ctx, "budget", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if progress, err = c.Cordon(ctx, nu, nodes); err != nil {
+		t.Fatal(err)
+	}
+	if condition := Condition(progress, true); !progress.Done() || condition.Status != sitev1alpha2.ConditionTrue || condition.Reason != "Drained" {
+		t.Errorf("unexpected progress %+v and condition %+v", progress, condition)
+	}
+}
+
+func TestCondition(t *testing.T) {
+	before := metav1.NewTime(time.Now().Add(-time.Hour))
+	conditions := []sitev1alpha2.ClusterCondition{
+		{Type: sitev1alpha2.NodeUnitCloudPartitioned, Status: sitev1alpha2.ConditionFalse},
+		{Type: sitev1alpha2.NodeUnitUnschedulable, Status: sitev1alpha2.ConditionFalse, Reason: "Cordoning", LastTransitionTime: before},
+	}
+	condition := Condition(Progress{Nodes: 2, Cordoned: 2, Pods: []string{"default/app"}}, true)
+	conditions = utils.SetCondition(conditions, condition)
+	if conditions[1].Reason != "Draining" || !conditions[1].LastTransitionTime.Equal(&before) {
+		t.Errorf("the transition time must be kept while the status is the same, got %+v", conditions[1])
+	}
+	conditions = utils.SetCondition(conditions, Condition(Progress{Nodes: 2, Cordoned: 2}, true))
+	if conditions[1].Status != sitev1alpha2.ConditionTrue || conditions[1].LastTransitionTime.Equal(&before) {
+		t.Errorf("unexpected condition %+v", conditions[1])
+	}
+	conditions = utils.RemoveCondition(conditions, sitev1alpha2.NodeUnitUnschedulable)
+	if len(conditions) != 1 || conditions[0].Type != sitev1alpha2.NodeUnitCloudPartitioned {
+		t.Errorf("unexpected conditions %+v", conditions)
+	}
+}
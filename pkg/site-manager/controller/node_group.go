@@ -45,6 +45,7 @@ import (
 
 	sitev1alpha2 "github.com/superedge/superedge/pkg/site-manager/apis/site.superedge.io/v1alpha2"
 	deleter "github.com/superedge/superedge/pkg/site-manager/controller/deleter"
+	"github.com/superedge/superedge/pkg/site-manager/controller/workload"
 	"k8s.io/apimachinery/pkg/api/errors"
 
 	"github.com/superedge/superedge/pkg/site-manager/constant"
@@ -72,12 +73,14 @@ type NodeGroupController struct {
 	syncHandler      func(key string) error
 	enqueueNodeGroup func(name string)
 	nodeGroupDeleter *deleter.NodeGroupDeleter
+	workloadBinder   *workload.Binder
 }
 
 func NewNodeGroupController(
 	nodeInformer coreinformers.NodeInformer,
 	nodeUnitInformer crdinformers.NodeUnitInformer,
 	nodeGroupInformer crdinformers.NodeGroupInformer,
+	workloadInformers *workload.Informers,
 	kubeClient clientset.Interface,
 	crdClient *crdClientset.Clientset,
 ) *NodeGroupController {
@@ -121,6 +124,8 @@ func NewNodeGroupController(
 	groupController.nodeGroupListerSynced = nodeGroupInformer.Informer().HasSynced
 
 	groupController.nodeGroupDeleter = deleter.NewNodeGroupDeleter(kubeClient, crdClient, nodeUnitInformer.Lister(), NodeGroupFinalizerID)
+	groupController.workloadBinder = workload.NewBinder(kubeClient, workloadInformers)
+	groupController.workloadBinder.AddCopyHandler(groupController.enqueue)
 	return groupController
 }
 
@@ -132,7 +137,7 @@ func (c *NodeGroupController) Run(workers, syncPeriodAsWhole int, stopCh <-chan
 	defer klog.V(1).Infof("Shutting down NodeGroupController")
 
 	if !cache.WaitForNamedCacheSync("NodeGroupController", stopCh,
-		c.nodeListerSynced, c.nodeUnitListerSynced, c.nodeGroupListerSynced) {
+		c.nodeListerSynced, c.nodeUnitListerSynced, c.nodeGroupListerSynced, c.workloadBinder.HasSynced) {
 		return
 	}
 
@@ -218,6 +223,10 @@ func (c *NodeGroupController) syncGroup(key string) error {
 				// so that it can be retried
 				return err
 			}
+			// the templates of the workloads run again, the copies are collected with the NodeGroup
+			if err := c.workloadBinder.Release(context.TODO(), ng); err != nil {
+				return err
+			}
 
 			// remove our finalizer from the list and update it.
 			controllerutil.RemoveFinalizer(ng, NodeGroupFinalizerID)
@@ -286,11 +295,19 @@ func (c *NodeGroupController) reconcileNodeGroup(ng *sitev1alpha2.NodeGroup) err
 		klog.ErrorS(err, "SetNodeToNodeUnits error")
 		return err
 	}
-	// 4. caculate status and update group status
+	// 4. ensure the workloads of node group are bound to each node unit, the status is updated even if some failed
+	workloadStatus, bindErr := c.workloadBinder.Bind(context.TODO(), ng, unitSet.List())
+	if bindErr != nil {
+		klog.ErrorS(bindErr, "Bind workload error", "node group", ng.Name)
+		c.eventRecorder.Event(ng, corev1.EventTypeWarning, "WorkloadBindFailed", bindErr.Error())
+	}
+
+	// 5. caculate status and update group status
 	newStatus, err := utils.CaculateNodeGroupStatus(unitSet, ng)
 	if err != nil {
 		return err
 	}
+	newStatus.WorkloadStatus = workloadStatus
 
 	if !reflect.DeepEqual(newStatus, &ng.Status) {
 		ng.Status = *newStatus
@@ -302,6 +319,9 @@ func (c *NodeGroupController) reconcileNodeGroup(ng *sitev1alpha2.NodeGroup) err
 			return err
 		}
 	}
+	if bindErr != nil {
+		return bindErr
+	}
 	klog.V(4).InfoS("NodeGroup update success", "node group", ng.Name)
 	return nil
 }
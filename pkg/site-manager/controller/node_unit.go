@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"github.com/superedge/superedge/pkg/site-manager/constant"
+	"github.com/superedge/superedge/pkg/site-manager/controller/cordon"
 	deleter "github.com/superedge/superedge/pkg/site-manager/controller/deleter"
 
 	crdClientset "github.com/superedge/superedge/pkg/site-manager/generated/clientset/versioned"
@@ -65,6 +66,8 @@ type NodeUnitController struct {
 	dsListter      applisters.DaemonSetLister
 	dsListerSynced cache.InformerSynced
 
+	stsListerSynced cache.InformerSynced
+
 	nodeUnitLister       crdv1listers.NodeUnitLister
 	nodeUnitListerSynced cache.InformerSynced
 
@@ -77,15 +80,28 @@ type NodeUnitController struct {
 	enqueueNodeUnit func(name string)
 	nodeUnitDeleter *deleter.NodeUnitDeleter
 	kinsController  *unitcluster.KinsController
+	cordoner        *cordon.Cordoner
+	drainOptions    cordon.DrainOptions
+
+	partitionOptions PartitionOptions
 }
 
+// cordonRetryPeriod is the period to check the progress of the cordon and the drain of the unschedulable NodeUnits
+const cordonRetryPeriod = 10 * time.Second
+
+// upgradeRetryPeriod is the period to go on with the upgrade of the unit clusters
+const upgradeRetryPeriod = 10 * time.Second
+
 func NewNodeUnitController(
 	nodeInformer coreinformers.NodeInformer,
 	dsInformer appinformers.DaemonSetInformer,
+	stsInformer appinformers.StatefulSetInformer,
 	nodeUnitInformer crdinformers.NodeUnitInformer,
 	nodeGroupInformer crdinformers.NodeGroupInformer,
 	kubeClient clientset.Interface,
 	crdClient *crdClientset.Clientset,
+	drainOptions cordon.DrainOptions,
+	partitionOptions PartitionOptions,
 ) *NodeUnitController {
 
 	eventBroadcaster := record.NewBroadcaster()
@@ -128,6 +144,8 @@ func NewNodeUnitController(
 
 	nodeUnitController.nodeLister = nodeInformer.Lister()
 	nodeUnitController.nodeListerSynced = nodeInformer.Informer().HasSynced
+	nodeUnitController.dsListerSynced = dsInformer.Informer().HasSynced
+	nodeUnitController.stsListerSynced = stsInformer.Informer().HasSynced
 
 	nodeUnitController.nodeUnitLister = nodeUnitInformer.Lister()
 	nodeUnitController.nodeUnitListerSynced = nodeUnitInformer.Informer().HasSynced
@@ -145,8 +163,12 @@ func NewNodeUnitController(
 		crdClient,
 		nodeInformer.Lister(),
 		dsInformer.Lister(),
+		stsInformer.Lister(),
 		nodeUnitInformer.Lister(),
 	)
+	nodeUnitController.cordoner = cordon.NewCordoner(kubeClient, drainOptions)
+	nodeUnitController.drainOptions = drainOptions
+	nodeUnitController.partitionOptions = partitionOptions
 	klog.V(4).Infof("Site-manager set handler success")
 
 	return nodeUnitController
@@ -160,7 +182,7 @@ func (c *NodeUnitController) Run(workers, syncPeriodAsWhole int, stopCh <-chan s
 	defer klog.V(1).Infof("Shutting down site-manager daemon")
 
 	if !cache.WaitForNamedCacheSync("site-manager-daemon", stopCh,
-		c.nodeListerSynced, c.nodeUnitListerSynced) {
+		c.nodeListerSynced, c.dsListerSynced, c.stsListerSynced, c.nodeUnitListerSynced) {
 		return
 	}
 
@@ -473,6 +495,9 @@ func (c *NodeUnitController) reconcileNodeUnit(nu *sitev1alpha2.NodeUnit) error
 	if err := utils.DeleteNodesFromSetNode(c.kubeClient, nu, gcNodeMap); err != nil {
 		return err
 	}
+	if err := c.cordoner.Uncordon(context.TODO(), nu.Name, gcNodeMap); err != nil {
+		return err
+	}
 
 	// 2. check node which should belong to this unit, ensure setNode(default is label)
 	// 2.1 set node unit default value
@@ -496,7 +521,36 @@ func (c *NodeUnitController) reconcileNodeUnit(nu *sitev1alpha2.NodeUnit) error
 		return err
 	}
 
-	// 2.3 check node unit autonomy level if need install/uninstall unit cluster
+	// 2.3 cordon the nodes of the unschedulable node unit, release the cordons when it is schedulable or deleted
+	var cordonErr error
+	var cordonCondition *sitev1alpha2.ClusterCondition
+	if nu.Spec.Unschedulable && nu.DeletionTimestamp.IsZero() {
+		progress, err := c.cordoner.Cordon(context.TODO(), nu, nodeMap)
+		if err != nil {
+			klog.ErrorS(err, "Cordon node unit error", "node unit", nu.Name)
+			c.eventRecorder.Event(nu, corev1.EventTypeWarning, "CordonFailed", err.Error())
+			cordonErr = err
+		} else if !progress.Done() {
+			c.queue.AddAfter(nu.Name, cordonRetryPeriod)
+		}
+		condition := cordon.Condition(progress, c.drainOptions.Drain)
+		cordonCondition = &condition
+	} else if err := c.cordoner.Uncordon(context.TODO(), nu.Name, nodeMap); err != nil {
+		return err
+	}
+
+	// 2.4 derive the CloudPartitioned condition of a node unit cut from the cloud as a whole, refreshed while it holds
+	partitionCondition := c.partitionCondition(nu, nodeMap)
+	if partitionCondition != nil && partitionCondition.Status == sitev1alpha2.ConditionTrue {
+		c.queue.AddAfter(nu.Name, partitionRefreshPeriod)
+	}
+	conditions := append([]sitev1alpha2.ClusterCondition(nil), nu.Status.Conditions...)
+	if partitionCondition != nil {
+		conditions = replaceCondition(conditions, *partitionCondition)
+	}
+	partitioned := unitCloudPartitioned(conditions, time.Now())
+
+	// 2.5 check node unit autonomy level if need install/uninstall unit cluster
 	ucerr := c.kinsController.ReconcileUnitCluster(nu)
 	// 3. caculate node unit status
 	newStatus, err := utils.CaculateNodeUnitStatus(nodeMap, nu)
@@ -512,16 +566,46 @@ func (c *NodeUnitController) reconcileNodeUnit(nu *sitev1alpha2.NodeUnit) error
 	if ucerr != nil {
 		klog.ErrorS(ucerr, "ReconcileUnitCluster error", "node unit", nu.Name)
 		ucStatus.Phase = sitev1alpha2.ClusterFailed
-		ucStatus.Conditions = []sitev1alpha2.ClusterCondition{
-			{
-				Type:          "Init",
-				Status:        sitev1alpha2.ConditionFalse,
-				LastProbeTime: metav1.Now(),
-				Message:       ucerr.Error(),
-			},
+		ucStatus.Conditions = utils.SetCondition(ucStatus.Conditions, sitev1alpha2.ClusterCondition{
+			Type:               unitcluster.UnitClusterConditionInit,
+			Status:             sitev1alpha2.ConditionFalse,
+			LastProbeTime:      metav1.Now(),
+			LastTransitionTime: metav1.Now(),
+			Message:            ucerr.Error(),
+		})
+	} else if nu.Spec.AutonomyLevel != sitev1alpha2.AutonomyLevelL3 {
+		ucStatus.Conditions = utils.SetCondition(ucStatus.Conditions, sitev1alpha2.ClusterCondition{
+			Type:               unitcluster.UnitClusterConditionInit,
+			Status:             sitev1alpha2.ConditionTrue,
+			LastProbeTime:      metav1.Now(),
+			LastTransitionTime: metav1.Now(),
+			Reason:             "Installed",
+		})
+	}
+	// 3.2 upgrade the unit cluster to the k3s image of the node unit step by step, held while the node unit is
+	// partitioned from the cloud
+	var upgradeErr error
+	if ucerr == nil && partitioned {
+		unitcluster.PauseUpgrade(ucStatus, "the node unit is partitioned from the cloud")
+	} else if ucerr == nil {
+		requeue, err := c.kinsController.UpgradeUnitCluster(nu, ucStatus)
+		if err != nil {
+			klog.ErrorS(err, "Upgrade unit cluster error", "node unit", nu.Name)
+			upgradeErr = err
+		} else if requeue {
+			c.queue.AddAfter(nu.Name, upgradeRetryPeriod)
 		}
+		c.recordUpgradeEvent(nu, nu.Status.UnitCluster.Upgrade, ucStatus.Upgrade)
 	}
 	newStatus.UnitCluster = *ucStatus
+	// the conditions are published by the components in the node unit, like CloudPartitioned by edge-health, and
+	// by site-manager for a node unit it can not reach at all
+	newStatus.Conditions = conditions
+	if cordonCondition != nil {
+		newStatus.Conditions = utils.SetCondition(newStatus.Conditions, *cordonCondition)
+	} else {
+		newStatus.Conditions = utils.RemoveCondition(newStatus.Conditions, sitev1alpha2.NodeUnitUnschedulable)
+	}
 
 	if !reflect.DeepEqual(newStatus, &nu.Status) || !reflect.DeepEqual(newStatus, &nu.Status) {
 		nu.Status = *newStatus
@@ -535,5 +619,25 @@ func (c *NodeUnitController) reconcileNodeUnit(nu *sitev1alpha2.NodeUnit) error
 
 	klog.V(4).InfoS("NodeUnit update success", "node unit", nu.Name)
 
-	return nil
+	if cordonErr != nil {
+		return cordonErr
+	}
+	return upgradeErr
+}
+
+// recordUpgradeEvent records an event when the upgrade of the unit cluster enters a phase
+func (c *NodeUnitController) recordUpgradeEvent(nu *sitev1alpha2.NodeUnit, old, current *sitev1alpha2.UnitClusterUpgrade) {
+	if current == nil || current.Phase == "" || (old != nil && old.Phase == current.Phase) {
+		return
+	}
+	eventType := corev1.EventTypeNormal
+	message := fmt.Sprintf("Unit cluster upgrade %s: %s", current.Phase, current.Message)
+	switch current.Phase {
+	case sitev1alpha2.UpgradeRollingBack, sitev1alpha2.UpgradeRolledBack:
+		eventType = corev1.EventTypeWarning
+		message = fmt.Sprintf("Unit cluster upgrade %s: %s", current.Phase, current.FailureReason)
+	case sitev1alpha2.UpgradeFailed:
+		eventType = corev1.EventTypeWarning
+	}
+	c.eventRecorder.Event(nu, eventType, "UnitClusterUpgrade", message)
 }
@@ -0,0 +1,171 @@
+/*
+Copyright 2021 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	sitev1alpha2 "github.com/superedge/superedge/pkg/site-manager/apis/site.superedge.io/v1alpha2"
+	tunnelutil "github.com/superedge/superedge/pkg/tunnel/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+const (
+	CloudPartitionedReasonNodesUnreachable = "NodesUnreachable"
+	CloudPartitionedReasonNodesReachable   = "NodesReachable"
+)
+
+// partitionRefreshPeriod is the period to refresh the CloudPartitioned condition derived by site-manager, it is
+// shorter than the cloud-partition-timeout of edge-health-admission so the condition is trusted while it holds
+const partitionRefreshPeriod = time.Minute
+
+// cloudPartitionTimeout is the age after which a CloudPartitioned condition is stale, the default
+// cloud-partition-timeout of edge-health-admission
+const cloudPartitionTimeout = 5 * time.Minute
+
+// PartitionOptions are the options to derive the CloudPartitioned condition of the NodeUnits
+type PartitionOptions struct {
+	// TunnelNamespace is the namespace of tunnel-cloud, whose tunnel-nodes ConfigMap lists the nodes connected to
+	// the tunnel. The nodes are not checked for a tunnel when it is empty.
+	TunnelNamespace string
+}
+
+// partitionCondition derives the CloudPartitioned condition of nu cloud side. It returns nil when the condition
+// published by edge-health is left as it is, the tunnel connections are only read when all the nodes are unreachable.
+func (c *NodeUnitController) partitionCondition(nu *sitev1alpha2.NodeUnit, nodeMap map[string]*corev1.Node) *sitev1alpha2.ClusterCondition {
+	tunneled := sets.NewString()
+	if unitUnreachable(nodeMap) && c.partitionOptions.TunnelNamespace != "" {
+		cm, err := c.kubeClient.CoreV1().ConfigMaps(c.partitionOptions.TunnelNamespace).Get(context.TODO(), tunnelutil.HostsConfig, metav1.GetOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			klog.ErrorS(err, "Get tunnel nodes error, CloudPartitioned is left as it is", "node unit", nu.Name)
+			return nil
+		}
+		if err == nil {
+			tunneled = tunnelNodes(cm.Data[tunnelutil.COREFILE_HOSTS_FILE])
+		}
+	}
+	return cloudPartitionCondition(nu.Status.Conditions, nodeMap, tunneled, metav1.Now())
+}
+
+// cloudPartitionCondition returns the CloudPartitioned condition of a NodeUnit whose nodes are nodeMap, tunneled are
+// the nodes connected to tunnel-cloud. A NodeUnit whose nodes are all unreachable and none connected to the tunnel is
+// partitioned, the nodes of a whole site cut from the cloud can not publish it themselves. The condition is refreshed
+// every partitionRefreshPeriod while it holds, and set to False once a node is reachable again. nil is returned to
+// leave the condition published by edge-health as it is.
+func cloudPartitionCondition(conditions []sitev1alpha2.ClusterCondition, nodeMap map[string]*corev1.Node, tunneled sets.String, now metav1.Time) *sitev1alpha2.ClusterCondition {
+	var current *sitev1alpha2.ClusterCondition
+	for i := range conditions {
+		if conditions[i].Type == sitev1alpha2.NodeUnitCloudPartitioned {
+			current = &conditions[i]
+		}
+	}
+	var connected []string
+	for name := range nodeMap {
+		if tunneled.Has(name) {
+			connected = append(connected, name)
+		}
+	}
+	condition := &sitev1alpha2.ClusterCondition{
+		Type:               sitev1alpha2.NodeUnitCloudPartitioned,
+		LastProbeTime:      now,
+		LastTransitionTime: now,
+	}
+	if unitUnreachable(nodeMap) && len(connected) == 0 {
+		condition.Status = sitev1alpha2.ConditionTrue
+		condition.Reason = CloudPartitionedReasonNodesUnreachable
+		condition.Message = fmt.Sprintf("all %d nodes are unreachable and none is connected to tunnel-cloud", len(nodeMap))
+		if current != nil && current.Status == condition.Status && current.Reason == condition.Reason {
+			if now.Sub(current.LastProbeTime.Time) < partitionRefreshPeriod {
+				return current
+			}
+			condition.LastTransitionTime = current.LastTransitionTime
+		}
+		return condition
+	}
+	// the condition derived by site-manager is withdrawn, the one of edge-health is kept
+	if current == nil || current.Status != sitev1alpha2.ConditionTrue || current.Reason != CloudPartitionedReasonNodesUnreachable {
+		return nil
+	}
+	condition.Status = sitev1alpha2.ConditionFalse
+	condition.Reason = CloudPartitionedReasonNodesReachable
+	if len(connected) != 0 {
+		condition.Message = fmt.Sprintf("%d of %d nodes are connected to tunnel-cloud", len(connected), len(nodeMap))
+	} else {
+		condition.Message = fmt.Sprintf("%d of %d nodes are reachable", len(nodeMap)-len(unreachableNodes(nodeMap)), len(nodeMap))
+	}
+	return condition
+}
+
+// unitUnreachable returns whether the NodeUnit has nodes and all of them are unreachable
+func unitUnreachable(nodeMap map[string]*corev1.Node) bool {
+	return len(nodeMap) != 0 && len(unreachableNodes(nodeMap)) == len(nodeMap)
+}
+
+// unreachableNodes returns the nodes whose kubelet stopped posting their status, their Ready condition is Unknown
+func unreachableNodes(nodeMap map[string]*corev1.Node) []string {
+	var unreachable []string
+	for name, node := range nodeMap {
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == corev1.NodeReady && condition.Status == corev1.ConditionUnknown {
+				unreachable = append(unreachable, name)
+			}
+		}
+	}
+	return unreachable
+}
+
+// tunnelNodes returns the nodes of the hosts kept by tunnel-cloud, a line maps the tunnel-cloud pod a node is
+// connected to and the name of the node
+func tunnelNodes(hosts string) sets.String {
+	nodes := sets.NewString()
+	scanner := bufio.NewScanner(strings.NewReader(hosts))
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) >= 2 && !strings.HasPrefix(fields[0], "#") {
+			nodes.Insert(fields[1])
+		}
+	}
+	return nodes
+}
+
+// replaceCondition replaces the condition of the same type with condition, its probe time included
+func replaceCondition(conditions []sitev1alpha2.ClusterCondition, condition sitev1alpha2.ClusterCondition) []sitev1alpha2.ClusterCondition {
+	for i := range conditions {
+		if conditions[i].Type == condition.Type {
+			conditions[i] = condition
+			return conditions
+		}
+	}
+	return append(conditions, condition)
+}
+
+// unitCloudPartitioned returns whether the CloudPartitioned condition is True and not stale
+func unitCloudPartitioned(conditions []sitev1alpha2.ClusterCondition, now time.Time) bool {
+	for _, condition := range conditions {
+		if condition.Type == sitev1alpha2.NodeUnitCloudPartitioned {
+			return condition.Status == sitev1alpha2.ConditionTrue && now.Sub(condition.LastProbeTime.Time) <= cloudPartitionTimeout
+		}
+	}
+	return false
+}
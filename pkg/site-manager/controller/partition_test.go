@@ -0,0 +1,97 @@
+/*
+Copyright 2022 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	sitev1alpha2 "github.com/superedge/superedge/pkg/site-manager/apis/site.superedge.io/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func readyNode(name string, status corev1.ConditionStatus) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: status}},
+		},
+	}
+}
+
+func TestCloudPartitionCondition(t *testing.T) {
+	now := metav1.Now()
+	unreachable := map[string]*corev1.Node{
+		"node1": readyNode("node1", corev1.ConditionUnknown),
+		"node2": readyNode("node2", corev1.ConditionUnknown),
+	}
+	edgeHealth := sitev1alpha2.ClusterCondition{
+		Type:   sitev1alpha2.NodeUnitCloudPartitioned,
+		Status: sitev1alpha2.ConditionFalse,
+		Reason: "UplinkConnected",
+	}
+
+	// the whole site is cut from the cloud, the condition of edge-health is stale and overridden
+	condition := cloudPartitionCondition([]sitev1alpha2.ClusterCondition{edgeHealth}, unreachable, sets.NewString(), now)
+	if condition == nil || condition.Status != sitev1alpha2.ConditionTrue || condition.Reason != CloudPartitionedReasonNodesUnreachable {
+		t.Fatalf("unexpected condition %+v", condition)
+	}
+	conditions := []sitev1alpha2.ClusterCondition{*condition}
+
+	// it is refreshed only after partitionRefreshPeriod, keeping its transition time
+	if c := cloudPartitionCondition(conditions, unreachable, sets.NewString(), now); c == nil || !c.LastProbeTime.Equal(&now) {
+		t.Errorf("unexpected condition %+v", c)
+	}
+	later := metav1.NewTime(now.Add(partitionRefreshPeriod))
+	refreshed := cloudPartitionCondition(conditions, unreachable, sets.NewString(), later)
+	if refreshed == nil || !refreshed.LastProbeTime.Equal(&later) || !refreshed.LastTransitionTime.Equal(&now) {
+		t.Errorf("unexpected refreshed condition %+v", refreshed)
+	}
+	if !unitCloudPartitioned(conditions, now.Time) || unitCloudPartitioned(conditions, now.Add(cloudPartitionTimeout+time.Second)) {
+		t.Error("unexpected staleness of the condition")
+	}
+
+	// a node still connected to tunnel-cloud is not partitioned, the condition of site-manager is withdrawn
+	withdrawn := cloudPartitionCondition(conditions, unreachable, sets.NewString("node2"), later)
+	if withdrawn == nil || withdrawn.Status != sitev1alpha2.ConditionFalse || withdrawn.Reason != CloudPartitionedReasonNodesReachable {
+		t.Errorf("unexpected condition %+v", withdrawn)
+	}
+
+	// a ready node withdraws it too, and the condition of edge-health is left as it is
+	reachable := map[string]*corev1.Node{
+		"node1": readyNode("node1", corev1.ConditionUnknown),
+		"node2": readyNode("node2", corev1.ConditionTrue),
+	}
+	if c := cloudPartitionCondition(conditions, reachable, sets.NewString(), later); c == nil || c.Status != sitev1alpha2.ConditionFalse {
+		t.Errorf("unexpected condition %+v", c)
+	}
+	if c := cloudPartitionCondition([]sitev1alpha2.ClusterCondition{edgeHealth}, reachable, sets.NewString(), later); c != nil {
+		t.Errorf("expected the condition of edge-health kept, got %+v", c)
+	}
+	if c := cloudPartitionCondition(nil, map[string]*corev1.Node{}, sets.NewString(), later); c != nil {
+		t.Errorf("expected no condition for a node unit without nodes, got %+v", c)
+	}
+}
+
+func TestTunnelNodes(t *testing.T) {
+	hosts := "# tunnel nodes\n10.0.0.1    node1\n\n10.0.0.2 node2\ninvalid\n"
+	if nodes := tunnelNodes(hosts); !nodes.Equal(sets.NewString("node1", "node2")) {
+		t.Errorf("unexpected nodes %v", nodes.List())
+	}
+}
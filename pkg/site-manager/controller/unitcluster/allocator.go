@@ -0,0 +1,383 @@
+package unitcluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	sitev1alpha2 "github.com/superedge/superedge/pkg/site-manager/apis/site.superedge.io/v1alpha2"
+	crdv1listers "github.com/superedge/superedge/pkg/site-manager/generated/listers/site.superedge.io/v1alpha2"
+	"github.com/superedge/superedge/pkg/util/allocator"
+	"github.com/superedge/superedge/pkg/util/ipallocator"
+)
+
+// Allocation is the network of a unit cluster, it must not overlap the networks of the other unit clusters
+type Allocation struct {
+	ServiceCIDR   string `json:"serviceCIDR"`
+	CoreDNSIP     string `json:"corednsIP"`
+	NodePortRange string `json:"nodePortRange"`
+}
+
+// KubernetesServiceIP returns the cluster ip of the kubernetes service of the unit cluster
+func (a *Allocation) KubernetesServiceIP() (string, error) {
+	_, cidr, err := net.ParseCIDR(a.ServiceCIDR)
+	if err != nil {
+		return "", err
+	}
+	ip, err := ipallocator.GetIndexedIP(cidr, 1)
+	if err != nil {
+		return "", err
+	}
+	return ip.String(), nil
+}
+
+// Allocator allocates the service cidrs, the coredns ips and the node port ranges of the unit clusters. The
+// allocations are kept in the ConfigMap KinsAllocationConfigMapName, keyed by the node units, and the bitmaps of the
+// free blocks are rebuilt from them on each allocation.
+type Allocator struct {
+	lock           sync.Mutex
+	kubeClient     clientset.Interface
+	nodeUnitLister crdv1listers.NodeUnitLister
+}
+
+func NewAllocator(kubeClient clientset.Interface, nodeUnitLister crdv1listers.NodeUnitLister) *Allocator {
+	return &Allocator{kubeClient: kubeClient, nodeUnitLister: nodeUnitLister}
+}
+
+// Allocate returns the allocation of nu. The allocation is kept once made, the parameters service-cidr, coredns-ip
+// and node-port-range override it when they don't conflict with the allocations of the other node units.
+func (a *Allocator) Allocate(nu *sitev1alpha2.NodeUnit) (*Allocation, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	cm, allocations, err := a.load()
+	if err != nil {
+		return nil, err
+	}
+	var old *Allocation
+	if allocation, ok := allocations[nu.Name]; ok {
+		old = &allocation
+	}
+	others := make(map[string]Allocation)
+	for unit, allocation := range allocations {
+		if unit != nu.Name && a.inUse(unit) {
+			others[unit] = allocation
+		}
+	}
+	allocation, err := allocate(nu, others, old)
+	if err != nil {
+		return nil, err
+	}
+	others[nu.Name] = *allocation
+	if old == nil || *old != *allocation {
+		klog.InfoS("Allocate unit cluster network", "node unit", nu.Name, "service cidr", allocation.ServiceCIDR,
+			"coredns ip", allocation.CoreDNSIP, "node port range", allocation.NodePortRange)
+	}
+	return allocation, a.save(cm, others)
+}
+
+// Get returns the allocation of unit, nil when unit has none
+func (a *Allocator) Get(unit string) (*Allocation, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	_, allocations, err := a.load()
+	if err != nil {
+		return nil, err
+	}
+	if allocation, ok := allocations[unit]; ok {
+		return &allocation, nil
+	}
+	return nil, nil
+}
+
+// Release releases the allocation of unit
+func (a *Allocator) Release(unit string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	cm, allocations, err := a.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := allocations[unit]; !ok {
+		return nil
+	}
+	delete(allocations, unit)
+	klog.InfoS("Release unit cluster network", "node unit", unit)
+	return a.save(cm, allocations)
+}
+
+// inUse is false for the allocations left by the node units deleted or downgraded to L3 before being released
+func (a *Allocator) inUse(unit string) bool {
+	nu, err := a.nodeUnitLister.Get(unit)
+	if errors.IsNotFound(err) {
+		return false
+	}
+	return err != nil || nu.Spec.AutonomyLevel != sitev1alpha2.AutonomyLevelL3
+}
+
+func (a *Allocator) load() (*corev1.ConfigMap, map[string]Allocation, error) {
+	allocations := make(map[string]Allocation)
+	cm, err := a.kubeClient.CoreV1().ConfigMaps(DefaultKinsNamespace).Get(context.TODO(), KinsAllocationConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, allocations, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	for unit, data := range cm.Data {
+		var allocation Allocation
+		if err := json.Unmarshal([]byte(data), &allocation); err != nil {
+			klog.ErrorS(err, "Invalid unit cluster allocation, dropped", "node unit", unit, "allocation", data)
+			continue
+		}
+		allocations[unit] = allocation
+	}
+	return cm, allocations, nil
+}
+
+// save writes the allocations to cm, which is created when nil. A conflict with another writer fails the save and the
+// node unit is requeued.
+func (a *Allocator) save(cm *corev1.ConfigMap, allocations map[string]Allocation) error {
+	data := make(map[string]string, len(allocations))
+	for unit, allocation := range allocations {
+		b, err := json.Marshal(allocation)
+		if err != nil {
+			return err
+		}
+		data[unit] = string(b)
+	}
+	if cm == nil {
+		if len(data) == 0 {
+			return nil
+		}
+		_, err := a.kubeClient.CoreV1().ConfigMaps(DefaultKinsNamespace).Create(context.TODO(), &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: KinsAllocationConfigMapName, Namespace: DefaultKinsNamespace},
+			Data:       data,
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if reflect.DeepEqual(cm.Data, data) || (len(cm.Data) == 0 && len(data) == 0) {
+		return nil
+	}
+	newCm := cm.DeepCopy()
+	newCm.Data = data
+	_, err := a.kubeClient.CoreV1().ConfigMaps(DefaultKinsNamespace).Update(context.TODO(), newCm, metav1.UpdateOptions{})
+	return err
+}
+
+// allocate validates the parameters of nu against the allocations of the other node units, and allocates from the
+// default pools what the parameters and the old allocation leave unset
+func allocate(nu *sitev1alpha2.NodeUnit, others map[string]Allocation, old *Allocation) (*Allocation, error) {
+	allocation := &Allocation{
+		ServiceCIDR:   unitClusterParameter(nu, ParameterServiceCIDRKey),
+		CoreDNSIP:     unitClusterParameter(nu, ParameterCoreDNSIPKey),
+		NodePortRange: unitClusterParameter(nu, ParameterNodePortRangeKey),
+	}
+	if old != nil {
+		if allocation.ServiceCIDR == "" {
+			allocation.ServiceCIDR = old.ServiceCIDR
+		}
+		if allocation.CoreDNSIP == "" && allocation.ServiceCIDR == old.ServiceCIDR {
+			allocation.CoreDNSIP = old.CoreDNSIP
+		}
+		if allocation.NodePortRange == "" {
+			allocation.NodePortRange = old.NodePortRange
+		}
+	}
+
+	// 1. service cidr
+	units := sortedUnits(others)
+	var serviceCIDR *net.IPNet
+	if allocation.ServiceCIDR != "" {
+		cidr, err := parseServiceCIDR(allocation.ServiceCIDR)
+		if err != nil {
+			return nil, err
+		}
+		for _, unit := range units {
+			if other, err := parseServiceCIDR(others[unit].ServiceCIDR); err == nil && cidrOverlap(cidr, other) {
+				return nil, fmt.Errorf("service cidr %s overlaps %s of node unit %s", cidr, other, unit)
+			}
+		}
+		serviceCIDR = cidr
+	} else {
+		cidr, err := allocateServiceCIDR(others)
+		if err != nil {
+			return nil, err
+		}
+		serviceCIDR = cidr
+	}
+	allocation.ServiceCIDR = serviceCIDR.String()
+
+	// 2. coredns ip, in the service cidr and not the ip of the kubernetes service
+	r := ipallocator.NewCIDRRange(serviceCIDR)
+	kubernetesIP, err := ipallocator.GetIndexedIP(serviceCIDR, 1)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Allocate(kubernetesIP); err != nil {
+		return nil, fmt.Errorf("service cidr %s: %v", serviceCIDR, err)
+	}
+	if allocation.CoreDNSIP == "" {
+		index := DefaultKinsCoreDNSIPIndex
+		if size := int(ipallocator.RangeSize(serviceCIDR)); index > size-2 {
+			index = size - 2
+		}
+		ip, err := ipallocator.GetIndexedIP(serviceCIDR, index)
+		if err != nil {
+			return nil, err
+		}
+		allocation.CoreDNSIP = ip.String()
+	}
+	corednsIP := net.ParseIP(allocation.CoreDNSIP)
+	if corednsIP == nil {
+		return nil, fmt.Errorf("invalid coredns ip %s", allocation.CoreDNSIP)
+	}
+	if err := r.Allocate(corednsIP); err != nil {
+		return nil, fmt.Errorf("coredns ip %s of service cidr %s: %v", allocation.CoreDNSIP, serviceCIDR, err)
+	}
+
+	// 3. node port range
+	if allocation.NodePortRange != "" {
+		portRange, err := parseNodePortRange(allocation.NodePortRange)
+		if err != nil {
+			return nil, err
+		}
+		for _, unit := range units {
+			if other, err := parseNodePortRange(others[unit].NodePortRange); err == nil && portRangeOverlap(portRange, other) {
+				return nil, fmt.Errorf("node port range %s overlaps %s of node unit %s", portRange, other, unit)
+			}
+		}
+		allocation.NodePortRange = portRange.String()
+	} else {
+		portRange, err := allocateNodePortRange(others)
+		if err != nil {
+			return nil, err
+		}
+		allocation.NodePortRange = portRange.String()
+	}
+	return allocation, nil
+}
+
+// allocateServiceCIDR allocates a free block of DefaultKinsServiceCIDRPool, the blocks overlapping the service cidrs
+// of the other node units are taken
+func allocateServiceCIDR(others map[string]Allocation) (*net.IPNet, error) {
+	_, pool, err := net.ParseCIDR(DefaultKinsServiceCIDRPool)
+	if err != nil {
+		return nil, err
+	}
+	blockSize := 1 << uint(32-DefaultKinsServiceCIDRMaskSize)
+	block := func(i int) *net.IPNet {
+		ip, _ := ipallocator.GetIndexedIP(pool, i*blockSize)
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(DefaultKinsServiceCIDRMaskSize, 32)}
+	}
+	max := int(ipallocator.RangeSize(pool)) / blockSize
+	blocks := allocator.NewContiguousAllocationMap(max, DefaultKinsServiceCIDRPool)
+	for _, other := range others {
+		cidr, err := parseServiceCIDR(other.ServiceCIDR)
+		if err != nil {
+			continue
+		}
+		for i := 0; i < max; i++ {
+			if cidrOverlap(block(i), cidr) {
+				blocks.Allocate(i)
+			}
+		}
+	}
+	i, ok, _ := blocks.AllocateNext()
+	if !ok {
+		return nil, fmt.Errorf("no service cidr left in %s", DefaultKinsServiceCIDRPool)
+	}
+	return block(i), nil
+}
+
+// allocateNodePortRange allocates a free block of DefaultKinsNodePortRangeSize ports from
+// DefaultKinsNodePortRangeStart, the blocks overlapping the node port ranges of the other node units are taken
+func allocateNodePortRange(others map[string]Allocation) (*utilnet.PortRange, error) {
+	poolSpec := fmt.Sprintf("%d-%d", DefaultKinsNodePortRangeStart, DefaultKinsNodePortRangeEnd)
+	block := func(i int) *utilnet.PortRange {
+		return &utilnet.PortRange{Base: DefaultKinsNodePortRangeStart + i*DefaultKinsNodePortRangeSize, Size: DefaultKinsNodePortRangeSize}
+	}
+	max := (DefaultKinsNodePortRangeEnd - DefaultKinsNodePortRangeStart + 1) / DefaultKinsNodePortRangeSize
+	blocks := allocator.NewContiguousAllocationMap(max, poolSpec)
+	for _, other := range others {
+		portRange, err := parseNodePortRange(other.NodePortRange)
+		if err != nil {
+			continue
+		}
+		for i := 0; i < max; i++ {
+			if portRangeOverlap(block(i), portRange) {
+				blocks.Allocate(i)
+			}
+		}
+	}
+	i, ok, _ := blocks.AllocateNext()
+	if !ok {
+		return nil, fmt.Errorf("no node port range left in %s", poolSpec)
+	}
+	return block(i), nil
+}
+
+func parseServiceCIDR(s string) (*net.IPNet, error) {
+	ip, cidr, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service cidr %s: %v", s, err)
+	}
+	if ip.To4() == nil {
+		return nil, fmt.Errorf("invalid service cidr %s: only ipv4 is supported", s)
+	}
+	if !ip.Equal(cidr.IP) {
+		return nil, fmt.Errorf("invalid service cidr %s: %s expected", s, cidr)
+	}
+	if ones, _ := cidr.Mask.Size(); ones > 28 {
+		return nil, fmt.Errorf("invalid service cidr %s: the mask must not be longer than /28", s)
+	}
+	return cidr, nil
+}
+
+func parseNodePortRange(s string) (*utilnet.PortRange, error) {
+	portRange := &utilnet.PortRange{}
+	if err := portRange.Set(s); err != nil {
+		return nil, fmt.Errorf("invalid node port range %s: %v", s, err)
+	}
+	if portRange.Base < 1 || portRange.Size < 1 {
+		return nil, fmt.Errorf("invalid node port range %s", s)
+	}
+	return portRange, nil
+}
+
+func cidrOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+func portRangeOverlap(a, b *utilnet.PortRange) bool {
+	return a.Base < b.Base+b.Size && b.Base < a.Base+a.Size
+}
+
+func sortedUnits(allocations map[string]Allocation) []string {
+	units := make([]string, 0, len(allocations))
+	for unit := range allocations {
+		units = append(units, unit)
+	}
+	sort.Strings(units)
+	return units
+}
+
+func unitClusterParameter(nu *sitev1alpha2.NodeUnit, key string) string {
+	if nu.Spec.UnitClusterInfo == nil {
+		return ""
+	}
+	return nu.Spec.UnitClusterInfo.Parameters[key]
+}
@@ -0,0 +1,108 @@
+package unitcluster
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	sitev1alpha2 "github.com/superedge/superedge/pkg/site-manager/apis/site.superedge.io/v1alpha2"
+	crdv1listers "github.com/superedge/superedge/pkg/site-manager/generated/listers/site.superedge.io/v1alpha2"
+)
+
+func newUnit(name string, level sitev1alpha2.AutonomyLevelType, parameters map[string]string) *sitev1alpha2.NodeUnit {
+	return &sitev1alpha2.NodeUnit{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: sitev1alpha2.NodeUnitSpec{
+			AutonomyLevel:   level,
+			UnitClusterInfo: &sitev1alpha2.UnitClusterInfoSpec{Parameters: parameters},
+		},
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	client := fake.NewSimpleClientset()
+	a := NewAllocator(client, crdv1listers.NewNodeUnitLister(indexer))
+	allocate := func(nu *sitev1alpha2.NodeUnit) (*Allocation, error) {
+		if err := indexer.Update(nu); err != nil {
+			t.Fatal(err)
+		}
+		return a.Allocate(nu)
+	}
+	expect := func(nu *sitev1alpha2.NodeUnit, expected Allocation) {
+		allocation, err := allocate(nu)
+		if err != nil {
+			t.Fatalf("node unit %s: %v", nu.Name, err)
+		}
+		if *allocation != expected {
+			t.Errorf("node unit %s: expected %+v, got %+v", nu.Name, expected, *allocation)
+		}
+	}
+
+	first := Allocation{ServiceCIDR: "26.0.0.0/16", CoreDNSIP: "26.0.0.255", NodePortRange: "40000-40999"}
+	second := Allocation{ServiceCIDR: "26.1.0.0/16", CoreDNSIP: "26.1.0.255", NodePortRange: "41000-41999"}
+	expect(newUnit("a", sitev1alpha2.AutonomyLevelL4, nil), first)
+	expect(newUnit("b", sitev1alpha2.AutonomyLevelL5, nil), second)
+	// the allocation is kept
+	expect(newUnit("a", sitev1alpha2.AutonomyLevelL4, nil), first)
+	cm, err := client.CoreV1().ConfigMaps(DefaultKinsNamespace).Get(context.TODO(), KinsAllocationConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cm.Data) != 2 {
+		t.Errorf("expected the allocations of 2 node units, got %v", cm.Data)
+	}
+
+	for _, parameters := range []map[string]string{
+		{ParameterServiceCIDRKey: "26.1.128.0/17"},
+		{ParameterServiceCIDRKey: "26.0.0.0/8"},
+		{ParameterServiceCIDRKey: "10.0.0.1/24"},
+		{ParameterServiceCIDRKey: "10.0.0.0/30"},
+		{ParameterServiceCIDRKey: "fd00::/108"},
+		{ParameterNodePortRangeKey: "40500-40600"},
+		{ParameterNodePortRangeKey: "41999+10"},
+		{ParameterNodePortRangeKey: "30100-30000"},
+		{ParameterServiceCIDRKey: "10.0.0.0/24", ParameterCoreDNSIPKey: "10.0.1.10"},
+		{ParameterServiceCIDRKey: "10.0.0.0/24", ParameterCoreDNSIPKey: "10.0.0.1"},
+		{ParameterServiceCIDRKey: "10.0.0.0/24", ParameterCoreDNSIPKey: "10.0.0.255"},
+	} {
+		if allocation, err := allocate(newUnit("c", sitev1alpha2.AutonomyLevelL4, parameters)); err == nil {
+			t.Errorf("parameters %v: expected error, got %+v", parameters, *allocation)
+		}
+	}
+	expect(newUnit("c", sitev1alpha2.AutonomyLevelL4, map[string]string{
+		ParameterServiceCIDRKey:   "10.0.0.0/24",
+		ParameterNodePortRangeKey: "30000-30099",
+	}), Allocation{ServiceCIDR: "10.0.0.0/24", CoreDNSIP: "10.0.0.254", NodePortRange: "30000-30099"})
+	expect(newUnit("d", sitev1alpha2.AutonomyLevelL4, map[string]string{
+		ParameterServiceCIDRKey: "26.2.0.0/16",
+		ParameterCoreDNSIPKey:   "26.2.0.10",
+	}), Allocation{ServiceCIDR: "26.2.0.0/16", CoreDNSIP: "26.2.0.10", NodePortRange: "42000-42999"})
+
+	// the released blocks are allocated again
+	if err := a.Release("b"); err != nil {
+		t.Fatal(err)
+	}
+	expect(newUnit("e", sitev1alpha2.AutonomyLevelL4, nil), Allocation{ServiceCIDR: "26.1.0.0/16", CoreDNSIP: "26.1.0.255", NodePortRange: "41000-41999"})
+	if allocation, err := a.Get("b"); err != nil || allocation != nil {
+		t.Errorf("expected no allocation of b, got %+v, %v", allocation, err)
+	}
+	// so are the ones of the node units downgraded to L3 and not released yet
+	if err := indexer.Update(newUnit("a", sitev1alpha2.AutonomyLevelL3, nil)); err != nil {
+		t.Fatal(err)
+	}
+	expect(newUnit("f", sitev1alpha2.AutonomyLevelL4, nil), Allocation{ServiceCIDR: "26.0.0.0/16", CoreDNSIP: "26.0.0.255", NodePortRange: "40000-40999"})
+	if allocation, err := a.Get("a"); err != nil || allocation != nil {
+		t.Errorf("expected no allocation of a, got %+v, %v", allocation, err)
+	}
+}
+
+func TestKubernetesServiceIP(t *testing.T) {
+	allocation := &Allocation{ServiceCIDR: "26.3.0.0/16"}
+	if ip, err := allocation.KubernetesServiceIP(); err != nil || ip != "26.3.0.1" {
+		t.Errorf("expected 26.3.0.1, got %s, %v", ip, err)
+	}
+}
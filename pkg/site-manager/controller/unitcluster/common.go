@@ -1,20 +1,55 @@
 package unitcluster
 
+import "time"
+
 const (
-	DefaultKinsNamespace          = "kins-system"
-	KinsResourceNameSuffix        = "kins"
-	KinsResourceLabelKey          = "site.superedge.io/kins-resource"
-	KinsRoleLabelKey              = "site.superedge.io/kins-role"
-	KinsUnitClusterClearAnno      = "site.superedge.io/clear-cluster"
-	KinsRoleLabelServer           = "server"
-	KinsRoleLabelAgent            = "agent"
-	DefaultKinsServiceCIDR        = "26.%d.0.%s"
-	DefaultKinsNodePortRangeStart = 40000
-	DefaultKinsCRIWImage          = "ccr.ccs.tencentyun.com/tkeedge/cri-w:v0.1.0"
-	DefaultK3SImage               = "ccr.ccs.tencentyun.com/tkeedge/k3s:v1.22.6-revison-1"
+	DefaultKinsNamespace        = "kins-system"
+	KinsResourceNameSuffix      = "kins"
+	KinsResourceLabelKey        = "site.superedge.io/kins-resource"
+	KinsRoleLabelKey            = "site.superedge.io/kins-role"
+	KinsUnitClusterClearAnno    = "site.superedge.io/clear-cluster"
+	KinsRoleLabelServer         = "server"
+	KinsRoleLabelAgent          = "agent"
+	KinsAllocationConfigMapName = "kins-allocation"
+	DefaultKinsCRIWImage        = "ccr.ccs.tencentyun.com/tkeedge/cri-w:v0.1.0"
+	DefaultK3SImage             = "ccr.ccs.tencentyun.com/tkeedge/k3s:v1.22.6-revison-1"
 
 	ParameterK3SImageKey      = "k3s-image"
 	ParameterCRIWImageKey     = "criw-image"
 	ParameterServiceCIDRKey   = "service-cidr"
+	ParameterCoreDNSIPKey     = "coredns-ip"
 	ParameterNodePortRangeKey = "node-port-range"
 )
+
+// The pools of the networks of the unit clusters, every unit cluster is allocated a /16 service cidr of 26.0.0.0/8
+// with the coredns ip at the index 255, and 1000 node ports from 40000
+const (
+	DefaultKinsServiceCIDRPool     = "26.0.0.0/8"
+	DefaultKinsServiceCIDRMaskSize = 16
+	DefaultKinsCoreDNSIPIndex      = 255
+	DefaultKinsNodePortRangeStart  = 40000
+	DefaultKinsNodePortRangeEnd    = 65535
+	DefaultKinsNodePortRangeSize   = 1000
+)
+
+// The conditions of the unit cluster
+const (
+	// UnitClusterConditionInit is False when the unit cluster failed to be installed
+	UnitClusterConditionInit = "Init"
+	// UnitClusterConditionServerReady is True when all the kins servers are ready
+	UnitClusterConditionServerReady = "KinsServerReady"
+	// UnitClusterConditionAgentReady is True when all the kins agents are ready
+	UnitClusterConditionAgentReady = "KinsAgentReady"
+	// UnitClusterConditionCRIReady is True when the cri wrappers of all the nodes are ready
+	UnitClusterConditionCRIReady = "KinsCRIReady"
+	// UnitClusterConditionAPIServerReady is True when the apiserver of the unit cluster is reachable with its credential
+	UnitClusterConditionAPIServerReady = "APIServerReady"
+
+	// DefaultUnitClusterTimeout is the timeout of the requests to the unit clusters
+	DefaultUnitClusterTimeout = 10 * time.Second
+	// DefaultUnitClusterObserveInterval is the minimum interval between two observations of a unit cluster
+	DefaultUnitClusterObserveInterval = time.Minute
+	// DefaultUpgradeStepTimeout is the time a kins pod replaced by the upgrade has to become ready, and the unit
+	// cluster to become healthy again
+	DefaultUpgradeStepTimeout = 10 * time.Minute
+)
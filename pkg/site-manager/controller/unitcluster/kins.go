@@ -4,11 +4,9 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/base64"
-	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"k8s.io/apimachinery/pkg/types"
-	"net"
 	"reflect"
 	"strings"
 	"time"
@@ -49,7 +47,10 @@ type KinsController struct {
 	crdClient      *crdClientset.Clientset
 	nodeLister     corelisters.NodeLister
 	dsLister       applisters.DaemonSetLister
+	stsLister      applisters.StatefulSetLister
 	nodeUnitLister crdv1listers.NodeUnitLister
+	allocator      *Allocator
+	observations   *unitObservations
 }
 
 func NewKinsController(
@@ -57,6 +58,7 @@ func NewKinsController(
 	crdClient *crdClientset.Clientset,
 	nodeLister corelisters.NodeLister,
 	dsLister applisters.DaemonSetLister,
+	stsLister applisters.StatefulSetLister,
 	nodeUnitLister crdv1listers.NodeUnitLister,
 ) *KinsController {
 	return &KinsController{
@@ -64,7 +66,10 @@ func NewKinsController(
 		crdClient,
 		nodeLister,
 		dsLister,
+		stsLister,
 		nodeUnitLister,
+		NewAllocator(kubeClient, nodeUnitLister),
+		newUnitObservations(),
 	}
 }
 
@@ -126,9 +131,14 @@ func (kc *KinsController) installUnitCluster(nu *sitev1alpha2.NodeUnit) error {
 	if err := kc.createCRIW(nu); err != nil {
 		return err
 	}
+	// allocate service cidr, coredns ip and nodeport range
+	allocation, err := kc.allocator.Allocate(nu)
+	if err != nil {
+		klog.ErrorS(err, "allocate unit cluster network error", "node unit", nu.Name)
+		return err
+	}
 	// create kins server
-
-	if err := kc.createServer(nu); err != nil {
+	if err := kc.createServer(nu, allocation); err != nil {
 		return err
 	}
 
@@ -138,7 +148,7 @@ func (kc *KinsController) installUnitCluster(nu *sitev1alpha2.NodeUnit) error {
 	}
 
 	// create secret
-	if err := kc.creatSecret(nu); err != nil {
+	if err := kc.creatSecret(nu, allocation); err != nil {
 		return err
 	}
 
@@ -288,20 +298,11 @@ func (kc *KinsController) createServerStorage(nu *sitev1alpha2.NodeUnit, serverN
 	return nil
 }
 
-func (kc *KinsController) createServer(nu *sitev1alpha2.NodeUnit) error {
-	existUnitCluster := int32(0)
-	// caculate service cidr nodeport range and coredns IP
-	//todo
-	//if nuList, err := kc.nodeUnitLister.List(labels.Everything()); err != nil {
-	//	for _, nu := range nuList {
-	//		if nu.Spec.AutonomyLevel == sitev1alpha2.AutonomyLevelL4 || nu.Spec.AutonomyLevel == sitev1alpha2.AutonomyLevelL5 {
-	//			existUnitCluster += 1
-	//		}
-	//	}
-	//}
-
-	uclusterServiceCIDR, uclusterDNSIP := caculateKinsServiceCIDRAndCoreDNSIP(nu, existUnitCluster)
-
+func (kc *KinsController) createServer(nu *sitev1alpha2.NodeUnit, allocation *Allocation) error {
+	image, err := kc.k3sImage(nu)
+	if err != nil {
+		return err
+	}
 	serverOption := map[string]interface{}{
 		"KinsResourceLabelKey": KinsResourceLabelKey,
 		"KinsServerName":       buildKinsServerStatefulSetName(nu.Name),
@@ -312,11 +313,11 @@ func (kc *KinsController) createServer(nu *sitev1alpha2.NodeUnit) error {
 		"KinsRoleLabelAgent":   KinsRoleLabelAgent,
 		"UnitName":             nu.Name,
 		"NodeUnitSuperedge":    constant.NodeUnitSuperedge,
-		"K3SServerImage":       getK3SImage(nu),
+		"K3SServerImage":       image,
 		"KinsSecretName":       buildKinsSecretName(nu.Name),
-		"ServiceCIDR":          uclusterServiceCIDR,
-		"KinsNodePortRange":    caculateKinsNodePortRange(nu, int(existUnitCluster)),
-		"KinsCorednsIP":        uclusterDNSIP,
+		"ServiceCIDR":          allocation.ServiceCIDR,
+		"KinsNodePortRange":    allocation.NodePortRange,
+		"KinsCorednsIP":        allocation.CoreDNSIP,
 	}
 	if err := kubectl.CreateResourceWithFile(kc.kubeClient, manifest.KinsServerTemplate, serverOption); err != nil {
 		klog.ErrorS(err, "create kins server error")
@@ -348,7 +349,7 @@ func (kc *KinsController) createServer(nu *sitev1alpha2.NodeUnit) error {
 	return nil
 }
 
-func (kc *KinsController) creatSecret(nu *sitev1alpha2.NodeUnit) error {
+func (kc *KinsController) creatSecret(nu *sitev1alpha2.NodeUnit, allocation *Allocation) error {
 	knowToken := generateKinsSecretKnownToken()
 	knowTokenBase64 := base64.URLEncoding.EncodeToString([]byte(knowToken))
 	// get or create secret
@@ -392,13 +393,17 @@ func (kc *KinsController) creatSecret(nu *sitev1alpha2.NodeUnit) error {
 	// get or create configmap
 	if _, err := kc.kubeClient.CoreV1().ConfigMaps(DefaultKinsNamespace).Get(context.TODO(), buildKinsConfigMapName(nu.Name), metav1.GetOptions{}); err != nil {
 		if errors.IsNotFound(err) {
+			kubernetesIP, err := allocation.KubernetesServiceIP()
+			if err != nil {
+				return err
+			}
 			configmapOption := map[string]interface{}{
 				"KinsResourceLabelKey": KinsResourceLabelKey,
 				"KinsConfigMapName":    buildKinsConfigMapName(nu.Name),
 				"UnitName":             nu.Name,
 				"NodeUnitSuperedge":    constant.NodeUnitSuperedge,
 				"KinsNamespace":        DefaultKinsNamespace,
-				"KinsServiceClusterIP": fmt.Sprintf(DefaultKinsServiceCIDR, 0, "1"),
+				"KinsServiceClusterIP": kubernetesIP,
 				"KnowToken":            strings.Split(knowToken, ",")[0],
 			}
 			if err := kubectl.CreateResourceWithFile(kc.kubeClient, manifest.KinsConfigMapTemplate, configmapOption); err != nil {
@@ -433,6 +438,10 @@ func (kc *KinsController) createCRIW(nu *sitev1alpha2.NodeUnit) error {
 }
 
 func (kc *KinsController) createAgent(nu *sitev1alpha2.NodeUnit) error {
+	image, err := kc.k3sImage(nu)
+	if err != nil {
+		return err
+	}
 	// create kins agent
 	agentOption := map[string]interface{}{
 		"KinsResourceLabelKey": KinsResourceLabelKey,
@@ -443,7 +452,7 @@ func (kc *KinsController) createAgent(nu *sitev1alpha2.NodeUnit) error {
 		"KinsRoleLabelServer":  KinsRoleLabelServer,
 		"UnitName":             nu.Name,
 		"NodeUnitSuperedge":    constant.NodeUnitSuperedge,
-		"K3SAgentImage":        getK3SImage(nu),
+		"K3SAgentImage":        image,
 		"KinsSecretName":       buildKinsSecretName(nu.Name),
 		"KinsServerEndpoint":   buildKinsServiceName(nu.Name),
 	}
@@ -577,6 +586,12 @@ func (kc *KinsController) recoverNodeUnit(nu *sitev1alpha2.NodeUnit) error {
 		}
 	}
 
+	// release service cidr, coredns ip and nodeport range
+	if err := kc.allocator.Release(nu.Name); err != nil {
+		klog.V(4).ErrorS(err, "Release unit cluster network error", "node unit", nu.Name)
+		return err
+	}
+
 	// recover node unit setnode
 	var newTaints []corev1.Taint
 	for _, t := range nu.Spec.SetNode.Taints {
@@ -598,28 +613,6 @@ func (kc *KinsController) recoverNodeUnit(nu *sitev1alpha2.NodeUnit) error {
 	return nil
 }
 
-func (kc *KinsController) UpdateUnitClusterStatus(nu *sitev1alpha2.NodeUnit) (*sitev1alpha2.UnitClusterStatus, error) {
-	if nu.Spec.AutonomyLevel == sitev1alpha2.AutonomyLevelL3 {
-		return &nu.Status.UnitCluster, nil
-	}
-	newStatus := nu.Status.UnitCluster.DeepCopy()
-	// kclient, err := BuildUnitClusterClientSet(kc.kubeClient, nu)
-	// if err != nil {
-	// 	return nil, err
-	// }
-	// get version
-	// version, err := kclient.Discovery().ServerVersion()
-	// if err != nil {
-	// 	newStatus.Phase = sitev1alpha2.ClusterFailed
-	// 	klog.ErrorS(err, "get unit cluster version failed")
-	// } else {
-	// 	newStatus.Version = strings.TrimPrefix(version.String(), "v")
-	// 	newStatus.Phase = sitev1alpha2.ClusterRunning
-	// }
-
-	return newStatus, nil
-}
-
 func buildKinsCRIDaemonSetName(nuName string) string {
 	return fmt.Sprintf("%s-cri-%s", nuName, KinsResourceNameSuffix)
 }
@@ -648,41 +641,6 @@ func buildKinsServerEndpoint(ip string, port int) string {
 	return fmt.Sprintf("%s://%s:%d", "https", ip, port)
 }
 
-func caculateKinsServiceCIDRAndCoreDNSIP(nu *sitev1alpha2.NodeUnit, existUnitCluster int32) (string, string) {
-	defaultSvcCidr, defaultCorednsIP := fmt.Sprintf(DefaultKinsServiceCIDR, existUnitCluster, "0/16"), fmt.Sprintf(DefaultKinsServiceCIDR, existUnitCluster, "255")
-
-	if nu.Spec.UnitClusterInfo != nil &&
-		nu.Spec.UnitClusterInfo.Parameters != nil &&
-		nu.Spec.UnitClusterInfo.Parameters[ParameterServiceCIDRKey] != "" {
-		// TODO validate service cidr
-		svcCidrStr := nu.Spec.UnitClusterInfo.Parameters[ParameterServiceCIDRKey]
-		_, svcCidr, err := net.ParseCIDR(svcCidrStr)
-		if err != nil {
-			klog.ErrorS(err, "invalid service cidr", "service cidr string", svcCidrStr)
-			return defaultSvcCidr, defaultCorednsIP
-		}
-		return svcCidrStr, getLastCIDRIPByIndex(svcCidr)
-	}
-
-	return defaultSvcCidr, defaultCorednsIP
-}
-
-// every unitcluster has 1000 nodeport,from 40000
-func caculateKinsNodePortRange(nu *sitev1alpha2.NodeUnit, existUnitCluster int) string {
-	if nu.Spec.UnitClusterInfo != nil &&
-		nu.Spec.UnitClusterInfo.Parameters != nil &&
-		nu.Spec.UnitClusterInfo.Parameters[ParameterNodePortRangeKey] != "" {
-		// TODO validate node port range
-		return nu.Spec.UnitClusterInfo.Parameters[ParameterNodePortRangeKey]
-	}
-	var start, end int
-
-	start = DefaultKinsNodePortRangeStart + existUnitCluster*1000
-	end = start + 1000
-
-	return fmt.Sprintf("%d-%d", start, end)
-}
-
 func generateKinsSecretK3SToken(nuName string) string {
 	hasher := sha1.New()
 	hasher.Write([]byte(nuName))
@@ -694,18 +652,6 @@ func generateKinsSecretKnownToken() string {
 	return fmt.Sprintf("%s,admin,admin,system:masters", rand.String(32))
 }
 
-func getLastCIDRIPByIndex(ipnet *net.IPNet) string {
-	// convert IPNet struct mask and address to uint32
-	mask := binary.BigEndian.Uint32(ipnet.Mask)
-	start := binary.BigEndian.Uint32(ipnet.IP)
-
-	// find the final address
-	lastIP := (start & mask) | (mask ^ 0xffffffff)
-	ip := make(net.IP, 4)
-	binary.BigEndian.PutUint32(ip, lastIP)
-	return ip.String()
-}
-
 func getK3SImage(nu *sitev1alpha2.NodeUnit) string {
 	if nu.Spec.UnitClusterInfo != nil &&
 		nu.Spec.UnitClusterInfo.Parameters != nil &&
@@ -740,6 +686,10 @@ func BuildUnitClusterClientSet(k8sClientSet clientset.Interface, nu *sitev1alpha
 				klog.ErrorS(err, "Failed to get restConfig", "nodeunit", nu.Name)
 				return nil, err
 			}
+			if unitRestConfig.Timeout == 0 {
+				// an unreachable unit cluster must not block the workers
+				unitRestConfig.Timeout = DefaultUnitClusterTimeout
+			}
 			unitKubeClient, err := kubernetes.NewForConfig(unitRestConfig)
 			if err != nil {
 				klog.ErrorS(err, "Failed to build unit cluster kube client", "nodeunit", nu.Name)
@@ -13,6 +13,8 @@ spec:
   selector:
     matchLabels:
       site.superedge.io/kins-role: agent
+  updateStrategy:
+    type: OnDelete
   template:
     metadata:
       labels:
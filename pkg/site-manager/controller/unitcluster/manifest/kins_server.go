@@ -30,6 +30,8 @@ metadata:
 spec:
   replicas: 1
   serviceName: {{ .KinsServerName }}-init
+  updateStrategy:
+    type: OnDelete
   selector:
     matchLabels:
       site.superedge.io/nodeunit: {{ .UnitName }}
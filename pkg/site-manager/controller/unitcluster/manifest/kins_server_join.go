@@ -13,6 +13,8 @@ spec:
   podManagementPolicy: Parallel
   replicas: 2
   serviceName: {{ .KinsServerName }}-join
+  updateStrategy:
+    type: OnDelete
   selector:
     matchLabels:
       site.superedge.io/nodeunit: {{ .UnitName }}
@@ -0,0 +1,353 @@
+package unitcluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	sitev1alpha2 "github.com/superedge/superedge/pkg/site-manager/apis/site.superedge.io/v1alpha2"
+	"github.com/superedge/superedge/pkg/site-manager/utils"
+)
+
+// kinsServerPort is the port of the apiserver of the kins servers
+const kinsServerPort = 6443
+
+// UpdateUnitClusterStatus observes the kins components in the host cluster and the unit cluster itself, the phase
+// of the unit cluster follows the observations and the service cidr is the allocated one. The status is empty for the
+// L3 node units, which have no unit cluster.
+func (kc *KinsController) UpdateUnitClusterStatus(nu *sitev1alpha2.NodeUnit) (*sitev1alpha2.UnitClusterStatus, error) {
+	if nu.Spec.AutonomyLevel == sitev1alpha2.AutonomyLevelL3 {
+		kc.observations.forget(nu.Name)
+		return &sitev1alpha2.UnitClusterStatus{}, nil
+	}
+	newStatus, err := kc.unitClusterStatus(nu, func() (clientset.Interface, error) {
+		return BuildUnitClusterClientSet(kc.kubeClient, nu)
+	})
+	if err != nil {
+		return nil, err
+	}
+	allocation, err := kc.allocator.Get(nu.Name)
+	if err != nil {
+		return nil, err
+	}
+	if allocation != nil {
+		newStatus.ServiceCIDR = allocation.ServiceCIDR
+	}
+	return newStatus, nil
+}
+
+// unitClusterStatus builds the status of the unit cluster of nu, connect returns the client of the unit cluster or
+// why it can't be reached
+func (kc *KinsController) unitClusterStatus(nu *sitev1alpha2.NodeUnit, connect func() (clientset.Interface, error)) (*sitev1alpha2.UnitClusterStatus, error) {
+	newStatus := nu.Status.UnitCluster.DeepCopy()
+	now := metav1.Now()
+
+	// 1. the kins components in the host cluster
+	serverReady, serverDesired, err := kc.serverReplicas(nu)
+	if err != nil {
+		return nil, err
+	}
+	newStatus.Conditions = utils.SetCondition(newStatus.Conditions,
+		componentCondition(UnitClusterConditionServerReady, "servers", serverReady, serverDesired, serverDesired > 0, now))
+	for _, component := range []struct {
+		conditionType, name, dsName string
+	}{
+		{UnitClusterConditionAgentReady, "agents", buildKinsAgentStatefulSetName(nu.Name)},
+		{UnitClusterConditionCRIReady, "cri wrappers", buildKinsCRIDaemonSetName(nu.Name)},
+	} {
+		ds, err := kc.dsLister.DaemonSets(DefaultKinsNamespace).Get(component.dsName)
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+		var ready, desired int32
+		if ds != nil {
+			ready, desired = ds.Status.NumberReady, ds.Status.DesiredNumberScheduled
+		}
+		newStatus.Conditions = utils.SetCondition(newStatus.Conditions,
+			componentCondition(component.conditionType, component.name, ready, desired, ds != nil, now))
+	}
+	if newStatus.Addresses, err = kc.unitClusterAddresses(nu); err != nil {
+		return nil, err
+	}
+
+	// 2. the unit cluster through its credential, observed at most every DefaultUnitClusterObserveInterval
+	clientErr := kc.observations.observe(nu.Name, newStatus, connect)
+	apiserverCondition := sitev1alpha2.ClusterCondition{
+		Type:               UnitClusterConditionAPIServerReady,
+		Status:             sitev1alpha2.ConditionTrue,
+		LastProbeTime:      now,
+		LastTransitionTime: now,
+		Reason:             "Reachable",
+		Message:            fmt.Sprintf("unit cluster %s is reachable", newStatus.Version),
+	}
+	if clientErr != nil {
+		klog.V(4).InfoS("Unit cluster is unreachable", "node unit", nu.Name, "error", clientErr)
+		apiserverCondition.Status = sitev1alpha2.ConditionFalse
+		apiserverCondition.Reason = "Unreachable"
+		apiserverCondition.Message = clientErr.Error()
+	}
+	newStatus.Conditions = utils.SetCondition(newStatus.Conditions, apiserverCondition)
+	newStatus.Phase = unitClusterPhase(nu.Status.UnitCluster.Phase, clientErr == nil)
+	newStatus.ClusterResource = keepEqualResource(nu.Status.UnitCluster.ClusterResource, newStatus.ClusterResource)
+
+	return newStatus, nil
+}
+
+// serverReplicas returns the ready and the desired replicas of the kins servers, the L5 node units join two more
+// servers to the first one
+func (kc *KinsController) serverReplicas(nu *sitev1alpha2.NodeUnit) (ready, desired int32, err error) {
+	names := []string{buildKinsServerStatefulSetName(nu.Name)}
+	if nu.Spec.AutonomyLevel == sitev1alpha2.AutonomyLevelL5 {
+		names = append(names, buildKinsServerStatefulSetName(nu.Name)+"-join")
+	}
+	for _, name := range names {
+		sts, err := kc.stsLister.StatefulSets(DefaultKinsNamespace).Get(name)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		ready += sts.Status.ReadyReplicas
+		desired += statefulSetReplicas(sts)
+	}
+	return ready, desired, nil
+}
+
+func statefulSetReplicas(sts *appsv1.StatefulSet) int32 {
+	if sts.Spec.Replicas == nil {
+		return 1
+	}
+	return *sts.Spec.Replicas
+}
+
+func componentCondition(conditionType, name string, ready, desired int32, found bool, now metav1.Time) sitev1alpha2.ClusterCondition {
+	condition := sitev1alpha2.ClusterCondition{
+		Type:               conditionType,
+		Status:             sitev1alpha2.ConditionFalse,
+		LastProbeTime:      now,
+		LastTransitionTime: now,
+		Reason:             "NotReady",
+		Message:            fmt.Sprintf("%d/%d %s ready", ready, desired, name),
+	}
+	switch {
+	case !found:
+		condition.Reason = "NotFound"
+		condition.Message = fmt.Sprintf("the %s are not created", name)
+	case ready >= desired:
+		condition.Status = sitev1alpha2.ConditionTrue
+		condition.Reason = "Ready"
+	}
+	return condition
+}
+
+// unitClusterAddresses returns the address of the kins service, accessed from the nodes, and the addresses of the
+// ready kins servers
+func (kc *KinsController) unitClusterAddresses(nu *sitev1alpha2.NodeUnit) ([]sitev1alpha2.ClusterAddress, error) {
+	var addresses []sitev1alpha2.ClusterAddress
+	svc, err := kc.kubeClient.CoreV1().Services(DefaultKinsNamespace).Get(context.TODO(), buildKinsServiceName(nu.Name), metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if err == nil && svc.Spec.ClusterIP != "" && svc.Spec.ClusterIP != corev1.ClusterIPNone {
+		for _, port := range svc.Spec.Ports {
+			addresses = append(addresses, sitev1alpha2.ClusterAddress{Type: sitev1alpha2.AddressAdvertise, Host: svc.Spec.ClusterIP, Port: port.Port})
+		}
+	}
+
+	serverSelector := labels.SelectorFromSet(labels.Set{
+		"site.superedge.io/nodeunit": nu.Name,
+		KinsRoleLabelKey:             KinsRoleLabelServer,
+	})
+	pods, err := kc.kubeClient.CoreV1().Pods(DefaultKinsNamespace).List(context.TODO(), metav1.ListOptions{LabelSelector: serverSelector.String()})
+	if err != nil {
+		return nil, err
+	}
+	var servers []string
+	for i := range pods.Items {
+		if pod := &pods.Items[i]; pod.Status.PodIP != "" && podReady(pod) {
+			servers = append(servers, pod.Status.PodIP)
+		}
+	}
+	sort.Strings(servers)
+	for _, server := range servers {
+		addresses = append(addresses, sitev1alpha2.ClusterAddress{Type: sitev1alpha2.AddressReal, Host: server, Port: kinsServerPort})
+	}
+	return addresses, nil
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// unitObservation is the last observation of a unit cluster
+type unitObservation struct {
+	time            time.Time
+	version         string
+	clusterResource sitev1alpha2.ClusterResource
+	err             error
+}
+
+// unitObservations throttles the requests to the unit clusters: every reconcile of a node unit observes its unit
+// cluster, and the unreachable ones would stall the workers for DefaultUnitClusterTimeout each time
+type unitObservations struct {
+	sync.Mutex
+	last map[string]unitObservation
+}
+
+func newUnitObservations() *unitObservations {
+	return &unitObservations{last: make(map[string]unitObservation)}
+}
+
+// observe observes the unit cluster of unit into status, or sets the last observation when it is more recent than
+// DefaultUnitClusterObserveInterval, and returns why the unit cluster can't be reached
+func (o *unitObservations) observe(unit string, status *sitev1alpha2.UnitClusterStatus, connect func() (clientset.Interface, error)) error {
+	o.Lock()
+	last, ok := o.last[unit]
+	o.Unlock()
+	if ok && time.Since(last.time) < DefaultUnitClusterObserveInterval {
+		if last.err == nil {
+			status.Version = last.version
+			status.ClusterResource = *last.clusterResource.DeepCopy()
+		}
+		return last.err
+	}
+
+	unitClient, err := connect()
+	if err == nil {
+		err = observeUnitCluster(context.TODO(), unitClient, status)
+	}
+	o.Lock()
+	defer o.Unlock()
+	o.last[unit] = unitObservation{
+		time:            time.Now(),
+		version:         status.Version,
+		clusterResource: *status.ClusterResource.DeepCopy(),
+		err:             err,
+	}
+	return err
+}
+
+func (o *unitObservations) forget(unit string) {
+	o.Lock()
+	defer o.Unlock()
+	delete(o.last, unit)
+}
+
+// observeUnitCluster gets the version of the unit cluster, and sums the resources of its nodes and the requests of
+// its pods
+func observeUnitCluster(ctx context.Context, unitClient clientset.Interface, status *sitev1alpha2.UnitClusterStatus) error {
+	version, err := unitClient.Discovery().ServerVersion()
+	if err != nil {
+		return err
+	}
+	status.Version = strings.TrimPrefix(version.String(), "v")
+
+	nodes, err := unitClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	pods, err := unitClient.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: "status.phase!=" + string(corev1.PodSucceeded) + ",status.phase!=" + string(corev1.PodFailed),
+	})
+	if err != nil {
+		return err
+	}
+
+	clusterResource := sitev1alpha2.ClusterResource{
+		Capacity:    sitev1alpha2.ResourceList{},
+		Allocatable: sitev1alpha2.ResourceList{},
+		Allocated:   sitev1alpha2.ResourceList{},
+	}
+	for _, node := range nodes.Items {
+		addResourceList(clusterResource.Capacity, node.Status.Capacity)
+		addResourceList(clusterResource.Allocatable, node.Status.Allocatable)
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Spec.NodeName == "" || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		addResourceList(clusterResource.Allocated, podRequests(pod))
+	}
+	status.ClusterResource = clusterResource
+	return nil
+}
+
+// podRequests returns the requests of the containers of the pod, or of its largest init container, with its overhead
+func podRequests(pod *corev1.Pod) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	for _, container := range pod.Spec.Containers {
+		for name, quantity := range container.Resources.Requests {
+			q := requests[name]
+			q.Add(quantity)
+			requests[name] = q
+		}
+	}
+	for _, container := range pod.Spec.InitContainers {
+		for name, quantity := range container.Resources.Requests {
+			if q, ok := requests[name]; !ok || quantity.Cmp(q) > 0 {
+				requests[name] = quantity.DeepCopy()
+			}
+		}
+	}
+	for name, quantity := range pod.Spec.Overhead {
+		q := requests[name]
+		q.Add(quantity)
+		requests[name] = q
+	}
+	return requests
+}
+
+func addResourceList(list sitev1alpha2.ResourceList, add corev1.ResourceList) {
+	for name, quantity := range add {
+		q := list[string(name)]
+		q.Add(quantity)
+		list[string(name)] = q
+	}
+}
+
+// keepEqualResource keeps the quantities of old equal to the new ones, so the status is not updated when only the
+// format of the quantities differs
+func keepEqualResource(old, new sitev1alpha2.ClusterResource) sitev1alpha2.ClusterResource {
+	keep := func(old, new sitev1alpha2.ResourceList) {
+		for name, quantity := range new {
+			if oldQuantity, ok := old[name]; ok && oldQuantity.Cmp(quantity) == 0 {
+				new[name] = oldQuantity
+			}
+		}
+	}
+	keep(old.Capacity, new.Capacity)
+	keep(old.Allocatable, new.Allocatable)
+	keep(old.Allocated, new.Allocated)
+	return new
+}
+
+// unitClusterPhase is Running while the unit cluster is reachable, the unit cluster unreachable is Initializing
+// until it is first reached, and Failed after
+func unitClusterPhase(old sitev1alpha2.ClusterPhase, reachable bool) sitev1alpha2.ClusterPhase {
+	switch {
+	case reachable:
+		return sitev1alpha2.ClusterRunning
+	case old == "" || old == sitev1alpha2.ClusterInitializing:
+		return sitev1alpha2.ClusterInitializing
+	default:
+		return sitev1alpha2.ClusterFailed
+	}
+}
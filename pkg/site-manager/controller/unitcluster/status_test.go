@@ -0,0 +1,182 @@
+package unitcluster
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	applisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+
+	sitev1alpha2 "github.com/superedge/superedge/pkg/site-manager/apis/site.superedge.io/v1alpha2"
+)
+
+func TestUnitClusterStatus(t *testing.T) {
+	nu := &sitev1alpha2.NodeUnit{
+		ObjectMeta: metav1.ObjectMeta{Name: "unit"},
+		Spec:       sitev1alpha2.NodeUnitSpec{AutonomyLevel: sitev1alpha2.AutonomyLevelL4},
+	}
+	replicas := int32(1)
+	server := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: buildKinsServerStatefulSetName(nu.Name), Namespace: DefaultKinsNamespace},
+		Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+		Status:     appsv1.StatefulSetStatus{ReadyReplicas: 1},
+	}
+	serverPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "server-0", Namespace: DefaultKinsNamespace, Labels: map[string]string{
+			"site.superedge.io/nodeunit": nu.Name,
+			KinsRoleLabelKey:             KinsRoleLabelServer,
+		}},
+		Status: corev1.PodStatus{PodIP: "192.168.0.2", Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}},
+	}
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: buildKinsServiceName(nu.Name), Namespace: DefaultKinsNamespace},
+		Spec:       corev1.ServiceSpec{ClusterIP: "10.96.0.100", Ports: []corev1.ServicePort{{Port: 443}}},
+	}
+	dsIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, ds := range []*appsv1.DaemonSet{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: buildKinsAgentStatefulSetName(nu.Name), Namespace: DefaultKinsNamespace},
+			Status:     appsv1.DaemonSetStatus{DesiredNumberScheduled: 2, NumberReady: 1},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: buildKinsCRIDaemonSetName(nu.Name), Namespace: DefaultKinsNamespace},
+			Status:     appsv1.DaemonSetStatus{DesiredNumberScheduled: 3, NumberReady: 3},
+		},
+	} {
+		if err := dsIndexer.Add(ds); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stsIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	if err := stsIndexer.Add(server); err != nil {
+		t.Fatal(err)
+	}
+	kc := &KinsController{
+		kubeClient:   fake.NewSimpleClientset(serverPod, service),
+		dsLister:     applisters.NewDaemonSetLister(dsIndexer),
+		stsLister:    applisters.NewStatefulSetLister(stsIndexer),
+		observations: newUnitObservations(),
+	}
+
+	newNode := func(name string) *corev1.Node {
+		resources := corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2"), corev1.ResourceMemory: resource.MustParse("4Gi")}
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}, Status: corev1.NodeStatus{Capacity: resources, Allocatable: resources}}
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: metav1.NamespaceDefault},
+		Spec: corev1.PodSpec{
+			NodeName: "node1",
+			Containers: []corev1.Container{
+				{Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")}}},
+				{Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("200m")}}},
+			},
+			InitContainers: []corev1.Container{
+				{Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")}}},
+			},
+		},
+	}
+	unitClient := fake.NewSimpleClientset(newNode("node1"), newNode("node2"), pod)
+	unitClient.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.22.6+k3s1"}
+
+	connected := func() (clientset.Interface, error) {
+		return unitClient, nil
+	}
+	status, err := kc.unitClusterStatus(nu, connected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != "1.22.6+k3s1" || status.Phase != sitev1alpha2.ClusterRunning {
+		t.Errorf("unexpected version %s and phase %s", status.Version, status.Phase)
+	}
+	conditions := make(map[string]sitev1alpha2.ConditionStatus)
+	for _, condition := range status.Conditions {
+		conditions[condition.Type] = condition.Status
+	}
+	expectedConditions := map[string]sitev1alpha2.ConditionStatus{
+		UnitClusterConditionServerReady:    sitev1alpha2.ConditionTrue,
+		UnitClusterConditionAgentReady:     sitev1alpha2.ConditionFalse,
+		UnitClusterConditionCRIReady:       sitev1alpha2.ConditionTrue,
+		UnitClusterConditionAPIServerReady: sitev1alpha2.ConditionTrue,
+	}
+	if !reflect.DeepEqual(conditions, expectedConditions) {
+		t.Errorf("expected conditions %v, got %v", expectedConditions, conditions)
+	}
+	expectedAddresses := []sitev1alpha2.ClusterAddress{
+		{Type: sitev1alpha2.AddressAdvertise, Host: "10.96.0.100", Port: 443},
+		{Type: sitev1alpha2.AddressReal, Host: "192.168.0.2", Port: kinsServerPort},
+	}
+	if !reflect.DeepEqual(status.Addresses, expectedAddresses) {
+		t.Errorf("expected addresses %+v, got %+v", expectedAddresses, status.Addresses)
+	}
+	for _, tc := range []struct {
+		list     sitev1alpha2.ResourceList
+		name     corev1.ResourceName
+		expected string
+	}{
+		{status.ClusterResource.Capacity, corev1.ResourceCPU, "4"},
+		{status.ClusterResource.Allocatable, corev1.ResourceMemory, "8Gi"},
+		{status.ClusterResource.Allocated, corev1.ResourceCPU, "300m"},
+		{status.ClusterResource.Allocated, corev1.ResourceMemory, "1Gi"},
+	} {
+		if q := tc.list[string(tc.name)]; q.Cmp(resource.MustParse(tc.expected)) != 0 {
+			t.Errorf("expected %s %s, got %s", tc.name, tc.expected, q.String())
+		}
+	}
+
+	// the unit cluster becomes unreachable, the last observation is kept for DefaultUnitClusterObserveInterval
+	nu.Status.UnitCluster = *status
+	refused := func() (clientset.Interface, error) {
+		return nil, fmt.Errorf("connection refused")
+	}
+	if status, err = kc.unitClusterStatus(nu, func() (clientset.Interface, error) {
+		t.Error("the unit cluster is observed again before DefaultUnitClusterObserveInterval")
+		return refused()
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if status.Phase != sitev1alpha2.ClusterRunning || !reflect.DeepEqual(status.ClusterResource, nu.Status.UnitCluster.ClusterResource) {
+		t.Errorf("unexpected phase %s and resources %+v", status.Phase, status.ClusterResource)
+	}
+	last := kc.observations.last[nu.Name]
+	last.time = last.time.Add(-DefaultUnitClusterObserveInterval)
+	kc.observations.last[nu.Name] = last
+	status, err = kc.unitClusterStatus(nu, refused)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Phase != sitev1alpha2.ClusterFailed || status.Version != "1.22.6+k3s1" {
+		t.Errorf("unexpected phase %s and version %s", status.Phase, status.Version)
+	}
+	for _, condition := range status.Conditions {
+		if condition.Type == UnitClusterConditionAPIServerReady && condition.Status != sitev1alpha2.ConditionFalse {
+			t.Errorf("unexpected condition %+v", condition)
+		}
+	}
+}
+
+func TestUnitClusterPhase(t *testing.T) {
+	for _, tc := range []struct {
+		old       sitev1alpha2.ClusterPhase
+		reachable bool
+		expected  sitev1alpha2.ClusterPhase
+	}{
+		{"", false, sitev1alpha2.ClusterInitializing},
+		{sitev1alpha2.ClusterInitializing, false, sitev1alpha2.ClusterInitializing},
+		{sitev1alpha2.ClusterInitializing, true, sitev1alpha2.ClusterRunning},
+		{sitev1alpha2.ClusterRunning, false, sitev1alpha2.ClusterFailed},
+		{sitev1alpha2.ClusterFailed, true, sitev1alpha2.ClusterRunning},
+	} {
+		if phase := unitClusterPhase(tc.old, tc.reachable); phase != tc.expected {
+			t.Errorf("%s reachable %t: expected %s, got %s", tc.old, tc.reachable, tc.expected, phase)
+		}
+	}
+}
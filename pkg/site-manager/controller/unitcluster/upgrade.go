@@ -0,0 +1,414 @@
+package unitcluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/klog/v2"
+
+	sitev1alpha2 "github.com/superedge/superedge/pkg/site-manager/apis/site.superedge.io/v1alpha2"
+)
+
+// kinsPod is a kins server or agent pod replaced by the upgrade, pod is nil while it is recreated
+type kinsPod struct {
+	name      string
+	container string
+	pod       *corev1.Pod
+}
+
+// UpgradeUnitCluster upgrades the unit cluster of nu to the k3s image of its parameters, one step per call. The
+// upgrade checks the unit cluster is healthy, replaces the kins servers one by one, then the kins agents, and waits
+// for the unit cluster to be healthy again before each replacement. A pod not ready after DefaultUpgradeStepTimeout
+// rolls the unit cluster back to its image. status is the new status of the unit cluster, its progress and phase are
+// updated, and true is returned while the node unit should be reconciled again to go on.
+func (kc *KinsController) UpgradeUnitCluster(nu *sitev1alpha2.NodeUnit, status *sitev1alpha2.UnitClusterStatus) (bool, error) {
+	if nu.Spec.AutonomyLevel == sitev1alpha2.AutonomyLevelL3 {
+		return false, nil
+	}
+	target := getK3SImage(nu)
+	now := metav1.Now()
+	if status.Upgrade == nil {
+		// the image is recorded once the unit cluster runs, the unit clusters installed before keep their image
+		if status.Phase != sitev1alpha2.ClusterRunning {
+			return false, nil
+		}
+		image, err := kc.serverImage(nu)
+		if err != nil {
+			return false, err
+		}
+		if image == "" {
+			image = target
+		}
+		status.Upgrade = &sitev1alpha2.UnitClusterUpgrade{Image: image}
+	}
+	upgrade := status.Upgrade
+	if strings.HasPrefix(upgrade.Message, upgradePaused) {
+		// the step waits for DefaultUpgradeStepTimeout again once the pause is over
+		upgrade.Message = ""
+		upgrade.LastTransitionTime = now
+	}
+	requeue, err := kc.upgradeStep(nu, status, upgrade, target, now)
+	switch upgrade.Phase {
+	case sitev1alpha2.UpgradeServers, sitev1alpha2.UpgradeAgents, sitev1alpha2.UpgradeRollingBack:
+		status.Phase = sitev1alpha2.ClusterUpgrading
+	}
+	return requeue, err
+}
+
+// upgradePaused prefixes the message of an upgrade held by PauseUpgrade
+const upgradePaused = "paused: "
+
+// PauseUpgrade holds the upgrade in progress of the unit cluster of a node unit partitioned from the cloud, its pods
+// can be neither replaced nor checked then. The upgrade goes on with the next call of UpgradeUnitCluster, and the
+// time it was held does not count towards DefaultUpgradeStepTimeout, so it is not rolled back for the partition.
+func PauseUpgrade(status *sitev1alpha2.UnitClusterStatus, reason string) {
+	upgrade := status.Upgrade
+	if upgrade == nil {
+		return
+	}
+	switch upgrade.Phase {
+	case sitev1alpha2.UpgradePreflight, sitev1alpha2.UpgradeServers, sitev1alpha2.UpgradeAgents, sitev1alpha2.UpgradeRollingBack:
+		upgrade.Message = upgradePaused + reason
+		if upgrade.Phase != sitev1alpha2.UpgradePreflight {
+			status.Phase = sitev1alpha2.ClusterUpgrading
+		}
+	}
+}
+
+func (kc *KinsController) upgradeStep(nu *sitev1alpha2.NodeUnit, status *sitev1alpha2.UnitClusterStatus,
+	upgrade *sitev1alpha2.UnitClusterUpgrade, target string, now metav1.Time) (bool, error) {
+	switch upgrade.Phase {
+	case "", sitev1alpha2.UpgradeSucceeded, sitev1alpha2.UpgradeRolledBack, sitev1alpha2.UpgradeFailed:
+		if target == upgrade.Image || (target == upgrade.TargetImage && upgrade.Phase != sitev1alpha2.UpgradeSucceeded) {
+			// nothing to upgrade, or the upgrade to target failed and waits for another target
+			return false, nil
+		}
+		klog.InfoS("Start upgrade of unit cluster", "node unit", nu.Name, "image", upgrade.Image, "target image", target)
+		upgrade.FailureReason = ""
+		setUpgradePhase(upgrade, sitev1alpha2.UpgradePreflight, fmt.Sprintf("upgrading from %s to %s", upgrade.Image, target), now)
+		fallthrough
+	case sitev1alpha2.UpgradePreflight:
+		if target == upgrade.Image {
+			// canceled before any pod is replaced
+			upgrade.TargetImage = ""
+			setUpgradePhase(upgrade, "", "", now)
+			return false, nil
+		}
+		// the target is followed until the upgrade starts
+		upgrade.TargetImage = target
+		if err := preflight(status, upgrade.Image, target); err != nil {
+			upgrade.Message = fmt.Sprintf("preflight: %v", err)
+			return true, nil
+		}
+		// the pods are replaced from the next step, once the manifests are rendered with the target image
+		setUpgradePhase(upgrade, sitev1alpha2.UpgradeServers, "", now)
+		return true, nil
+	case sitev1alpha2.UpgradeServers, sitev1alpha2.UpgradeAgents:
+		if target == upgrade.Image {
+			startRollback(nu, upgrade, "the upgrade is canceled", now)
+			return true, nil
+		}
+		done, err := kc.rollForward(nu, status, upgrade, now)
+		if err != nil {
+			startRollback(nu, upgrade, err.Error(), now)
+			return true, nil
+		}
+		if !done {
+			return true, nil
+		}
+		if upgrade.Phase == sitev1alpha2.UpgradeServers {
+			setUpgradePhase(upgrade, sitev1alpha2.UpgradeAgents, "", now)
+			return true, nil
+		}
+		klog.InfoS("Unit cluster upgraded", "node unit", nu.Name, "image", upgrade.TargetImage)
+		upgrade.Image = upgrade.TargetImage
+		setUpgradePhase(upgrade, sitev1alpha2.UpgradeSucceeded, fmt.Sprintf("upgraded to %s", upgrade.Image), now)
+		return false, nil
+	case sitev1alpha2.UpgradeRollingBack:
+		done, err := kc.rollBack(nu, status, upgrade, now)
+		if err != nil {
+			klog.ErrorS(err, "Unit cluster rollback failed", "node unit", nu.Name, "image", upgrade.Image)
+			setUpgradePhase(upgrade, sitev1alpha2.UpgradeFailed, fmt.Sprintf("rollback to %s failed: %v", upgrade.Image, err), now)
+			return false, nil
+		}
+		if !done {
+			return true, nil
+		}
+		klog.InfoS("Unit cluster rolled back", "node unit", nu.Name, "image", upgrade.Image)
+		setUpgradePhase(upgrade, sitev1alpha2.UpgradeRolledBack, fmt.Sprintf("rolled back to %s", upgrade.Image), now)
+		return false, nil
+	}
+	return false, fmt.Errorf("unknown upgrade phase %s", upgrade.Phase)
+}
+
+// rollForward replaces the pods of the current phase with the ones of the target image, gated by the health of the
+// unit cluster
+func (kc *KinsController) rollForward(nu *sitev1alpha2.NodeUnit, status *sitev1alpha2.UnitClusterStatus,
+	upgrade *sitev1alpha2.UnitClusterUpgrade, now metav1.Time) (bool, error) {
+	var pods []kinsPod
+	var err error
+	gates := []string{UnitClusterConditionServerReady, UnitClusterConditionAPIServerReady}
+	if upgrade.Phase == sitev1alpha2.UpgradeServers {
+		pods, err = kc.serverPods(nu)
+	} else {
+		pods, err = kc.agentPods(nu)
+		gates = append(gates, UnitClusterConditionAgentReady)
+	}
+	if err != nil {
+		return false, err
+	}
+	return kc.rollPods(upgrade, pods, upgrade.TargetImage, true, func() error {
+		return conditionsTrue(status, gates...)
+	}, now)
+}
+
+// rollBack replaces the upgraded agents then the upgraded servers in the reverse order with the ones of the image
+// of the unit cluster. The pods are not gated by the health of the unit cluster, which the rollback is to restore,
+// until all of them are replaced.
+func (kc *KinsController) rollBack(nu *sitev1alpha2.NodeUnit, status *sitev1alpha2.UnitClusterStatus,
+	upgrade *sitev1alpha2.UnitClusterUpgrade, now metav1.Time) (bool, error) {
+	agents, err := kc.agentPods(nu)
+	if err != nil {
+		return false, err
+	}
+	servers, err := kc.serverPods(nu)
+	if err != nil {
+		return false, err
+	}
+	for i, j := 0, len(servers)-1; i < j; i, j = i+1, j-1 {
+		servers[i], servers[j] = servers[j], servers[i]
+	}
+	return kc.rollPods(upgrade, append(agents, servers...), upgrade.Image, false, func() error {
+		return conditionsTrue(status, UnitClusterConditionServerReady, UnitClusterConditionAPIServerReady, UnitClusterConditionAgentReady)
+	}, now)
+}
+
+// rollPods deletes the first pod not running image to replace it, once the pods before it run image, and are ready
+// when strict, and gate passes. It returns true when all the pods run image and gate passes, and an error when it
+// waits for more than DefaultUpgradeStepTimeout. Without strict, gate is only checked once all the pods run image.
+func (kc *KinsController) rollPods(upgrade *sitev1alpha2.UnitClusterUpgrade, pods []kinsPod, image string, strict bool,
+	gate func() error, now metav1.Time) (bool, error) {
+	upgrade.UpgradedPods = nil
+	for _, p := range pods {
+		if p.pod == nil || p.pod.DeletionTimestamp != nil {
+			return waitUpgrade(upgrade, fmt.Sprintf("waiting for %s to be recreated", p.name), now)
+		}
+		if podImage(p.pod, p.container) == image {
+			upgrade.UpgradedPods = append(upgrade.UpgradedPods, p.name)
+			if strict && !podReady(p.pod) {
+				return waitUpgrade(upgrade, fmt.Sprintf("waiting for %s to be ready", p.name), now)
+			}
+			continue
+		}
+		if strict {
+			if err := gate(); err != nil {
+				return waitUpgrade(upgrade, err.Error(), now)
+			}
+		}
+		uid := p.pod.UID
+		err := kc.kubeClient.CoreV1().Pods(p.pod.Namespace).Delete(context.TODO(), p.pod.Name, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &uid},
+		})
+		if err != nil && !errors.IsNotFound(err) {
+			return false, err
+		}
+		klog.InfoS("Replace kins pod", "pod", klog.KObj(p.pod), "image", image)
+		upgrade.Message = fmt.Sprintf("replacing %s with %s", p.name, image)
+		upgrade.LastTransitionTime = now
+		return false, nil
+	}
+	if err := gate(); err != nil {
+		return waitUpgrade(upgrade, err.Error(), now)
+	}
+	return true, nil
+}
+
+// waitUpgrade records what the upgrade waits for, and fails it when it waits for more than DefaultUpgradeStepTimeout
+// since its last step
+func waitUpgrade(upgrade *sitev1alpha2.UnitClusterUpgrade, message string, now metav1.Time) (bool, error) {
+	upgrade.Message = message
+	if now.Sub(upgrade.LastTransitionTime.Time) > DefaultUpgradeStepTimeout {
+		return false, fmt.Errorf("%s for more than %s", message, DefaultUpgradeStepTimeout)
+	}
+	return false, nil
+}
+
+func setUpgradePhase(upgrade *sitev1alpha2.UnitClusterUpgrade, phase sitev1alpha2.UnitClusterUpgradePhase, message string, now metav1.Time) {
+	upgrade.Phase = phase
+	upgrade.Message = message
+	upgrade.UpgradedPods = nil
+	upgrade.LastTransitionTime = now
+}
+
+func startRollback(nu *sitev1alpha2.NodeUnit, upgrade *sitev1alpha2.UnitClusterUpgrade, reason string, now metav1.Time) {
+	klog.InfoS("Roll back upgrade of unit cluster", "node unit", nu.Name, "image", upgrade.Image,
+		"target image", upgrade.TargetImage, "reason", reason)
+	upgrade.FailureReason = reason
+	setUpgradePhase(upgrade, sitev1alpha2.UpgradeRollingBack, "", now)
+}
+
+// preflight checks the unit cluster is healthy, and the version of target is the version of image or the next minor
+// one when both can be parsed from the image tags
+func preflight(status *sitev1alpha2.UnitClusterStatus, image, target string) error {
+	if status.Phase != sitev1alpha2.ClusterRunning {
+		return fmt.Errorf("the unit cluster is %s", status.Phase)
+	}
+	if err := conditionsTrue(status, UnitClusterConditionServerReady, UnitClusterConditionAgentReady,
+		UnitClusterConditionCRIReady, UnitClusterConditionAPIServerReady); err != nil {
+		return err
+	}
+	from, fromErr := imageVersion(image)
+	to, toErr := imageVersion(target)
+	if fromErr != nil || toErr != nil {
+		return nil
+	}
+	if to.LessThan(from) {
+		return fmt.Errorf("downgrade from %s to %s is not supported", from, to)
+	}
+	if to.Major() != from.Major() || to.Minor() > from.Minor()+1 {
+		return fmt.Errorf("upgrade from %s to %s skips minor versions", from, to)
+	}
+	return nil
+}
+
+func conditionsTrue(status *sitev1alpha2.UnitClusterStatus, conditionTypes ...string) error {
+	for _, conditionType := range conditionTypes {
+		found := false
+		for _, condition := range status.Conditions {
+			if condition.Type != conditionType {
+				continue
+			}
+			found = true
+			if condition.Status != sitev1alpha2.ConditionTrue {
+				return fmt.Errorf("%s is %s: %s", conditionType, condition.Status, condition.Message)
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s is unknown", conditionType)
+		}
+	}
+	return nil
+}
+
+// imageVersion parses the version of the tag of image, like v1.22.6-revison-1
+func imageVersion(image string) (*utilversion.Version, error) {
+	image = strings.SplitN(image, "@", 2)[0]
+	name := image[strings.LastIndex(image, "/")+1:]
+	i := strings.LastIndex(name, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("image %s has no tag", image)
+	}
+	return utilversion.ParseGeneric(name[i+1:])
+}
+
+func podImage(pod *corev1.Pod, container string) string {
+	for _, c := range pod.Spec.Containers {
+		if c.Name == container {
+			return c.Image
+		}
+	}
+	return ""
+}
+
+// serverImage returns the k3s image of the kins servers, empty when they are not created
+func (kc *KinsController) serverImage(nu *sitev1alpha2.NodeUnit) (string, error) {
+	sts, err := kc.kubeClient.AppsV1().StatefulSets(DefaultKinsNamespace).Get(context.TODO(), buildKinsServerStatefulSetName(nu.Name), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, c := range sts.Spec.Template.Spec.Containers {
+		if c.Name == "server" {
+			return c.Image, nil
+		}
+	}
+	return "", nil
+}
+
+// k3sImage returns the k3s image the kins manifests are rendered with: the target image once the upgrade replaces
+// the pods, the image of the unit cluster otherwise
+func (kc *KinsController) k3sImage(nu *sitev1alpha2.NodeUnit) (string, error) {
+	upgrade := nu.Status.UnitCluster.Upgrade
+	if upgrade == nil {
+		image, err := kc.serverImage(nu)
+		if err != nil || image != "" {
+			return image, err
+		}
+		return getK3SImage(nu), nil
+	}
+	switch upgrade.Phase {
+	case sitev1alpha2.UpgradeServers, sitev1alpha2.UpgradeAgents:
+		return upgrade.TargetImage, nil
+	}
+	return upgrade.Image, nil
+}
+
+// serverPods returns the pods of the kins servers in the order of the upgrade, the first server then the joined
+// ones of the L5 node units
+func (kc *KinsController) serverPods(nu *sitev1alpha2.NodeUnit) ([]kinsPod, error) {
+	names := []string{buildKinsServerStatefulSetName(nu.Name)}
+	if nu.Spec.AutonomyLevel == sitev1alpha2.AutonomyLevelL5 {
+		names = append(names, buildKinsServerStatefulSetName(nu.Name)+"-join")
+	}
+	var pods []kinsPod
+	for _, name := range names {
+		sts, err := kc.kubeClient.AppsV1().StatefulSets(DefaultKinsNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i := int32(0); i < statefulSetReplicas(sts); i++ {
+			p := kinsPod{name: fmt.Sprintf("%s-%d", name, i), container: "server"}
+			pod, err := kc.kubeClient.CoreV1().Pods(DefaultKinsNamespace).Get(context.TODO(), p.name, metav1.GetOptions{})
+			if err != nil && !errors.IsNotFound(err) {
+				return nil, err
+			}
+			if err == nil {
+				p.pod = pod
+			}
+			pods = append(pods, p)
+		}
+	}
+	return pods, nil
+}
+
+// agentPods returns the pods of the kins agents ordered by their nodes, the agents of all the node units share the
+// labels so the pods are selected by their owner
+func (kc *KinsController) agentPods(nu *sitev1alpha2.NodeUnit) ([]kinsPod, error) {
+	ds, err := kc.dsLister.DaemonSets(DefaultKinsNamespace).Get(buildKinsAgentStatefulSetName(nu.Name))
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	selector, err := metav1.LabelSelectorAsSelector(ds.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	podList, err := kc.kubeClient.CoreV1().Pods(DefaultKinsNamespace).List(context.TODO(), metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+	var pods []kinsPod
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if owner := metav1.GetControllerOf(pod); owner != nil && owner.UID == ds.UID {
+			pods = append(pods, kinsPod{name: pod.Name, container: "agent", pod: pod})
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].pod.Spec.NodeName < pods[j].pod.Spec.NodeName
+	})
+	return pods, nil
+}
@@ -0,0 +1,267 @@
+package unitcluster
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	applisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+
+	sitev1alpha2 "github.com/superedge/superedge/pkg/site-manager/apis/site.superedge.io/v1alpha2"
+)
+
+const (
+	oldK3SImage = "ccr.ccs.tencentyun.com/tkeedge/k3s:v1.22.6-revison-1"
+	newK3SImage = "ccr.ccs.tencentyun.com/tkeedge/k3s:v1.23.4-revison-1"
+)
+
+type upgradeFixture struct {
+	t      *testing.T
+	kc     *KinsController
+	nu     *sitev1alpha2.NodeUnit
+	status *sitev1alpha2.UnitClusterStatus
+	ds     *appsv1.DaemonSet
+}
+
+func newUpgradeFixture(t *testing.T) *upgradeFixture {
+	nu := newUnit("unit", sitev1alpha2.AutonomyLevelL4, map[string]string{ParameterK3SImageKey: newK3SImage})
+	replicas := int32(1)
+	server := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: buildKinsServerStatefulSetName(nu.Name), Namespace: DefaultKinsNamespace},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "server", Image: oldK3SImage}}}},
+		},
+	}
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: buildKinsAgentStatefulSetName(nu.Name), Namespace: DefaultKinsNamespace, UID: types.UID("agent-uid")},
+		Spec:       appsv1.DaemonSetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{KinsRoleLabelKey: KinsRoleLabelAgent}}},
+	}
+	dsIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	if err := dsIndexer.Add(ds); err != nil {
+		t.Fatal(err)
+	}
+	f := &upgradeFixture{
+		t:  t,
+		kc: &KinsController{kubeClient: fake.NewSimpleClientset(server), dsLister: applisters.NewDaemonSetLister(dsIndexer)},
+		nu: nu,
+		ds: ds,
+	}
+	f.status = &sitev1alpha2.UnitClusterStatus{Phase: sitev1alpha2.ClusterRunning}
+	for _, conditionType := range []string{UnitClusterConditionServerReady, UnitClusterConditionAgentReady,
+		UnitClusterConditionCRIReady, UnitClusterConditionAPIServerReady} {
+		f.setCondition(conditionType, sitev1alpha2.ConditionTrue)
+	}
+	f.createPod(buildKinsServerStatefulSetName(nu.Name)+"-0", "server", oldK3SImage, true)
+	f.createPod("agent-a", "agent", oldK3SImage, true)
+	f.createPod("agent-b", "agent", oldK3SImage, true)
+	return f
+}
+
+func (f *upgradeFixture) setCondition(conditionType string, status sitev1alpha2.ConditionStatus) {
+	for i := range f.status.Conditions {
+		if f.status.Conditions[i].Type == conditionType {
+			f.status.Conditions[i].Status = status
+			return
+		}
+	}
+	f.status.Conditions = append(f.status.Conditions, sitev1alpha2.ClusterCondition{Type: conditionType, Status: status})
+}
+
+// createPod creates the pod as its controller would recreate it
+func (f *upgradeFixture) createPod(name, container, image string, ready bool) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: DefaultKinsNamespace, UID: types.UID(name + "-" + image)},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: container, Image: image}}},
+	}
+	if container == "agent" {
+		controller := true
+		pod.Labels = map[string]string{KinsRoleLabelKey: KinsRoleLabelAgent}
+		pod.Spec.NodeName = "node-" + strings.TrimPrefix(name, "agent-")
+		pod.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "DaemonSet", Name: f.ds.Name, UID: f.ds.UID, Controller: &controller}}
+	}
+	if ready {
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	}
+	pods := f.kc.kubeClient.CoreV1().Pods(DefaultKinsNamespace)
+	if err := pods.Delete(context.TODO(), name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		f.t.Fatal(err)
+	}
+	if _, err := pods.Create(context.TODO(), pod, metav1.CreateOptions{}); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+func (f *upgradeFixture) podDeleted(name string) bool {
+	_, err := f.kc.kubeClient.CoreV1().Pods(DefaultKinsNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	return errors.IsNotFound(err)
+}
+
+// step upgrades once, the node unit is updated with the new status as the controller does
+func (f *upgradeFixture) step(expectedPhase sitev1alpha2.UnitClusterUpgradePhase) {
+	f.t.Helper()
+	// the phase is observed again before each step
+	f.status.Phase = unitClusterPhase(f.status.Phase, true)
+	if _, err := f.kc.UpgradeUnitCluster(f.nu, f.status); err != nil {
+		f.t.Fatal(err)
+	}
+	if f.status.Upgrade == nil || f.status.Upgrade.Phase != expectedPhase {
+		f.t.Fatalf("expected upgrade phase %s, got %+v", expectedPhase, f.status.Upgrade)
+	}
+	f.nu.Status.UnitCluster = *f.status.DeepCopy()
+}
+
+func TestUpgradeUnitCluster(t *testing.T) {
+	f := newUpgradeFixture(t)
+	serverPod := buildKinsServerStatefulSetName(f.nu.Name) + "-0"
+
+	// the image of the unit cluster is recorded, the manifests keep it during the preflight
+	f.step(sitev1alpha2.UpgradeServers)
+	if f.status.Upgrade.Image != oldK3SImage || f.status.Upgrade.TargetImage != newK3SImage || f.status.Phase != sitev1alpha2.ClusterUpgrading {
+		t.Errorf("unexpected status %+v", f.status)
+	}
+	if image, err := f.kc.k3sImage(f.nu); err != nil || image != newK3SImage {
+		t.Errorf("expected the manifests rendered with %s, got %s, %v", newK3SImage, image, err)
+	}
+
+	// the server is replaced once the unit cluster is healthy
+	f.setCondition(UnitClusterConditionAPIServerReady, sitev1alpha2.ConditionFalse)
+	f.step(sitev1alpha2.UpgradeServers)
+	if f.podDeleted(serverPod) {
+		t.Fatal("the server is replaced while the unit cluster is unhealthy")
+	}
+	f.setCondition(UnitClusterConditionAPIServerReady, sitev1alpha2.ConditionTrue)
+	f.step(sitev1alpha2.UpgradeServers)
+	if !f.podDeleted(serverPod) {
+		t.Fatal("the server is not replaced")
+	}
+	f.step(sitev1alpha2.UpgradeServers)
+	f.createPod(serverPod, "server", newK3SImage, false)
+	f.step(sitev1alpha2.UpgradeServers)
+	if !strings.Contains(f.status.Upgrade.Message, "to be ready") {
+		t.Errorf("unexpected message %s", f.status.Upgrade.Message)
+	}
+	f.createPod(serverPod, "server", newK3SImage, true)
+	f.step(sitev1alpha2.UpgradeAgents)
+
+	// the agents are replaced one by one
+	for _, agent := range []string{"agent-a", "agent-b"} {
+		f.step(sitev1alpha2.UpgradeAgents)
+		if !f.podDeleted(agent) {
+			t.Fatalf("%s is not replaced", agent)
+		}
+		f.createPod(agent, "agent", newK3SImage, true)
+	}
+	f.step(sitev1alpha2.UpgradeSucceeded)
+	if f.status.Upgrade.Image != newK3SImage || f.status.Phase != sitev1alpha2.ClusterRunning {
+		t.Errorf("unexpected status %+v", f.status)
+	}
+	f.step(sitev1alpha2.UpgradeSucceeded)
+}
+
+func TestUpgradeUnitClusterRollback(t *testing.T) {
+	f := newUpgradeFixture(t)
+	serverPod := buildKinsServerStatefulSetName(f.nu.Name) + "-0"
+	f.step(sitev1alpha2.UpgradeServers)
+	f.step(sitev1alpha2.UpgradeServers)
+	f.createPod(serverPod, "server", newK3SImage, false)
+	f.setCondition(UnitClusterConditionServerReady, sitev1alpha2.ConditionFalse)
+	f.step(sitev1alpha2.UpgradeServers)
+
+	// the new server is not ready in time
+	f.status.Upgrade.LastTransitionTime = metav1.NewTime(time.Now().Add(-DefaultUpgradeStepTimeout - time.Minute))
+	f.step(sitev1alpha2.UpgradeRollingBack)
+	if !strings.Contains(f.status.Upgrade.FailureReason, "to be ready") {
+		t.Errorf("unexpected failure reason %s", f.status.Upgrade.FailureReason)
+	}
+	if image, err := f.kc.k3sImage(f.nu); err != nil || image != oldK3SImage {
+		t.Errorf("expected the manifests rendered with %s, got %s, %v", oldK3SImage, image, err)
+	}
+	// the rollback is not gated by the health of the unit cluster
+	f.step(sitev1alpha2.UpgradeRollingBack)
+	if !f.podDeleted(serverPod) {
+		t.Fatal("the server is not rolled back")
+	}
+	f.createPod(serverPod, "server", oldK3SImage, true)
+	f.step(sitev1alpha2.UpgradeRollingBack)
+	f.setCondition(UnitClusterConditionServerReady, sitev1alpha2.ConditionTrue)
+	f.step(sitev1alpha2.UpgradeRolledBack)
+	if f.status.Upgrade.Image != oldK3SImage || f.status.Phase != sitev1alpha2.ClusterRunning {
+		t.Errorf("unexpected status %+v", f.status)
+	}
+	// the failed target is not retried
+	f.step(sitev1alpha2.UpgradeRolledBack)
+}
+
+func TestPauseUpgrade(t *testing.T) {
+	f := newUpgradeFixture(t)
+	serverPod := buildKinsServerStatefulSetName(f.nu.Name) + "-0"
+	f.step(sitev1alpha2.UpgradeServers)
+	f.step(sitev1alpha2.UpgradeServers)
+	f.createPod(serverPod, "server", newK3SImage, false)
+
+	// the node unit is partitioned for longer than the step timeout, the upgrade is held
+	f.status.Upgrade.LastTransitionTime = metav1.NewTime(time.Now().Add(-DefaultUpgradeStepTimeout - time.Minute))
+	PauseUpgrade(f.status, "the node unit is partitioned from the cloud")
+	if !strings.HasPrefix(f.status.Upgrade.Message, upgradePaused) || f.status.Phase != sitev1alpha2.ClusterUpgrading {
+		t.Errorf("unexpected status %+v", f.status)
+	}
+	f.nu.Status.UnitCluster = *f.status.DeepCopy()
+
+	// the step waits again once the partition is over, it is not rolled back
+	f.step(sitev1alpha2.UpgradeServers)
+	if strings.HasPrefix(f.status.Upgrade.Message, upgradePaused) {
+		t.Errorf("the upgrade is still paused: %s", f.status.Upgrade.Message)
+	}
+	f.createPod(serverPod, "server", newK3SImage, true)
+	f.step(sitev1alpha2.UpgradeAgents)
+
+	// a finished upgrade is left as it is
+	f.status.Upgrade.Phase = sitev1alpha2.UpgradeSucceeded
+	f.status.Upgrade.Message = ""
+	PauseUpgrade(f.status, "the node unit is partitioned from the cloud")
+	if f.status.Upgrade.Message != "" {
+		t.Errorf("unexpected message %s", f.status.Upgrade.Message)
+	}
+}
+
+func TestUpgradePreflight(t *testing.T) {
+	for _, tc := range []struct {
+		target   string
+		expected string
+	}{
+		{"ccr.ccs.tencentyun.com/tkeedge/k3s:v1.24.1-revison-1", "skips minor versions"},
+		{"ccr.ccs.tencentyun.com/tkeedge/k3s:v1.21.1-revison-1", "downgrade"},
+		{"localhost:5000/k3s:custom", ""},
+		{newK3SImage, ""},
+	} {
+		f := newUpgradeFixture(t)
+		f.nu.Spec.UnitClusterInfo.Parameters[ParameterK3SImageKey] = tc.target
+		if tc.expected == "" {
+			f.step(sitev1alpha2.UpgradeServers)
+			continue
+		}
+		f.step(sitev1alpha2.UpgradePreflight)
+		if !strings.Contains(f.status.Upgrade.Message, tc.expected) {
+			t.Errorf("%s: expected preflight error %q, got %q", tc.target, tc.expected, f.status.Upgrade.Message)
+		}
+		// the upgrade is canceled when the target is set back
+		f.nu.Spec.UnitClusterInfo.Parameters[ParameterK3SImageKey] = oldK3SImage
+		f.step("")
+	}
+
+	f := newUpgradeFixture(t)
+	f.setCondition(UnitClusterConditionAgentReady, sitev1alpha2.ConditionFalse)
+	f.step(sitev1alpha2.UpgradePreflight)
+	if f.podDeleted(buildKinsServerStatefulSetName(f.nu.Name) + "-0") {
+		t.Error("the server is replaced while the preflight fails")
+	}
+}
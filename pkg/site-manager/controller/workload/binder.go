@@ -0,0 +1,417 @@
+/*
+Copyright 2021 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workload
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	clientset "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	sitev1alpha2 "github.com/superedge/superedge/pkg/site-manager/apis/site.superedge.io/v1alpha2"
+	"github.com/superedge/superedge/pkg/site-manager/constant"
+)
+
+// Binder binds the workloads of a NodeGroup to its NodeUnits: every workload is copied to each NodeUnit, the copy
+// runs on the nodes labeled {NodeGroup name: NodeUnit name} by the NodeGroup. The listed workload is the template
+// of the copies, it is pinned to run no pod: the pods of its copies carry its labels and would be selected by it.
+type Binder struct {
+	kubeClient        clientset.Interface
+	informers         map[sitev1alpha2.WorkloadType]cache.SharedIndexInformer
+	endpointsInformer cache.SharedIndexInformer
+	endpointsLister   corelisters.EndpointsLister
+	synced            []cache.InformerSynced
+}
+
+// NewBinder reads the templates and the copies from the caches of informers
+func NewBinder(kubeClient clientset.Interface, informers *Informers) *Binder {
+	b := &Binder{
+		kubeClient:        kubeClient,
+		informers:         make(map[sitev1alpha2.WorkloadType]cache.SharedIndexInformer),
+		endpointsInformer: informers.Endpoints.Informer(),
+		endpointsLister:   informers.Endpoints.Lister(),
+		synced:            []cache.InformerSynced{informers.Endpoints.Informer().HasSynced},
+	}
+	for _, k := range allKinds {
+		informer := k.informer(informers)
+		b.informers[k.workloadType] = informer
+		b.synced = append(b.synced, informer.HasSynced)
+	}
+	return b
+}
+
+// HasSynced returns whether the caches of the workloads are synced
+func (b *Binder) HasSynced() bool {
+	for _, synced := range b.synced {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
+// AddCopyHandler calls enqueue with the NodeGroup of the copies added, updated or deleted, and of the Endpoints
+// of the copies of the Services, the readiness of the copies is reported in the status of the NodeGroup
+func (b *Binder) AddCopyHandler(enqueue func(ngName string)) {
+	handle := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		m, err := meta.Accessor(obj)
+		if err != nil {
+			return
+		}
+		if ngName, ok := m.GetLabels()[constant.NodeGroupWorkloadLabel]; ok {
+			enqueue(ngName)
+		}
+	}
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    handle,
+		UpdateFunc: func(_, cur interface{}) { handle(cur) },
+		DeleteFunc: handle,
+	}
+	for _, informer := range b.informers {
+		informer.AddEventHandler(handler)
+	}
+	// the Endpoints carry the labels of their Service
+	b.endpointsInformer.AddEventHandler(handler)
+}
+
+func (b *Binder) lister(k *kind) cache.GenericLister {
+	return cache.NewGenericLister(b.informers[k.workloadType].GetIndexer(), k.resource)
+}
+
+// Bind ensures the copies of the workloads of ng in units, deletes the copies no longer bound, and returns the
+// units where the copies are ready. The status of the workloads that failed is returned with the error.
+func (b *Binder) Bind(ctx context.Context, ng *sitev1alpha2.NodeGroup, units []string) ([]sitev1alpha2.WorkloadStatus, error) {
+	var errs []error
+	var status []sitev1alpha2.WorkloadStatus
+	bound := make(map[sitev1alpha2.WorkloadType]sets.String)
+	templates := make(map[sitev1alpha2.WorkloadType]sets.String)
+	for _, w := range ng.Spec.Workload {
+		k, ok := kinds[w.Type]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unsupported workload type %q of %s", w.Type, w.Name))
+			continue
+		}
+		if bound[k.workloadType] == nil {
+			bound[k.workloadType], templates[k.workloadType] = sets.NewString(), sets.NewString()
+		}
+		sources, err := b.sources(k, w)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, src := range sources {
+			srcMeta, _ := meta.Accessor(src)
+			templates[k.workloadType].Insert(srcMeta.GetNamespace() + "/" + srcMeta.GetName())
+			s, err := b.bindWorkload(ctx, k, src, ng, units, bound[k.workloadType])
+			if err != nil {
+				errs = append(errs, err)
+			}
+			status = append(status, s)
+			if err := b.pinTemplate(ctx, k, src, ng.Name); err != nil {
+				errs = append(errs, fmt.Errorf("pin %s: %v", s.WorkloadName, err))
+			}
+		}
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].WorkloadName < status[j].WorkloadName })
+
+	// the copies of the types no longer listed are deleted too, and their templates run again
+	for _, k := range allKinds {
+		if err := b.deleteUnbound(ctx, k, ng, bound[k.workloadType]); err != nil {
+			errs = append(errs, err)
+		}
+		if err := b.unpinTemplates(ctx, k, ng.Name, templates[k.workloadType]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return status, utilerrors.NewAggregate(errs)
+}
+
+// Release unpins the templates of ng when it is deleted, its copies are collected with it
+func (b *Binder) Release(ctx context.Context, ng *sitev1alpha2.NodeGroup) error {
+	var errs []error
+	for _, k := range allKinds {
+		if err := b.unpinTemplates(ctx, k, ng.Name, nil); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// sources returns the workloads named or selected by w, the copies are never selected
+func (b *Binder) sources(k *kind, w sitev1alpha2.Workload) ([]runtime.Object, error) {
+	var sources []runtime.Object
+	if w.Name != "" {
+		namespace, name := metav1.NamespaceDefault, w.Name
+		if i := strings.Index(w.Name, "/"); i >= 0 {
+			namespace, name = w.Name[:i], w.Name[i+1:]
+		}
+		obj, err := b.lister(k).ByNamespace(namespace).Get(name)
+		if errors.IsNotFound(err) {
+			klog.V(4).InfoS("NodeGroup workload not found", "type", w.Type, "workload", w.Name)
+		} else if err != nil {
+			return nil, err
+		} else {
+			sources = append(sources, obj)
+		}
+	}
+	if w.Selector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{
+			MatchLabels:      w.Selector.MatchLabels,
+			MatchExpressions: w.Selector.MatchExpressions,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if selector.Empty() {
+			return sources, nil
+		}
+		notCopy, err := labels.NewRequirement(constant.NodeGroupWorkloadLabel, selection.DoesNotExist, nil)
+		if err != nil {
+			return nil, err
+		}
+		objs, err := b.lister(k).List(selector.Add(*notCopy))
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, objs...)
+	}
+	return sources, nil
+}
+
+// template returns src as its copies see it, without the pinning
+func template(k *kind, src runtime.Object) runtime.Object {
+	obj := k.pin(src, false)
+	m, _ := meta.Accessor(obj)
+	if _, ok := m.GetLabels()[constant.WorkloadTemplateLabel]; ok {
+		templateLabels := make(map[string]string)
+		for key, v := range m.GetLabels() {
+			if key != constant.WorkloadTemplateLabel {
+				templateLabels[key] = v
+			}
+		}
+		m.SetLabels(templateLabels)
+	}
+	return obj
+}
+
+// pinTemplate keeps the template from running pods, it is labeled with the NodeGroup which pinned it first
+func (b *Binder) pinTemplate(ctx context.Context, k *kind, src runtime.Object, ngName string) error {
+	pinned := k.pin(src, true)
+	m, _ := meta.Accessor(pinned)
+	if _, ok := m.GetLabels()[constant.WorkloadTemplateLabel]; ok && equality.Semantic.DeepEqual(pinned, src) {
+		return nil
+	} else if !ok {
+		pinnedLabels := make(map[string]string)
+		for key, v := range m.GetLabels() {
+			pinnedLabels[key] = v
+		}
+		pinnedLabels[constant.WorkloadTemplateLabel] = ngName
+		m.SetLabels(pinnedLabels)
+	}
+	klog.V(4).InfoS("Pin NodeGroup workload template", "type", k.workloadType, "workload", klog.KObj(m))
+	return k.update(ctx, b.kubeClient, src, pinned)
+}
+
+// unpinTemplates runs again the templates pinned by ngName which are not in templates
+func (b *Binder) unpinTemplates(ctx context.Context, k *kind, ngName string, templates sets.String) error {
+	objs, err := b.lister(k).List(labels.SelectorFromSet(labels.Set{constant.WorkloadTemplateLabel: ngName}))
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, obj := range objs {
+		m, _ := meta.Accessor(obj)
+		if templates.Has(m.GetNamespace() + "/" + m.GetName()) {
+			continue
+		}
+		klog.V(4).InfoS("Unpin NodeGroup workload template", "type", k.workloadType, "workload", klog.KObj(m))
+		if err := k.update(ctx, b.kubeClient, obj, template(k, obj)); err != nil && !errors.IsNotFound(err) {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// bindWorkload ensures the copies of src in units and returns in which units they are ready. The names of the
+// copies are added to bound.
+func (b *Binder) bindWorkload(ctx context.Context, k *kind, src runtime.Object, ng *sitev1alpha2.NodeGroup,
+	units []string, bound sets.String) (sitev1alpha2.WorkloadStatus, error) {
+	srcMeta, _ := meta.Accessor(src)
+	status := sitev1alpha2.WorkloadStatus{
+		WorkloadName: fmt.Sprintf("%s/%s/%s", k.workloadType, srcMeta.GetNamespace(), srcMeta.GetName()),
+	}
+	src = template(k, src)
+	hash, err := specHash(src)
+	if err != nil {
+		return status, err
+	}
+
+	var errs []error
+	for _, unit := range units {
+		desired := k.bind(src, ng.Name, unit)
+		desiredMeta, _ := meta.Accessor(desired)
+		setCopyMeta(desiredMeta, srcMeta, ng, unit, hash)
+		bound.Insert(desiredMeta.GetNamespace() + "/" + desiredMeta.GetName())
+
+		ready, err := b.ensureCopy(ctx, k, desired, ng.Name, hash)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("bind %s to NodeUnit %s: %v", status.WorkloadName, unit, err))
+		}
+		if ready {
+			status.ReadyUnit = append(status.ReadyUnit, unit)
+		} else {
+			status.NotReadyUnit = append(status.NotReadyUnit, unit)
+		}
+	}
+	return status, utilerrors.NewAggregate(errs)
+}
+
+// ensureCopy creates the copy or updates it when its template changed, and returns whether it is ready
+func (b *Binder) ensureCopy(ctx context.Context, k *kind, desired runtime.Object, ngName, hash string) (bool, error) {
+	desiredMeta, _ := meta.Accessor(desired)
+	cur, err := b.lister(k).ByNamespace(desiredMeta.GetNamespace()).Get(desiredMeta.GetName())
+	if errors.IsNotFound(err) {
+		klog.V(4).InfoS("Create NodeGroup workload", "type", k.workloadType, "workload", klog.KObj(desiredMeta))
+		// the copy created by a previous sync may not be in the cache yet, its event enqueues the NodeGroup
+		if err := k.create(ctx, b.kubeClient, desired); err != nil && !errors.IsAlreadyExists(err) {
+			return false, err
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	curMeta, _ := meta.Accessor(cur)
+	if owner := curMeta.GetLabels()[constant.NodeGroupWorkloadLabel]; owner != ngName {
+		return false, fmt.Errorf("%s %s already exists and is not bound by NodeGroup %s", k.workloadType, klog.KObj(curMeta), ngName)
+	}
+	if curMeta.GetAnnotations()[constant.WorkloadHashAnnotation] != hash {
+		klog.V(4).InfoS("Update NodeGroup workload", "type", k.workloadType, "workload", klog.KObj(desiredMeta))
+		return false, k.update(ctx, b.kubeClient, cur, desired)
+	}
+	return k.ready(b.endpointsLister, cur)
+}
+
+// deleteUnbound deletes the copies of ng not in bound
+func (b *Binder) deleteUnbound(ctx context.Context, k *kind, ng *sitev1alpha2.NodeGroup, bound sets.String) error {
+	copies, err := b.lister(k).List(labels.SelectorFromSet(labels.Set{constant.NodeGroupWorkloadLabel: ng.Name}))
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, obj := range copies {
+		m, _ := meta.Accessor(obj)
+		if bound.Has(m.GetNamespace() + "/" + m.GetName()) {
+			continue
+		}
+		klog.V(4).InfoS("Delete unbound NodeGroup workload", "type", k.workloadType, "workload", klog.KObj(m))
+		if err := k.delete(ctx, b.kubeClient, m.GetNamespace(), m.GetName()); err != nil && !errors.IsNotFound(err) {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// setCopyMeta sets the metadata of the copy of src in unit, the copy is owned by the NodeGroup
+func setCopyMeta(copyMeta, srcMeta metav1.Object, ng *sitev1alpha2.NodeGroup, unit, hash string) {
+	copyLabels := make(map[string]string)
+	for k, v := range srcMeta.GetLabels() {
+		copyLabels[k] = v
+	}
+	for k, v := range copyPodLabels(ng.Name, unit) {
+		copyLabels[k] = v
+	}
+	copyMeta.SetName(CopyName(srcMeta.GetName(), unit))
+	copyMeta.SetNamespace(srcMeta.GetNamespace())
+	copyMeta.SetLabels(copyLabels)
+	copyMeta.SetAnnotations(map[string]string{constant.WorkloadHashAnnotation: hash})
+	copyMeta.SetOwnerReferences([]metav1.OwnerReference{
+		*metav1.NewControllerRef(ng, sitev1alpha2.SchemeGroupVersion.WithKind("NodeGroup")),
+	})
+	copyMeta.SetResourceVersion("")
+	copyMeta.SetUID("")
+	copyMeta.SetGeneration(0)
+	copyMeta.SetCreationTimestamp(metav1.Time{})
+	copyMeta.SetManagedFields(nil)
+	copyMeta.SetFinalizers(nil)
+}
+
+// copyPodLabels tells apart the pods of the copies in the NodeUnits
+func copyPodLabels(ngName, unit string) map[string]string {
+	return map[string]string{
+		constant.NodeGroupWorkloadLabel: ngName,
+		constant.NodeUnitWorkloadLabel:  unit,
+	}
+}
+
+// CopyName returns the name of the copy of the workload in unit, it is hashed when longer than a DNS label
+func CopyName(name, unit string) string {
+	copyName := name + "-" + unit
+	if len(copyName) <= 63 {
+		return copyName
+	}
+	h := sha1.Sum([]byte(copyName))
+	suffix := hex.EncodeToString(h[:])[:10]
+	if len(name) > 52 {
+		name = strings.TrimRight(name[:52], "-.")
+	}
+	return name + "-" + suffix
+}
+
+// specHash hashes the labels and the spec of the workload, the copies are updated when they change
+func specHash(obj runtime.Object) (string, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	var fields struct {
+		Metadata struct {
+			Labels map[string]string `json:"labels,omitempty"`
+		} `json:"metadata"`
+		Spec json.RawMessage `json:"spec"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return "", err
+	}
+	if data, err = json.Marshal(fields); err != nil {
+		return "", err
+	}
+	h := fnv.New32a()
+	h.Write(data)
+	return fmt.Sprintf("%x", h.Sum32()), nil
+}
@@ -0,0 +1,325 @@
+/*
+Copyright 2021 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workload
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	sitev1alpha2 "github.com/superedge/superedge/pkg/site-manager/apis/site.superedge.io/v1alpha2"
+	"github.com/superedge/superedge/pkg/site-manager/constant"
+)
+
+// startBinder returns a binder reading the caches of informers of client, sync waits for them to hold the objects
+// of client
+func startBinder(t *testing.T, client *fake.Clientset) (b *Binder, sync func()) {
+	factory := informers.NewSharedInformerFactory(client, 0)
+	b = NewBinder(client, &Informers{
+		Deployment:  factory.Apps().V1().Deployments(),
+		DaemonSet:   factory.Apps().V1().DaemonSets(),
+		StatefulSet: factory.Apps().V1().StatefulSets(),
+		Job:         factory.Batch().V1().Jobs(),
+		CronJob:     factory.Batch().V1().CronJobs(),
+		Service:     factory.Core().V1().Services(),
+		Endpoints:   factory.Core().V1().Endpoints(),
+	})
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	factory.Start(stop)
+	if !cache.WaitForCacheSync(stop, b.HasSynced) {
+		t.Fatal("caches not synced")
+	}
+	indexers := map[schema.GroupVersionKind]cache.Indexer{
+		corev1.SchemeGroupVersion.WithKind("Endpoints"): b.endpointsInformer.GetIndexer(),
+	}
+	for _, k := range allKinds {
+		gvk := appsv1.SchemeGroupVersion.WithKind(string(k.workloadType))
+		if k.resource.Group != "apps" {
+			gvk = schema.GroupVersionKind{Group: k.resource.Group, Version: "v1", Kind: string(k.workloadType)}
+		}
+		indexers[gvk] = b.informers[k.workloadType].GetIndexer()
+	}
+	sync = func() {
+		t.Helper()
+		err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+			for gvk, indexer := range indexers {
+				resource, _ := meta.UnsafeGuessKindToResource(gvk)
+				list, err := client.Tracker().List(resource, gvk, metav1.NamespaceAll)
+				if err != nil {
+					return false, err
+				}
+				objs, err := meta.ExtractList(list)
+				if err != nil {
+					return false, err
+				}
+				if len(objs) != len(indexer.ListKeys()) {
+					return false, nil
+				}
+				for _, obj := range objs {
+					cached, exists, err := indexer.Get(obj)
+					if err != nil || !exists || !equality.Semantic.DeepEqual(cached, obj) {
+						return false, err
+					}
+				}
+			}
+			return true, nil
+		})
+		if err != nil {
+			t.Fatalf("caches not synced: %v", err)
+		}
+	}
+	return b, sync
+}
+
+func TestBind(t *testing.T) {
+	ctx := context.TODO()
+	replicas := int32(2)
+	appLabels := map[string]string{"app": "nginx"}
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", Labels: appLabels},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "nginx"}},
+			Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "nginx"}}},
+		},
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "edge", Labels: appLabels},
+		Spec: corev1.ServiceSpec{
+			Selector:  map[string]string{"app": "nginx"},
+			ClusterIP: "10.96.0.10",
+			Ports:     []corev1.ServicePort{{Port: 80, NodePort: 30080}},
+		},
+	}
+	client := fake.NewSimpleClientset(deploy, svc)
+	ng := &sitev1alpha2.NodeGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: "group", UID: "uid"},
+		Spec: sitev1alpha2.NodeGroupSpec{Workload: []sitev1alpha2.Workload{
+			{Name: "nginx", Type: sitev1alpha2.WorkloadDeploy},
+			{Type: sitev1alpha2.WorkloadService, Selector: &sitev1alpha2.Selector{MatchLabels: appLabels}},
+		}},
+	}
+	b, sync := startBinder(t, client)
+	enqueued := make(chan string, 100)
+	b.AddCopyHandler(func(ngName string) { enqueued <- ngName })
+
+	status, err := b.Bind(ctx, ng, []string{"unit1", "unit2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sync()
+	select {
+	case ngName := <-enqueued:
+		if ngName != "group" {
+			t.Errorf("expected the NodeGroup of the copies enqueued, got %s", ngName)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("the NodeGroup is not enqueued when its copies change")
+	}
+	expected := []sitev1alpha2.WorkloadStatus{
+		{WorkloadName: "Deployment/default/nginx", NotReadyUnit: []string{"unit1", "unit2"}},
+		{WorkloadName: "Service/edge/nginx", NotReadyUnit: []string{"unit1", "unit2"}},
+	}
+	if !reflect.DeepEqual(status, expected) {
+		t.Fatalf("expected status %+v, got %+v", expected, status)
+	}
+
+	d, err := client.AppsV1().Deployments("default").Get(ctx, "nginx-unit1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Spec.Template.Spec.NodeSelector["group"] != "unit1" || d.Spec.Selector.MatchLabels[constant.NodeUnitWorkloadLabel] != "unit1" ||
+		d.Spec.Template.Labels[constant.NodeUnitWorkloadLabel] != "unit1" || d.Labels[constant.NodeGroupWorkloadLabel] != "group" {
+		t.Errorf("the copy is not bound to unit1: %+v", d)
+	}
+	if len(d.OwnerReferences) != 1 || d.OwnerReferences[0].Kind != "NodeGroup" || d.OwnerReferences[0].Name != "group" {
+		t.Errorf("the copy must be owned by the NodeGroup, got %+v", d.OwnerReferences)
+	}
+	if _, ok := d.Labels[constant.WorkloadTemplateLabel]; ok || d.Spec.Template.Spec.Affinity != nil {
+		t.Errorf("the copy must not be pinned: %+v", d)
+	}
+	// the templates run no pod, and select none
+	if tmpl, err := client.AppsV1().Deployments("default").Get(ctx, "nginx", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	} else if tmpl.Labels[constant.WorkloadTemplateLabel] != "group" || !pinned(&tmpl.Spec.Template) {
+		t.Errorf("the template is not pinned: %+v", tmpl)
+	}
+	if tmpl, err := client.CoreV1().Services("edge").Get(ctx, "nginx", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	} else if _, ok := tmpl.Spec.Selector[constant.WorkloadTemplateLabel]; !ok {
+		t.Errorf("the template service selects the pods of the copies: %+v", tmpl.Spec.Selector)
+	}
+	s, err := client.CoreV1().Services("edge").Get(ctx, "nginx-unit2", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Spec.Selector[constant.WorkloadTemplateLabel]; ok || s.Spec.ClusterIP != "" || s.Spec.Ports[0].NodePort != 0 ||
+		s.Spec.Selector[constant.NodeUnitWorkloadLabel] != "unit2" {
+		t.Errorf("unexpected service copy %+v", s.Spec)
+	}
+
+	// the copies in unit1 become ready
+	d.Status = appsv1.DeploymentStatus{Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2}
+	if _, err := client.AppsV1().Deployments("default").UpdateStatus(ctx, d, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CoreV1().Endpoints("edge").Create(ctx, &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx-unit1", Namespace: "edge"},
+		Subsets:    []corev1.EndpointSubset{{Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}}}},
+	}, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	sync()
+	// unit2 leaves the group
+	status, err = b.Bind(ctx, ng, []string{"unit1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []sitev1alpha2.WorkloadStatus{
+		{WorkloadName: "Deployment/default/nginx", ReadyUnit: []string{"unit1"}},
+		{WorkloadName: "Service/edge/nginx", ReadyUnit: []string{"unit1"}},
+	}
+	if !reflect.DeepEqual(status, expected) {
+		t.Fatalf("expected status %+v, got %+v", expected, status)
+	}
+	if _, err := client.AppsV1().Deployments("default").Get(ctx, "nginx-unit2", metav1.GetOptions{}); err == nil {
+		t.Errorf("the copy in unit2 must be deleted")
+	}
+	sync()
+
+	// the copies follow the template
+	replicas = 3
+	if _, err := client.AppsV1().Deployments("default").Update(ctx, deploy, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	sync()
+	if _, err := b.Bind(ctx, ng, []string{"unit1"}); err != nil {
+		t.Fatal(err)
+	}
+	sync()
+	if d, err = client.AppsV1().Deployments("default").Get(ctx, "nginx-unit1", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	} else if *d.Spec.Replicas != 3 {
+		t.Errorf("the copy is not updated: %+v", d.Spec)
+	}
+
+	// the workloads not bound by the group are left alone
+	if _, err := client.AppsV1().Deployments("default").Create(ctx, &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx-unit3", Namespace: "default"},
+	}, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	sync()
+	if _, err := b.Bind(ctx, ng, []string{"unit1", "unit3"}); err == nil {
+		t.Errorf("binding over an existing workload must fail")
+	}
+	sync()
+
+	// the copies are deleted when the workloads are no longer listed
+	ng.Spec.Workload = nil
+	if _, err := b.Bind(ctx, ng, []string{"unit1"}); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := client.AppsV1().Deployments("default").List(ctx, metav1.ListOptions{}); len(list.Items) != 2 {
+		t.Errorf("expected the template and the unbound workload left, got %d deployments", len(list.Items))
+	}
+	if list, _ := client.CoreV1().Services("edge").List(ctx, metav1.ListOptions{}); len(list.Items) != 1 {
+		t.Errorf("expected the template service left, got %d services", len(list.Items))
+	}
+	// and the templates run again
+	if tmpl, err := client.AppsV1().Deployments("default").Get(ctx, "nginx", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	} else if _, ok := tmpl.Labels[constant.WorkloadTemplateLabel]; ok || tmpl.Spec.Template.Spec.Affinity != nil {
+		t.Errorf("the template is not unpinned: %+v", tmpl)
+	}
+	if tmpl, err := client.CoreV1().Services("edge").Get(ctx, "nginx", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	} else if !labels.Equals(tmpl.Spec.Selector, map[string]string{"app": "nginx"}) {
+		t.Errorf("the template service is not unpinned: %+v", tmpl.Spec.Selector)
+	}
+}
+
+func pinned(template *corev1.PodTemplateSpec) bool {
+	affinity := template.Spec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return false
+	}
+	for _, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		if !reflect.DeepEqual(term.MatchExpressions[len(term.MatchExpressions)-len(templateRequirements):], templateRequirements) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPinPodTemplate(t *testing.T) {
+	user := corev1.NodeSelectorRequirement{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}}
+	for _, affinity := range []*corev1.Affinity{
+		nil,
+		{PodAntiAffinity: &corev1.PodAntiAffinity{}},
+		{NodeAffinity: &corev1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{
+				{MatchExpressions: []corev1.NodeSelectorRequirement{user}},
+				{MatchFields: []corev1.NodeSelectorRequirement{{Key: "metadata.name", Operator: corev1.NodeSelectorOpIn, Values: []string{"node"}}}},
+			},
+		}}},
+	} {
+		template := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Affinity: affinity.DeepCopy()}}
+		pinPodTemplate(template, true)
+		if !pinned(template) {
+			t.Errorf("affinity %+v is not pinned: %+v", affinity, template.Spec.Affinity)
+		}
+		// pinning is idempotent
+		again := template.DeepCopy()
+		pinPodTemplate(again, true)
+		if !reflect.DeepEqual(again, template) {
+			t.Errorf("affinity %+v pinned twice: %+v", affinity, again.Spec.Affinity)
+		}
+		pinPodTemplate(template, false)
+		if !reflect.DeepEqual(template.Spec.Affinity, affinity) {
+			t.Errorf("expected affinity %+v unpinned, got %+v", affinity, template.Spec.Affinity)
+		}
+	}
+}
+
+func TestCopyName(t *testing.T) {
+	if name := CopyName("nginx", "unit1"); name != "nginx-unit1" {
+		t.Errorf("unexpected name %s", name)
+	}
+	long := CopyName(strings.Repeat("a", 60), "unit1")
+	if len(long) > 63 || !strings.HasPrefix(long, strings.Repeat("a", 52)+"-") {
+		t.Errorf("unexpected name %s", long)
+	}
+	if long == CopyName(strings.Repeat("a", 60), "unit2") {
+		t.Errorf("the names of the copies in different units must differ")
+	}
+}
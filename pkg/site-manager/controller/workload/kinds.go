@@ -0,0 +1,501 @@
+/*
+Copyright 2021 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workload
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	appinformers "k8s.io/client-go/informers/apps/v1"
+	batchinformers "k8s.io/client-go/informers/batch/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	sitev1alpha2 "github.com/superedge/superedge/pkg/site-manager/apis/site.superedge.io/v1alpha2"
+	"github.com/superedge/superedge/pkg/site-manager/constant"
+)
+
+// Informers are the shared informers the templates and the copies of the workloads are read from
+type Informers struct {
+	Deployment  appinformers.DeploymentInformer
+	DaemonSet   appinformers.DaemonSetInformer
+	StatefulSet appinformers.StatefulSetInformer
+	Job         batchinformers.JobInformer
+	CronJob     batchinformers.CronJobInformer
+	Service     coreinformers.ServiceInformer
+	// Endpoints tell whether the copies of the Services are ready
+	Endpoints coreinformers.EndpointsInformer
+}
+
+// kind reads and writes the copies of a type of workload
+type kind struct {
+	workloadType sitev1alpha2.WorkloadType
+	resource     schema.GroupResource
+	informer     func(i *Informers) cache.SharedIndexInformer
+
+	create func(ctx context.Context, client clientset.Interface, obj runtime.Object) error
+	// update replaces cur by desired, keeping the fields set by the cluster
+	update func(ctx context.Context, client clientset.Interface, cur, desired runtime.Object) error
+	delete func(ctx context.Context, client clientset.Interface, namespace, name string) error
+	// bind returns the copy of the workload running in unit, the metadata is set by the caller
+	bind func(src runtime.Object, ngName, unit string) runtime.Object
+	// pin returns the template with its pods excluded from scheduling or selection, or not
+	pin   func(src runtime.Object, pinned bool) runtime.Object
+	ready func(endpointsLister corelisters.EndpointsLister, obj runtime.Object) (bool, error)
+}
+
+var allKinds = []*kind{deploymentKind, daemonSetKind, statefulSetKind, jobKind, cronJobKind, serviceKind}
+
+var kinds = map[sitev1alpha2.WorkloadType]*kind{
+	sitev1alpha2.WorkloadDeploy:       deploymentKind,
+	sitev1alpha2.WorkloadDaemonset:    daemonSetKind,
+	sitev1alpha2.WorkloadStatefulset:  statefulSetKind,
+	sitev1alpha2.WorkloadStatuefulset: statefulSetKind,
+	sitev1alpha2.WorkloadJob:          jobKind,
+	sitev1alpha2.WorkloadCronjob:      cronJobKind,
+	sitev1alpha2.WorkloadService:      serviceKind,
+}
+
+// bindPodTemplate runs the pods of the copy on the nodes of unit, and labels them to tell the copies apart
+func bindPodTemplate(template *corev1.PodTemplateSpec, ngName, unit string) {
+	if template.Labels == nil {
+		template.Labels = make(map[string]string)
+	}
+	for k, v := range copyPodLabels(ngName, unit) {
+		template.Labels[k] = v
+	}
+	if template.Spec.NodeSelector == nil {
+		template.Spec.NodeSelector = make(map[string]string)
+	}
+	template.Spec.NodeSelector[ngName] = unit
+}
+
+// bindSelector selects the pods of the copy only
+func bindSelector(selector *metav1.LabelSelector, ngName, unit string) *metav1.LabelSelector {
+	if selector == nil {
+		return nil
+	}
+	if selector.MatchLabels == nil {
+		selector.MatchLabels = make(map[string]string)
+	}
+	for k, v := range copyPodLabels(ngName, unit) {
+		selector.MatchLabels[k] = v
+	}
+	return selector
+}
+
+// templateRequirements can not be met by any node, the pods of a pinned template are never scheduled
+var templateRequirements = []corev1.NodeSelectorRequirement{
+	{Key: constant.WorkloadTemplateLabel, Operator: corev1.NodeSelectorOpExists},
+	{Key: constant.WorkloadTemplateLabel, Operator: corev1.NodeSelectorOpDoesNotExist},
+}
+
+// pinPodTemplate adds templateRequirements to every term of the required node affinity of the pods, or removes them
+func pinPodTemplate(template *corev1.PodTemplateSpec, pinned bool) {
+	spec := &template.Spec
+	if spec.Affinity != nil && spec.Affinity.NodeAffinity != nil && spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+		required := spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+		var terms []corev1.NodeSelectorTerm
+		for _, term := range required.NodeSelectorTerms {
+			var expressions []corev1.NodeSelectorRequirement
+			for _, r := range term.MatchExpressions {
+				if r.Key != constant.WorkloadTemplateLabel {
+					expressions = append(expressions, r)
+				}
+			}
+			term.MatchExpressions = expressions
+			if len(term.MatchExpressions) > 0 || len(term.MatchFields) > 0 {
+				terms = append(terms, term)
+			}
+		}
+		required.NodeSelectorTerms = terms
+		if len(terms) == 0 {
+			spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = nil
+		}
+		if len(spec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution) == 0 &&
+			spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+			spec.Affinity.NodeAffinity = nil
+		}
+		if *spec.Affinity == (corev1.Affinity{}) {
+			spec.Affinity = nil
+		}
+	}
+	if !pinned {
+		return
+	}
+	if spec.Affinity == nil {
+		spec.Affinity = &corev1.Affinity{}
+	}
+	if spec.Affinity.NodeAffinity == nil {
+		spec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	if spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{{}},
+		}
+	}
+	terms := spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	for i := range terms {
+		terms[i].MatchExpressions = append(terms[i].MatchExpressions, templateRequirements...)
+	}
+}
+
+// suspended returns the suspension of a pinned Job or CronJob, the copies are not suspended
+func suspended(pinned bool) *bool {
+	if !pinned {
+		return nil
+	}
+	return &pinned
+}
+
+func replicas(r *int32) int32 {
+	if r == nil {
+		return 1
+	}
+	return *r
+}
+
+var deploymentKind = &kind{
+	workloadType: sitev1alpha2.WorkloadDeploy,
+	resource:     schema.GroupResource{Group: "apps", Resource: "deployments"},
+	informer: func(i *Informers) cache.SharedIndexInformer {
+		return i.Deployment.Informer()
+	},
+	create: func(ctx context.Context, client clientset.Interface, obj runtime.Object) error {
+		d := obj.(*appsv1.Deployment)
+		_, err := client.AppsV1().Deployments(d.Namespace).Create(ctx, d, metav1.CreateOptions{})
+		return err
+	},
+	update: func(ctx context.Context, client clientset.Interface, cur, desired runtime.Object) error {
+		d := cur.(*appsv1.Deployment).DeepCopy()
+		d.Labels, d.Annotations = desired.(*appsv1.Deployment).Labels, mergeAnnotations(d.Annotations, desired.(*appsv1.Deployment).Annotations)
+		d.Spec = desired.(*appsv1.Deployment).Spec
+		_, err := client.AppsV1().Deployments(d.Namespace).Update(ctx, d, metav1.UpdateOptions{})
+		return err
+	},
+	delete: func(ctx context.Context, client clientset.Interface, namespace, name string) error {
+		return client.AppsV1().Deployments(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	},
+	bind: func(src runtime.Object, ngName, unit string) runtime.Object {
+		d := src.(*appsv1.Deployment).DeepCopy()
+		d.Spec.Selector = bindSelector(d.Spec.Selector, ngName, unit)
+		bindPodTemplate(&d.Spec.Template, ngName, unit)
+		d.Status = appsv1.DeploymentStatus{}
+		return d
+	},
+	pin: func(src runtime.Object, pinned bool) runtime.Object {
+		d := src.(*appsv1.Deployment).DeepCopy()
+		pinPodTemplate(&d.Spec.Template, pinned)
+		return d
+	},
+	ready: func(endpointsLister corelisters.EndpointsLister, obj runtime.Object) (bool, error) {
+		d := obj.(*appsv1.Deployment)
+		r := replicas(d.Spec.Replicas)
+		return d.Status.ObservedGeneration >= d.Generation && d.Status.Replicas == r &&
+			d.Status.UpdatedReplicas == r && d.Status.AvailableReplicas == r, nil
+	},
+}
+
+var daemonSetKind = &kind{
+	workloadType: sitev1alpha2.WorkloadDaemonset,
+	resource:     schema.GroupResource{Group: "apps", Resource: "daemonsets"},
+	informer: func(i *Informers) cache.SharedIndexInformer {
+		return i.DaemonSet.Informer()
+	},
+	create: func(ctx context.Context, client clientset.Interface, obj runtime.Object) error {
+		ds := obj.(*appsv1.DaemonSet)
+		_, err := client.AppsV1().DaemonSets(ds.Namespace).Create(ctx, ds, metav1.CreateOptions{})
+		return err
+	},
+	update: func(ctx context.Context, client clientset.Interface, cur, desired runtime.Object) error {
+		ds := cur.(*appsv1.DaemonSet).DeepCopy()
+		ds.Labels, ds.Annotations = desired.(*appsv1.DaemonSet).Labels, mergeAnnotations(ds.Annotations, desired.(*appsv1.DaemonSet).Annotations)
+		ds.Spec = desired.(*appsv1.DaemonSet).Spec
+		_, err := client.AppsV1().DaemonSets(ds.Namespace).Update(ctx, ds, metav1.UpdateOptions{})
+		return err
+	},
+	delete: func(ctx context.Context, client clientset.Interface, namespace, name string) error {
+		return client.AppsV1().DaemonSets(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	},
+	bind: func(src runtime.Object, ngName, unit string) runtime.Object {
+		ds := src.(*appsv1.DaemonSet).DeepCopy()
+		ds.Spec.Selector = bindSelector(ds.Spec.Selector, ngName, unit)
+		bindPodTemplate(&ds.Spec.Template, ngName, unit)
+		ds.Status = appsv1.DaemonSetStatus{}
+		return ds
+	},
+	pin: func(src runtime.Object, pinned bool) runtime.Object {
+		ds := src.(*appsv1.DaemonSet).DeepCopy()
+		pinPodTemplate(&ds.Spec.Template, pinned)
+		return ds
+	},
+	// a DaemonSet of a NodeUnit without nodes is not ready
+	ready: func(endpointsLister corelisters.EndpointsLister, obj runtime.Object) (bool, error) {
+		ds := obj.(*appsv1.DaemonSet)
+		desired := ds.Status.DesiredNumberScheduled
+		return ds.Status.ObservedGeneration >= ds.Generation && desired > 0 &&
+			ds.Status.UpdatedNumberScheduled == desired && ds.Status.NumberAvailable == desired, nil
+	},
+}
+
+var statefulSetKind = &kind{
+	workloadType: sitev1alpha2.WorkloadStatefulset,
+	resource:     schema.GroupResource{Group: "apps", Resource: "statefulsets"},
+	informer: func(i *Informers) cache.SharedIndexInformer {
+		return i.StatefulSet.Informer()
+	},
+	create: func(ctx context.Context, client clientset.Interface, obj runtime.Object) error {
+		sts := obj.(*appsv1.StatefulSet)
+		_, err := client.AppsV1().StatefulSets(sts.Namespace).Create(ctx, sts, metav1.CreateOptions{})
+		return err
+	},
+	// only the replicas, the template and the update strategy of a StatefulSet can be updated
+	update: func(ctx context.Context, client clientset.Interface, cur, desired runtime.Object) error {
+		sts, d := cur.(*appsv1.StatefulSet).DeepCopy(), desired.(*appsv1.StatefulSet)
+		sts.Labels, sts.Annotations = d.Labels, mergeAnnotations(sts.Annotations, d.Annotations)
+		sts.Spec.Replicas = d.Spec.Replicas
+		sts.Spec.Template = d.Spec.Template
+		sts.Spec.UpdateStrategy = d.Spec.UpdateStrategy
+		_, err := client.AppsV1().StatefulSets(sts.Namespace).Update(ctx, sts, metav1.UpdateOptions{})
+		return err
+	},
+	delete: func(ctx context.Context, client clientset.Interface, namespace, name string) error {
+		return client.AppsV1().StatefulSets(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	},
+	bind: func(src runtime.Object, ngName, unit string) runtime.Object {
+		sts := src.(*appsv1.StatefulSet).DeepCopy()
+		sts.Spec.Selector = bindSelector(sts.Spec.Selector, ngName, unit)
+		bindPodTemplate(&sts.Spec.Template, ngName, unit)
+		sts.Status = appsv1.StatefulSetStatus{}
+		return sts
+	},
+	pin: func(src runtime.Object, pinned bool) runtime.Object {
+		sts := src.(*appsv1.StatefulSet).DeepCopy()
+		pinPodTemplate(&sts.Spec.Template, pinned)
+		return sts
+	},
+	ready: func(endpointsLister corelisters.EndpointsLister, obj runtime.Object) (bool, error) {
+		sts := obj.(*appsv1.StatefulSet)
+		r := replicas(sts.Spec.Replicas)
+		return sts.Status.ObservedGeneration >= sts.Generation && sts.Status.ReadyReplicas == r &&
+			sts.Status.CurrentRevision == sts.Status.UpdateRevision, nil
+	},
+}
+
+var jobKind = &kind{
+	workloadType: sitev1alpha2.WorkloadJob,
+	resource:     schema.GroupResource{Group: "batch", Resource: "jobs"},
+	informer: func(i *Informers) cache.SharedIndexInformer {
+		return i.Job.Informer()
+	},
+	create: func(ctx context.Context, client clientset.Interface, obj runtime.Object) error {
+		job := obj.(*batchv1.Job)
+		_, err := client.BatchV1().Jobs(job.Namespace).Create(ctx, job, metav1.CreateOptions{})
+		return err
+	},
+	// the template of a Job can not be updated, the copy is deleted and created again by the next sync. The
+	// suspension is updated in place.
+	update: func(ctx context.Context, client clientset.Interface, cur, desired runtime.Object) error {
+		job, d := cur.(*batchv1.Job).DeepCopy(), desired.(*batchv1.Job)
+		if !equality.Semantic.DeepEqual(job.Spec.Template, d.Spec.Template) {
+			propagation := metav1.DeletePropagationBackground
+			return client.BatchV1().Jobs(job.Namespace).Delete(ctx, job.Name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+		}
+		job.Labels, job.Annotations = d.Labels, mergeAnnotations(job.Annotations, d.Annotations)
+		job.Spec.Suspend = d.Spec.Suspend
+		_, err := client.BatchV1().Jobs(job.Namespace).Update(ctx, job, metav1.UpdateOptions{})
+		return err
+	},
+	delete: func(ctx context.Context, client clientset.Interface, namespace, name string) error {
+		propagation := metav1.DeletePropagationBackground
+		return client.BatchV1().Jobs(namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	},
+	bind: func(src runtime.Object, ngName, unit string) runtime.Object {
+		job := src.(*batchv1.Job).DeepCopy()
+		bindJobSpec(&job.Spec, ngName, unit)
+		job.Status = batchv1.JobStatus{}
+		return job
+	},
+	// the template of a Job can not be updated, the Job is suspended instead
+	pin: func(src runtime.Object, pinned bool) runtime.Object {
+		job := src.(*batchv1.Job).DeepCopy()
+		job.Spec.Suspend = suspended(pinned)
+		return job
+	},
+	ready: func(endpointsLister corelisters.EndpointsLister, obj runtime.Object) (bool, error) {
+		for _, c := range obj.(*batchv1.Job).Status.Conditions {
+			if c.Type == batchv1.JobComplete && c.Status == corev1.ConditionTrue {
+				return true, nil
+			}
+		}
+		return false, nil
+	},
+}
+
+// bindJobSpec drops the selector generated for the listed Job, the copy gets its own
+func bindJobSpec(spec *batchv1.JobSpec, ngName, unit string) {
+	if spec.ManualSelector == nil || !*spec.ManualSelector {
+		spec.Selector = nil
+		delete(spec.Template.Labels, "controller-uid")
+		delete(spec.Template.Labels, "job-name")
+	} else {
+		spec.Selector = bindSelector(spec.Selector, ngName, unit)
+	}
+	bindPodTemplate(&spec.Template, ngName, unit)
+}
+
+var cronJobKind = &kind{
+	workloadType: sitev1alpha2.WorkloadCronjob,
+	resource:     schema.GroupResource{Group: "batch", Resource: "cronjobs"},
+	informer: func(i *Informers) cache.SharedIndexInformer {
+		return i.CronJob.Informer()
+	},
+	create: func(ctx context.Context, client clientset.Interface, obj runtime.Object) error {
+		cj := obj.(*batchv1.CronJob)
+		_, err := client.BatchV1().CronJobs(cj.Namespace).Create(ctx, cj, metav1.CreateOptions{})
+		return err
+	},
+	update: func(ctx context.Context, client clientset.Interface, cur, desired runtime.Object) error {
+		cj := cur.(*batchv1.CronJob).DeepCopy()
+		cj.Labels, cj.Annotations = desired.(*batchv1.CronJob).Labels, mergeAnnotations(cj.Annotations, desired.(*batchv1.CronJob).Annotations)
+		cj.Spec = desired.(*batchv1.CronJob).Spec
+		_, err := client.BatchV1().CronJobs(cj.Namespace).Update(ctx, cj, metav1.UpdateOptions{})
+		return err
+	},
+	delete: func(ctx context.Context, client clientset.Interface, namespace, name string) error {
+		propagation := metav1.DeletePropagationBackground
+		return client.BatchV1().CronJobs(namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	},
+	bind: func(src runtime.Object, ngName, unit string) runtime.Object {
+		cj := src.(*batchv1.CronJob).DeepCopy()
+		bindJobSpec(&cj.Spec.JobTemplate.Spec, ngName, unit)
+		cj.Status = batchv1.CronJobStatus{}
+		return cj
+	},
+	pin: func(src runtime.Object, pinned bool) runtime.Object {
+		cj := src.(*batchv1.CronJob).DeepCopy()
+		cj.Spec.Suspend = suspended(pinned)
+		return cj
+	},
+	// a CronJob is ready once its copy is up to date, its jobs run on schedule
+	ready: func(endpointsLister corelisters.EndpointsLister, obj runtime.Object) (bool, error) {
+		return true, nil
+	},
+}
+
+var serviceKind = &kind{
+	workloadType: sitev1alpha2.WorkloadService,
+	resource:     schema.GroupResource{Group: "", Resource: "services"},
+	informer: func(i *Informers) cache.SharedIndexInformer {
+		return i.Service.Informer()
+	},
+	create: func(ctx context.Context, client clientset.Interface, obj runtime.Object) error {
+		svc := obj.(*corev1.Service)
+		_, err := client.CoreV1().Services(svc.Namespace).Create(ctx, svc, metav1.CreateOptions{})
+		return err
+	},
+	// the cluster ips and the node ports allocated to the copy are kept
+	update: func(ctx context.Context, client clientset.Interface, cur, desired runtime.Object) error {
+		svc, d := cur.(*corev1.Service).DeepCopy(), desired.(*corev1.Service)
+		spec := *d.Spec.DeepCopy()
+		spec.ClusterIP, spec.ClusterIPs, spec.IPFamilies = svc.Spec.ClusterIP, svc.Spec.ClusterIPs, svc.Spec.IPFamilies
+		if spec.Type == svc.Spec.Type {
+			spec.HealthCheckNodePort = svc.Spec.HealthCheckNodePort
+			for i := range spec.Ports {
+				for _, p := range svc.Spec.Ports {
+					if p.Port == spec.Ports[i].Port && p.Protocol == spec.Ports[i].Protocol {
+						spec.Ports[i].NodePort = p.NodePort
+					}
+				}
+			}
+		}
+		svc.Labels, svc.Annotations = d.Labels, mergeAnnotations(svc.Annotations, d.Annotations)
+		svc.Spec = spec
+		_, err := client.CoreV1().Services(svc.Namespace).Update(ctx, svc, metav1.UpdateOptions{})
+		return err
+	},
+	delete: func(ctx context.Context, client clientset.Interface, namespace, name string) error {
+		return client.CoreV1().Services(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	},
+	// the copy selects the pods of the copies in unit, a headless Service stays headless
+	bind: func(src runtime.Object, ngName, unit string) runtime.Object {
+		svc := src.(*corev1.Service).DeepCopy()
+		if len(svc.Spec.Selector) > 0 {
+			for k, v := range copyPodLabels(ngName, unit) {
+				svc.Spec.Selector[k] = v
+			}
+		}
+		if svc.Spec.ClusterIP != corev1.ClusterIPNone {
+			svc.Spec.ClusterIP, svc.Spec.ClusterIPs = "", nil
+		}
+		for i := range svc.Spec.Ports {
+			svc.Spec.Ports[i].NodePort = 0
+		}
+		svc.Spec.HealthCheckNodePort = 0
+		svc.Status = corev1.ServiceStatus{}
+		return svc
+	},
+	// a pinned Service selects no pod, its selector is kept by the copies
+	pin: func(src runtime.Object, pinned bool) runtime.Object {
+		svc := src.(*corev1.Service).DeepCopy()
+		delete(svc.Spec.Selector, constant.WorkloadTemplateLabel)
+		if pinned && len(svc.Spec.Selector) > 0 {
+			svc.Spec.Selector[constant.WorkloadTemplateLabel] = "true"
+		}
+		return svc
+	},
+	// a Service is ready when one of its endpoints is, the Services without selector are always ready
+	ready: func(endpointsLister corelisters.EndpointsLister, obj runtime.Object) (bool, error) {
+		svc := obj.(*corev1.Service)
+		if len(svc.Spec.Selector) == 0 {
+			return true, nil
+		}
+		ep, err := endpointsLister.Endpoints(svc.Namespace).Get(svc.Name)
+		if errors.IsNotFound(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		for _, subset := range ep.Subsets {
+			if len(subset.Addresses) > 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	},
+}
+
+// mergeAnnotations keeps the annotations set by the cluster on the copy
+func mergeAnnotations(cur, desired map[string]string) map[string]string {
+	merged := make(map[string]string, len(cur)+len(desired))
+	for k, v := range cur {
+		merged[k] = v
+	}
+	for k, v := range desired {
+		merged[k] = v
+	}
+	return merged
+}
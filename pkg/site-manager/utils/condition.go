@@ -0,0 +1,51 @@
+/*
+Copyright 2021 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	sitev1alpha2 "github.com/superedge/superedge/pkg/site-manager/apis/site.superedge.io/v1alpha2"
+)
+
+// SetCondition replaces the condition of the same type, the transition time is kept when the status is the same,
+// and the condition is left as it is when nothing else changed
+func SetCondition(conditions []sitev1alpha2.ClusterCondition, condition sitev1alpha2.ClusterCondition) []sitev1alpha2.ClusterCondition {
+	for i := range conditions {
+		if conditions[i].Type != condition.Type {
+			continue
+		}
+		if conditions[i].Status == condition.Status && conditions[i].Reason == condition.Reason && conditions[i].Message == condition.Message {
+			return conditions
+		}
+		if conditions[i].Status == condition.Status {
+			condition.LastTransitionTime = conditions[i].LastTransitionTime
+		}
+		conditions[i] = condition
+		return conditions
+	}
+	return append(conditions, condition)
+}
+
+// RemoveCondition removes the condition of the type
+func RemoveCondition(conditions []sitev1alpha2.ClusterCondition, conditionType string) []sitev1alpha2.ClusterCondition {
+	var kept []sitev1alpha2.ClusterCondition
+	for _, condition := range conditions {
+		if condition.Type != conditionType {
+			kept = append(kept, condition)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/superedge/superedge/pkg/tunnel/tunnelcontext"
+)
+
+// Client calls the admin API of a tunnel-cloud replica
+type Client struct {
+	Server     string
+	Token      string
+	HTTPClient *http.Client
+}
+
+func (c *Client) ListNodes() ([]tunnelcontext.NodeInfo, error) {
+	var nodes []tunnelcontext.NodeInfo
+	err := c.do(http.MethodGet, NodesPath, &nodes)
+	return nodes, err
+}
+
+// ListConns lists the connections of the node, or of all nodes when node is empty
+func (c *Client) ListConns(node string) ([]tunnelcontext.ConnInfo, error) {
+	path := ConnsPath
+	if node != "" {
+		path = NodesPath + "/" + url.PathEscape(node) + "/conns"
+	}
+	var conns []tunnelcontext.ConnInfo
+	err := c.do(http.MethodGet, path, &conns)
+	return conns, err
+}
+
+func (c *Client) KillConn(traceID string) error {
+	return c.do(http.MethodDelete, ConnsPath+"/"+url.PathEscape(traceID), nil)
+}
+
+func (c *Client) DisconnectNode(node string) error {
+	return c.do(http.MethodDelete, NodesPath+"/"+url.PathEscape(node), nil)
+}
+
+// Drain starts draining the tunnel-cloud replica
+func (c *Client) Drain() error {
+	return c.do(http.MethodPost, DrainPath, nil)
+}
+
+func (c *Client) do(method, path string, out interface{}) error {
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.Server, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s %s: %s %s", method, path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
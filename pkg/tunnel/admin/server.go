@@ -0,0 +1,207 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/superedge/superedge/pkg/tunnel/conf"
+	"github.com/superedge/superedge/pkg/tunnel/proto"
+	"github.com/superedge/superedge/pkg/tunnel/proxy/modules/stream/streammng/connect"
+	"github.com/superedge/superedge/pkg/tunnel/tunnelcontext"
+	"github.com/superedge/superedge/pkg/tunnel/util"
+	"k8s.io/klog/v2"
+)
+
+const (
+	NodesPath = "/admin/nodes"
+	ConnsPath = "/admin/conns"
+	DrainPath = "/admin/drain"
+)
+
+// StartServer serves the admin API of tunnel-cloud, it is disabled when the admin port is not configured
+func StartServer() {
+	config := conf.TunnelConf.TunnlMode.Cloud.Admin
+	if config == nil || config.Port == 0 {
+		klog.Info("admin server is not configured")
+		return
+	}
+	tk, err := ioutil.ReadFile(config.TokenFile)
+	if err != nil {
+		klog.ErrorS(err, "failed to read the token of the admin server", "tokenFile", config.TokenFile)
+		return
+	}
+	token := strings.TrimSpace(string(tk))
+	if token == "" {
+		klog.Errorf("the token of the admin server is empty, tokenFile = %s", config.TokenFile)
+		return
+	}
+	tlsConfig, err := util.LoadTLSConfig(util.TunnelCloudCertPath, util.TunnelCloudKeyPath,
+		conf.TunnelConf.TunnlMode.Cloud.TLS.CipherSuites, conf.TunnelConf.TunnlMode.Cloud.TLS.MinTLSVersion, false)
+	if err != nil {
+		klog.ErrorS(err, "failed to load the tls config of the admin server")
+		return
+	}
+	ser := &http.Server{
+		Addr:      "0.0.0.0:" + strconv.Itoa(config.Port),
+		Handler:   NewHandler(token),
+		TLSConfig: tlsConfig,
+	}
+	klog.Infof("admin server listen on %s", ser.Addr)
+	if err := ser.ListenAndServeTLS("", ""); err != nil {
+		klog.Errorf("failed to start admin server err = %v", err)
+	}
+}
+
+// NewHandler returns the handler of the admin API, the requests must carry token as bearer token
+func NewHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(NodesPath, handleNodes)
+	mux.HandleFunc(NodesPath+"/", handleNode)
+	mux.HandleFunc(ConnsPath, handleConns)
+	mux.HandleFunc(ConnsPath+"/", handleConn)
+	mux.HandleFunc(DrainPath, connect.DrainHandler)
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		auth := request.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			klog.Errorf("unauthorized admin request from %s", request.RemoteAddr)
+			http.Error(writer, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		klog.InfoS("admin request", "method", request.Method, "path", request.URL.Path, "remoteAddr", request.RemoteAddr)
+		mux.ServeHTTP(writer, request)
+	})
+}
+
+// GET /admin/nodes
+func handleNodes(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	nodes := []tunnelcontext.NodeInfo{}
+	for _, name := range tunnelcontext.GetContext().GetNodes() {
+		if node := tunnelcontext.GetContext().GetNode(name); node != nil {
+			nodes = append(nodes, node.Info())
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+	writeJSON(writer, nodes)
+}
+
+// GET /admin/nodes/{node}/conns lists the connections of the node, DELETE /admin/nodes/{node} disconnects it
+func handleNode(writer http.ResponseWriter, request *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(request.URL.Path, NodesPath+"/"), "/")
+	parts := strings.Split(path, "/")
+	node := tunnelcontext.GetContext().GetNode(parts[0])
+	if node == nil {
+		http.Error(writer, fmt.Sprintf("node %s is not connected", parts[0]), http.StatusNotFound)
+		return
+	}
+	switch {
+	case len(parts) == 2 && parts[1] == "conns" && request.Method == http.MethodGet:
+		writeJSON(writer, connInfos(node))
+	case len(parts) == 1 && request.Method == http.MethodDelete:
+		klog.InfoS("disconnect node by admin request", "nodeName", node.GetName())
+		node.Send2Node(&proto.StreamMsg{
+			Node:     node.GetName(),
+			Category: util.STREAM,
+			Type:     util.CLOSED,
+		})
+		writer.WriteHeader(http.StatusAccepted)
+	case len(parts) <= 2:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	default:
+		writer.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// GET /admin/conns
+func handleConns(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	conns := []tunnelcontext.ConnInfo{}
+	for _, name := range tunnelcontext.GetContext().GetNodes() {
+		if node := tunnelcontext.GetContext().GetNode(name); node != nil {
+			conns = append(conns, connInfos(node)...)
+		}
+	}
+	writeJSON(writer, conns)
+}
+
+// DELETE /admin/conns/{traceID}
+func handleConn(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodDelete {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	uid := strings.Trim(strings.TrimPrefix(request.URL.Path, ConnsPath+"/"), "/")
+	conn := tunnelcontext.GetContext().GetConn(uid)
+	if conn == nil {
+		http.Error(writer, fmt.Sprintf("connection %s is not found", uid), http.StatusNotFound)
+		return
+	}
+	// the local connection is closed and the peer is notified by the closed message sent by common.Read
+	klog.InfoS("kill connection by admin request", util.STREAM_TRACE_ID, uid)
+	conn.Send2Conn(&proto.StreamMsg{
+		Type:  util.CLOSED,
+		Topic: uid,
+		Data:  []byte("killed by admin request"),
+	})
+	writer.WriteHeader(http.StatusAccepted)
+}
+
+func connInfos(node tunnelcontext.Node) []tunnelcontext.ConnInfo {
+	infos := []tunnelcontext.ConnInfo{}
+	for _, uid := range node.GetBindConns() {
+		conn := tunnelcontext.GetContext().GetConn(uid)
+		if conn == nil {
+			continue
+		}
+		info := conn.Info()
+		if info.Node == "" {
+			info.Node = node.GetName()
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Created.Before(infos[j].Created)
+	})
+	return infos
+}
+
+func writeJSON(writer http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(data)
+}
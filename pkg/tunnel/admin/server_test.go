@@ -0,0 +1,123 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/superedge/superedge/pkg/tunnel/conf"
+	"github.com/superedge/superedge/pkg/tunnel/proxy/modules/stream/streammng/connect"
+	"github.com/superedge/superedge/pkg/tunnel/tunnelcontext"
+	"github.com/superedge/superedge/pkg/tunnel/util"
+)
+
+func TestAdminAPI(t *testing.T) {
+	server := httptest.NewServer(NewHandler("secret"))
+	defer server.Close()
+
+	node := tunnelcontext.GetContext().AddNode("admin-node")
+	defer tunnelcontext.GetContext().RemoveNode("admin-node")
+	node.SetPeer("10.0.0.1:34567", "v0.9.0")
+	conn := tunnelcontext.GetContext().AddConn("trace-1")
+	defer tunnelcontext.GetContext().RemoveConn("trace-1")
+	conn.SetTarget("10.1.0.2:80")
+	conn.SetNode("admin-node", util.HTTP_PROXY)
+	conn.CountIn(10)
+	conn.CountOut(20)
+	node.BindNode("trace-1")
+
+	unauthorized := &Client{Server: server.URL, Token: "wrong"}
+	if _, err := unauthorized.ListNodes(); err == nil {
+		t.Fatal("requests with a wrong token must be rejected")
+	}
+
+	// the token must be sent with the bearer scheme
+	req, err := http.NewRequest(http.MethodGet, server.URL+NodesPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected unauthorized without the bearer scheme, got %s", resp.Status)
+	}
+
+	client := &Client{Server: server.URL, Token: "secret"}
+	nodes, err := client.ListNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].Name != "admin-node" || nodes[0].RemoteAddr != "10.0.0.1:34567" ||
+		nodes[0].Version != "v0.9.0" || nodes[0].Connections != 1 {
+		t.Fatalf("unexpected nodes %+v", nodes)
+	}
+
+	conns, err := client.ListConns("admin-node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conns) != 1 || conns[0].TraceID != "trace-1" || conns[0].Category != util.HTTP_PROXY ||
+		conns[0].Target != "10.1.0.2:80" || conns[0].BytesIn != 10 || conns[0].BytesOut != 20 {
+		t.Fatalf("unexpected conns %+v", conns)
+	}
+	if _, err := client.ListConns("unknown-node"); err == nil {
+		t.Fatal("expected not found error")
+	}
+
+	if err := client.KillConn("trace-1"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-conn.ConnRecv():
+		if msg.Type != util.CLOSED {
+			t.Fatalf("expected closed msg, got %s", msg.Type)
+		}
+	default:
+		t.Fatal("the connection is not closed")
+	}
+
+	if err := client.DisconnectNode("admin-node"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-node.NodeRecv():
+		if msg.Category != util.STREAM || msg.Type != util.CLOSED {
+			t.Fatalf("expected stream closed msg, got %s %s", msg.Category, msg.Type)
+		}
+	default:
+		t.Fatal("the stream of the node is not closed")
+	}
+
+	conf.TunnelConf = &conf.Tunnel{TunnlMode: &conf.TunnelMode{Cloud: &conf.TunnelCloud{
+		Stream: &conf.StreamCloud{Server: &conf.StreamServer{DrainTimeout: 1}},
+	}}}
+	if err := unauthorized.Drain(); err == nil || connect.IsDraining() {
+		t.Fatal("drain requests with a wrong token must be rejected")
+	}
+	if err := client.Drain(); err != nil {
+		t.Fatal(err)
+	}
+	if !connect.IsDraining() {
+		t.Fatal("tunnel-cloud is not draining")
+	}
+}
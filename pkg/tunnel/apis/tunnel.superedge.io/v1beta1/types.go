@@ -0,0 +1,65 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TunnelPortMappingResource is the resource name of TunnelPortMapping
+const TunnelPortMappingResource = "tunnelportmappings"
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// TunnelPortMapping opens a plain TCP listener on the selected edge nodes, the connections accepted by
+// the listener are forwarded through the tunnel to a cloud Service
+type TunnelPortMapping struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec TunnelPortMappingSpec `json:"spec,omitempty"`
+}
+
+type TunnelPortMappingSpec struct {
+	// NodeSelector selects the edge nodes opening the listener, all edge nodes running tunnel-edge are
+	// selected when it is nil
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector,omitempty"`
+	// ListenAddress defaults to 127.0.0.1
+	ListenAddress string           `json:"listenAddress,omitempty"`
+	ListenPort    int32            `json:"listenPort"`
+	Service       ServiceReference `json:"service"`
+	// AllowedSources are the CIDRs of the clients allowed to connect to the listener. When it is empty
+	// only a listener on a loopback address accepts connections
+	AllowedSources []string `json:"allowedSources,omitempty"`
+}
+
+type ServiceReference struct {
+	// Namespace must be empty or the namespace of the TunnelPortMapping, the mappings of other
+	// namespaces are not opened
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Port      int32  `json:"port"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type TunnelPortMappingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []TunnelPortMapping `json:"items"`
+}
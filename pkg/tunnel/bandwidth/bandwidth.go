@@ -0,0 +1,232 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bandwidth
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/superedge/superedge/pkg/site-manager/constant"
+	"github.com/superedge/superedge/pkg/tunnel/conf"
+	"github.com/superedge/superedge/pkg/tunnel/metrics"
+	"github.com/superedge/superedge/pkg/tunnel/util"
+	"golang.org/x/time/rate"
+	"k8s.io/klog/v2"
+)
+
+var ErrQuotaExceeded = errors.New("monthly bandwidth quota exceeded")
+
+var shaper *Shaper
+
+// NodeLabelsFunc returns the labels of the node, it is used to find the NodeUnits of the node
+type NodeLabelsFunc func(node string) map[string]string
+
+type Shaper struct {
+	config     *conf.Bandwidth
+	nodeLabels NodeLabelsFunc
+	buckets    map[string]*bucket
+	lock       sync.Mutex
+}
+
+type bucket struct {
+	limit   *conf.BandwidthLimit
+	limiter *rate.Limiter
+	quota   int64
+	used    int64
+	month   string
+}
+
+// InitBandwidth enables bandwidth shaping with the configuration of the tunnel, nodeLabels can be nil
+// when the NodeUnit limits are not used
+func InitBandwidth(config *conf.Bandwidth, nodeLabels NodeLabelsFunc) {
+	if config == nil {
+		shaper = nil
+		return
+	}
+	shaper = &Shaper{
+		config:     config,
+		nodeLabels: nodeLabels,
+		buckets:    make(map[string]*bucket),
+	}
+	klog.Info("bandwidth shaping of the tunnel is enabled")
+}
+
+// Wait blocks until n bytes of the category may be sent for the node, it returns ErrQuotaExceeded
+// when the monthly quota of the node or the category is used up
+func Wait(ctx context.Context, node, category string, n int) error {
+	if shaper == nil || n == 0 {
+		return nil
+	}
+	return shaper.Wait(ctx, node, category, n)
+}
+
+func (s *Shaper) Wait(ctx context.Context, node, category string, n int) error {
+	nodeBucket, categoryBucket := s.getBuckets(node, category)
+	// the quotas are all checked before any of them is charged, so rejected bytes do not use up the others
+	if err := s.consume(node, category, n, nodeBucket, categoryBucket); err != nil {
+		metrics.QuotaExceeded.WithLabelValues(node, category).Inc()
+		return err
+	}
+	for _, b := range []*bucket{nodeBucket, categoryBucket} {
+		if b == nil {
+			continue
+		}
+		if err := wait(ctx, b.limiter, node, category, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// consume charges n bytes to the node bucket and the category bucket, none of them is charged when the
+// quota of one of them is used up
+func (s *Shaper) consume(node, category string, n int, nodeBucket, categoryBucket *bucket) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	month := time.Now().Format("2006-01")
+	for _, b := range []*bucket{nodeBucket, categoryBucket} {
+		if b == nil {
+			continue
+		}
+		if b.month != month {
+			b.month = month
+			b.used = 0
+		}
+		if b.quota > 0 && b.used+int64(n) > b.quota {
+			return ErrQuotaExceeded
+		}
+	}
+	for _, b := range []*bucket{nodeBucket, categoryBucket} {
+		if b == nil {
+			continue
+		}
+		b.used += int64(n)
+		labelCategory := ""
+		if b == categoryBucket {
+			labelCategory = category
+		}
+		metrics.QuotaUsedBytes.WithLabelValues(node, labelCategory).Set(float64(b.used))
+	}
+	return nil
+}
+
+func wait(ctx context.Context, limiter *rate.Limiter, node, category string, n int) error {
+	if limiter == nil {
+		return nil
+	}
+	start := time.Now()
+	// WaitN rejects n greater than the burst, so large messages are taken in burst sized pieces
+	for remaining := n; remaining > 0; {
+		take := remaining
+		if take > limiter.Burst() {
+			take = limiter.Burst()
+		}
+		if err := limiter.WaitN(ctx, take); err != nil {
+			return err
+		}
+		remaining -= take
+	}
+	if waited := time.Since(start); waited > time.Millisecond {
+		metrics.BandwidthThrottled.WithLabelValues(node, category).Inc()
+		metrics.BandwidthThrottledSeconds.WithLabelValues(node, category).Add(waited.Seconds())
+	}
+	return nil
+}
+
+// getBuckets returns the buckets of the node and the category. The limit of the node is resolved on each call, so
+// the bucket of the node follows the changes of its NodeUnits and keeps the bytes used in the month
+func (s *Shaper) getBuckets(node, category string) (*bucket, *bucket) {
+	nodeLimit := s.nodeLimit(node)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	nodeBucket, ok := s.buckets[node]
+	if !ok || nodeBucket.limit != nodeLimit {
+		if nodeLimit == nil {
+			delete(s.buckets, node)
+			nodeBucket = nil
+		} else {
+			nodeBucket = newBucket(nodeLimit).keepUsage(nodeBucket)
+			s.buckets[node] = nodeBucket
+		}
+	}
+	key := node + "/" + category
+	categoryBucket, ok := s.buckets[key]
+	if !ok {
+		categoryBucket = newBucket(s.config.Category[categoryKey(category)])
+		s.buckets[key] = categoryBucket
+	}
+	return nodeBucket, categoryBucket
+}
+
+// nodeLimit returns the limit of the node. A node in several limited NodeUnits gets the limit of the NodeUnit
+// whose name sorts first, the choice must not change between calls or the bucket of the node would be replaced
+// with a full burst on each message
+func (s *Shaper) nodeLimit(node string) *conf.BandwidthLimit {
+	if limit, ok := s.config.Node[node]; ok {
+		return limit
+	}
+	if s.nodeLabels != nil && len(s.config.NodeUnit) != 0 {
+		var units []string
+		for k, v := range s.nodeLabels(node) {
+			if v != constant.NodeUnitSuperedge {
+				continue
+			}
+			if _, ok := s.config.NodeUnit[k]; ok {
+				units = append(units, k)
+			}
+		}
+		if len(units) != 0 {
+			sort.Strings(units)
+			return s.config.NodeUnit[units[0]]
+		}
+	}
+	return s.config.Default
+}
+
+func newBucket(limit *conf.BandwidthLimit) *bucket {
+	if limit == nil {
+		return nil
+	}
+	b := &bucket{limit: limit, quota: limit.MonthlyQuota}
+	if limit.Rate > 0 {
+		burst := limit.Burst
+		if burst <= 0 {
+			burst = limit.Rate
+		}
+		b.limiter = rate.NewLimiter(rate.Limit(limit.Rate), burst)
+	}
+	return b
+}
+
+// keepUsage carries the bytes used in the month over from the bucket old replaced by b
+func (b *bucket) keepUsage(old *bucket) *bucket {
+	if old != nil {
+		b.used, b.month = old.used, old.month
+	}
+	return b
+}
+
+// categoryKey maps the category of the message to the name of the module used in the configuration
+func categoryKey(category string) string {
+	if category == util.HTTP_PROXY {
+		return "http_proxy"
+	}
+	return category
+}
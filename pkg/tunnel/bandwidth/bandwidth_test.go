@@ -0,0 +1,150 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bandwidth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/superedge/superedge/pkg/site-manager/constant"
+	"github.com/superedge/superedge/pkg/tunnel/conf"
+	"github.com/superedge/superedge/pkg/tunnel/util"
+)
+
+func TestNodeLimit(t *testing.T) {
+	nodeLimit := &conf.BandwidthLimit{Rate: 1}
+	unitLimit := &conf.BandwidthLimit{Rate: 2}
+	defaultLimit := &conf.BandwidthLimit{Rate: 3}
+	InitBandwidth(&conf.Bandwidth{
+		Default:  defaultLimit,
+		Node:     map[string]*conf.BandwidthLimit{"node1": nodeLimit},
+		NodeUnit: map[string]*conf.BandwidthLimit{"unit1": unitLimit},
+	}, func(node string) map[string]string {
+		return map[string]string{"unit1": constant.NodeUnitSuperedge}
+	})
+	defer InitBandwidth(nil, nil)
+
+	cases := map[string]*conf.BandwidthLimit{
+		"node1": nodeLimit,
+		"node2": unitLimit,
+	}
+	for node, want := range cases {
+		if got := shaper.nodeLimit(node); got != want {
+			t.Errorf("node %s got limit %v, want %v", node, got, want)
+		}
+	}
+
+	shaper.nodeLabels = nil
+	if got := shaper.nodeLimit("node2"); got != defaultLimit {
+		t.Errorf("node2 got limit %v, want default limit", got)
+	}
+}
+
+func TestNodeInSeveralUnits(t *testing.T) {
+	unitALimit := &conf.BandwidthLimit{Rate: 1, Burst: 1}
+	unitBLimit := &conf.BandwidthLimit{Rate: 1 << 20}
+	InitBandwidth(&conf.Bandwidth{
+		NodeUnit: map[string]*conf.BandwidthLimit{"unit-a": unitALimit, "unit-b": unitBLimit},
+	}, func(node string) map[string]string {
+		return map[string]string{"unit-b": constant.NodeUnitSuperedge, "unit-a": constant.NodeUnitSuperedge}
+	})
+	defer InitBandwidth(nil, nil)
+
+	nodeBucket, _ := shaper.getBuckets("node1", util.SSH)
+	for i := 0; i < 100; i++ {
+		if got := shaper.nodeLimit("node1"); got != unitALimit {
+			t.Fatalf("got limit %v, want the limit of unit-a", got)
+		}
+		// the bucket must be kept, a new one would start with a full burst
+		if b, _ := shaper.getBuckets("node1", util.SSH); b != nodeBucket {
+			t.Fatalf("the bucket of the node was replaced")
+		}
+	}
+}
+
+func TestQuota(t *testing.T) {
+	InitBandwidth(&conf.Bandwidth{
+		Category: map[string]*conf.BandwidthLimit{"http_proxy": {MonthlyQuota: 10}},
+	}, nil)
+	defer InitBandwidth(nil, nil)
+
+	if err := Wait(context.Background(), "node1", util.HTTP_PROXY, 6); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := Wait(context.Background(), "node1", util.SSH, 6); err != nil {
+		t.Fatalf("the quota of httpProxy must not limit ssh, error: %v", err)
+	}
+	if err := Wait(context.Background(), "node1", util.HTTP_PROXY, 6); err != ErrQuotaExceeded {
+		t.Fatalf("expected quota exceeded, got %v", err)
+	}
+	if err := Wait(context.Background(), "node2", util.HTTP_PROXY, 6); err != nil {
+		t.Fatalf("the quota is counted for each node, error: %v", err)
+	}
+}
+
+func TestRateLimitLargeMessage(t *testing.T) {
+	InitBandwidth(&conf.Bandwidth{
+		Default: &conf.BandwidthLimit{Rate: 1 << 20, Burst: 1024},
+	}, nil)
+	defer InitBandwidth(nil, nil)
+
+	// messages larger than the burst must not be rejected
+	if err := Wait(context.Background(), "node1", util.SSH, 4096); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestQuotaRejectedNotCharged(t *testing.T) {
+	InitBandwidth(&conf.Bandwidth{
+		Default:  &conf.BandwidthLimit{MonthlyQuota: 10},
+		Category: map[string]*conf.BandwidthLimit{"http_proxy": {MonthlyQuota: 4}},
+	}, nil)
+	defer InitBandwidth(nil, nil)
+
+	if err := Wait(context.Background(), "node1", util.HTTP_PROXY, 6); err != ErrQuotaExceeded {
+		t.Fatalf("expected quota exceeded, got %v", err)
+	}
+	// the bytes rejected by the category quota must not use up the quota of the node
+	if err := Wait(context.Background(), "node1", util.SSH, 10); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestNodeLimitChanged(t *testing.T) {
+	unitLimit := &conf.BandwidthLimit{MonthlyQuota: 10}
+	labels := map[string]string{}
+	InitBandwidth(&conf.Bandwidth{
+		Default:  &conf.BandwidthLimit{MonthlyQuota: 100},
+		NodeUnit: map[string]*conf.BandwidthLimit{"unit1": unitLimit},
+	}, func(node string) map[string]string {
+		return labels
+	})
+	defer InitBandwidth(nil, nil)
+
+	if err := Wait(context.Background(), "node1", util.SSH, 8); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// the node joins the NodeUnit, its limit applies with the bytes already used in the month
+	labels = map[string]string{"unit1": constant.NodeUnitSuperedge}
+	if err := Wait(context.Background(), "node1", util.SSH, 8); err != ErrQuotaExceeded {
+		t.Fatalf("expected quota exceeded, got %v", err)
+	}
+	labels = map[string]string{}
+	if err := Wait(context.Background(), "node1", util.SSH, 8); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
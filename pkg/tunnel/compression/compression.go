@@ -0,0 +1,329 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package compression
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/superedge/superedge/pkg/tunnel/conf"
+	"github.com/superedge/superedge/pkg/tunnel/metrics"
+	"github.com/superedge/superedge/pkg/tunnel/proto"
+	"github.com/superedge/superedge/pkg/tunnel/util"
+	"k8s.io/klog/v2"
+)
+
+const (
+	Zstd   = "zstd"
+	Snappy = "snappy"
+
+	// MetadataKey carries the codecs offered by tunnel-edge in the request metadata of the stream and the
+	// codec selected by tunnel-cloud in the response header
+	MetadataKey = "x-tunnel-compression"
+
+	DefaultThreshold = 512
+
+	// the payload of a message never exceeds the max message size of grpc
+	maxDecodedSize = 4 << 20
+	// consecutive payloads compressed worse than minRatio after which compression is disabled for the connection
+	maxPoorFrames = 3
+	minRatio      = 0.9
+	// the states of connections whose closed message was lost are dropped past this limit
+	maxConns = 10000
+)
+
+var DefaultCodecs = []string{Zstd, Snappy}
+
+type Codec interface {
+	Name() string
+	Encode(src []byte) []byte
+	Decode(src []byte) ([]byte, error)
+}
+
+var (
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	codecs      = map[string]Codec{}
+)
+
+func init() {
+	var err error
+	zstdEncoder, err = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		panic(err)
+	}
+	zstdDecoder, err = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecodedSize), zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		panic(err)
+	}
+	codecs[Zstd] = zstdCodec{}
+	codecs[Snappy] = snappyCodec{}
+}
+
+type zstdCodec struct{}
+
+func (zstdCodec) Name() string {
+	return Zstd
+}
+
+func (zstdCodec) Encode(src []byte) []byte {
+	return zstdEncoder.EncodeAll(src, nil)
+}
+
+func (zstdCodec) Decode(src []byte) ([]byte, error) {
+	return zstdDecoder.DecodeAll(src, nil)
+}
+
+type snappyCodec struct{}
+
+func (snappyCodec) Name() string {
+	return Snappy
+}
+
+func (snappyCodec) Encode(src []byte) []byte {
+	return snappy.Encode(nil, src)
+}
+
+func (snappyCodec) Decode(src []byte) ([]byte, error) {
+	n, err := snappy.DecodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxDecodedSize {
+		return nil, fmt.Errorf("decoded length %d exceeds the limit %d", n, maxDecodedSize)
+	}
+	return snappy.Decode(nil, src)
+}
+
+func GetCodec(name string) Codec {
+	return codecs[name]
+}
+
+// Offered returns the codecs tunnel-edge offers to tunnel-cloud
+func Offered(config *conf.Compression) []string {
+	if config == nil || len(config.Codecs) == 0 {
+		return DefaultCodecs
+	}
+	return supported(config.Codecs)
+}
+
+// Negotiate selects the first codec configured on tunnel-cloud which is offered by tunnel-edge, it returns
+// an empty string when compression is disabled on tunnel-cloud or old tunnel-edge offers nothing
+func Negotiate(config *conf.Compression, offered []string) string {
+	if config == nil {
+		return ""
+	}
+	preferred := config.Codecs
+	if len(preferred) == 0 {
+		preferred = DefaultCodecs
+	}
+	offers := make(map[string]bool)
+	for _, o := range offered {
+		for _, name := range strings.Split(o, ",") {
+			offers[strings.TrimSpace(name)] = true
+		}
+	}
+	for _, name := range supported(preferred) {
+		if offers[name] {
+			return name
+		}
+	}
+	return ""
+}
+
+func Threshold(config *conf.Compression) int {
+	if config == nil || config.Threshold <= 0 {
+		return DefaultThreshold
+	}
+	return config.Threshold
+}
+
+func supported(names []string) []string {
+	var ret []string
+	for _, name := range names {
+		if _, ok := codecs[name]; ok {
+			ret = append(ret, name)
+		} else {
+			klog.Warningf("unsupported compression codec %s is ignored", name)
+		}
+	}
+	return ret
+}
+
+// Compressor compresses the payloads of the proxied connections sent through a stream. Compression is
+// decided for every connection, it is disabled for TLS and already compressed traffic.
+type Compressor struct {
+	codec     Codec
+	threshold int
+	conns     map[string]*connState
+	lock      sync.Mutex
+}
+
+type connState struct {
+	disabled  bool
+	poorFrame int
+}
+
+func NewCompressor(codec Codec, threshold int) *Compressor {
+	return &Compressor{
+		codec:     codec,
+		threshold: threshold,
+		conns:     make(map[string]*connState),
+	}
+}
+
+func (c *Compressor) Codec() string {
+	if c == nil {
+		return ""
+	}
+	return c.codec.Name()
+}
+
+// Compress returns the message to send, msg itself is not modified because it may be shared
+func (c *Compressor) Compress(msg *proto.StreamMsg) *proto.StreamMsg {
+	if c == nil || msg.Compression != "" {
+		return msg
+	}
+	if msg.Type != util.TCP_FORWARD {
+		if msg.Type == util.CLOSED {
+			c.Forget(msg.Topic)
+		}
+		return msg
+	}
+	state := c.state(msg.Topic, msg.Data)
+	if state.disabled || len(msg.Data) < c.threshold {
+		return msg
+	}
+	data := c.codec.Encode(msg.Data)
+	metrics.CompressionBytes.WithLabelValues(c.codec.Name(), "before").Add(float64(len(msg.Data)))
+	if float64(len(data)) >= float64(len(msg.Data))*minRatio {
+		c.lock.Lock()
+		state.poorFrame++
+		if state.poorFrame >= maxPoorFrames {
+			state.disabled = true
+			metrics.CompressionDisabled.WithLabelValues("ratio").Inc()
+			klog.V(4).InfoS("compression is disabled for the incompressible connection", util.STREAM_TRACE_ID, msg.Topic)
+		}
+		c.lock.Unlock()
+		if len(data) >= len(msg.Data) {
+			metrics.CompressionBytes.WithLabelValues(c.codec.Name(), "after").Add(float64(len(msg.Data)))
+			return msg
+		}
+	} else {
+		c.lock.Lock()
+		state.poorFrame = 0
+		c.lock.Unlock()
+	}
+	metrics.CompressionBytes.WithLabelValues(c.codec.Name(), "after").Add(float64(len(data)))
+	return &proto.StreamMsg{
+		Node:        msg.Node,
+		Category:    msg.Category,
+		Type:        msg.Type,
+		Topic:       msg.Topic,
+		Data:        data,
+		Addr:        msg.Addr,
+		Compression: c.codec.Name(),
+	}
+}
+
+// Forget drops the state of the connection
+func (c *Compressor) Forget(topic string) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.conns, topic)
+}
+
+func (c *Compressor) state(topic string, first []byte) *connState {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	state, ok := c.conns[topic]
+	if ok {
+		return state
+	}
+	if len(c.conns) >= maxConns {
+		c.conns = make(map[string]*connState)
+	}
+	state = &connState{}
+	if reason := incompressible(first); reason != "" {
+		state.disabled = true
+		metrics.CompressionDisabled.WithLabelValues(reason).Inc()
+		klog.V(4).InfoS("compression is disabled for the connection", "reason", reason, util.STREAM_TRACE_ID, topic)
+	}
+	c.conns[topic] = state
+	return state
+}
+
+var compressedMagics = [][]byte{
+	{0x1f, 0x8b},             // gzip
+	{0x28, 0xb5, 0x2f, 0xfd}, // zstd
+	{0xff, 0x06, 0x00, 0x00, 0x73, 0x4e, 0x61, 0x50, 0x70, 0x59}, // snappy framing
+	{0xfd, 0x37, 0x7a, 0x58, 0x5a, 0x00},                         // xz
+	{0x42, 0x5a, 0x68},                                           // bzip2
+	{0x50, 0x4b, 0x03, 0x04},                                     // zip
+	{0x89, 0x50, 0x4e, 0x47},                                     // png
+	{0xff, 0xd8, 0xff},                                           // jpeg
+}
+
+// incompressible inspects the first payload of a connection, it returns the reason why the connection
+// must not be compressed or an empty string
+func incompressible(data []byte) string {
+	// TLS record header: handshake, alert, change cipher spec or application data with major version 3
+	if len(data) >= 3 && data[0] >= 0x14 && data[0] <= 0x17 && data[1] == 0x03 && data[2] <= 0x04 {
+		return "tls"
+	}
+	for _, magic := range compressedMagics {
+		if bytes.HasPrefix(data, magic) {
+			return "compressed"
+		}
+	}
+	if bytes.HasPrefix(data, []byte("HTTP/1.")) {
+		end := bytes.Index(data, []byte("\r\n\r\n"))
+		if end < 0 {
+			end = len(data)
+		}
+		header := strings.ToLower(string(data[:end]))
+		if strings.Contains(header, "\r\ncontent-encoding:") && !strings.Contains(header, "\r\ncontent-encoding: identity") {
+			return "compressed"
+		}
+	}
+	return ""
+}
+
+// Decompress restores the payload of msg in place
+func Decompress(msg *proto.StreamMsg) error {
+	if msg.Compression == "" {
+		return nil
+	}
+	codec := GetCodec(msg.Compression)
+	if codec == nil {
+		return fmt.Errorf("unsupported compression codec %s", msg.Compression)
+	}
+	data, err := codec.Decode(msg.Data)
+	if err != nil {
+		return fmt.Errorf("failed to decompress the msg with %s, error: %v", msg.Compression, err)
+	}
+	msg.Data = data
+	msg.Compression = ""
+	return nil
+}
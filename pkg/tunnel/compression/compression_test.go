@@ -0,0 +1,101 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package compression
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/superedge/superedge/pkg/tunnel/conf"
+	"github.com/superedge/superedge/pkg/tunnel/proto"
+	"github.com/superedge/superedge/pkg/tunnel/util"
+)
+
+func forwardMsg(topic string, data []byte) *proto.StreamMsg {
+	return &proto.StreamMsg{Node: "node1", Category: util.HTTP_PROXY, Type: util.TCP_FORWARD, Topic: topic, Data: data}
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"level":"info","msg":"request served"}`+"\n"), 100)
+	for _, name := range DefaultCodecs {
+		c := NewCompressor(GetCodec(name), DefaultThreshold)
+		msg := forwardMsg("conn-1", data)
+		out := c.Compress(msg)
+		if out.Compression != name || len(out.Data) >= len(data) {
+			t.Fatalf("%s: expected compressed msg, got codec %q with %d bytes", name, out.Compression, len(out.Data))
+		}
+		if !bytes.Equal(msg.Data, data) {
+			t.Fatalf("%s: the original msg must not be modified", name)
+		}
+		if err := Decompress(out); err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		if out.Compression != "" || !bytes.Equal(out.Data, data) {
+			t.Fatalf("%s: payload is not restored", name)
+		}
+	}
+}
+
+func TestSkipCompression(t *testing.T) {
+	c := NewCompressor(GetCodec(Zstd), 16)
+	if out := c.Compress(forwardMsg("small", []byte("ping"))); out.Compression != "" {
+		t.Fatal("payloads smaller than the threshold must not be compressed")
+	}
+
+	tls := append([]byte{0x16, 0x03, 0x01, 0x02, 0x00}, bytes.Repeat([]byte("a"), 512)...)
+	if out := c.Compress(forwardMsg("tls", tls)); out.Compression != "" {
+		t.Fatal("TLS connections must not be compressed")
+	}
+	if out := c.Compress(forwardMsg("tls", bytes.Repeat([]byte("a"), 512))); out.Compression != "" {
+		t.Fatal("compression must stay disabled for the TLS connection")
+	}
+
+	gzipped := []byte("HTTP/1.1 200 OK\r\nContent-Encoding: gzip\r\n\r\n" + string(bytes.Repeat([]byte("a"), 512)))
+	if out := c.Compress(forwardMsg("gzip", gzipped)); out.Compression != "" {
+		t.Fatal("responses with a content encoding must not be compressed")
+	}
+
+	random := make([]byte, 4096)
+	for i := 0; i < maxPoorFrames; i++ {
+		rand.Read(random)
+		c.Compress(forwardMsg("random", random))
+	}
+	if !c.conns["random"].disabled {
+		t.Fatal("compression must be disabled for incompressible connections")
+	}
+
+	c.Compress(&proto.StreamMsg{Type: util.CLOSED, Topic: "random"})
+	if _, ok := c.conns["random"]; ok {
+		t.Fatal("the state of the closed connection must be dropped")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	if codec := Negotiate(nil, []string{"zstd,snappy"}); codec != "" {
+		t.Fatalf("compression is disabled without configuration, got %s", codec)
+	}
+	if codec := Negotiate(&conf.Compression{}, nil); codec != "" {
+		t.Fatalf("old edges offer nothing, got %s", codec)
+	}
+	if codec := Negotiate(&conf.Compression{}, []string{"snappy, zstd"}); codec != Zstd {
+		t.Fatalf("expected zstd, got %s", codec)
+	}
+	if codec := Negotiate(&conf.Compression{Codecs: []string{"lz4", Snappy}}, []string{"zstd,snappy"}); codec != Snappy {
+		t.Fatalf("expected snappy, got %s", codec)
+	}
+}
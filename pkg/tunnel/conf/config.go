@@ -38,6 +38,49 @@ type TunnelCloud struct {
 	HttpProxy *HttpProxyServer `toml:"http_proxy"`
 	SSH       *SSHServer       `toml:"ssh"`
 	TLS       *TLSConfig       `toml:"tls"`
+	Bandwidth *Bandwidth       `toml:"bandwidth"`
+	Admin     *AdminServer     `toml:"admin"`
+	DNS       *DNSServer       `toml:"dns"`
+	Gateway   *GatewayServer   `toml:"gateway"`
+}
+
+type GatewayServer struct {
+	Port int `toml:"port"`
+	// requests are routed by the hosts <port>.<pod-or-svc>.<node>.edge.<domain>
+	Domain string `toml:"domain"`
+	// https is served when the certificate is configured, it must be valid for *.edge.<domain>
+	Cert   string          `toml:"cert"`
+	Key    string          `toml:"key"`
+	Routes []*GatewayRoute `toml:"routes"`
+}
+
+// GatewayRoute exposes the targets matched by Host, the requests to the targets not matched by any route are rejected
+type GatewayRoute struct {
+	// glob matched against <port>.<pod-or-svc>.<node>, e.g. 3000.grafana.*
+	Host string `toml:"host"`
+	// file holding the bearer token of the route
+	TokenFile string `toml:"token_file"`
+	// file holding the user:password lines of the basic auth of the route
+	BasicAuthFile string `toml:"basic_auth_file"`
+	// scheme of the backends, http or https, defaults to http
+	Scheme string `toml:"scheme"`
+	// skips the verification of the certificates of the https backends, they are dialed by their pod IP
+	InsecureSkipVerify bool `toml:"insecure_skip_verify"`
+}
+
+type DNSServer struct {
+	// serves udp and tcp on the port
+	Port int `toml:"port"`
+	// only the names under the domain are answered when it is configured, e.g. edge.local
+	Domain string `toml:"domain"`
+	// seconds, defaults to 5
+	TTL int `toml:"ttl"`
+}
+
+type AdminServer struct {
+	Port int `toml:"port"`
+	// file holding the bearer token of the admin API
+	TokenFile string `toml:"token_file"`
 }
 
 type HttpsServer struct {
@@ -56,6 +99,10 @@ type StreamServer struct {
 	LogPort      int    `toml:"log_port"`
 	MetricsPort  int    `toml:"metrics_port"`
 	ChannelzAddr string `toml:"channelz_addr"`
+	// seconds to wait for the proxied connections to finish when tunnel-cloud is draining
+	DrainTimeout int `toml:"drain_timeout"`
+	// compression is disabled when it is not configured
+	Compression *Compression `toml:"compression"`
 }
 
 type TLSConfig struct {
@@ -78,8 +125,15 @@ type Register struct {
 }
 
 type TunnelEdge struct {
-	StreamEdge StreamEdge          `toml:"stream"`
-	HttpProxy  HttpProxyEdgeServer `toml:"http_proxy"`
+	StreamEdge  StreamEdge          `toml:"stream"`
+	HttpProxy   HttpProxyEdgeServer `toml:"http_proxy"`
+	Bandwidth   *Bandwidth          `toml:"bandwidth"`
+	PortMapping *PortMapping        `toml:"port_mapping"`
+}
+
+type PortMapping struct {
+	// opens the listeners declared by the TunnelPortMapping resources
+	Enable bool `toml:"enable"`
 }
 
 type HttpProxyEdgeServer struct {
@@ -97,6 +151,58 @@ type StreamClient struct {
 	ServerName   string `toml:"server_name"`
 	LogPort      int    `toml:"log_port"`
 	ChannelzAddr string `toml:"channelz_addr"`
+	// tunnel-cloud endpoints tried after ServerName when it is unhealthy
+	ServerNames []string         `toml:"server_names"`
+	Keepalive   *ClientKeepalive `toml:"keepalive"`
+	Backoff     *ClientBackoff   `toml:"backoff"`
+	// all codecs are offered to tunnel-cloud when it is not configured
+	Compression *Compression `toml:"compression"`
+}
+
+type Compression struct {
+	// codecs in the order of preference, zstd and snappy are supported
+	Codecs []string `toml:"codecs"`
+	// bytes, smaller payloads are not compressed
+	Threshold int `toml:"threshold"`
+}
+
+type ClientKeepalive struct {
+	// seconds, must not be less than the MinTime of the keepalive enforcement policy of tunnel-cloud
+	Time int `toml:"time"`
+	// seconds
+	Timeout int `toml:"timeout"`
+}
+
+type ClientBackoff struct {
+	// seconds
+	BaseDelay int `toml:"base_delay"`
+	// seconds
+	MaxDelay   int     `toml:"max_delay"`
+	Multiplier float64 `toml:"multiplier"`
+	// randomizes the delay by up to this fraction of it
+	Jitter float64 `toml:"jitter"`
+	// seconds to wait for the connection to tunnel-cloud
+	DialTimeout int `toml:"dial_timeout"`
+	// consecutive failures after which the next endpoint is tried
+	FailoverThreshold int `toml:"failover_threshold"`
+}
+
+// Bandwidth limits the data carried by the tunnel, the limit of a node is looked up in
+// Node, then NodeUnit and finally Default, the limits in Category apply to each node separately.
+type Bandwidth struct {
+	Default  *BandwidthLimit            `toml:"default"`
+	Node     map[string]*BandwidthLimit `toml:"node"`
+	NodeUnit map[string]*BandwidthLimit `toml:"nodeunit"`
+	Category map[string]*BandwidthLimit `toml:"category"`
+}
+
+type BandwidthLimit struct {
+	// bytes per second, 0 means unlimited
+	Rate int `toml:"rate"`
+	// bytes, defaults to Rate
+	Burst int `toml:"burst"`
+	// bytes per calendar month, 0 means unlimited
+	MonthlyQuota int64 `toml:"monthly_quota"`
 }
 
 type Config struct {
@@ -0,0 +1,263 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dns
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/superedge/superedge/pkg/tunnel/conf"
+	"github.com/superedge/superedge/pkg/tunnel/metrics"
+	"github.com/superedge/superedge/pkg/tunnel/proxy/modules/stream/streammng/connect"
+	"github.com/superedge/superedge/pkg/tunnel/tunnelcontext"
+	"github.com/superedge/superedge/pkg/tunnel/util"
+	"golang.org/x/net/dns/dnsmessage"
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultTTL = 5
+	// the largest message carried by udp and tcp
+	maxMsgSize = 65535
+	tcpTimeout = 10 * time.Second
+)
+
+// StartServer serves the DNS server of tunnel-cloud, it is disabled when the dns port is not configured
+func StartServer() {
+	config := conf.TunnelConf.TunnlMode.Cloud.DNS
+	if config == nil || config.Port == 0 {
+		klog.Info("dns server is not configured")
+		return
+	}
+	ttl := config.TTL
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	podIP := net.ParseIP(os.Getenv(util.POD_IP_ENV))
+	if podIP == nil {
+		klog.Errorf("failed to start dns server, invalid %s %s", util.POD_IP_ENV, os.Getenv(util.POD_IP_ENV))
+		return
+	}
+	r := NewResolver(config.Domain, podIP, ttl)
+	addr := "0.0.0.0:" + strconv.Itoa(config.Port)
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		klog.Errorf("failed to start dns server err = %v", err)
+		return
+	}
+	ln, err := net.Listen(util.TCP, addr)
+	if err != nil {
+		pc.Close()
+		klog.Errorf("failed to start dns server err = %v", err)
+		return
+	}
+	klog.Infof("dns server listen on %s", addr)
+	go r.serveTCP(ln)
+	r.serveUDP(pc)
+}
+
+// Resolver answers the names of the edge nodes and of the services on them with the address of the
+// tunnel-cloud pod the node is connected to. The nodes connected to this pod are looked up in the
+// tunnel context, so they are resolved as soon as the stream is established, the others in the route cache.
+type Resolver struct {
+	domain string
+	podIP  net.IP
+	ttl    uint32
+}
+
+func NewResolver(domain string, podIP net.IP, ttl int) *Resolver {
+	domain = strings.ToLower(strings.Trim(domain, "."))
+	if domain != "" {
+		domain = "." + domain
+	}
+	return &Resolver{
+		domain: domain,
+		podIP:  podIP,
+		ttl:    uint32(ttl),
+	}
+}
+
+// Lookup resolves <node> and <service>.<namespace>.<node>, followed by the domain when it is configured
+func (r *Resolver) Lookup(name string) (net.IP, dnsmessage.RCode) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if r.domain != "" {
+		if !strings.HasSuffix(name, r.domain) {
+			return nil, dnsmessage.RCodeRefused
+		}
+		name = strings.TrimSuffix(name, r.domain)
+	}
+	if ip := r.nodeAddr(name); ip != nil {
+		return ip, dnsmessage.RCodeSuccess
+	}
+	labels := strings.SplitN(name, ".", 3)
+	if len(labels) == 3 && isEdgeService(labels[0]+"."+labels[1]) {
+		if ip := r.nodeAddr(labels[2]); ip != nil {
+			return ip, dnsmessage.RCodeSuccess
+		}
+	}
+	return nil, dnsmessage.RCodeNameError
+}
+
+func (r *Resolver) nodeAddr(node string) net.IP {
+	if node == "" {
+		return nil
+	}
+	if tunnelcontext.GetContext().NodeIsExist(node) {
+		return r.podIP
+	}
+	if podIP, ok := connect.Route.EdgeNodeAddr(node); ok {
+		return net.ParseIP(podIP)
+	}
+	return nil
+}
+
+func isEdgeService(service string) bool {
+	if _, ok := connect.Route.UserService(service); ok {
+		return true
+	}
+	v, _ := connect.Route.Service(service)
+	return v == util.EDGE
+}
+
+// Answer builds the response of the query, nil is returned when the query can not be parsed
+func (r *Resolver) Answer(query []byte) []byte {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil {
+		klog.V(4).InfoS("failed to parse dns query", "err", err)
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		klog.V(4).InfoS("failed to parse dns question", "err", err)
+		return nil
+	}
+	respHeader := dnsmessage.Header{
+		ID:                 header.ID,
+		Response:           true,
+		OpCode:             header.OpCode,
+		Authoritative:      true,
+		RecursionDesired:   header.RecursionDesired,
+		RecursionAvailable: false,
+	}
+	var ip net.IP
+	if header.OpCode != 0 {
+		respHeader.RCode = dnsmessage.RCodeNotImplemented
+	} else if q.Class != dnsmessage.ClassINET {
+		respHeader.RCode = dnsmessage.RCodeRefused
+	} else {
+		ip, respHeader.RCode = r.Lookup(q.Name.String())
+	}
+	if respHeader.RCode == dnsmessage.RCodeRefused {
+		respHeader.Authoritative = false
+	}
+	metrics.DNSQueries.WithLabelValues(strings.TrimPrefix(q.Type.String(), "Type"), strings.TrimPrefix(respHeader.RCode.String(), "RCode")).Inc()
+
+	b := dnsmessage.NewBuilder(make([]byte, 0, 512), respHeader)
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil
+	}
+	if err := b.Question(q); err != nil {
+		return nil
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil
+	}
+	// other types of existing names are answered without records
+	rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: r.ttl}
+	if ip4 := ip.To4(); ip4 != nil && q.Type == dnsmessage.TypeA {
+		a := dnsmessage.AResource{}
+		copy(a.A[:], ip4)
+		err = b.AResource(rh, a)
+	} else if ip != nil && ip.To4() == nil && q.Type == dnsmessage.TypeAAAA {
+		aaaa := dnsmessage.AAAAResource{}
+		copy(aaaa.AAAA[:], ip.To16())
+		err = b.AAAAResource(rh, aaaa)
+	}
+	if err != nil {
+		klog.ErrorS(err, "failed to build dns answer", "name", q.Name.String())
+		return nil
+	}
+	resp, err := b.Finish()
+	if err != nil {
+		klog.ErrorS(err, "failed to build dns response", "name", q.Name.String())
+		return nil
+	}
+	return resp
+}
+
+func (r *Resolver) serveUDP(pc net.PacketConn) {
+	defer pc.Close()
+	for {
+		buf := make([]byte, maxMsgSize)
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			klog.Errorf("dns server stops reading udp err = %v", err)
+			return
+		}
+		go func() {
+			if resp := r.Answer(buf[:n]); resp != nil {
+				if _, err := pc.WriteTo(resp, addr); err != nil {
+					klog.V(4).InfoS("failed to write dns response", "remoteAddr", addr, "err", err)
+				}
+			}
+		}()
+	}
+}
+
+func (r *Resolver) serveTCP(ln net.Listener) {
+	defer ln.Close()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			klog.Errorf("dns server stops accepting tcp err = %v", err)
+			return
+		}
+		go r.handleTCP(conn)
+	}
+}
+
+// handleTCP reads the queries prefixed with their two bytes length until the client closes the connection
+func (r *Resolver) handleTCP(conn net.Conn) {
+	defer conn.Close()
+	for {
+		conn.SetDeadline(time.Now().Add(tcpTimeout))
+		length := make([]byte, 2)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return
+		}
+		query := make([]byte, binary.BigEndian.Uint16(length))
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+		resp := r.Answer(query)
+		if resp == nil {
+			return
+		}
+		msg := make([]byte, 2, 2+len(resp))
+		binary.BigEndian.PutUint16(msg, uint16(len(resp)))
+		if _, err := conn.Write(append(msg, resp...)); err != nil {
+			return
+		}
+	}
+}
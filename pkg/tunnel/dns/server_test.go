@@ -0,0 +1,108 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/superedge/superedge/pkg/tunnel/proxy/modules/stream/streammng/connect"
+	"github.com/superedge/superedge/pkg/tunnel/tunnelcontext"
+	"github.com/superedge/superedge/pkg/tunnel/util"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func query(t *testing.T, r *Resolver, name string, qtype dnsmessage.Type) dnsmessage.Message {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 42, RecursionDesired: true})
+	b.StartQuestions()
+	b.Question(dnsmessage.Question{Name: dnsmessage.MustNewName(name), Type: qtype, Class: dnsmessage.ClassINET})
+	q, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := r.Answer(q)
+	if resp == nil {
+		t.Fatalf("no response to %s", name)
+	}
+	var msg dnsmessage.Message
+	if err := msg.Unpack(resp); err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID != 42 || !msg.Response {
+		t.Fatalf("unexpected header %+v", msg.Header)
+	}
+	return msg
+}
+
+func TestAnswer(t *testing.T) {
+	tunnelcontext.GetContext().AddNode("edge-1")
+	defer tunnelcontext.GetContext().RemoveNode("edge-1")
+	connect.Route.EdgeNode["edge-2"] = "10.0.0.2"
+	connect.Route.ServicesMap["nginx.default"] = util.EDGE
+	connect.Route.ServicesMap["mysql.default"] = util.CLOUD
+	defer func() {
+		delete(connect.Route.EdgeNode, "edge-2")
+		delete(connect.Route.ServicesMap, "nginx.default")
+		delete(connect.Route.ServicesMap, "mysql.default")
+	}()
+
+	r := NewResolver("edge.local", net.ParseIP("10.0.0.1"), 5)
+	tests := []struct {
+		name  string
+		qtype dnsmessage.Type
+		rcode dnsmessage.RCode
+		addr  string
+	}{
+		{"edge-1.edge.local.", dnsmessage.TypeA, dnsmessage.RCodeSuccess, "10.0.0.1"},
+		{"EDGE-2.edge.local.", dnsmessage.TypeA, dnsmessage.RCodeSuccess, "10.0.0.2"},
+		{"nginx.default.edge-1.edge.local.", dnsmessage.TypeA, dnsmessage.RCodeSuccess, "10.0.0.1"},
+		{"edge-1.edge.local.", dnsmessage.TypeAAAA, dnsmessage.RCodeSuccess, ""},
+		{"mysql.default.edge-1.edge.local.", dnsmessage.TypeA, dnsmessage.RCodeNameError, ""},
+		{"edge-3.edge.local.", dnsmessage.TypeA, dnsmessage.RCodeNameError, ""},
+		{"edge-1.example.com.", dnsmessage.TypeA, dnsmessage.RCodeRefused, ""},
+	}
+	for _, tt := range tests {
+		msg := query(t, r, tt.name, tt.qtype)
+		if msg.RCode != tt.rcode {
+			t.Errorf("%s %s: expected %s, got %s", tt.name, tt.qtype, tt.rcode, msg.RCode)
+			continue
+		}
+		if tt.addr == "" {
+			if len(msg.Answers) != 0 {
+				t.Errorf("%s %s: unexpected answers %v", tt.name, tt.qtype, msg.Answers)
+			}
+			continue
+		}
+		if len(msg.Answers) != 1 {
+			t.Errorf("%s %s: expected 1 answer, got %d", tt.name, tt.qtype, len(msg.Answers))
+			continue
+		}
+		a, ok := msg.Answers[0].Body.(*dnsmessage.AResource)
+		if !ok || net.IP(a.A[:]).String() != tt.addr || msg.Answers[0].Header.TTL != 5 {
+			t.Errorf("%s %s: unexpected answer %v", tt.name, tt.qtype, msg.Answers[0])
+		}
+	}
+
+	r6 := NewResolver("", net.ParseIP("fd00::1"), 5)
+	msg := query(t, r6, "edge-1.", dnsmessage.TypeAAAA)
+	if len(msg.Answers) != 1 {
+		t.Fatalf("expected 1 AAAA answer, got %d", len(msg.Answers))
+	}
+	if aaaa := msg.Answers[0].Body.(*dnsmessage.AAAAResource); net.IP(aaaa.AAAA[:]).String() != "fd00::1" {
+		t.Fatalf("unexpected AAAA answer %v", aaaa)
+	}
+}
@@ -14,9 +14,16 @@ limitations under the License.
 package metrics
 
 import (
+	"sync"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
 var (
 	EdgeNodes = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -28,4 +35,211 @@ var (
 			"kubernetes_pod_name",
 		},
 	)
+
+	NodeConnected = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tunnel_node_connected",
+			Help: "Connection state of the tunnel of the node, 1 while connected, the series is deleted when the node disconnects.",
+		},
+		[]string{"node"},
+	)
+
+	NodeConnectedTimestamp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tunnel_node_connected_timestamp_seconds",
+			Help: "Unix time at which the tunnel of the node was established.",
+		},
+		[]string{"node"},
+	)
+
+	ActiveConnections = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tunnel_active_connections",
+			Help: "Number of proxied connections currently open.",
+		},
+		[]string{"category"},
+	)
+
+	ConnectionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tunnel_connections_total",
+			Help: "Total number of proxied connections.",
+		},
+		[]string{"category"},
+	)
+
+	BytesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tunnel_bytes_total",
+			Help: "Bytes carried by proxied connections, direction out is into the tunnel and in is out of the tunnel.",
+		},
+		[]string{"node", "category", "direction"},
+	)
+
+	ConnectLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "tunnel_connect_duration_seconds",
+			Help:    "Time taken by the peer to establish the connection to the target server.",
+			Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		},
+		[]string{"category"},
+	)
+
+	ConnectFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tunnel_connect_failures_total",
+			Help: "Number of failed connection attempts to the target server.",
+		},
+		[]string{"category", "reason"},
+	)
+
+	HeartbeatRTT = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "tunnel_edge_heartbeat_rtt_seconds",
+			Help:    "Round trip time of the heartbeat between tunnel-edge and tunnel-cloud.",
+			Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		},
+	)
+
+	Reconnects = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "tunnel_edge_reconnects_total",
+			Help: "Number of times tunnel-edge re-established the stream to tunnel-cloud.",
+		},
+	)
+
+	CompressionBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tunnel_compression_bytes_total",
+			Help: "Payload bytes sent through the stream before and after compression.",
+		},
+		[]string{"codec", "stage"},
+	)
+
+	CompressionDisabled = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tunnel_compression_disabled_total",
+			Help: "Number of connections for which compression was disabled.",
+		},
+		[]string{"reason"},
+	)
+
+	DNSQueries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tunnel_dns_queries_total",
+			Help: "Number of queries answered by the DNS server of tunnel-cloud.",
+		},
+		[]string{"type", "rcode"},
+	)
+
+	BandwidthThrottled = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tunnel_bandwidth_throttled_total",
+			Help: "Number of messages delayed by the bandwidth limit.",
+		},
+		[]string{"node", "category"},
+	)
+
+	BandwidthThrottledSeconds = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tunnel_bandwidth_throttled_seconds_total",
+			Help: "Time spent waiting for the bandwidth limit.",
+		},
+		[]string{"node", "category"},
+	)
+
+	QuotaUsedBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tunnel_quota_used_bytes",
+			Help: "Bytes counted against the monthly quota in the current month, category is empty for the quota of the node.",
+		},
+		[]string{"node", "category"},
+	)
+
+	QuotaExceeded = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tunnel_quota_exceeded_total",
+			Help: "Number of messages rejected because the monthly quota is used up.",
+		},
+		[]string{"node", "category"},
+	)
 )
+
+// nodeCategories records the categories each node carried bytes for, so that the
+// tunnel_bytes_total series of a node can be deleted when it disconnects
+var nodeCategories = struct {
+	sync.Mutex
+	categories map[string]map[string]struct{}
+}{categories: make(map[string]map[string]struct{})}
+
+// NodeBytes returns the tunnel_bytes_total counter of the node, category and direction
+func NodeBytes(node, category, direction string) prometheus.Counter {
+	nodeCategories.Lock()
+	categories, ok := nodeCategories.categories[node]
+	if !ok {
+		categories = make(map[string]struct{})
+		nodeCategories.categories[node] = categories
+	}
+	categories[category] = struct{}{}
+	nodeCategories.Unlock()
+	return BytesTotal.WithLabelValues(node, category, direction)
+}
+
+// DeleteNode deletes the per node series of a disconnected node, edge nodes come and go
+// and keeping their series would grow the label cardinality without bound
+func DeleteNode(node string) {
+	NodeConnected.DeleteLabelValues(node)
+	NodeConnectedTimestamp.DeleteLabelValues(node)
+	nodeCategories.Lock()
+	categories := nodeCategories.categories[node]
+	delete(nodeCategories.categories, node)
+	nodeCategories.Unlock()
+	for category := range categories {
+		BytesTotal.DeleteLabelValues(node, category, DirectionIn)
+		BytesTotal.DeleteLabelValues(node, category, DirectionOut)
+	}
+}
+
+// queueCollector reports the number of messages waiting in the channel of each node,
+// the channel holds at most util.MSG_CHANNEL_CAP messages.
+type queueCollector struct {
+	depth    *prometheus.Desc
+	capacity *prometheus.Desc
+	cap      int
+	depths   func() map[string]int
+}
+
+func NewQueueCollector(capacity int, depths func() map[string]int) prometheus.Collector {
+	return &queueCollector{
+		depth: prometheus.NewDesc("tunnel_node_msg_queue_length",
+			"Number of messages waiting in the message channel of the node.", []string{"node"}, nil),
+		capacity: prometheus.NewDesc("tunnel_node_msg_queue_capacity",
+			"Capacity of the message channel of the node.", nil, nil),
+		cap:    capacity,
+		depths: depths,
+	}
+}
+
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.depth
+	ch <- c.capacity
+}
+
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.capacity, prometheus.GaugeValue, float64(c.cap))
+	for node, depth := range c.depths() {
+		ch <- prometheus.MustNewConstMetric(c.depth, prometheus.GaugeValue, float64(depth), node)
+	}
+}
+
+func RegisterCloudMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(EdgeNodes, NodeConnected, NodeConnectedTimestamp, ActiveConnections, ConnectionsTotal,
+		BytesTotal, ConnectLatency, ConnectFailures, BandwidthThrottled, BandwidthThrottledSeconds, QuotaUsedBytes, QuotaExceeded,
+		CompressionBytes, CompressionDisabled, DNSQueries)
+}
+
+func RegisterEdgeMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(NodeConnected, NodeConnectedTimestamp, ActiveConnections, ConnectionsTotal,
+		BytesTotal, ConnectLatency, ConnectFailures, HeartbeatRTT, Reconnects, BandwidthThrottled, BandwidthThrottledSeconds,
+		QuotaUsedBytes, QuotaExceeded, CompressionBytes, CompressionDisabled)
+}
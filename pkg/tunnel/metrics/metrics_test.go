@@ -0,0 +1,45 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDeleteNode(t *testing.T) {
+	NodeConnected.WithLabelValues("node1").Set(1)
+	NodeConnected.WithLabelValues("node2").Set(1)
+	NodeConnectedTimestamp.WithLabelValues("node1").Set(1)
+	NodeBytes("node1", "tcp", DirectionOut).Add(1)
+	NodeBytes("node1", "tcp", DirectionIn).Add(1)
+	NodeBytes("node1", "ssh", DirectionIn).Add(1)
+	NodeBytes("node2", "tcp", DirectionIn).Add(1)
+
+	DeleteNode("node1")
+
+	if n := testutil.CollectAndCount(NodeConnected); n != 1 {
+		t.Errorf("expected the tunnel_node_connected series of node2 only, got %d series", n)
+	}
+	if n := testutil.CollectAndCount(NodeConnectedTimestamp); n != 0 {
+		t.Errorf("expected no tunnel_node_connected_timestamp_seconds series, got %d", n)
+	}
+	if n := testutil.CollectAndCount(BytesTotal); n != 1 {
+		t.Errorf("expected the tunnel_bytes_total series of node2 only, got %d series", n)
+	}
+	if v := testutil.ToFloat64(BytesTotal.WithLabelValues("node2", "tcp", DirectionIn)); v != 1 {
+		t.Errorf("expected the bytes of node2 to be kept, got %v", v)
+	}
+}
@@ -17,11 +17,14 @@ limitations under the License.
 package module
 
 import (
+	"context"
 	"github.com/superedge/superedge/pkg/tunnel/tunnelcontext"
 	"k8s.io/klog/v2"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 )
 
 func LoadModules(mode string) {
@@ -35,12 +38,38 @@ func LoadModules(mode string) {
 
 }
 
-func ShutDown() {
+// ShutDown waits for an os signal, drains the modules within drainTimeout and then cleans them up.
+// A second signal during draining skips the rest of it.
+func ShutDown(drainTimeout time.Duration) {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGILL, syscall.SIGTRAP, syscall.SIGABRT)
 	s := <-c
 	klog.Info("got os signal " + s.String())
 	modules := GetModules()
+	if drainTimeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		go func() {
+			select {
+			case s := <-c:
+				klog.Info("got os signal " + s.String() + " while draining")
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		wg := sync.WaitGroup{}
+		for name, m := range modules {
+			if drainer, ok := m.(Drainer); ok {
+				klog.Info("drain module " + name)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					drainer.Drain(ctx)
+				}()
+			}
+		}
+		wg.Wait()
+		cancel()
+	}
 	for name, module := range modules {
 		klog.Info("cleanup module " + name)
 		module.CleanUp()
@@ -16,12 +16,19 @@ limitations under the License.
 
 package module
 
+import "context"
+
 type Module interface {
 	Name() string
 	Start(mode string)
 	CleanUp()
 }
 
+// Drainer is implemented by the modules which finish their in-flight work before CleanUp is called
+type Drainer interface {
+	Drain(ctx context.Context)
+}
+
 var Modules map[string]Module
 
 func Register(m Module) {
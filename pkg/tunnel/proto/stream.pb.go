@@ -47,6 +47,7 @@ type StreamMsg struct {
 	Topic                string   `protobuf:"bytes,4,opt,name=topic,proto3" json:"topic,omitempty"`
 	Data                 []byte   `protobuf:"bytes,5,opt,name=data,proto3" json:"data,omitempty"`
 	Addr                 string   `protobuf:"bytes,6,opt,name=addr,proto3" json:"addr,omitempty"`
+	Compression          string   `protobuf:"bytes,7,opt,name=compression,proto3" json:"compression,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -119,6 +120,13 @@ func (m *StreamMsg) GetAddr() string {
 	return ""
 }
 
+func (m *StreamMsg) GetCompression() string {
+	if m != nil {
+		return m.Compression
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*StreamMsg)(nil), "proto.StreamMsg")
 }
@@ -126,19 +134,20 @@ func init() {
 func init() { proto.RegisterFile("stream.proto", fileDescriptor_bb17ef3f514bfe54) }
 
 var fileDescriptor_bb17ef3f514bfe54 = []byte{
-	// 182 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x29, 0x2e, 0x29, 0x4a,
-	0x4d, 0xcc, 0xd5, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x05, 0x53, 0x4a, 0xbd, 0x8c, 0x5c,
-	0x9c, 0xc1, 0x60, 0x71, 0xdf, 0xe2, 0x74, 0x21, 0x21, 0x2e, 0x96, 0xbc, 0xfc, 0x94, 0x54, 0x09,
-	0x46, 0x05, 0x46, 0x0d, 0xce, 0x20, 0x30, 0x5b, 0x48, 0x8a, 0x8b, 0x23, 0x39, 0xb1, 0x24, 0x35,
-	0x3d, 0xbf, 0xa8, 0x52, 0x82, 0x09, 0x2c, 0x0e, 0xe7, 0x83, 0xd4, 0x97, 0x54, 0x16, 0xa4, 0x4a,
-	0x30, 0x43, 0xd4, 0x83, 0xd8, 0x42, 0x22, 0x5c, 0xac, 0x25, 0xf9, 0x05, 0x99, 0xc9, 0x12, 0x2c,
-	0x60, 0x41, 0x08, 0x07, 0xa4, 0x32, 0x25, 0xb1, 0x24, 0x51, 0x82, 0x55, 0x81, 0x51, 0x83, 0x27,
-	0x08, 0xcc, 0x06, 0x89, 0x25, 0xa6, 0xa4, 0x14, 0x49, 0xb0, 0x41, 0x74, 0x83, 0xd8, 0x46, 0xae,
-	0x5c, 0x6c, 0x10, 0xe7, 0x08, 0x59, 0x73, 0xf1, 0x87, 0x94, 0xe6, 0xe5, 0xa5, 0xe6, 0x40, 0xf8,
-	0x99, 0x79, 0xe9, 0x42, 0x02, 0x10, 0xb7, 0xeb, 0xc1, 0x1d, 0x2c, 0x85, 0x21, 0xa2, 0xc4, 0xa0,
-	0xc1, 0x68, 0xc0, 0x98, 0xc4, 0x06, 0x16, 0x36, 0x06, 0x04, 0x00, 0x00, 0xff, 0xff, 0x7e, 0x49,
-	0x6f, 0x83, 0xf4, 0x00, 0x00, 0x00,
+	// 198 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x64, 0x8f, 0xb1, 0x6a, 0xc3, 0x30,
+	0x14, 0x45, 0xab, 0xd6, 0x76, 0xeb, 0x57, 0x43, 0xcb, 0xa3, 0x83, 0xf0, 0x64, 0x3c, 0x79, 0x32,
+	0xa5, 0x1d, 0x33, 0x67, 0xcc, 0xe2, 0xe4, 0x07, 0x14, 0x4b, 0x18, 0x43, 0x2c, 0x09, 0x49, 0x19,
+	0xfc, 0x55, 0xf9, 0xc5, 0xa0, 0x27, 0x30, 0x81, 0x4c, 0x3a, 0xf7, 0xe8, 0x0a, 0x74, 0xa1, 0xf2,
+	0xc1, 0x29, 0xb1, 0xf4, 0xd6, 0x99, 0x60, 0x30, 0xa7, 0xa3, 0xbd, 0x31, 0x28, 0x8f, 0xe4, 0x0f,
+	0x7e, 0x42, 0x84, 0x4c, 0x1b, 0xa9, 0x38, 0x6b, 0x58, 0x57, 0x0e, 0xc4, 0x58, 0xc3, 0xc7, 0x28,
+	0x82, 0x9a, 0x8c, 0x5b, 0xf9, 0x2b, 0xf9, 0x2d, 0xc7, 0x7e, 0x58, 0xad, 0xe2, 0x6f, 0xa9, 0x1f,
+	0x19, 0x7f, 0x20, 0x0f, 0xc6, 0xce, 0x23, 0xcf, 0x48, 0xa6, 0x10, 0x9b, 0x52, 0x04, 0xc1, 0xf3,
+	0x86, 0x75, 0xd5, 0x40, 0x1c, 0x9d, 0x90, 0xd2, 0xf1, 0x22, 0xbd, 0x8e, 0x8c, 0x0d, 0x7c, 0x8e,
+	0x66, 0xb1, 0x4e, 0x79, 0x3f, 0x1b, 0xcd, 0xdf, 0xe9, 0xea, 0x51, 0xfd, 0xed, 0xa1, 0x48, 0x1f,
+	0xc6, 0x1d, 0x7c, 0x9d, 0xae, 0x5a, 0xab, 0x4b, 0xca, 0xb3, 0x9e, 0xf0, 0x3b, 0xad, 0xeb, 0xb7,
+	0x49, 0xf5, 0x93, 0x69, 0x5f, 0x3a, 0xf6, 0xcb, 0xce, 0x05, 0xe9, 0xff, 0xfb, 0x00, 0x77, 0x4c,
+	0x0a, 0x52, 0x16, 0x01, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
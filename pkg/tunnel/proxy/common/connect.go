@@ -14,9 +14,12 @@ limitations under the License.
 package common
 
 import (
+	"context"
 	"io"
 	"net"
 
+	"github.com/superedge/superedge/pkg/tunnel/bandwidth"
+	"github.com/superedge/superedge/pkg/tunnel/metrics"
 	"github.com/superedge/superedge/pkg/tunnel/proto"
 	"github.com/superedge/superedge/pkg/tunnel/tunnelcontext"
 	"github.com/superedge/superedge/pkg/tunnel/util"
@@ -28,7 +31,15 @@ const (
 )
 
 func Read(conn net.Conn, node tunnelcontext.Node, category, handleType, uuid string) {
+	metrics.ConnectionsTotal.WithLabelValues(category).Inc()
+	metrics.ActiveConnections.WithLabelValues(category).Inc()
+	bytesOut := metrics.NodeBytes(node.GetName(), category, metrics.DirectionOut)
+	tunnelConn := tunnelcontext.GetContext().GetConn(uuid)
+	if tunnelConn != nil {
+		tunnelConn.SetNode(node.GetName(), category)
+	}
 	defer func() {
+		metrics.ActiveConnections.WithLabelValues(category).Dec()
 		node.UnbindNode(uuid)
 		tunnelcontext.GetContext().RemoveConn(uuid)
 		conn.Close()
@@ -51,6 +62,10 @@ func Read(conn net.Conn, node tunnelcontext.Node, category, handleType, uuid str
 			}
 			return
 		}
+		bytesOut.Add(float64(n))
+		if tunnelConn != nil {
+			tunnelConn.CountOut(n)
+		}
 		node.Send2Node(&proto.StreamMsg{
 			Node:     node.GetName(),
 			Category: category,
@@ -73,7 +88,14 @@ func Write(conn net.Conn, ch tunnelcontext.Conn) {
 				klog.V(2).InfoS("receive a closeMsg", "closeMsg", msg)
 				return
 			}
-			_, err := conn.Write(msg.Data)
+			err := bandwidth.Wait(context.Background(), msg.Node, msg.Category, len(msg.Data))
+			if err != nil {
+				klog.ErrorS(err, "failed to write data", util.STREAM_TRACE_ID, msg.Topic)
+				return
+			}
+			n, err := conn.Write(msg.Data)
+			metrics.NodeBytes(msg.Node, msg.Category, metrics.DirectionIn).Add(float64(n))
+			ch.CountIn(n)
 			if err != nil {
 				klog.ErrorS(err, "failed to write data", util.STREAM_TRACE_ID, msg.Topic)
 				return
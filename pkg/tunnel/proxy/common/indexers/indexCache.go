@@ -146,3 +146,18 @@ func GetServiceByClusterIP(clusterIp string) (*v1.Service, error) {
 	}
 	return svcs[0].(*v1.Service), nil
 }
+
+// Get the pods with the name on the node, pods with the same name may exist in different namespaces
+func GetPodsByNameOnNode(name, nodeName string) ([]*v1.Pod, error) {
+	if podIndexer == nil {
+		return nil, fmt.Errorf("podIndexer is not initialized")
+	}
+	var pods []*v1.Pod
+	for _, obj := range podIndexer.List() {
+		pod, ok := obj.(*v1.Pod)
+		if ok && pod.Name == name && pod.Spec.NodeName == nodeName {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
@@ -38,6 +38,12 @@ const (
 )
 
 func ForwardNode(nodename, host, port, category string, proxyConn net.Conn, ctx context.Context) error {
+	// Edge nodes without tunnel are reached through a gateway node of their nodeunit
+	if routeNode, err := RouteNode(nodename); err == nil {
+		nodename = routeNode
+	} else {
+		klog.V(2).InfoS("failed to find a route to the node", "nodeName", nodename, "err", err, util.STREAM_TRACE_ID, ctx.Value(util.STREAM_TRACE_ID))
+	}
 	node := tunnelcontext.GetContext().GetNode(nodename)
 
 	//Direct forwarding edge nodes
@@ -67,20 +73,17 @@ func ForwardNode(nodename, host, port, category string, proxyConn net.Conn, ctx
 	} else {
 
 		//From tunnel-coredns, query the pods of tunnel-cloud where edge nodes establish long-term connections
-		addr, ok := connect.Route.EdgeNode[nodename]
+		addr, ok := connect.Route.EdgeNodeAddr(nodename)
 
 		//forward cloud node
 		if !ok {
-			_, cloudOk := connect.Route.CloudNode[nodename]
+			_, cloudOk := connect.Route.CloudNodeAddr(nodename)
 			if cloudOk {
 				return DirectDial(host, port, category, proxyConn, ctx)
 			}
 		}
 
 		//forward edge node
-		/*
-			todo Supports sending requests through nodes within nodeunit at the edge
-		*/
 		//You can only proxy once between tunnel-cloud pods
 		if connect.IsEndpointIp(strings.Split(proxyConn.RemoteAddr().String(), ":")[0]) && !net.ParseIP(strings.Split(proxyConn.LocalAddr().String(), ":")[0]).IsLoopback() {
 			klog.InfoS("loop forwarding", "remoteAddr", proxyConn.RemoteAddr().String(), "localAddr", proxyConn.LocalAddr().String(), util.STREAM_TRACE_ID, ctx.Value(util.STREAM_TRACE_ID))
@@ -151,7 +154,7 @@ func GetTargetType(nodeName string) TargetType {
 		return LocalPodType
 	}
 
-	if _, ok := connect.Route.EdgeNode[nodeName]; ok {
+	if _, ok := connect.Route.EdgeNodeAddr(nodeName); ok {
 		return RemotePodType
 	}
 	return DisconnectNodeType
@@ -0,0 +1,106 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/superedge/superedge/pkg/site-manager/constant"
+	"github.com/superedge/superedge/pkg/tunnel/proxy/common/indexers"
+	"github.com/superedge/superedge/pkg/tunnel/proxy/modules/stream/streammng/connect"
+	"github.com/superedge/superedge/pkg/tunnel/util"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+)
+
+// RouteNode returns the node whose tunnel carries the requests to nodeName. It is nodeName itself when
+// the node has a tunnel, otherwise it is a gateway node of the same NodeUnit which dials the target on
+// the local network of the NodeUnit.
+func RouteNode(nodeName string) (string, error) {
+	if GetTargetType(nodeName) != DisconnectNodeType {
+		return nodeName, nil
+	}
+	if _, ok := connect.Route.CloudNodeAddr(nodeName); ok {
+		return nodeName, nil
+	}
+	gateway, err := SelectGateway(nodeName)
+	if err != nil {
+		return "", err
+	}
+	klog.V(2).InfoS("forward request through the gateway node", "nodeName", nodeName, "gateway", gateway)
+	return gateway, nil
+}
+
+// SelectGateway selects a gateway node from the NodeUnits of nodeName. Only the gateways with their own
+// tunnel are selected, the requests are never relayed twice so they cannot loop between edge nodes.
+// The gateways connected to this tunnel-cloud pod are preferred.
+func SelectGateway(nodeName string) (string, error) {
+	if indexers.NodeLister == nil {
+		return "", fmt.Errorf("nodeLister is not initialized")
+	}
+	target, err := indexers.NodeLister.Get(nodeName)
+	if err != nil {
+		return "", err
+	}
+	units := nodeUnits(target)
+	if len(units) == 0 {
+		return "", fmt.Errorf("node %s does not belong to any nodeunit", nodeName)
+	}
+	gateways, err := indexers.NodeLister.List(labels.SelectorFromSet(labels.Set{util.EdgeGatewayLabelKey: "enable"}))
+	if err != nil {
+		return "", err
+	}
+	var local, remote []string
+	for _, gw := range gateways {
+		if gw.Name == nodeName || !shareNodeUnit(gw, units) {
+			continue
+		}
+		switch GetTargetType(gw.Name) {
+		case LocalPodType:
+			local = append(local, gw.Name)
+		case RemotePodType:
+			remote = append(remote, gw.Name)
+		}
+	}
+	if len(local) != 0 {
+		sort.Strings(local)
+		return local[0], nil
+	}
+	if len(remote) != 0 {
+		sort.Strings(remote)
+		return remote[0], nil
+	}
+	return "", fmt.Errorf("no gateway node with a tunnel is found in the nodeunits %v of node %s", units, nodeName)
+}
+
+func nodeUnits(node *v1.Node) []string {
+	var units []string
+	for k, v := range node.Labels {
+		if v == constant.NodeUnitSuperedge {
+			units = append(units, k)
+		}
+	}
+	return units
+}
+
+func shareNodeUnit(node *v1.Node, units []string) bool {
+	for _, unit := range units {
+		if node.Labels[unit] == constant.NodeUnitSuperedge {
+			return true
+		}
+	}
+	return false
+}
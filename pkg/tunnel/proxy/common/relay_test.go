@@ -0,0 +1,77 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"testing"
+
+	"github.com/superedge/superedge/pkg/site-manager/constant"
+	"github.com/superedge/superedge/pkg/tunnel/proxy/common/indexers"
+	"github.com/superedge/superedge/pkg/tunnel/proxy/modules/stream/streammng/connect"
+	"github.com/superedge/superedge/pkg/tunnel/tunnelcontext"
+	"github.com/superedge/superedge/pkg/tunnel/util"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newNode(name string, lbs map[string]string) *v1.Node {
+	return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: lbs}}
+}
+
+func TestRouteNode(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	nodes := []*v1.Node{
+		newNode("target", map[string]string{"unit-a": constant.NodeUnitSuperedge}),
+		newNode("gw-remote", map[string]string{"unit-a": constant.NodeUnitSuperedge, util.EdgeGatewayLabelKey: "enable"}),
+		newNode("gw-local", map[string]string{"unit-a": constant.NodeUnitSuperedge, util.EdgeGatewayLabelKey: "enable"}),
+		newNode("gw-other-unit", map[string]string{"unit-b": constant.NodeUnitSuperedge, util.EdgeGatewayLabelKey: "enable"}),
+		newNode("gw-disconnected", map[string]string{"unit-a": constant.NodeUnitSuperedge, util.EdgeGatewayLabelKey: "enable"}),
+		newNode("lonely", map[string]string{"unit-c": constant.NodeUnitSuperedge}),
+	}
+	for _, n := range nodes {
+		if err := indexer.Add(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	indexers.NodeLister = listersv1.NewNodeLister(indexer)
+	connect.Route.EdgeNode["gw-remote"] = "10.0.0.2"
+	connect.Route.EdgeNode["gw-other-unit"] = "10.0.0.2"
+	defer func() {
+		delete(connect.Route.EdgeNode, "gw-remote")
+		delete(connect.Route.EdgeNode, "gw-other-unit")
+	}()
+
+	gw, err := RouteNode("target")
+	if err != nil || gw != "gw-remote" {
+		t.Fatalf("expected gw-remote, got %s, error: %v", gw, err)
+	}
+
+	tunnelcontext.GetContext().AddNode("gw-local")
+	defer tunnelcontext.GetContext().RemoveNode("gw-local")
+	gw, err = RouteNode("target")
+	if err != nil || gw != "gw-local" {
+		t.Fatalf("the gateway connected to this pod must be preferred, got %s, error: %v", gw, err)
+	}
+
+	gw, err = RouteNode("gw-local")
+	if err != nil || gw != "gw-local" {
+		t.Fatalf("nodes with tunnel must be accessed directly, got %s, error: %v", gw, err)
+	}
+
+	if gw, err = RouteNode("lonely"); err == nil {
+		t.Fatalf("expected no route to node lonely, got %s", gw)
+	}
+}
@@ -208,6 +208,9 @@ func HandleServerConn(proxyConn net.Conn, category string, noAccess func(host st
 		}
 
 		// Forward to edge node
+		if routeNode, err := common.RouteNode(info.nodeName); err == nil {
+			info.nodeName = routeNode
+		}
 		edgeNode := tunnelcontext.GetContext().GetNode(info.nodeName)
 		if edgeNode != nil {
 			conn, err := edgeNode.ConnectNode(category, net.JoinHostPort(info.podIp, info.port), req.Context())
@@ -231,7 +234,7 @@ func HandleServerConn(proxyConn net.Conn, category string, noAccess func(host st
 				return err
 			}
 		} else {
-			tunnelCloudPodIp, ok := connect.Route.EdgeNode[info.nodeName]
+			tunnelCloudPodIp, ok := connect.Route.EdgeNodeAddr(info.nodeName)
 			// Forwarding through tunnel-cloud
 			if ok {
 				remoteConn, err := net.Dial("tcp", common.GetRemoteAddr(category, tunnelCloudPodIp))
@@ -352,7 +355,7 @@ func getForwardInfo(host, port string) (*forwardInfo, bool, error) {
 			}
 
 			// cloud
-			if _, ok := connect.Route.CloudNode[node.Name]; ok {
+			if _, ok := connect.Route.CloudNodeAddr(node.Name); ok {
 				return &forwardInfo{
 					podIp:    interIp,
 					port:     port,
@@ -361,7 +364,16 @@ func getForwardInfo(host, port string) (*forwardInfo, bool, error) {
 			}
 
 			// edge
-			if _, ok := connect.Route.EdgeNode[node.Name]; ok {
+			if _, ok := connect.Route.EdgeNodeAddr(node.Name); ok {
+				return &forwardInfo{
+					podIp:    interIp,
+					port:     port,
+					nodeName: node.Name,
+				}, false, nil
+			}
+
+			// edge nodes without tunnel, forwarded by the gateway node of the nodeunit
+			if _, err := common.SelectGateway(node.Name); err == nil {
 				return &forwardInfo{
 					podIp:    interIp,
 					port:     port,
@@ -429,7 +441,7 @@ func resolvForwardInfo(svc *v1.Service, port string) (*forwardInfo, bool, error)
 	}
 
 	// user services
-	if v, ok := connect.Route.UserServicesMap[fmt.Sprintf("%s.%s", svc.Name, svc.Namespace)]; ok {
+	if v, ok := connect.Route.UserService(fmt.Sprintf("%s.%s", svc.Name, svc.Namespace)); ok {
 		if v == util.CLOUD {
 			return nil, true, nil
 		}
@@ -444,7 +456,7 @@ func resolvForwardInfo(svc *v1.Service, port string) (*forwardInfo, bool, error)
 	}
 
 	// service
-	if v, ok := connect.Route.ServicesMap[fmt.Sprintf("%s.%s", svc.Name, svc.Namespace)]; ok {
+	if v, ok := connect.Route.Service(fmt.Sprintf("%s.%s", svc.Name, svc.Namespace)); ok {
 		if v == util.CLOUD {
 			return nil, true, nil
 		}
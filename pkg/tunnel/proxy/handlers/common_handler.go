@@ -90,6 +90,7 @@ func ConnectingHandler(msg *proto.StreamMsg) error {
 		})
 	}
 	ch := tunnelcontext.GetContext().AddConn(msg.Topic)
+	ch.SetTarget(msg.Addr)
 	node.BindNode(msg.Topic)
 	go common.Read(conn, node, msg.Category, util.TCP_FORWARD, msg.Topic)
 	go common.Write(conn, ch)
@@ -104,6 +104,7 @@ func AccessHandler(msg *proto.StreamMsg) error {
 		// Return 200 status code
 		successMsg(node)
 		remoteCh := tunnelcontext.GetContext().AddConn(msg.GetTopic())
+		remoteCh.SetTarget(targetServer)
 		node.BindNode(msg.GetTopic())
 		go common.Read(remoteConn, node, msg.Category, util.TCP_FORWARD, msg.GetTopic())
 		go common.Write(remoteConn, remoteCh)
@@ -136,6 +137,16 @@ func AccessHandler(msg *proto.StreamMsg) error {
 		return directDial(host, port, msg.GetNode())
 	}
 
+	// the target node without tunnel is reached through the gateway node of its nodeunit
+	if routeNode, err := common.RouteNode(info.nodeName); err == nil {
+		if routeNode != info.nodeName && routeNode == localNode.GetName() {
+			loopErr := fmt.Errorf("the gateway node %s is in the same nodeunit as node %s and must access it directly", routeNode, info.nodeName)
+			klog.ErrorS(loopErr, "loop forwarding", util.STREAM_TRACE_ID, msg.GetTopic())
+			errMsg(localNode, loopErr)
+			return loopErr
+		}
+		info.nodeName = routeNode
+	}
 	switch common.GetTargetType(info.nodeName) {
 	case common.LocalPodType:
 		remoteNode := tunnelcontext.GetContext().GetNode(info.nodeName)
@@ -153,7 +164,7 @@ func AccessHandler(msg *proto.StreamMsg) error {
 
 	case common.RemotePodType:
 		// Establish a connection with the remote proxyServer
-		if remoteIp, ok := connect.Route.EdgeNode[info.nodeName]; ok {
+		if remoteIp, ok := connect.Route.EdgeNodeAddr(info.nodeName); ok {
 			remoteConn, err := common.GetRemoteConn(msg.GetCategory(), remoteIp)
 			if err != nil {
 				errMsg(localNode, err)
@@ -187,6 +198,7 @@ func AccessHandler(msg *proto.StreamMsg) error {
 			// Return 200 status code
 			successMsg(localNode)
 			remoteCh := tunnelcontext.GetContext().AddConn(msg.GetTopic())
+			remoteCh.SetTarget(net.JoinHostPort(info.podIp, info.port))
 			localNode.BindNode(msg.GetTopic())
 			go common.Read(remoteConn, localNode, msg.GetCategory(), util.TCP_FORWARD, msg.GetTopic())
 			go common.Write(remoteConn, remoteCh)
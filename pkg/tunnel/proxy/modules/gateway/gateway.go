@@ -0,0 +1,186 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/superedge/superedge/pkg/tunnel/conf"
+	"github.com/superedge/superedge/pkg/tunnel/module"
+	"github.com/superedge/superedge/pkg/tunnel/proxy/common"
+	"github.com/superedge/superedge/pkg/tunnel/proxy/common/indexers"
+	"github.com/superedge/superedge/pkg/tunnel/tunnelcontext"
+	"github.com/superedge/superedge/pkg/tunnel/util"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+)
+
+const readHeaderTimeout = 10 * time.Second
+
+type Gateway struct {
+	server *http.Server
+}
+
+func (g *Gateway) Name() string {
+	return util.GATEWAY
+}
+
+func (g *Gateway) Start(mode string) {
+	if mode != util.CLOUD {
+		return
+	}
+	config := conf.TunnelConf.TunnlMode.Cloud.Gateway
+	if config == nil || config.Port == 0 {
+		klog.Info("gateway is not configured")
+		return
+	}
+	handler, err := NewProxy(config, Resolve, DialNode)
+	if err != nil {
+		klog.ErrorS(err, "failed to create gateway proxy")
+		return
+	}
+	g.server = &http.Server{
+		Addr:    "0.0.0.0:" + strconv.Itoa(config.Port),
+		Handler: handler,
+		// the gateway is exposed to browsers, slow clients must not hold the connections open
+		ReadHeaderTimeout: readHeaderTimeout,
+		IdleTimeout:       idleConnTimeout,
+	}
+	go func() {
+		klog.Infof("gateway listen on %s", g.server.Addr)
+		if config.Cert != "" {
+			err = g.server.ListenAndServeTLS(config.Cert, config.Key)
+		} else {
+			err = g.server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			klog.Errorf("failed to start gateway err = %v", err)
+		}
+	}()
+}
+
+func (g *Gateway) CleanUp() {
+	if g.server != nil {
+		g.server.Close()
+	}
+	tunnelcontext.GetContext().RemoveModule(util.GATEWAY)
+}
+
+// Resolve looks up the pod with the name on the node first, then the endpoint of the service
+// with the name on the node, the port of a service is its service port
+func Resolve(target *Target) (string, error) {
+	pods, err := indexers.GetPodsByNameOnNode(target.Name, target.Node)
+	if err != nil {
+		return "", err
+	}
+	if len(pods) > 1 {
+		return "", fmt.Errorf("pod %s exists in %d namespaces on node %s", target.Name, len(pods), target.Node)
+	}
+	if len(pods) == 1 {
+		if pods[0].Status.PodIP == "" {
+			return "", fmt.Errorf("pod %s/%s has no ip", pods[0].Namespace, pods[0].Name)
+		}
+		return net.JoinHostPort(pods[0].Status.PodIP, target.Port), nil
+	}
+
+	port, _ := strconv.Atoi(target.Port)
+	svcs, err := indexers.ServiceLister.List(labels.Everything())
+	if err != nil {
+		return "", err
+	}
+	for _, svc := range svcs {
+		if svc.Name != target.Name {
+			continue
+		}
+		for _, sp := range svc.Spec.Ports {
+			if int(sp.Port) != port {
+				continue
+			}
+			eps, err := indexers.EndpointLister.Endpoints(svc.Namespace).Get(svc.Name)
+			if err != nil {
+				continue
+			}
+			for _, subset := range eps.Subsets {
+				for _, epPort := range subset.Ports {
+					if epPort.Name != sp.Name {
+						continue
+					}
+					for _, addr := range subset.Addresses {
+						if addr.NodeName != nil && *addr.NodeName == target.Node {
+							return net.JoinHostPort(addr.IP, strconv.Itoa(int(epPort.Port))), nil
+						}
+					}
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("neither pod nor service %s serving port %s is found on node %s", target.Name, target.Port, target.Node)
+}
+
+// DialNode connects to the address through the tunnel of the node, the connections of other
+// tunnel-cloud replicas are forwarded by them
+func DialNode(ctx context.Context, node, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	// the tunnel connection is kept by the connection pool beyond the request, it is not bound to the context of
+	// the request and it needs its own id
+	traceID := uuid.NewV4().String()
+	forwardCtx := context.WithValue(context.Background(), util.STREAM_TRACE_ID, traceID)
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		if err := common.ForwardNode(node, host, port, util.HTTP_PROXY, server, forwardCtx); err != nil {
+			klog.ErrorS(err, "failed to forward gateway connection", "nodeName", node, "addr", addr, util.STREAM_TRACE_ID, traceID)
+		}
+	}()
+	reader := bufio.NewReader(client)
+	resp, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect %s through node %s: %s", addr, node, resp.Status)
+	}
+	return &bufferedConn{Conn: client, reader: reader}, nil
+}
+
+// bufferedConn reads the data buffered while reading the response of the CONNECT first
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func InitGateway() {
+	module.Register(&Gateway{})
+	klog.Infof("init module: %s success !", util.GATEWAY)
+}
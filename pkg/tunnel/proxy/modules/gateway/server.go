@@ -0,0 +1,310 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/superedge/superedge/pkg/tunnel/conf"
+	"github.com/superedge/superedge/pkg/tunnel/util"
+	"k8s.io/klog/v2"
+)
+
+type (
+	// ResolveFunc returns the address of the pod serving the target
+	ResolveFunc func(target *Target) (string, error)
+	// DialFunc connects to the address through the tunnel of the node
+	DialFunc func(ctx context.Context, node, addr string) (net.Conn, error)
+)
+
+type contextKey string
+
+const (
+	nodeContextKey  contextKey = "gateway-node"
+	routeContextKey contextKey = "gateway-route"
+)
+
+// idleConnTimeout is the time the idle tunnel connections are kept, the transports of the nodes
+// not used for that long are dropped
+const idleConnTimeout = 90 * time.Second
+
+// Target is the backend named by the host <port>.<pod-or-svc>.<node>.edge.<domain>
+type Target struct {
+	Port string
+	Name string
+	Node string
+}
+
+func (t *Target) String() string {
+	return t.Port + "." + t.Name + "." + t.Node
+}
+
+// ParseHost parses the host of the request, the node name may contain dots
+func ParseHost(host, domain string) (*Target, error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	suffix := ".edge." + strings.ToLower(strings.Trim(domain, "."))
+	if !strings.HasSuffix(host, suffix) {
+		return nil, fmt.Errorf("host %s is not under %s", host, strings.TrimPrefix(suffix, "."))
+	}
+	parts := strings.SplitN(strings.TrimSuffix(host, suffix), ".", 3)
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("host %s does not match <port>.<pod-or-svc>.<node>%s", host, suffix)
+	}
+	if port, err := strconv.Atoi(parts[0]); err != nil || port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid port %s of host %s", parts[0], host)
+	}
+	return &Target{Port: parts[0], Name: parts[1], Node: parts[2]}, nil
+}
+
+type route struct {
+	pattern   string
+	token     string
+	users     map[string]string
+	scheme    string
+	tlsConfig *tls.Config
+}
+
+// authorize checks the credentials of the request, the routes without credentials are public
+func (r *route) authorize(req *http.Request) bool {
+	if r.token == "" && len(r.users) == 0 {
+		return true
+	}
+	if r.token != "" {
+		auth := req.Header.Get("Authorization")
+		if strings.HasPrefix(auth, "Bearer ") &&
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(r.token)) == 1 {
+			return true
+		}
+	}
+	if user, password, ok := req.BasicAuth(); ok {
+		if pwd, exist := r.users[user]; exist && subtle.ConstantTimeCompare([]byte(password), []byte(pwd)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Proxy is the reverse proxy routing the requests to the services on the edge nodes by their host
+type Proxy struct {
+	domain  string
+	routes  []*route
+	resolve ResolveFunc
+	dial    DialFunc
+	proxy   *httputil.ReverseProxy
+
+	// the idle connections are pooled by the address of the backend, the same address can be on several
+	// nodes, e.g. hostNetwork pods or overlapping site networks, so each node has its own transport
+	transports     map[transportKey]*nodeTransport
+	transportsLock sync.Mutex
+	lastSweep      time.Time
+}
+
+type transportKey struct {
+	route *route
+	node  string
+}
+
+type nodeTransport struct {
+	*http.Transport
+	lastUsed time.Time
+}
+
+func NewProxy(config *conf.GatewayServer, resolve ResolveFunc, dial DialFunc) (*Proxy, error) {
+	if config.Domain == "" {
+		return nil, fmt.Errorf("the domain of the gateway is not configured")
+	}
+	g := &Proxy{
+		domain:     config.Domain,
+		resolve:    resolve,
+		dial:       dial,
+		transports: make(map[transportKey]*nodeTransport),
+		lastSweep:  time.Now(),
+	}
+	for _, r := range config.Routes {
+		if _, err := path.Match(r.Host, ""); err != nil {
+			return nil, fmt.Errorf("invalid host pattern %s of the gateway route: %v", r.Host, err)
+		}
+		rt := &route{pattern: strings.ToLower(r.Host), scheme: r.Scheme}
+		switch r.Scheme {
+		case "", "http":
+			rt.scheme = "http"
+		case "https":
+			rt.tlsConfig = &tls.Config{InsecureSkipVerify: r.InsecureSkipVerify}
+		default:
+			return nil, fmt.Errorf("invalid scheme %s of the gateway route %s", r.Scheme, r.Host)
+		}
+		if r.TokenFile != "" {
+			tk, err := ioutil.ReadFile(r.TokenFile)
+			if err != nil {
+				return nil, err
+			}
+			rt.token = strings.TrimSpace(string(tk))
+		}
+		if r.BasicAuthFile != "" {
+			users, err := ioutil.ReadFile(r.BasicAuthFile)
+			if err != nil {
+				return nil, err
+			}
+			rt.users = make(map[string]string)
+			for _, line := range strings.Split(string(users), "\n") {
+				if user := strings.SplitN(strings.TrimSpace(line), ":", 2); len(user) == 2 {
+					rt.users[user[0]] = user[1]
+				}
+			}
+		}
+		g.routes = append(g.routes, rt)
+	}
+	g.proxy = &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			if r, ok := req.Context().Value(routeContextKey).(*route); ok {
+				req.URL.Scheme = r.scheme
+			}
+			req.Header.Set("X-Forwarded-Host", req.Host)
+			if req.TLS != nil {
+				req.Header.Set("X-Forwarded-Proto", "https")
+			} else {
+				req.Header.Set("X-Forwarded-Proto", "http")
+			}
+		},
+		Transport: roundTripperFunc(g.roundTrip),
+		// flush immediately for server-sent events
+		FlushInterval: -1,
+		ErrorHandler: func(writer http.ResponseWriter, request *http.Request, err error) {
+			klog.ErrorS(err, "failed to proxy gateway request", "host", request.Host, util.STREAM_TRACE_ID, request.Context().Value(util.STREAM_TRACE_ID))
+			http.Error(writer, err.Error(), http.StatusBadGateway)
+		},
+	}
+	return g, nil
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// roundTrip sends the request with the transport of the node and the route of the request
+func (g *Proxy) roundTrip(req *http.Request) (*http.Response, error) {
+	r, _ := req.Context().Value(routeContextKey).(*route)
+	node, _ := req.Context().Value(nodeContextKey).(string)
+	if r == nil || node == "" {
+		return nil, fmt.Errorf("the gateway request has no route or node")
+	}
+	return g.transport(r, node).RoundTrip(req)
+}
+
+// transport returns the transport of the node and the route, the transports not used for idleConnTimeout
+// are dropped so the nodes which left do not accumulate
+func (g *Proxy) transport(r *route, node string) *http.Transport {
+	g.transportsLock.Lock()
+	defer g.transportsLock.Unlock()
+	now := time.Now()
+	if now.Sub(g.lastSweep) > idleConnTimeout {
+		for k, t := range g.transports {
+			if now.Sub(t.lastUsed) > idleConnTimeout {
+				t.CloseIdleConnections()
+				delete(g.transports, k)
+			}
+		}
+		g.lastSweep = now
+	}
+	key := transportKey{route: r, node: node}
+	t, ok := g.transports[key]
+	if !ok {
+		t = &nodeTransport{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return g.dial(ctx, node, addr)
+			},
+			TLSClientConfig:       r.tlsConfig,
+			MaxIdleConnsPerHost:   4,
+			IdleConnTimeout:       idleConnTimeout,
+			ResponseHeaderTimeout: 60 * time.Second,
+		}}
+		g.transports[key] = t
+	}
+	t.lastUsed = now
+	return t.Transport
+}
+
+// match returns the first route exposing the target
+func (g *Proxy) match(target *Target) *route {
+	for _, r := range g.routes {
+		if ok, _ := path.Match(r.pattern, target.String()); ok {
+			return r
+		}
+	}
+	return nil
+}
+
+func (g *Proxy) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	traceID := uuid.NewV4().String()
+	target, err := ParseHost(request.Host, g.domain)
+	if err != nil {
+		klog.V(2).InfoS("unknown gateway host", "host", request.Host, "err", err, util.STREAM_TRACE_ID, traceID)
+		http.Error(writer, err.Error(), http.StatusNotFound)
+		return
+	}
+	r := g.match(target)
+	if r == nil {
+		klog.InfoS("target is not exposed by the gateway", "target", target, "remoteAddr", request.RemoteAddr, util.STREAM_TRACE_ID, traceID)
+		http.Error(writer, fmt.Sprintf("%s is not exposed", target), http.StatusForbidden)
+		return
+	}
+	if !r.authorize(request) {
+		klog.InfoS("unauthorized gateway request", "target", target, "remoteAddr", request.RemoteAddr, util.STREAM_TRACE_ID, traceID)
+		if len(r.users) != 0 {
+			writer.Header().Set("WWW-Authenticate", `Basic realm="tunnel-gateway"`)
+		}
+		http.Error(writer, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	addr, err := g.resolve(target)
+	if err != nil {
+		klog.ErrorS(err, "failed to resolve gateway target", "target", target, util.STREAM_TRACE_ID, traceID)
+		http.Error(writer, err.Error(), http.StatusBadGateway)
+		return
+	}
+	klog.V(2).InfoS("proxy gateway request", "target", target, "addr", addr, "method", request.Method,
+		"path", request.URL.Path, "remoteAddr", request.RemoteAddr, util.STREAM_TRACE_ID, traceID)
+
+	ctx := context.WithValue(request.Context(), util.STREAM_TRACE_ID, traceID)
+	ctx = context.WithValue(ctx, nodeContextKey, target.Node)
+	ctx = context.WithValue(ctx, routeContextKey, r)
+	out := request.Clone(ctx)
+	out.URL.Host = addr
+	// the credentials of the gateway are not passed to the backend
+	if r.token != "" || len(r.users) != 0 {
+		out.Header.Del("Authorization")
+	}
+	g.proxy.ServeHTTP(writer, out)
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/superedge/superedge/pkg/tunnel/conf"
+)
+
+func TestParseHost(t *testing.T) {
+	tests := []struct {
+		host   string
+		target string
+		err    bool
+	}{
+		{"3000.grafana.edge-1.edge.example.com", "3000.grafana.edge-1", false},
+		{"3000.Grafana.node.a.edge.example.com:443", "3000.grafana.node.a", false},
+		{"grafana.edge-1.edge.example.com", "", true},
+		{"http.grafana.edge-1.edge.example.com", "", true},
+		{"3000.grafana.edge-1.example.com", "", true},
+	}
+	for _, tt := range tests {
+		target, err := ParseHost(tt.host, "example.com")
+		if (err != nil) != tt.err {
+			t.Errorf("%s: unexpected error %v", tt.host, err)
+			continue
+		}
+		if err == nil && target.String() != tt.target {
+			t.Errorf("%s: expected %s, got %s", tt.host, tt.target, target)
+		}
+	}
+}
+
+func TestProxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("Upgrade") == "websocket" {
+			conn, rw, err := writer.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+			rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+			rw.Flush()
+			line, _ := rw.ReadString('\n')
+			rw.WriteString("echo " + line)
+			rw.Flush()
+			return
+		}
+		fmt.Fprintf(writer, "%s %s %s", request.Host, request.Header.Get("X-Forwarded-Host"), request.Header.Get("Authorization"))
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var dialedNode string
+	proxy, err := NewProxy(&conf.GatewayServer{
+		Domain: "example.com",
+		Routes: []*conf.GatewayRoute{
+			{Host: "8080.private.*", TokenFile: tokenFile},
+			{Host: "*.public.edge-1"},
+		},
+	}, func(target *Target) (string, error) {
+		return backend.Listener.Addr().String(), nil
+	}, func(ctx context.Context, node, addr string) (net.Conn, error) {
+		dialedNode = node
+		return net.Dial("tcp", addr)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gateway := httptest.NewServer(proxy)
+	defer gateway.Close()
+
+	get := func(host, token string) (int, string) {
+		req, _ := http.NewRequest(http.MethodGet, gateway.URL, nil)
+		req.Host = host
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if code, _ := get("80.web.edge-1.edge.example.com", ""); code != http.StatusForbidden {
+		t.Errorf("targets not matched by any route must be rejected, got %d", code)
+	}
+	if code, _ := get("8080.private.edge-2.edge.example.com", "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("requests with a wrong token must be rejected, got %d", code)
+	}
+	code, body := get("8080.private.edge-2.edge.example.com", "secret")
+	if code != http.StatusOK || body != "8080.private.edge-2.edge.example.com 8080.private.edge-2.edge.example.com " {
+		t.Errorf("unexpected response %d %q", code, body)
+	}
+	if dialedNode != "edge-2" {
+		t.Errorf("expected to dial through edge-2, got %s", dialedNode)
+	}
+	if code, _ := get("9090.public.edge-1.edge.example.com", ""); code != http.StatusOK {
+		t.Errorf("routes without credentials are public, got %d", code)
+	}
+
+	conn, err := net.Dial("tcp", gateway.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET /ws HTTP/1.1\r\nHost: 9090.public.edge-1.edge.example.com\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected 101, got %d", resp.StatusCode)
+	}
+	fmt.Fprintf(conn, "hello\n")
+	line, err := reader.ReadString('\n')
+	if err != nil || strings.TrimSpace(line) != "echo hello" {
+		t.Fatalf("unexpected websocket data %q %v", line, err)
+	}
+}
+
+func TestProxyTransportPerNode(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		fmt.Fprint(writer, "ok")
+	}))
+	defer backend.Close()
+	tlsBackend := httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		fmt.Fprint(writer, "tls")
+	}))
+	defer tlsBackend.Close()
+
+	var dialedNodes []string
+	proxy, err := NewProxy(&conf.GatewayServer{
+		Domain: "example.com",
+		Routes: []*conf.GatewayRoute{
+			{Host: "443.*", Scheme: "https", InsecureSkipVerify: true},
+			{Host: "*"},
+		},
+	}, func(target *Target) (string, error) {
+		if target.Port == "443" {
+			return tlsBackend.Listener.Addr().String(), nil
+		}
+		// the same address on every node, like a hostNetwork pod
+		return backend.Listener.Addr().String(), nil
+	}, func(ctx context.Context, node, addr string) (net.Conn, error) {
+		dialedNodes = append(dialedNodes, node)
+		return net.Dial("tcp", addr)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gateway := httptest.NewServer(proxy)
+	defer gateway.Close()
+
+	get := func(host string) (int, string) {
+		req, _ := http.NewRequest(http.MethodGet, gateway.URL, nil)
+		req.Host = host
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	for _, host := range []string{"80.web.edge-1.edge.example.com", "80.web.edge-1.edge.example.com", "80.web.edge-2.edge.example.com"} {
+		if code, _ := get(host); code != http.StatusOK {
+			t.Fatalf("%s: unexpected status %d", host, code)
+		}
+	}
+	// the idle connection through edge-1 is reused for edge-1 only
+	if strings.Join(dialedNodes, ",") != "edge-1,edge-2" {
+		t.Errorf("expected to dial through edge-1 and edge-2, got %v", dialedNodes)
+	}
+	if code, body := get("443.web.edge-1.edge.example.com"); code != http.StatusOK || body != "tls" {
+		t.Errorf("unexpected response of the https backend %d %q", code, body)
+	}
+
+	if _, err := NewProxy(&conf.GatewayServer{
+		Domain: "example.com",
+		Routes: []*conf.GatewayRoute{{Host: "*", Scheme: "ftp"}},
+	}, nil, nil); err == nil {
+		t.Error("expected an error for an invalid scheme")
+	}
+}
@@ -28,7 +28,6 @@ import (
 )
 
 type HttpProxy struct {
-	stop chan struct{}
 }
 
 func (h HttpProxy) Name() string {
@@ -89,7 +88,6 @@ func (h HttpProxy) Start(mode string) {
 }
 
 func (h HttpProxy) CleanUp() {
-	h.stop <- struct{}{}
 	tunnelcontext.GetContext().RemoveModule(util.HTTP_PROXY)
 }
 
@@ -0,0 +1,243 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package portmapping
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/superedge/superedge/pkg/tunnel/apis/tunnel.superedge.io/v1beta1"
+	"github.com/superedge/superedge/pkg/tunnel/proxy/common"
+	"github.com/superedge/superedge/pkg/tunnel/tunnelcontext"
+	"github.com/superedge/superedge/pkg/tunnel/util"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+)
+
+const defaultListenAddress = "127.0.0.1"
+
+type (
+	NodeLabelsFunc   func() (map[string]string, error)
+	ListMappingsFunc func() ([]*v1beta1.TunnelPortMapping, error)
+	TunnelNodeFunc   func() tunnelcontext.Node
+)
+
+// Manager keeps a listener open for every TunnelPortMapping selecting the node
+type Manager struct {
+	nodeLabels   NodeLabelsFunc
+	listMappings ListMappingsFunc
+	tunnelNode   TunnelNodeFunc
+	listeners    map[string]*listener
+	lock         sync.Mutex
+}
+
+type listener struct {
+	key     string
+	spec    v1beta1.TunnelPortMappingSpec
+	target  string
+	allowed []*net.IPNet
+	// loopback is true when the listener only accepts the connections of the node itself
+	loopback bool
+	ln       net.Listener
+}
+
+func NewManager(nodeLabels NodeLabelsFunc, listMappings ListMappingsFunc, tunnelNode TunnelNodeFunc) *Manager {
+	return &Manager{
+		nodeLabels:   nodeLabels,
+		listMappings: listMappings,
+		tunnelNode:   tunnelNode,
+		listeners:    make(map[string]*listener),
+	}
+}
+
+// Reconcile opens the listeners of the mappings selecting the node and closes the others. The
+// connections accepted before a listener is closed are not interrupted.
+func (m *Manager) Reconcile() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	nodeLabels, err := m.nodeLabels()
+	if err != nil {
+		klog.ErrorS(err, "failed to get the labels of the node")
+		return
+	}
+	mappings, err := m.listMappings()
+	if err != nil {
+		klog.ErrorS(err, "failed to list TunnelPortMapping")
+		return
+	}
+	desired := make(map[string]*v1beta1.TunnelPortMapping)
+	for _, mapping := range mappings {
+		selected, err := selectsNode(mapping, nodeLabels)
+		if err != nil {
+			klog.ErrorS(err, "invalid nodeSelector", "mapping", key(mapping))
+			continue
+		}
+		if selected {
+			desired[key(mapping)] = mapping
+		}
+	}
+	for k, l := range m.listeners {
+		if mapping, ok := desired[k]; ok && reflect.DeepEqual(mapping.Spec, l.spec) {
+			continue
+		}
+		klog.InfoS("close port mapping listener", "mapping", k, "addr", l.ln.Addr())
+		l.ln.Close()
+		delete(m.listeners, k)
+	}
+	for k, mapping := range desired {
+		if _, ok := m.listeners[k]; ok {
+			continue
+		}
+		l, err := m.listen(mapping)
+		if err != nil {
+			klog.ErrorS(err, "failed to open port mapping listener", "mapping", k)
+			continue
+		}
+		m.listeners[k] = l
+		go m.serve(l)
+	}
+}
+
+// Close closes all listeners
+func (m *Manager) Close() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for k, l := range m.listeners {
+		l.ln.Close()
+		delete(m.listeners, k)
+	}
+}
+
+func (m *Manager) listen(mapping *v1beta1.TunnelPortMapping) (*listener, error) {
+	spec := mapping.Spec
+	if spec.ListenPort <= 0 || spec.ListenPort > 65535 {
+		return nil, fmt.Errorf("invalid listenPort %d", spec.ListenPort)
+	}
+	if spec.Service.Name == "" || spec.Service.Port <= 0 || spec.Service.Port > 65535 {
+		return nil, fmt.Errorf("invalid service %s:%d", spec.Service.Name, spec.Service.Port)
+	}
+	// the target is limited to the namespace of the mapping, otherwise the users of one namespace could expose
+	// the services of any namespace on the edge nodes
+	if spec.Service.Namespace != "" && spec.Service.Namespace != mapping.Namespace {
+		return nil, fmt.Errorf("service namespace %s differs from the namespace %s of the mapping", spec.Service.Namespace, mapping.Namespace)
+	}
+	var allowed []*net.IPNet
+	for _, source := range spec.AllowedSources {
+		_, cidr, err := net.ParseCIDR(source)
+		if err != nil {
+			ip := net.ParseIP(source)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid allowedSources %s", source)
+			}
+			cidr = &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}
+		}
+		allowed = append(allowed, cidr)
+	}
+	addr := spec.ListenAddress
+	if addr == "" {
+		addr = defaultListenAddress
+	}
+	ln, err := net.Listen(util.TCP, net.JoinHostPort(addr, strconv.Itoa(int(spec.ListenPort))))
+	if err != nil {
+		return nil, err
+	}
+	l := &listener{
+		key:     key(mapping),
+		spec:    *mapping.Spec.DeepCopy(),
+		target:  net.JoinHostPort(spec.Service.Name+"."+mapping.Namespace, strconv.Itoa(int(spec.Service.Port))),
+		allowed: allowed,
+		// without allowedSources only the clients of the node itself may connect
+		loopback: ln.Addr().(*net.TCPAddr).IP.IsLoopback(),
+		ln:       ln,
+	}
+	klog.InfoS("open port mapping listener", "mapping", l.key, "addr", ln.Addr(), "target", l.target)
+	return l, nil
+}
+
+func (m *Manager) serve(l *listener) {
+	for {
+		conn, err := l.ln.Accept()
+		if err != nil {
+			klog.V(2).InfoS("port mapping listener stops accepting", "mapping", l.key, "err", err)
+			return
+		}
+		if !l.allow(conn.RemoteAddr()) {
+			klog.InfoS("connection is denied by the port mapping", "mapping", l.key, "remoteAddr", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+		go m.forward(l, conn)
+	}
+}
+
+// forward sends the connection through the tunnel, tunnel-cloud resolves the service by the AccessHandler
+func (m *Manager) forward(l *listener, conn net.Conn) {
+	uid := uuid.NewV4().String()
+	node := m.tunnelNode()
+	if node == nil {
+		klog.InfoS("the tunnel of the node is not established", "mapping", l.key, util.STREAM_TRACE_ID, uid)
+		conn.Close()
+		return
+	}
+	ctx := context.WithValue(context.Background(), util.STREAM_TRACE_ID, uid)
+	tunnelConn, err := node.ConnectNode(util.HTTP_PROXY, l.target, ctx)
+	if err != nil {
+		klog.ErrorS(err, "failed to connect the target of the port mapping", "mapping", l.key, "target", l.target, util.STREAM_TRACE_ID, uid)
+		conn.Close()
+		return
+	}
+	klog.V(2).InfoS("forward port mapping connection", "mapping", l.key, "remoteAddr", conn.RemoteAddr(), "target", l.target, util.STREAM_TRACE_ID, uid)
+	go common.Read(conn, node, util.HTTP_PROXY, util.TCP_FORWARD, uid)
+	common.Write(conn, tunnelConn)
+}
+
+func (l *listener) allow(addr net.Addr) bool {
+	if len(l.allowed) == 0 {
+		return l.loopback
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, cidr := range l.allowed {
+		if cidr.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func selectsNode(mapping *v1beta1.TunnelPortMapping, nodeLabels map[string]string) (bool, error) {
+	if mapping.Spec.NodeSelector == nil {
+		return true, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(mapping.Spec.NodeSelector)
+	if err != nil {
+		return false, err
+	}
+	return selector.Matches(labels.Set(nodeLabels)), nil
+}
+
+func key(mapping *v1beta1.TunnelPortMapping) string {
+	return mapping.Namespace + "/" + mapping.Name
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package portmapping
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/superedge/superedge/pkg/tunnel/apis/tunnel.superedge.io/v1beta1"
+	"github.com/superedge/superedge/pkg/tunnel/tunnelcontext"
+	"github.com/superedge/superedge/pkg/tunnel/util"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func freePort(t *testing.T) int32 {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return int32(ln.Addr().(*net.TCPAddr).Port)
+}
+
+func newMapping(name string, port int32, selector map[string]string, allowed ...string) *v1beta1.TunnelPortMapping {
+	mapping := &v1beta1.TunnelPortMapping{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec: v1beta1.TunnelPortMappingSpec{
+			ListenPort:     port,
+			Service:        v1beta1.ServiceReference{Name: "mysql", Port: 3306},
+			AllowedSources: allowed,
+		},
+	}
+	if selector != nil {
+		mapping.Spec.NodeSelector = &metav1.LabelSelector{MatchLabels: selector}
+	}
+	return mapping
+}
+
+func TestReconcile(t *testing.T) {
+	node := tunnelcontext.GetContext().AddNode("portmapping-node")
+	defer tunnelcontext.GetContext().RemoveNode("portmapping-node")
+
+	allowedPort, deniedPort, otherUnitPort := freePort(t), freePort(t), freePort(t)
+	mappings := []*v1beta1.TunnelPortMapping{
+		newMapping("allowed", allowedPort, map[string]string{"unit": "a"}, "127.0.0.0/8"),
+		newMapping("denied", deniedPort, nil, "10.0.0.0/8"),
+		newMapping("other-unit", otherUnitPort, map[string]string{"unit": "b"}),
+	}
+	m := NewManager(func() (map[string]string, error) {
+		return map[string]string{"unit": "a"}, nil
+	}, func() ([]*v1beta1.TunnelPortMapping, error) {
+		return mappings, nil
+	}, func() tunnelcontext.Node {
+		return node
+	})
+	defer m.Close()
+	m.Reconcile()
+
+	if len(m.listeners) != 2 {
+		t.Fatalf("expected 2 listeners, got %d", len(m.listeners))
+	}
+	if _, ok := m.listeners["default/other-unit"]; ok {
+		t.Fatal("the mapping selecting other nodes must not be opened")
+	}
+
+	conn, err := net.Dial("tcp", addr(deniedPort))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("the connection from a source not allowed must be closed")
+	}
+	conn.Close()
+
+	conn, err = net.Dial("tcp", addr(allowedPort))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	select {
+	case msg := <-node.NodeRecv():
+		if msg.Type != tunnelcontext.CONNECT_REQ || msg.Category != util.HTTP_PROXY || msg.Addr != "mysql.default:3306" {
+			t.Fatalf("unexpected msg %s %s %s", msg.Category, msg.Type, msg.Addr)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the connection is not forwarded through the tunnel")
+	}
+
+	mappings = mappings[:1]
+	m.Reconcile()
+	if len(m.listeners) != 1 {
+		t.Fatalf("the listener of the deleted mapping must be closed, got %d listeners", len(m.listeners))
+	}
+	if _, err := net.Dial("tcp", addr(deniedPort)); err == nil {
+		t.Fatal("the listener of the deleted mapping is still open")
+	}
+}
+
+func TestRestrictions(t *testing.T) {
+	otherNamespacePort, wildcardPort := freePort(t), freePort(t)
+	otherNamespace := newMapping("other-namespace", otherNamespacePort, nil)
+	otherNamespace.Spec.Service.Namespace = "kube-system"
+	wildcard := newMapping("wildcard", wildcardPort, nil)
+	wildcard.Spec.ListenAddress = "0.0.0.0"
+	m := NewManager(func() (map[string]string, error) {
+		return nil, nil
+	}, func() ([]*v1beta1.TunnelPortMapping, error) {
+		return []*v1beta1.TunnelPortMapping{otherNamespace, wildcard}, nil
+	}, func() tunnelcontext.Node {
+		return nil
+	})
+	defer m.Close()
+	m.Reconcile()
+
+	if _, ok := m.listeners["default/other-namespace"]; ok {
+		t.Fatal("the mapping targeting a service of another namespace must not be opened")
+	}
+	l, ok := m.listeners["default/wildcard"]
+	if !ok {
+		t.Fatal("the mapping listening on all addresses is not opened")
+	}
+	if l.allow(&net.TCPAddr{IP: net.ParseIP("10.0.0.1")}) || l.allow(&net.TCPAddr{IP: net.ParseIP("127.0.0.1")}) {
+		t.Fatal("a listener on a non-loopback address without allowedSources must deny all sources")
+	}
+}
+
+func addr(port int32) string {
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port)))
+}
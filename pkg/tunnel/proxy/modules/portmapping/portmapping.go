@@ -0,0 +1,155 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package portmapping
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/superedge/superedge/pkg/tunnel/apis/tunnel.superedge.io/v1beta1"
+	"github.com/superedge/superedge/pkg/tunnel/conf"
+	"github.com/superedge/superedge/pkg/tunnel/module"
+	"github.com/superedge/superedge/pkg/tunnel/tunnelcontext"
+	"github.com/superedge/superedge/pkg/tunnel/util"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+const resyncPeriod = 5 * time.Minute
+
+type PortMapping struct {
+	stop    chan struct{}
+	manager *Manager
+}
+
+func (p *PortMapping) Name() string {
+	return util.PORT_MAPPING
+}
+
+func (p *PortMapping) Start(mode string) {
+	if mode != util.EDGE {
+		return
+	}
+	config := conf.TunnelConf.TunnlMode.EDGE.PortMapping
+	if config == nil || !config.Enable {
+		klog.Info("port mapping is not enabled")
+		return
+	}
+	restConfig, err := rest.InClusterConfig()
+	if err != nil {
+		klog.ErrorS(err, "failed to get InClusterConfig")
+		return
+	}
+	clientSet, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		klog.ErrorS(err, "failed to create kubernetes client")
+		return
+	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		klog.ErrorS(err, "failed to create dynamic client")
+		return
+	}
+	nodeName := os.Getenv(util.NODE_NAME_ENV)
+	p.stop = make(chan struct{})
+
+	nodeInformerFactory := informers.NewSharedInformerFactoryWithOptions(clientSet, resyncPeriod,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", nodeName).String()
+		}))
+	nodeInformer := nodeInformerFactory.Core().V1().Nodes()
+	mappingInformer := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, resyncPeriod).
+		ForResource(v1beta1.SchemeGroupVersion.WithResource(v1beta1.TunnelPortMappingResource))
+
+	p.manager = NewManager(func() (map[string]string, error) {
+		node, err := nodeInformer.Lister().Get(nodeName)
+		if err != nil {
+			return nil, err
+		}
+		return node.Labels, nil
+	}, func() ([]*v1beta1.TunnelPortMapping, error) {
+		objs, err := mappingInformer.Lister().List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		var mappings []*v1beta1.TunnelPortMapping
+		for _, obj := range objs {
+			mapping, err := toPortMapping(obj)
+			if err != nil {
+				klog.ErrorS(err, "failed to convert TunnelPortMapping")
+				continue
+			}
+			mappings = append(mappings, mapping)
+		}
+		return mappings, nil
+	}, func() tunnelcontext.Node {
+		return tunnelcontext.GetContext().GetNode(nodeName)
+	})
+
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { p.manager.Reconcile() },
+		UpdateFunc: func(oldObj, newObj interface{}) { p.manager.Reconcile() },
+		DeleteFunc: func(obj interface{}) { p.manager.Reconcile() },
+	}
+	nodeInformer.Informer().AddEventHandler(handler)
+	mappingInformer.Informer().AddEventHandler(handler)
+	nodeInformerFactory.Start(p.stop)
+	go mappingInformer.Informer().Run(p.stop)
+	go func() {
+		if !cache.WaitForCacheSync(p.stop, nodeInformer.Informer().HasSynced, mappingInformer.Informer().HasSynced) {
+			klog.Error("failed to sync the caches of port mapping")
+			return
+		}
+		p.manager.Reconcile()
+	}()
+}
+
+func (p *PortMapping) CleanUp() {
+	if p.stop != nil {
+		close(p.stop)
+	}
+	if p.manager != nil {
+		p.manager.Close()
+	}
+	tunnelcontext.GetContext().RemoveModule(util.PORT_MAPPING)
+}
+
+func toPortMapping(obj runtime.Object) (*v1beta1.TunnelPortMapping, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object type %T", obj)
+	}
+	mapping := &v1beta1.TunnelPortMapping{}
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), mapping)
+	return mapping, err
+}
+
+func InitPortMapping() {
+	module.Register(&PortMapping{})
+	klog.Infof("init module: %s success !", util.PORT_MAPPING)
+}
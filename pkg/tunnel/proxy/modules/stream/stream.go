@@ -17,7 +17,10 @@ limitations under the License.
 package stream
 
 import (
+	"context"
+	"github.com/superedge/superedge/pkg/tunnel/admin"
 	"github.com/superedge/superedge/pkg/tunnel/conf"
+	"github.com/superedge/superedge/pkg/tunnel/dns"
 	"github.com/superedge/superedge/pkg/tunnel/module"
 	"github.com/superedge/superedge/pkg/tunnel/proxy/modules/stream/streammng/connect"
 	"github.com/superedge/superedge/pkg/tunnel/proxy/modules/stream/streammsg"
@@ -29,6 +32,7 @@ import (
 )
 
 type Stream struct {
+	mode string
 }
 
 func (stream *Stream) Name() string {
@@ -36,13 +40,17 @@ func (stream *Stream) Name() string {
 }
 
 func (stream *Stream) Start(mode string) {
+	stream.mode = mode
 	tunnelcontext.GetContext().RegisterHandler(util.STREAM_HEART_BEAT, util.STREAM, streammsg.HeartbeatHandler)
 	var channelzAddr string
 	if mode == util.CLOUD {
 		go connect.StartServer()
 		go connect.StartMetricsServer()
+		go admin.StartServer()
+		go dns.StartServer()
 		channelzAddr = conf.TunnelConf.TunnlMode.Cloud.Stream.Server.ChannelzAddr
 	} else {
+		tunnelcontext.GetContext().RegisterHandler(util.STREAM_RECONNECT, util.STREAM, connect.ReconnectHandler)
 		go connect.StartSendClient()
 		channelzAddr = conf.TunnelConf.TunnlMode.EDGE.StreamEdge.Client.ChannelzAddr
 	}
@@ -52,6 +60,12 @@ func (stream *Stream) Start(mode string) {
 	go connect.StartChannelzServer(channelzAddr)
 }
 
+func (stream *Stream) Drain(ctx context.Context) {
+	if stream.mode == util.CLOUD {
+		connect.Drain(ctx)
+	}
+}
+
 func (stream *Stream) CleanUp() {
 	tunnelcontext.GetContext().RemoveModule(stream.Name())
 }
@@ -0,0 +1,120 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connect
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/superedge/superedge/pkg/tunnel/conf"
+	"github.com/superedge/superedge/pkg/tunnel/proto"
+	"github.com/superedge/superedge/pkg/tunnel/tunnelcontext"
+	"github.com/superedge/superedge/pkg/tunnel/util"
+	"k8s.io/klog/v2"
+)
+
+const DefaultDrainTimeout = 30 * time.Second
+
+var draining int32
+
+func IsDraining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
+func DrainTimeout() time.Duration {
+	if conf.TunnelConf.TunnlMode.Cloud.Stream.Server.DrainTimeout > 0 {
+		return time.Duration(conf.TunnelConf.TunnlMode.Cloud.Stream.Server.DrainTimeout) * time.Second
+	}
+	return DefaultDrainTimeout
+}
+
+// Drain stops accepting new streams and asks every edge node to reconnect to another tunnel-cloud replica
+// as soon as it has no proxied connection. The edge nodes still connected when ctx is done are asked to
+// reconnect at once. Drain returns when all edge nodes are gone or ctx is done.
+func Drain(ctx context.Context) {
+	atomic.StoreInt32(&draining, 1)
+	klog.InfoS("tunnel-cloud starts draining", "nodes", len(tunnelcontext.GetContext().GetNodes()))
+	notified := make(map[string]bool)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		nodes := tunnelcontext.GetContext().GetNodes()
+		if len(nodes) == 0 {
+			klog.Info("tunnel-cloud drained")
+			return
+		}
+		for _, name := range nodes {
+			node := tunnelcontext.GetContext().GetNode(name)
+			if node == nil || notified[name] || len(node.GetBindConns()) != 0 {
+				continue
+			}
+			sendReconnect(node)
+			notified[name] = true
+		}
+		select {
+		case <-ctx.Done():
+			for _, name := range tunnelcontext.GetContext().GetNodes() {
+				node := tunnelcontext.GetContext().GetNode(name)
+				if node == nil || notified[name] {
+					continue
+				}
+				klog.InfoS("drain timed out, proxied connections of the node are closed", "nodeName", name, "connections", len(node.GetBindConns()))
+				sendReconnect(node)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func sendReconnect(node tunnelcontext.Node) {
+	klog.InfoS("ask the edge node to reconnect to another tunnel-cloud replica", "nodeName", node.GetName())
+	node.Send2Node(&proto.StreamMsg{
+		Node:     node.GetName(),
+		Category: util.STREAM,
+		Type:     util.STREAM_RECONNECT,
+	})
+}
+
+// DrainHandler starts draining tunnel-cloud on POST, the readiness check fails from then on. It is served by the
+// authenticated admin API only
+func DrainHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&draining, 0, 1) {
+		writer.WriteHeader(http.StatusConflict)
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), DrainTimeout())
+		defer cancel()
+		Drain(ctx)
+	}()
+	writer.WriteHeader(http.StatusAccepted)
+}
+
+func ReadyHandler(writer http.ResponseWriter, request *http.Request) {
+	if IsDraining() {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	writer.WriteHeader(http.StatusOK)
+}
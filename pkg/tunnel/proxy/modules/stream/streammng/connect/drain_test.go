@@ -0,0 +1,71 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connect
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/superedge/superedge/pkg/tunnel/tunnelcontext"
+	"github.com/superedge/superedge/pkg/tunnel/util"
+)
+
+func TestDrain(t *testing.T) {
+	defer atomic.StoreInt32(&draining, 0)
+	idle := tunnelcontext.GetContext().AddNode("idle-node")
+	busy := tunnelcontext.GetContext().AddNode("busy-node")
+	busy.BindNode("conn-1")
+	defer tunnelcontext.GetContext().RemoveNode("idle-node")
+	defer tunnelcontext.GetContext().RemoveNode("busy-node")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		Drain(ctx)
+		close(done)
+	}()
+
+	select {
+	case msg := <-idle.NodeRecv():
+		if msg.Type != util.STREAM_RECONNECT {
+			t.Fatalf("expected reconnect msg, got %s", msg.Type)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the idle node is not asked to reconnect")
+	}
+	if !IsDraining() {
+		t.Fatal("tunnel-cloud must be draining")
+	}
+	select {
+	case msg := <-busy.NodeRecv():
+		t.Fatalf("the node with proxied connections must not be asked to reconnect before the deadline, got %s", msg.Type)
+	default:
+	}
+
+	<-done
+	select {
+	case msg := <-busy.NodeRecv():
+		if msg.Type != util.STREAM_RECONNECT {
+			t.Fatalf("expected reconnect msg, got %s", msg.Type)
+		}
+	default:
+		t.Fatal("the busy node is not asked to reconnect after the deadline")
+	}
+}
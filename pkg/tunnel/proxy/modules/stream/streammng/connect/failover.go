@@ -0,0 +1,233 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connect
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/superedge/superedge/pkg/tunnel/conf"
+	"google.golang.org/grpc/backoff"
+)
+
+const (
+	StateConnecting = "connecting"
+	StateConnected  = "connected"
+	StateBackoff    = "backoff"
+)
+
+const (
+	defaultBaseDelay         = time.Second
+	defaultMaxDelay          = 120 * time.Second
+	defaultMultiplier        = 1.6
+	defaultJitter            = 0.2
+	defaultFailoverThreshold = 3
+)
+
+// Backoff computes the delay before reconnecting to tunnel-cloud, the delay grows exponentially with the
+// consecutive failures and is randomized so that the edge nodes do not reconnect at the same time
+type Backoff struct {
+	BaseDelay         time.Duration
+	MaxDelay          time.Duration
+	Multiplier        float64
+	Jitter            float64
+	DialTimeout       time.Duration
+	FailoverThreshold int
+}
+
+func NewBackoff(config *conf.ClientBackoff) *Backoff {
+	bo := &Backoff{
+		BaseDelay:         defaultBaseDelay,
+		MaxDelay:          defaultMaxDelay,
+		Multiplier:        defaultMultiplier,
+		Jitter:            defaultJitter,
+		DialTimeout:       defaultDialTimeout,
+		FailoverThreshold: defaultFailoverThreshold,
+	}
+	if config == nil {
+		return bo
+	}
+	if config.BaseDelay > 0 {
+		bo.BaseDelay = time.Duration(config.BaseDelay) * time.Second
+	}
+	if config.MaxDelay > 0 {
+		bo.MaxDelay = time.Duration(config.MaxDelay) * time.Second
+	}
+	if config.Multiplier >= 1 {
+		bo.Multiplier = config.Multiplier
+	}
+	if config.Jitter > 0 && config.Jitter < 1 {
+		bo.Jitter = config.Jitter
+	}
+	if config.DialTimeout > 0 {
+		bo.DialTimeout = time.Duration(config.DialTimeout) * time.Second
+	}
+	if config.FailoverThreshold > 0 {
+		bo.FailoverThreshold = config.FailoverThreshold
+	}
+	return bo
+}
+
+// Delay returns the delay after the given number of consecutive failures
+func (bo *Backoff) Delay(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	delay := float64(bo.BaseDelay) * math.Pow(bo.Multiplier, float64(failures-1))
+	if delay > float64(bo.MaxDelay) {
+		delay = float64(bo.MaxDelay)
+	}
+	delay *= 1 + bo.Jitter*(rand.Float64()*2-1)
+	return time.Duration(delay)
+}
+
+// GrpcConfig returns the backoff used by grpc between the connection attempts of a dial
+func (bo *Backoff) GrpcConfig() backoff.Config {
+	return backoff.Config{
+		BaseDelay:  bo.BaseDelay,
+		Multiplier: bo.Multiplier,
+		Jitter:     bo.Jitter,
+		MaxDelay:   bo.MaxDelay,
+	}
+}
+
+// Endpoints tracks the consecutive failures of the tunnel-cloud endpoints
+type Endpoints struct {
+	lock      sync.Mutex
+	names     []string
+	failures  map[string]int
+	threshold int
+	next      int
+}
+
+func NewEndpoints(names []string, threshold int) *Endpoints {
+	eps := &Endpoints{
+		failures:  make(map[string]int),
+		threshold: threshold,
+	}
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if _, ok := eps.failures[name]; ok {
+			continue
+		}
+		eps.names = append(eps.names, name)
+		eps.failures[name] = 0
+	}
+	return eps
+}
+
+// Pick returns the endpoint with the fewest consecutive failures, the endpoints with the same number of
+// failures are picked in turn
+func (eps *Endpoints) Pick() string {
+	eps.lock.Lock()
+	defer eps.lock.Unlock()
+	return eps.pick()
+}
+
+// Next returns the endpoint to connect to after current failed, current is kept until it is unhealthy
+func (eps *Endpoints) Next(current string) string {
+	eps.lock.Lock()
+	defer eps.lock.Unlock()
+	if current != "" && !eps.unhealthy(current) {
+		return current
+	}
+	return eps.pick()
+}
+
+func (eps *Endpoints) pick() string {
+	if len(eps.names) == 0 {
+		return ""
+	}
+	best := -1
+	for i := 0; i < len(eps.names); i++ {
+		idx := (eps.next + i) % len(eps.names)
+		if best == -1 || eps.failures[eps.names[idx]] < eps.failures[eps.names[best]] {
+			best = idx
+		}
+	}
+	eps.next = (best + 1) % len(eps.names)
+	return eps.names[best]
+}
+
+func (eps *Endpoints) Failed(name string) int {
+	eps.lock.Lock()
+	defer eps.lock.Unlock()
+	eps.failures[name]++
+	return eps.failures[name]
+}
+
+func (eps *Endpoints) Succeeded(name string) {
+	eps.lock.Lock()
+	defer eps.lock.Unlock()
+	eps.failures[name] = 0
+}
+
+func (eps *Endpoints) Failures(name string) int {
+	eps.lock.Lock()
+	defer eps.lock.Unlock()
+	return eps.failures[name]
+}
+
+// Unhealthy reports whether the endpoint failed too many times in a row and another endpoint is available
+func (eps *Endpoints) Unhealthy(name string) bool {
+	eps.lock.Lock()
+	defer eps.lock.Unlock()
+	return eps.unhealthy(name)
+}
+
+func (eps *Endpoints) unhealthy(name string) bool {
+	return len(eps.names) > 1 && eps.failures[name] > 0 && eps.failures[name]%eps.threshold == 0
+}
+
+type ConnectionStatus struct {
+	Endpoint  string    `json:"endpoint"`
+	State     string    `json:"state"`
+	GrpcState string    `json:"grpcState,omitempty"`
+	Since     time.Time `json:"since"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+type connectionState struct {
+	lock   sync.RWMutex
+	status ConnectionStatus
+}
+
+// ClientState is the state of the connection of tunnel-edge to tunnel-cloud
+var ClientState = &connectionState{status: ConnectionStatus{State: StateConnecting, Since: time.Now()}}
+
+func (s *connectionState) Set(endpoint, state string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.status.Endpoint != endpoint || s.status.State != state {
+		s.status.Since = time.Now()
+	}
+	s.status.Endpoint = endpoint
+	s.status.State = state
+	if err != nil {
+		s.status.LastError = err.Error()
+	}
+}
+
+func (s *connectionState) Get() ConnectionStatus {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.status
+}
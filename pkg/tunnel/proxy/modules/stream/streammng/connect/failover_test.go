@@ -0,0 +1,88 @@
+/*
+Copyright 2020 The SuperEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connect
+
+import (
+	"testing"
+	"time"
+
+	"github.com/superedge/superedge/pkg/tunnel/conf"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	bo := NewBackoff(&conf.ClientBackoff{BaseDelay: 1, MaxDelay: 10, Multiplier: 2, Jitter: 0.5})
+	if d := bo.Delay(0); d != 0 {
+		t.Fatalf("expected no delay without failures, got %s", d)
+	}
+	cases := map[int]time.Duration{1: time.Second, 3: 4 * time.Second, 10: 10 * time.Second}
+	for failures, want := range cases {
+		for i := 0; i < 100; i++ {
+			d := bo.Delay(failures)
+			if d < want/2 || d > want*3/2 {
+				t.Fatalf("delay after %d failures is %s, want %s ± 50%%", failures, d, want)
+			}
+		}
+	}
+}
+
+func TestEndpointsFailover(t *testing.T) {
+	eps := NewEndpoints([]string{"a:9000", "b:9000", "a:9000", ""}, 2)
+	if len(eps.names) != 2 {
+		t.Fatalf("expected 2 endpoints, got %v", eps.names)
+	}
+	if ep := eps.Pick(); ep != "a:9000" {
+		t.Fatalf("expected a:9000, got %s", ep)
+	}
+	eps.Failed("a:9000")
+	if eps.Unhealthy("a:9000") {
+		t.Fatal("a:9000 must not be unhealthy after one failure")
+	}
+	eps.Failed("a:9000")
+	if !eps.Unhealthy("a:9000") {
+		t.Fatal("a:9000 must be unhealthy after reaching the threshold")
+	}
+	if ep := eps.Pick(); ep != "b:9000" {
+		t.Fatalf("expected failover to b:9000, got %s", ep)
+	}
+	eps.Failed("b:9000")
+	eps.Failed("b:9000")
+	eps.Failed("b:9000")
+	if ep := eps.Pick(); ep != "a:9000" {
+		t.Fatalf("expected a:9000 with fewer failures, got %s", ep)
+	}
+	eps.Succeeded("b:9000")
+	if ep := eps.Pick(); ep != "b:9000" {
+		t.Fatalf("expected b:9000 after success, got %s", ep)
+	}
+
+	// the endpoint is kept after a failed dial until the threshold is reached
+	eps = NewEndpoints([]string{"a:9000", "b:9000"}, 2)
+	eps.Failed("a:9000")
+	if ep := eps.Next("a:9000"); ep != "a:9000" {
+		t.Fatalf("expected a:9000 below the threshold, got %s", ep)
+	}
+	eps.Failed("a:9000")
+	if ep := eps.Next("a:9000"); ep != "b:9000" {
+		t.Fatalf("expected failover to b:9000, got %s", ep)
+	}
+
+	single := NewEndpoints([]string{"a:9000"}, 1)
+	single.Failed("a:9000")
+	if single.Unhealthy("a:9000") {
+		t.Fatal("the only endpoint can not fail over")
+	}
+}
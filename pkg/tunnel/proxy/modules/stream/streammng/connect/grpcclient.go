@@ -18,13 +18,18 @@ package connect
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/superedge/superedge/pkg/tunnel/conf"
+	"github.com/superedge/superedge/pkg/tunnel/metrics"
 	"github.com/superedge/superedge/pkg/tunnel/proto"
 	stream2 "github.com/superedge/superedge/pkg/tunnel/proxy/modules/stream/streammng/stream"
+	"github.com/superedge/superedge/pkg/tunnel/tunnelcontext"
 	"github.com/superedge/superedge/pkg/tunnel/util"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/connectivity"
@@ -33,67 +38,179 @@ import (
 	"k8s.io/klog/v2"
 )
 
-var kacp = keepalive.ClientParameters{
-	Time:                10 * time.Millisecond,
-	Timeout:             time.Second,
-	PermitWithoutStream: true,
-}
+const (
+	defaultKeepaliveTime    = 30 * time.Second
+	defaultKeepaliveTimeout = 10 * time.Second
+	defaultDialTimeout      = 30 * time.Second
+	// a stream lasting longer than this resets the backoff
+	stableStreamDuration = 30 * time.Second
+)
 
-var streamConn *grpc.ClientConn
+// the connection to tunnel-cloud, it holds a *grpc.ClientConn and is read by the health check
+var streamConn atomic.Value
 
-func StartClient() (*grpc.ClientConn, error) {
+// set by ReconnectHandler, the connection to tunnel-cloud is re-established when the stream ends
+var reconnect int32
+
+func keepaliveParams() keepalive.ClientParameters {
+	kacp := keepalive.ClientParameters{
+		Time:                defaultKeepaliveTime,
+		Timeout:             defaultKeepaliveTimeout,
+		PermitWithoutStream: true,
+	}
+	if ka := conf.TunnelConf.TunnlMode.EDGE.StreamEdge.Client.Keepalive; ka != nil {
+		if ka.Time > 0 {
+			kacp.Time = time.Duration(ka.Time) * time.Second
+		}
+		if ka.Timeout > 0 {
+			kacp.Timeout = time.Duration(ka.Timeout) * time.Second
+		}
+	}
+	return kacp
+}
+
+func StartClient(serverName string, bo *Backoff) (*grpc.ClientConn, error) {
 	creds, err := credentials.NewClientTLSFromFile(util.TunnelEdgeCAPath, conf.TunnelConf.TunnlMode.EDGE.StreamEdge.Client.Dns)
 	if err != nil {
 		klog.ErrorS(err, "failed to load credentials")
 		return nil, err
 	}
-	opts := []grpc.DialOption{grpc.WithKeepaliveParams(kacp), grpc.WithStreamInterceptor(ClientStreamInterceptor), grpc.WithTransportCredentials(creds), grpc.WithConnectParams(grpc.ConnectParams{
-		MinConnectTimeout: 60 * time.Second,
+	opts := []grpc.DialOption{grpc.WithKeepaliveParams(keepaliveParams()), grpc.WithStreamInterceptor(ClientStreamInterceptor), grpc.WithTransportCredentials(creds), grpc.WithConnectParams(grpc.ConnectParams{
+		Backoff:           bo.GrpcConfig(),
+		MinConnectTimeout: bo.DialTimeout,
 	}), grpc.WithBlock()}
-	conn, err := grpc.Dial(conf.TunnelConf.TunnlMode.EDGE.StreamEdge.Client.ServerName, opts...)
+	ctx, cancel := context.WithTimeout(context.Background(), bo.DialTimeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, serverName, opts...)
 	if err != nil {
-		klog.Error("edge start client fail !")
+		klog.ErrorS(err, "edge start client fail !", "serverName", serverName)
 		return nil, err
 	}
 	return conn, nil
 }
 
 func StartSendClient() {
-	conn, err := StartClient()
-	if err != nil {
-		klog.ErrorS(err, "edge start client error !")
-		os.Exit(1)
-	}
-	defer conn.Close()
-	streamConn = conn
+	client := conf.TunnelConf.TunnlMode.EDGE.StreamEdge.Client
+	bo := NewBackoff(client.Backoff)
+	endpoints := NewEndpoints(append([]string{client.ServerName}, client.ServerNames...), bo.FailoverThreshold)
+	connected := false
+	serverName := ""
 	for {
-		if conn.GetState() == connectivity.Ready {
-			cli := proto.NewStreamClient(conn)
-			stream2.Send(cli, context.Background())
+		if serverName == "" {
+			serverName = endpoints.Pick()
+		}
+		ClientState.Set(serverName, StateConnecting, nil)
+		conn, err := StartClient(serverName, bo)
+		if err != nil {
+			failures := endpoints.Failed(serverName)
+			delay := bo.Delay(failures)
+			ClientState.Set(serverName, StateBackoff, err)
+			klog.InfoS("failed to connect to tunnel-cloud, retry later", "serverName", serverName, "failures", failures, "delay", delay)
+			time.Sleep(delay)
+			if next := endpoints.Next(serverName); next != serverName {
+				klog.InfoS("tunnel-cloud endpoint is unhealthy, fail over", "serverName", serverName, "next", next)
+				serverName = next
+			}
+			continue
 		}
-		time.Sleep(1 * time.Second)
+		streamConn.Store(conn)
+		for {
+			var err error
+			if conn.GetState() == connectivity.Ready {
+				if connected {
+					metrics.Reconnects.Inc()
+				}
+				connected = true
+				ClientState.Set(serverName, StateConnected, nil)
+				start := time.Now()
+				cli := proto.NewStreamClient(conn)
+				stream2.Send(cli, context.Background())
+				if time.Since(start) < stableStreamDuration {
+					err = fmt.Errorf("stream to tunnel-cloud closed after %s", time.Since(start).Round(time.Second))
+				}
+			} else if !waitForReady(conn, bo.DialTimeout) {
+				err = fmt.Errorf("connection to tunnel-cloud is %s", conn.GetState())
+			}
+			if atomic.CompareAndSwapInt32(&reconnect, 1, 0) {
+				// a new connection is balanced to another tunnel-cloud replica
+				klog.InfoS("reconnect to tunnel-cloud", "serverName", serverName)
+				break
+			}
+			if err == nil {
+				endpoints.Succeeded(serverName)
+				continue
+			}
+			failures := endpoints.Failed(serverName)
+			delay := bo.Delay(failures)
+			ClientState.Set(serverName, StateBackoff, err)
+			klog.InfoS("connection to tunnel-cloud failed, retry later", "serverName", serverName, "failures", failures, "delay", delay, "err", err)
+			time.Sleep(delay)
+			if endpoints.Unhealthy(serverName) {
+				klog.InfoS("tunnel-cloud endpoint is unhealthy, fail over", "serverName", serverName)
+				break
+			}
+			ClientState.Set(serverName, StateConnecting, nil)
+		}
+		conn.Close()
+		serverName = ""
 	}
 }
 
-func EdgeHealthCheck(writer http.ResponseWriter, request *http.Request) {
-	if request.Method == http.MethodGet {
-		if streamConn == nil {
-			writer.WriteHeader(http.StatusInternalServerError)
-			klog.Error("Edge node connection is not established")
-			return
+func waitForReady(conn *grpc.ClientConn, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for {
+		state := conn.GetState()
+		if state == connectivity.Ready {
+			return true
 		}
-		if streamConn.GetState() == connectivity.Ready {
-			writer.WriteHeader(http.StatusOK)
-			klog.Infof("the connection of the node is being established status = %s", streamConn.GetState())
-			return
-		} else {
-			writer.WriteHeader(http.StatusInternalServerError)
-			klog.Errorf("the connection of the node is abnormal status = %s", streamConn.GetState())
-			return
+		if !conn.WaitForStateChange(ctx, state) {
+			return false
 		}
-	} else {
+	}
+}
+
+// ReconnectHandler closes the stream when the tunnel-cloud replica is draining, the stream is then
+// established again over a new connection
+func ReconnectHandler(msg *proto.StreamMsg) error {
+	klog.InfoS("tunnel-cloud asks to reconnect", "nodeName", msg.GetNode())
+	atomic.StoreInt32(&reconnect, 1)
+	node := tunnelcontext.GetContext().GetNode(os.Getenv(util.NODE_NAME_ENV))
+	if node == nil {
+		return fmt.Errorf("failed to get edge node %s", os.Getenv(util.NODE_NAME_ENV))
+	}
+	node.Send2Node(&proto.StreamMsg{
+		Node:     os.Getenv(util.NODE_NAME_ENV),
+		Category: util.STREAM,
+		Type:     util.CLOSED,
+	})
+	return nil
+}
+
+// EdgeHealthCheck reports the state of the connection to tunnel-cloud, it responds 200 when the connection is ready
+func EdgeHealthCheck(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
 		writer.WriteHeader(http.StatusMethodNotAllowed)
 		klog.Error("only supports GET method")
 		return
 	}
+	status := ClientState.Get()
+	conn, _ := streamConn.Load().(*grpc.ClientConn)
+	if conn != nil {
+		status.GrpcState = conn.GetState().String()
+	}
+	data, err := json.Marshal(status)
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	if conn != nil && conn.GetState() == connectivity.Ready {
+		writer.WriteHeader(http.StatusOK)
+		klog.V(4).Infof("the connection of the node is being established status = %s", conn.GetState())
+	} else {
+		writer.WriteHeader(http.StatusInternalServerError)
+		klog.Errorf("the connection of the node is abnormal status = %s", status.State)
+	}
+	writer.Write(data)
 }
@@ -101,9 +101,14 @@ func StartLogServer(mode string) {
 				fmt.Fprintln(writer, "only supports GET method")
 			}
 		})
+		mux.HandleFunc("/cloud/readyz", ReadyHandler)
 		ser.Addr = "0.0.0.0:" + strconv.Itoa(conf.TunnelConf.TunnlMode.Cloud.Stream.Server.LogPort)
 	} else {
 		mux.HandleFunc("/edge/healthz", EdgeHealthCheck)
+		reg := prometheus.NewRegistry()
+		metrics.RegisterEdgeMetrics(reg)
+		reg.MustRegister(metrics.NewQueueCollector(tunnelutil.MSG_CHANNEL_CAP, nodeQueueDepths))
+		mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
 		ser.Addr = "0.0.0.0:" + strconv.Itoa(conf.TunnelConf.TunnlMode.EDGE.StreamEdge.Client.LogPort)
 	}
 	klog.Infof("log server listen on %s", ser.Addr)
@@ -135,7 +140,8 @@ func StartChannelzServer(addr string) {
 
 func StartMetricsServer() {
 	reg := prometheus.NewRegistry()
-	reg.MustRegister(metrics.EdgeNodes)
+	metrics.RegisterCloudMetrics(reg)
+	reg.MustRegister(metrics.NewQueueCollector(tunnelutil.MSG_CHANNEL_CAP, nodeQueueDepths))
 	metrics.EdgeNodes.WithLabelValues(os.Getenv(tunnelutil.POD_NAMESPACE_ENV), os.Getenv(tunnelutil.POD_NAME)).Set(0)
 	http.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
 	addr := "0.0.0.0:" + strconv.Itoa(conf.TunnelConf.TunnlMode.Cloud.Stream.Server.MetricsPort)
@@ -145,3 +151,13 @@ func StartMetricsServer() {
 		klog.Errorf("failed to start log http server err = %v", err)
 	}
 }
+
+func nodeQueueDepths() map[string]int {
+	depths := make(map[string]int)
+	for _, name := range tunnelcontext.GetContext().GetNodes() {
+		if node := tunnelcontext.GetContext().GetNode(name); node != nil {
+			depths[name] = len(node.GetChan())
+		}
+	}
+	return depths
+}
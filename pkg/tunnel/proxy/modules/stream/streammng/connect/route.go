@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/superedge/superedge/pkg/tunnel/proxy/common/indexers"
@@ -41,13 +42,48 @@ var Route = &RouteCache{
 	UserServicesMap: map[string]string{},
 }
 
+// RouteCache is written by SyncRoute while the proxies and the DNS server read it, the maps are guarded by
+// the lock and read through the methods of RouteCache
 type RouteCache struct {
+	lock            sync.RWMutex
 	EdgeNode        map[string]string
 	CloudNode       map[string]string
 	ServicesMap     map[string]string
 	UserServicesMap map[string]string
 }
 
+// EdgeNodeAddr returns the IP of the tunnel-cloud pod the edge node is connected to
+func (r *RouteCache) EdgeNodeAddr(node string) (string, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	addr, ok := r.EdgeNode[node]
+	return addr, ok
+}
+
+// CloudNodeAddr returns the internal IP of the cloud node
+func (r *RouteCache) CloudNodeAddr(node string) (string, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	addr, ok := r.CloudNode[node]
+	return addr, ok
+}
+
+// Service returns where the endpoints of the service <name>.<namespace> are, cloud or edge
+func (r *RouteCache) Service(service string) (string, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	v, ok := r.ServicesMap[service]
+	return v, ok
+}
+
+// UserService returns where the user declares the endpoints of the service <name>.<namespace> are, cloud or edge
+func (r *RouteCache) UserService(service string) (string, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	v, ok := r.UserServicesMap[service]
+	return v, ok
+}
+
 func SyncRoute(userClient kubernetes.Interface) {
 	id := os.Getenv(tunnelutil.POD_NAME)
 	lock, err := resourcelock.New(resourcelock.EndpointsResourceLock,
@@ -117,25 +153,7 @@ func syncCache() error {
 	}
 	defer edgeNodeFile.Close()
 
-	updateFlag := false
-	// check edge node
 	edgeNodes := hosts2Array(edgeNodeFile)
-	if len(edgeNodes) != len(Route.EdgeNode) {
-		updateFlag = true
-	} else {
-		for _, v := range edgeNodes {
-			if value, ok := Route.EdgeNode[string(v[1])]; ok {
-				if value != string(v[0]) {
-					updateFlag = true
-				}
-			} else {
-				updateFlag = true
-			}
-		}
-	}
-
-	// check cloud node
-
 	r, err := labels.NewRequirement(util.CloudNodeLabelKey, selection.Equals, []string{"enable"})
 	if err != nil {
 		return err
@@ -157,7 +175,29 @@ func syncCache() error {
 	if len(masters) != 0 {
 		cloudNodes = append(cloudNodes, masters...)
 	}
+	svcs, err := indexers.ServiceLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	Route.lock.Lock()
+	updateFlag := false
+	// check edge node
+	if len(edgeNodes) != len(Route.EdgeNode) {
+		updateFlag = true
+	} else {
+		for _, v := range edgeNodes {
+			if value, ok := Route.EdgeNode[string(v[1])]; ok {
+				if value != string(v[0]) {
+					updateFlag = true
+				}
+			} else {
+				updateFlag = true
+			}
+		}
+	}
 
+	// check cloud node
 	nodesMap := make(map[string]int)
 	for i, n := range cloudNodes {
 		nodesMap[n.Name] = i
@@ -190,10 +230,6 @@ func syncCache() error {
 	}
 
 	// check service
-	svcs, err := indexers.ServiceLister.List(labels.Everything())
-	if err != nil {
-		return err
-	}
 	svcMaps := make(map[string]int)
 	for i, svc := range svcs {
 		svcMaps[fmt.Sprintf("%s.%s", svc.Name, svc.Namespace)] = i
@@ -288,14 +324,10 @@ func syncCache() error {
 		}
 	}
 
+	edgeNodeBuffer := &bytes.Buffer{}
+	cloudNodeBuffer := &bytes.Buffer{}
+	serviceBuffer := &bytes.Buffer{}
 	if updateFlag {
-		cfg, err := register.ClientSet.CoreV1().ConfigMaps(os.Getenv(tunnelutil.POD_NAMESPACE_ENV)).Get(context.Background(), tunnelutil.CacheConfig, metav1.GetOptions{})
-		if err != nil {
-			return err
-		}
-		edgeNodeBuffer := &bytes.Buffer{}
-		cloudNodeBuffer := &bytes.Buffer{}
-		serviceBuffer := &bytes.Buffer{}
 		for k, v := range Route.EdgeNode {
 			edgeNodeBuffer.WriteString(v)
 			edgeNodeBuffer.WriteString("    ")
@@ -314,6 +346,14 @@ func syncCache() error {
 			serviceBuffer.WriteString(v)
 			serviceBuffer.WriteString("\n")
 		}
+	}
+	Route.lock.Unlock()
+
+	if updateFlag {
+		cfg, err := register.ClientSet.CoreV1().ConfigMaps(os.Getenv(tunnelutil.POD_NAMESPACE_ENV)).Get(context.Background(), tunnelutil.CacheConfig, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
 		cfg.Data[tunnelutil.EdgeNodesFile] = edgeNodeBuffer.String()
 		cfg.Data[tunnelutil.CloudNodesFile] = cloudNodeBuffer.String()
 		cfg.Data[tunnelutil.ServicesFile] = serviceBuffer.String()
@@ -352,19 +392,25 @@ func loadCacheFromLocalFile() error {
 	}
 	defer userServiceFile.Close()
 
-	for _, v := range hosts2Array(hosts) {
+	edgeNodes := hosts2Array(hosts)
+	cloudNodes := hosts2Array(cloudNodeFile)
+	services := service2Array(servicesFile)
+	userServices := service2Array(userServiceFile)
+	Route.lock.Lock()
+	defer Route.lock.Unlock()
+	for _, v := range edgeNodes {
 		Route.EdgeNode[string(v[1])] = string(v[0])
 	}
 
-	for _, v := range hosts2Array(cloudNodeFile) {
+	for _, v := range cloudNodes {
 		Route.CloudNode[string(v[1])] = string(v[0])
 	}
 
-	for _, v := range service2Array(servicesFile) {
+	for _, v := range services {
 		Route.ServicesMap[string(v[0])] = string(v[1])
 	}
 
-	for _, v := range service2Array(userServiceFile) {
+	for _, v := range userServices {
 		Route.UserServicesMap[string(v[0])] = string(v[1])
 	}
 	return nil
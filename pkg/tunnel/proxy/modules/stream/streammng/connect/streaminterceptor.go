@@ -19,28 +19,38 @@ package connect
 import (
 	"context"
 	"fmt"
+	"github.com/superedge/superedge/pkg/tunnel/compression"
+	"github.com/superedge/superedge/pkg/tunnel/conf"
+	"github.com/superedge/superedge/pkg/tunnel/metrics"
 	"github.com/superedge/superedge/pkg/tunnel/proto"
 	"github.com/superedge/superedge/pkg/tunnel/token"
 	ctx "github.com/superedge/superedge/pkg/tunnel/tunnelcontext"
 	"github.com/superedge/superedge/pkg/tunnel/util"
+	"github.com/superedge/superedge/pkg/version"
 	"golang.org/x/oauth2"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/oauth"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 	"k8s.io/klog/v2"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 var (
 	ErrMissingMetadata = status.Errorf(codes.InvalidArgument, "missing metadata")
 	ErrInvalidToken    = status.Errorf(codes.Unauthenticated, "invalid token")
+	ErrDraining        = status.Errorf(codes.Unavailable, "tunnel-cloud is draining")
 )
 var clientToken string
 
+// VersionMetadataKey carries the version of tunnel-edge in the request metadata of the stream
+const VersionMetadataKey = "x-tunnel-version"
+
 func ClientStreamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
 	var credsConfigured bool
 	for _, o := range opts {
@@ -54,20 +64,58 @@ func ClientStreamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grp
 			AccessToken: clientToken,
 		})))
 	}
+	var compressionConf *conf.Compression
+	if conf.TunnelConf != nil && conf.TunnelConf.TunnlMode != nil && conf.TunnelConf.TunnlMode.EDGE != nil &&
+		conf.TunnelConf.TunnlMode.EDGE.StreamEdge.Client != nil {
+		compressionConf = conf.TunnelConf.TunnlMode.EDGE.StreamEdge.Client.Compression
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, VersionMetadataKey, version.Get().GitVersion)
+	if offered := compression.Offered(compressionConf); len(offered) != 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, compression.MetadataKey, strings.Join(offered, ","))
+	}
 	s, err := streamer(ctx, desc, cc, method, opts...)
 	if err != nil {
 		return nil, err
 	}
-	return newClientWrappedStream(s), nil
+	return newClientWrappedStream(s, compression.Threshold(compressionConf)), nil
 }
 
-func newClientWrappedStream(s grpc.ClientStream) grpc.ClientStream {
-	return &wrappedClientStream{s, false}
+func newClientWrappedStream(s grpc.ClientStream, threshold int) grpc.ClientStream {
+	w := &wrappedClientStream{ClientStream: s}
+	// tunnel-cloud selects the codec in the response header, old tunnel-cloud selects nothing and the
+	// messages sent to it are never compressed
+	go func() {
+		md, err := s.Header()
+		if err != nil {
+			return
+		}
+		codecs := md.Get(compression.MetadataKey)
+		if len(codecs) == 0 {
+			return
+		}
+		codec := compression.GetCodec(codecs[0])
+		if codec == nil {
+			klog.Errorf("tunnel-cloud selected unsupported compression codec %s", codecs[0])
+			return
+		}
+		klog.Infof("compression codec %s is negotiated with tunnel-cloud", codec.Name())
+		w.compressor.Store(compression.NewCompressor(codec, threshold))
+	}()
+	return w
 }
 
 type wrappedClientStream struct {
 	grpc.ClientStream
 	restart bool
+	// unix nano of the last heartbeat sent, used to measure the heartbeat rtt
+	heartbeatSent int64
+	// *compression.Compressor, set once the codec is negotiated
+	compressor atomic.Value
+}
+
+func (w *wrappedClientStream) getCompressor() *compression.Compressor {
+	c, _ := w.compressor.Load().(*compression.Compressor)
+	return c
 }
 
 func (w *wrappedClientStream) SendMsg(m interface{}) error {
@@ -108,6 +156,7 @@ func (w *wrappedClientStream) SendMsg(m interface{}) error {
 						Type:     util.STREAM_HEART_BEAT,
 						Topic:    os.Getenv(util.NODE_NAME_ENV) + util.STREAM_HEART_BEAT,
 					})
+					atomic.StoreInt64(&hw.heartbeatSent, time.Now().UnixNano())
 					klog.V(8).Info("streamClient send heartbeat message")
 					w.restart = true
 					count = 0
@@ -125,7 +174,7 @@ func (w *wrappedClientStream) SendMsg(m interface{}) error {
 			return fmt.Errorf("streamClient stops sending messages to server node: %s", os.Getenv(util.NODE_NAME_ENV))
 		}
 		klog.V(8).Infof("streamClinet starts to send messages to the server node: %s uuid: %s", msg.Node, msg.Topic)
-		err := w.ClientStream.SendMsg(msg)
+		err := w.ClientStream.SendMsg(w.getCompressor().Compress(msg))
 		if err != nil {
 			klog.Errorf("streamClient failed to send message err = %v", err)
 			return err
@@ -156,14 +205,22 @@ func (w *wrappedClientStream) RecvMsg(m interface{}) error {
 		klog.V(8).Infof("streamClient recv msg node: %s uuid: %s", msg.Node, msg.Topic)
 		if msg.Category == util.STREAM && msg.Type == util.STREAM_HEART_BEAT {
 			klog.V(8).Info("streamClient received heartbeat message")
+			if sent := atomic.SwapInt64(&w.heartbeatSent, 0); sent != 0 {
+				metrics.HeartbeatRTT.Observe(time.Since(time.Unix(0, sent)).Seconds())
+			}
 			w.restart = false
 			continue
 		}
+		decompress(msg, w.getCompressor())
 		ctx.GetContext().Handler(msg, msg.Type, msg.Category)
 	}
 }
 
 func ServerStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if IsDraining() {
+		klog.Info("tunnel-cloud is draining, reject the new stream")
+		return ErrDraining
+	}
 	klog.Info("start verifying the token !")
 	md, ok := metadata.FromIncomingContext(ss.Context())
 	if !ok {
@@ -185,7 +242,25 @@ func ServerStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.S
 		return ErrInvalidToken
 	}
 	klog.Infof("token verification successful node = %s", auth.NodeName)
-	err = handler(srv, newServerWrappedStream(ss, auth.NodeName))
+	var compressor *compression.Compressor
+	compressionConf := conf.TunnelConf.TunnlMode.Cloud.Stream.Server.Compression
+	if codec := compression.Negotiate(compressionConf, md[compression.MetadataKey]); codec != "" {
+		err = ss.SendHeader(metadata.Pairs(compression.MetadataKey, codec))
+		if err != nil {
+			klog.Errorf("failed to send the compression codec to node = %s err = %v", auth.NodeName, err)
+			return err
+		}
+		klog.Infof("compression codec %s is negotiated with node = %s", codec, auth.NodeName)
+		compressor = compression.NewCompressor(compression.GetCodec(codec), compression.Threshold(compressionConf))
+	}
+	wrapped := newServerWrappedStream(ss, auth.NodeName, compressor)
+	if p, ok := peer.FromContext(ss.Context()); ok {
+		wrapped.remoteAddr = p.Addr.String()
+	}
+	if v := md.Get(VersionMetadataKey); len(v) != 0 {
+		wrapped.version = v[0]
+	}
+	err = handler(srv, wrapped)
 	if err != nil {
 		ctx.GetContext().RemoveNode(auth.NodeName)
 		klog.Errorf("node disconnected node = %s err = %v", auth.NodeName, err)
@@ -193,13 +268,16 @@ func ServerStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.S
 	return err
 }
 
-func newServerWrappedStream(s grpc.ServerStream, node string) grpc.ServerStream {
-	return &wrappedServerStream{s, node}
+func newServerWrappedStream(s grpc.ServerStream, node string, compressor *compression.Compressor) *wrappedServerStream {
+	return &wrappedServerStream{ServerStream: s, node: node, compressor: compressor}
 }
 
 type wrappedServerStream struct {
 	grpc.ServerStream
-	node string
+	node       string
+	compressor *compression.Compressor
+	remoteAddr string
+	version    string
 }
 
 func (w *wrappedServerStream) SendMsg(m interface{}) error {
@@ -207,6 +285,7 @@ func (w *wrappedServerStream) SendMsg(m interface{}) error {
 		return w.ServerStream.SendMsg(m)
 	}
 	node := ctx.GetContext().AddNode(w.node)
+	node.SetPeer(w.remoteAddr, w.version)
 	klog.Infof("node added successfully node = %s", node.GetName())
 	defer klog.Infof("streamServer no longer sends messages to edge node: %s", w.node)
 	for {
@@ -216,7 +295,7 @@ func (w *wrappedServerStream) SendMsg(m interface{}) error {
 			return fmt.Errorf("streamServer stops sending messages to node: %s", w.node)
 		}
 		klog.V(8).Infof("streamServer starts to send messages to the client node: %s uuid: %s", msg.Node, msg.Topic)
-		err := w.ServerStream.SendMsg(msg)
+		err := w.ServerStream.SendMsg(w.compressor.Compress(msg))
 		if err != nil {
 			klog.Errorf("streamServer failed to send a message to the edge node: %s", w.node)
 			return err
@@ -247,10 +326,25 @@ func (w *wrappedServerStream) RecvMsg(m interface{}) error {
 			return err
 		}
 		klog.V(8).Infof("streamServer received the message successfully node: %s uuid: %s", msg.Node, msg.Topic)
+		decompress(msg, w.compressor)
 		ctx.GetContext().Handler(msg, msg.Type, msg.Category)
 	}
 }
 
+// decompress restores the payload of msg, the connection is closed when the payload is corrupted
+func decompress(msg *proto.StreamMsg, compressor *compression.Compressor) {
+	if msg.Type == util.CLOSED {
+		compressor.Forget(msg.Topic)
+	}
+	err := compression.Decompress(msg)
+	if err != nil {
+		klog.ErrorS(err, "failed to decompress msg", "nodeName", msg.Node, "category", msg.Category, util.STREAM_TRACE_ID, msg.Topic)
+		msg.Type = util.CLOSED
+		msg.Data = []byte(err.Error())
+		msg.Compression = ""
+	}
+}
+
 func InitToken(nodeName, tk string) error {
 	var err error
 	clientToken, err = token.GetTonken(nodeName, tk)
@@ -16,11 +16,36 @@ limitations under the License.
 
 package tunnelcontext
 
-import "github.com/superedge/superedge/pkg/tunnel/proto"
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/superedge/superedge/pkg/tunnel/proto"
+)
 
 type conn struct {
 	uid string
 	ch  chan *proto.StreamMsg
+	// bytes written out of the tunnel and read into the tunnel, updated atomically
+	bytesIn  int64
+	bytesOut int64
+	created  time.Time
+	infoLock sync.RWMutex
+	node     string
+	category string
+	target   string
+}
+
+// ConnInfo describes a proxied connection
+type ConnInfo struct {
+	TraceID  string    `json:"traceID"`
+	Node     string    `json:"node"`
+	Category string    `json:"category"`
+	Target   string    `json:"target,omitempty"`
+	Created  time.Time `json:"created"`
+	BytesIn  int64     `json:"bytesIn"`
+	BytesOut int64     `json:"bytesOut"`
 }
 
 func (c *conn) Send2Conn(msg *proto.StreamMsg) {
@@ -33,3 +58,38 @@ func (c *conn) ConnRecv() <-chan *proto.StreamMsg {
 func (c *conn) GetUid() string {
 	return c.uid
 }
+
+func (c *conn) SetTarget(target string) {
+	c.infoLock.Lock()
+	defer c.infoLock.Unlock()
+	c.target = target
+}
+
+func (c *conn) SetNode(node, category string) {
+	c.infoLock.Lock()
+	defer c.infoLock.Unlock()
+	c.node = node
+	c.category = category
+}
+
+func (c *conn) CountIn(n int) {
+	atomic.AddInt64(&c.bytesIn, int64(n))
+}
+
+func (c *conn) CountOut(n int) {
+	atomic.AddInt64(&c.bytesOut, int64(n))
+}
+
+func (c *conn) Info() ConnInfo {
+	c.infoLock.RLock()
+	defer c.infoLock.RUnlock()
+	return ConnInfo{
+		TraceID:  c.uid,
+		Node:     c.node,
+		Category: c.category,
+		Target:   c.target,
+		Created:  c.created,
+		BytesIn:  atomic.LoadInt64(&c.bytesIn),
+		BytesOut: atomic.LoadInt64(&c.bytesOut),
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/superedge/superedge/pkg/tunnel/proto"
 	"github.com/superedge/superedge/pkg/tunnel/util"
 	"sync"
+	"time"
 )
 
 type connContext struct {
@@ -29,7 +30,7 @@ type connContext struct {
 
 func (entity *connContext) AddConn(uid string) *conn {
 	entity.connLock.Lock()
-	c := &conn{uid: uid, ch: make(chan *proto.StreamMsg, util.MSG_CHANNEL_CAP)}
+	c := &conn{uid: uid, ch: make(chan *proto.StreamMsg, util.MSG_CHANNEL_CAP), created: time.Now()}
 	entity.conns[uid] = c
 	entity.connLock.Unlock()
 	return c
@@ -64,7 +65,8 @@ func (entity *connContext) SetConn(uid string, ch chan *proto.StreamMsg) {
 	entity.connLock.Lock()
 	defer entity.connLock.Unlock()
 	entity.conns[uid] = &conn{
-		uid,
-		ch,
+		uid:     uid,
+		ch:      ch,
+		created: time.Now(),
 	}
 }
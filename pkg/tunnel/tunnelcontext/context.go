@@ -32,6 +32,11 @@ type Conn interface {
 	Send2Conn(msg *proto.StreamMsg)
 	ConnRecv() <-chan *proto.StreamMsg
 	GetUid() string
+	SetTarget(target string)
+	SetNode(node, category string)
+	CountIn(n int)
+	CountOut(n int)
+	Info() ConnInfo
 }
 
 type ConnMng interface {
@@ -54,6 +59,8 @@ type Node interface {
 	AddPairNode(uid, nodeName string)
 	RemovePairNode(uid string)
 	GetPairNode(uid string) string
+	SetPeer(remoteAddr, version string)
+	Info() NodeInfo
 }
 
 type NodeMng interface {
@@ -49,3 +49,18 @@ func Test_Klog(t *testing.T) {
 	fs.Parse(os.Args[0:])
 	GetContext().AddModule(util.STREAM)
 }
+
+func Test_ConnectFailedReason(t *testing.T) {
+	cases := map[string]string{
+		"dial tcp 10.0.0.1:80: connect: connection refused":  "refused",
+		"dial tcp: lookup foo on 10.0.0.10:53: no such host": "dns",
+		"dial tcp 10.0.0.1:80: i/o timeout":                  "dial_timeout",
+		"the edge node node1 disconnected":                   "node_disconnected",
+		"unexpected":                                         "other",
+	}
+	for msg, want := range cases {
+		if got := connectFailedReason(msg); got != want {
+			t.Errorf("connectFailedReason(%q) = %s, want %s", msg, got, want)
+		}
+	}
+}
@@ -19,9 +19,12 @@ package tunnelcontext
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/superedge/superedge/pkg/tunnel/bandwidth"
+	"github.com/superedge/superedge/pkg/tunnel/metrics"
 	"github.com/superedge/superedge/pkg/tunnel/proto"
 	"github.com/superedge/superedge/pkg/tunnel/util"
 	"k8s.io/klog/v2"
@@ -40,6 +43,20 @@ type node struct {
 	connsLock sync.RWMutex
 	pairnodes map[string]string
 	nodesLock sync.RWMutex
+	connected time.Time
+	peerLock  sync.RWMutex
+	// address and version of the peer at the other end of the stream
+	remoteAddr string
+	version    string
+}
+
+// NodeInfo describes a node connected through the tunnel
+type NodeInfo struct {
+	Name        string    `json:"name"`
+	Connected   time.Time `json:"connected"`
+	RemoteAddr  string    `json:"remoteAddr,omitempty"`
+	Version     string    `json:"version,omitempty"`
+	Connections int       `json:"connections"`
 }
 
 func (edge *node) BindNode(uuid string) {
@@ -73,6 +90,7 @@ func (edge *node) ConnectNode(category, addr string, ctx context.Context) (*conn
 	defer cancle()
 	var err error
 	conn := tunnelContext.AddConn(uid)
+	conn.SetTarget(addr)
 	edge.BindNode(uid)
 	defer func() {
 		if err != nil {
@@ -80,6 +98,7 @@ func (edge *node) ConnectNode(category, addr string, ctx context.Context) (*conn
 			tunnelContext.RemoveConn(uid)
 		}
 	}()
+	start := time.Now()
 	edge.Send2Node(&proto.StreamMsg{
 		Node:     edge.name,
 		Category: category,
@@ -91,13 +110,16 @@ func (edge *node) ConnectNode(category, addr string, ctx context.Context) (*conn
 	select {
 	case resp := <-conn.ch:
 		if resp.Type == CONNECT_SUCCESSED {
+			metrics.ConnectLatency.WithLabelValues(category).Observe(time.Since(start).Seconds())
 			return conn, err
 		}
 		if resp.Type == CONNECT_FAILED {
+			metrics.ConnectFailures.WithLabelValues(category, connectFailedReason(string(resp.Data))).Inc()
 			err = fmt.Errorf("failed to connect target server %s, error:%s, %s:%s", addr, string(resp.Data), util.STREAM_TRACE_ID, uid)
 			return conn, err
 		}
 	case <-subCtx.Done():
+		metrics.ConnectFailures.WithLabelValues(category, "timeout").Inc()
 		err = fmt.Errorf("the connection to the target server %s of the edge node %s timed out, %s:%s", addr, edge.name, util.STREAM_TRACE_ID, uid)
 		return conn, err
 	}
@@ -107,6 +129,20 @@ func (edge *node) ConnectNode(category, addr string, ctx context.Context) (*conn
 func (edge *node) Send2Node(msg *proto.StreamMsg) {
 	klog.V(3).InfoS("node send msg", "nodeName", edge.name, "category", msg.GetCategory(),
 		"type", msg.GetType(), util.STREAM_TRACE_ID, msg.GetTopic())
+	if msg.Type == util.TCP_FORWARD {
+		err := bandwidth.Wait(context.Background(), edge.name, msg.Category, len(msg.Data))
+		if err != nil {
+			// the peer closes the connection when it receives the closed message
+			klog.ErrorS(err, "failed to send msg to node", "nodeName", edge.name, "category", msg.GetCategory(), util.STREAM_TRACE_ID, msg.GetTopic())
+			msg = &proto.StreamMsg{
+				Node:     msg.Node,
+				Category: msg.Category,
+				Type:     util.CLOSED,
+				Topic:    msg.Topic,
+				Data:     []byte(err.Error()),
+			}
+		}
+	}
 	edge.ch <- msg
 }
 
@@ -146,3 +182,39 @@ func (edge *node) GetPairNode(uid string) string {
 	defer edge.nodesLock.RUnlock()
 	return edge.pairnodes[uid]
 }
+
+func (edge *node) SetPeer(remoteAddr, version string) {
+	edge.peerLock.Lock()
+	defer edge.peerLock.Unlock()
+	edge.remoteAddr = remoteAddr
+	edge.version = version
+}
+
+func (edge *node) Info() NodeInfo {
+	edge.peerLock.RLock()
+	defer edge.peerLock.RUnlock()
+	return NodeInfo{
+		Name:        edge.name,
+		Connected:   edge.connected,
+		RemoteAddr:  edge.remoteAddr,
+		Version:     edge.version,
+		Connections: len(edge.GetBindConns()),
+	}
+}
+
+// connectFailedReason classifies the error carried by a CONNECT_FAILED message
+func connectFailedReason(errMsg string) string {
+	switch {
+	case strings.Contains(errMsg, "connection refused"):
+		return "refused"
+	case strings.Contains(errMsg, "no such host"):
+		return "dns"
+	case strings.Contains(errMsg, "i/o timeout"):
+		return "dial_timeout"
+	case strings.Contains(errMsg, "no route to host"), strings.Contains(errMsg, "network is unreachable"):
+		return "unreachable"
+	case strings.Contains(errMsg, "disconnected"), strings.Contains(errMsg, "broken"), strings.Contains(errMsg, "not connected"):
+		return "node_disconnected"
+	}
+	return "other"
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/superedge/superedge/pkg/tunnel/util"
 	"os"
 	"sync"
+	"time"
 )
 
 type nodeContext struct {
@@ -38,9 +39,12 @@ func (entity *nodeContext) AddNode(name string) *node {
 		name:      name,
 		pairnodes: make(map[string]string),
 		nodesLock: sync.RWMutex{},
+		connected: time.Now(),
 	}
 	entity.nodes[name] = edge
 	metrics.EdgeNodes.WithLabelValues(os.Getenv(util.POD_NAMESPACE_ENV), os.Getenv(util.POD_NAME)).Inc()
+	metrics.NodeConnected.WithLabelValues(name).Set(1)
+	metrics.NodeConnectedTimestamp.WithLabelValues(name).Set(float64(time.Now().Unix()))
 	return edge
 }
 
@@ -55,6 +59,7 @@ func (entity *nodeContext) RemoveNode(name string) {
 	defer entity.nodeLock.Unlock()
 	delete(entity.nodes, name)
 	metrics.EdgeNodes.WithLabelValues(os.Getenv(util.POD_NAMESPACE_ENV), os.Getenv(util.POD_NAME)).Dec()
+	metrics.DeleteNode(name)
 }
 
 func (entity *nodeContext) GetNodes() []string {
@@ -19,6 +19,8 @@ package util
 const (
 	STREAM_HEART_BEAT = "heartbeat"
 	STREAM_TRACE_ID   = "Traceid"
+	// STREAM_RECONNECT asks the edge node to reconnect to another tunnel-cloud replica
+	STREAM_RECONNECT = "reconnect"
 )
 
 const (
@@ -31,6 +33,10 @@ const (
 	SSH        = "ssh"
 	EGRESS     = "egress"
 	HTTP_PROXY = "httpProxy"
+	// module name of the TunnelPortMapping listeners, their connections use the HTTP_PROXY category
+	PORT_MAPPING = "portMapping"
+	// module name of the host based reverse proxy of tunnel-cloud, its connections use the HTTP_PROXY category
+	GATEWAY = "gateway"
 )
 
 const (
@@ -65,6 +71,11 @@ const (
 	CloudProxy              = "CLOUD_PROXY"
 )
 
+const (
+	// EdgeGatewayLabelKey marks the edge nodes which forward the requests to the nodes without tunnel in their NodeUnits
+	EdgeGatewayLabelKey = "superedge.io/tunnel-gateway"
+)
+
 const (
 	ConnectMsg = "HTTP/1.1 200 Connection established\r\n\r\n"
 )
@@ -242,6 +242,20 @@ func GenerateClientCertAndKey(caCert *x509.Certificate, caKey *rsa.PrivateKey,
 // NewSignedCert creates a signed certificate using the given CA certificate and key
 func NewSignedCert(cfg *cert.Config, key crypto.Signer,
 	caCert *x509.Certificate, caKey crypto.Signer) (*x509.Certificate, error) {
+	return newSignedCert(cfg, key.Public(), caCert, caKey, caCert.NotBefore, time.Now().Add(duration10y).UTC())
+}
+
+// NewSignedCertWithDuration signs the public key of a certificate request with the given CA certificate and key,
+// the certificate is valid for duration
+func NewSignedCertWithDuration(cfg *cert.Config, publicKey crypto.PublicKey,
+	caCert *x509.Certificate, caKey crypto.Signer, duration time.Duration) (*x509.Certificate, error) {
+	now := time.Now()
+	// tolerate the clock skew between the nodes
+	return newSignedCert(cfg, publicKey, caCert, caKey, now.Add(-5*time.Minute).UTC(), now.Add(duration).UTC())
+}
+
+func newSignedCert(cfg *cert.Config, publicKey crypto.PublicKey,
+	caCert *x509.Certificate, caKey crypto.Signer, notBefore, notAfter time.Time) (*x509.Certificate, error) {
 	serial, err := cryptorand.Int(cryptorand.Reader, new(big.Int).SetInt64(math.MaxInt64))
 	if err != nil {
 		return nil, err
@@ -261,12 +275,12 @@ func NewSignedCert(cfg *cert.Config, key crypto.Signer,
 		DNSNames:     cfg.AltNames.DNSNames,
 		IPAddresses:  cfg.AltNames.IPs,
 		SerialNumber: serial,
-		NotBefore:    caCert.NotBefore,
-		NotAfter:     time.Now().Add(duration10y).UTC(),
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
 		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
 		ExtKeyUsage:  cfg.Usages,
 	}
-	certDERBytes, err := x509.CreateCertificate(cryptorand.Reader, &certTmpl, caCert, key.Public(), caKey)
+	certDERBytes, err := x509.CreateCertificate(cryptorand.Reader, &certTmpl, caCert, publicKey, caKey)
 	if err != nil {
 		return nil, err
 	}